@@ -0,0 +1,103 @@
+package endor
+
+import "time"
+
+// startBackground starts the goroutine that sweeps expired keys, writes
+// index checkpoints and syncs the writes of SyncInterval, unless all of them
+// are disabled.
+func (db *DB) startBackground() {
+	sweep := interval(db.opts.SweepInterval, DefaultSweepInterval)
+	checkpoint := interval(db.opts.CheckpointInterval, DefaultCheckpointInterval)
+	if db.readOnly || db.inMemory {
+		checkpoint = 0
+	}
+	flush := db.opts.SyncPolicy.interval
+	if db.readOnly {
+		flush = 0
+	}
+	if sweep == 0 && checkpoint == 0 && flush == 0 {
+		return
+	}
+	db.stop = make(chan struct{})
+	db.stopped = make(chan struct{})
+	go db.backgroundLoop(sweep, checkpoint, flush)
+}
+
+// interval resolves a configured interval, where zero selects def and a
+// negative value disables the task, reported as zero.
+func interval(configured time.Duration, def time.Duration) time.Duration {
+	if configured == 0 {
+		return def
+	}
+	if configured < 0 {
+		return 0
+	}
+	return configured
+}
+
+func (db *DB) backgroundLoop(sweep time.Duration, checkpoint time.Duration, flush time.Duration) {
+	defer close(db.stopped)
+	sweeps := ticker(sweep)
+	defer stopTicker(sweeps)
+	checkpoints := ticker(checkpoint)
+	defer stopTicker(checkpoints)
+	flushes := ticker(flush)
+	defer stopTicker(flushes)
+	for {
+		select {
+		case <-db.stop:
+			return
+		case <-tick(sweeps):
+			db.sweep()
+			// Keys whose callbacks failed to be marked done are
+			// reported again on the next tick.
+			db.notifyExpired()
+		case <-tick(checkpoints):
+			db.mu.Lock()
+			if !db.closed {
+				// A failed checkpoint only means the next open replays
+				// more of the data file; the next tick tries again.
+				db.saveCheckpoint()
+			}
+			db.mu.Unlock()
+		case <-tick(flushes):
+			db.mu.Lock()
+			if !db.closed {
+				// A failed sync leaves unsynced set, so the next tick
+				// tries again.
+				db.syncPending()
+			}
+			db.mu.Unlock()
+		}
+	}
+}
+
+func ticker(d time.Duration) *time.Ticker {
+	if d == 0 {
+		return nil
+	}
+	return time.NewTicker(d)
+}
+
+// tick returns the channel of t, or nil for a disabled task, which blocks
+// its select case forever.
+func tick(t *time.Ticker) <-chan time.Time {
+	if t == nil {
+		return nil
+	}
+	return t.C
+}
+
+func stopTicker(t *time.Ticker) {
+	if t != nil {
+		t.Stop()
+	}
+}
+
+func (db *DB) stopBackground() {
+	if db.stop == nil {
+		return
+	}
+	close(db.stop)
+	<-db.stopped
+}
@@ -0,0 +1,38 @@
+package endor
+
+import "time"
+
+// WriteBatch collects Set and Delete operations to commit together with
+// DB.Write. The zero value is an empty batch ready to use.
+type WriteBatch struct {
+	records []record
+}
+
+// Set queues storing value under key.
+func (b *WriteBatch) Set(key string, value []byte) {
+	b.records = append(b.records, record{Op: opSet, Key: key, Value: value})
+}
+
+// SetWithTTL queues storing value under key until ttl has passed.
+func (b *WriteBatch) SetWithTTL(key string, value []byte, ttl time.Duration) {
+	r := record{Op: opSet, Key: key, Value: value}
+	if ttl > 0 {
+		r.Expires = time.Now().Add(ttl).UnixNano()
+	}
+	b.records = append(b.records, r)
+}
+
+// Delete queues removing key.
+func (b *WriteBatch) Delete(key string) {
+	b.records = append(b.records, record{Op: opDelete, Key: key})
+}
+
+// Len returns the number of queued operations.
+func (b *WriteBatch) Len() int {
+	return len(b.records)
+}
+
+// Reset empties the batch so it can be reused.
+func (b *WriteBatch) Reset() {
+	b.records = b.records[:0]
+}
@@ -0,0 +1,93 @@
+package endor
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestWriteBatch(t *testing.T) {
+	db, path := openTest(t, Options{})
+	if err := db.Set("a", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	before, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b WriteBatch
+	b.Set("b", []byte("1"))
+	b.Set("c", []byte("2"))
+	b.Delete("a")
+	if err := db.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	after, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := after.Flushes - before.Flushes; n != 1 {
+		t.Fatalf("a batch of %d took %d syncs, want 1", b.Len(), n)
+	}
+	if _, err := db.Get("a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get(a) after the batch deleted it = %v", err)
+	}
+	for key, want := range map[string]string{"b": "1", "c": "2"} {
+		if got, err := db.Get(key); err != nil || string(got) != want {
+			t.Fatalf("Get(%s) = %q, %v, want %q", key, got, err, want)
+		}
+	}
+
+	// One bad operation fails the whole batch.
+	b.Reset()
+	if b.Len() != 0 {
+		t.Fatalf("Len after Reset = %d", b.Len())
+	}
+	b.Set("d", []byte("3"))
+	b.Set("", []byte("4"))
+	if err := db.Write(&b); !errors.Is(err, ErrEmptyKey) {
+		t.Fatalf("Write with an empty key = %v, want ErrEmptyKey", err)
+	}
+	if _, err := db.Get("d"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get(d) of a failed batch = %v, want ErrKeyNotFound", err)
+	}
+
+	// A batch cut short by a crash is dropped as a whole on open.
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Reset()
+	b.Set("e", []byte("5"))
+	b.Set("f", []byte("6"))
+	if err := db.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path + ".checkpoint"); err != nil {
+		t.Fatal(err)
+	}
+	full, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, info.Size()+(full.Size()-info.Size())/2); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, key := range []string{"e", "f"} {
+		if _, err := db.Get(key); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("Get(%s) of a torn batch = %v, want ErrKeyNotFound", key, err)
+		}
+	}
+	if got, err := db.Get("b"); err != nil || string(got) != "1" {
+		t.Fatalf("Get(b) after the torn batch = %q, %v", got, err)
+	}
+}
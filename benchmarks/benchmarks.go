@@ -0,0 +1,224 @@
+// Package benchmarks runs reproducible workloads against an endor store, so
+// the effect of Options on a given machine and disk can be measured rather
+// than guessed. Every workload is seeded, so two runs issue the same
+// operations on the same keys in the same order per goroutine:
+//
+//	for _, w := range benchmarks.Workloads {
+//		r, err := benchmarks.Run(dir, endor.Options{SyncPolicy: endor.SyncNever}, w)
+//		...
+//		fmt.Println(r)
+//	}
+//
+// Command endor-bench runs them from the shell. The package's benchmarks
+// run them under go test, the store filled at a tenth of their size, along
+// with sweeps of WriteBufferSize, ReadLength and SyncEvery:
+//
+//	go test -bench . -benchmem ./benchmarks
+package benchmarks
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aaydin-tr/endor"
+)
+
+// Workload describes the operations of a run. The store is first filled
+// with Keys keys, which is not measured, and then Ops operations are spread
+// over Concurrency goroutines, each a Get with probability ReadRatio and a
+// Set of the same key otherwise.
+type Workload struct {
+	Name      string
+	Keys      int
+	ValueSize int
+	Ops       int
+	ReadRatio float64
+	// Sequential walks the keys in order instead of picking them at
+	// random.
+	Sequential bool
+	// Concurrency is the number of goroutines issuing operations. Zero
+	// selects one.
+	Concurrency int
+	// Seed seeds the choice of keys, values and operations.
+	Seed int64
+}
+
+var (
+	SequentialGet = Workload{Name: "seq-get", Keys: 100000, ValueSize: 100, Ops: 200000, ReadRatio: 1, Sequential: true, Seed: 1}
+	RandomGet     = Workload{Name: "random-get", Keys: 100000, ValueSize: 100, Ops: 200000, ReadRatio: 1, Seed: 1}
+	SmallValues   = Workload{Name: "small-set", Keys: 100000, ValueSize: 16, Ops: 100000, Seed: 1}
+	LargeValues   = Workload{Name: "large-set", Keys: 1000, ValueSize: 256 << 10, Ops: 2000, Seed: 1}
+	Mixed         = Workload{Name: "mixed", Keys: 100000, ValueSize: 100, Ops: 200000, ReadRatio: 0.8, Concurrency: 8, Seed: 1}
+
+	// Workloads lists the workloads above.
+	Workloads = []Workload{SequentialGet, RandomGet, SmallValues, LargeValues, Mixed}
+)
+
+// Scale returns w with its keys and operations multiplied by f, for runs
+// that fit a smaller disk or take longer than by default.
+func (w Workload) Scale(f float64) Workload {
+	w.Keys = max(int(float64(w.Keys)*f), 1)
+	w.Ops = max(int(float64(w.Ops)*f), 1)
+	return w
+}
+
+// Result is what a run measured.
+type Result struct {
+	Workload string
+	Ops      int
+	Elapsed  time.Duration
+	// P50, P99 and Max are latencies of single operations.
+	P50, P99, Max time.Duration
+	// FileBytes is the size of the data file at the end of the run.
+	FileBytes int64
+}
+
+// OpsPerSec is the throughput of the run.
+func (r Result) OpsPerSec() float64 {
+	return float64(r.Ops) / r.Elapsed.Seconds()
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%-12s %10.0f ops/s  p50 %-10v p99 %-10v max %-10v %d bytes", r.Workload, r.OpsPerSec(), r.P50, r.P99, r.Max, r.FileBytes)
+}
+
+// Run runs w against a new store in dir opened with opts. A store left in
+// dir by an earlier run of w is removed first, and the store is removed
+// again afterwards.
+func Run(dir string, opts endor.Options, w Workload) (Result, error) {
+	path := filepath.Join(dir, w.Name+".db")
+	if err := removeStore(path); err != nil {
+		return Result{}, err
+	}
+	defer removeStore(path)
+	db, err := endor.OpenWithOptions(path, opts)
+	if err != nil {
+		return Result{}, err
+	}
+	defer db.Close()
+
+	if err := fill(db, w); err != nil {
+		return Result{}, err
+	}
+
+	workers := max(w.Concurrency, 1)
+	latencies := make([][]time.Duration, workers)
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for g := 0; g < workers; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			latencies[g], errs[g] = run(db, w, g, w.Ops/workers+boolInt(g < w.Ops%workers))
+		}(g)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	for _, err := range errs {
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	var all []time.Duration
+	for _, l := range latencies {
+		all = append(all, l...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	stats, err := db.Stats()
+	if err != nil {
+		return Result{}, err
+	}
+	r := Result{Workload: w.Name, Ops: len(all), Elapsed: elapsed, FileBytes: stats.FileBytes}
+	if len(all) > 0 {
+		r.P50, r.P99, r.Max = all[len(all)/2], all[len(all)*99/100], all[len(all)-1]
+	}
+	return r, db.Close()
+}
+
+// run issues the ops operations of goroutine g and returns how long each
+// took.
+func run(db *endor.DB, w Workload, g int, ops int) ([]time.Duration, error) {
+	rnd := rand.New(rand.NewSource(w.Seed + int64(g) + 1))
+	value := make([]byte, w.ValueSize)
+	latencies := make([]time.Duration, 0, ops)
+	for i := 0; i < ops; i++ {
+		k, read := w.next(rnd, g*ops+i)
+		if !read {
+			rnd.Read(value)
+		}
+		start := time.Now()
+		var err error
+		if read {
+			_, err = db.Get(key(k))
+		} else {
+			err = db.Set(key(k), value)
+		}
+		latencies = append(latencies, time.Since(start))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return latencies, nil
+}
+
+// fill sets the w.Keys keys the operations of w pick from.
+func fill(db *endor.DB, w Workload) error {
+	rnd := rand.New(rand.NewSource(w.Seed))
+	value := make([]byte, w.ValueSize)
+	for i := 0; i < w.Keys; i++ {
+		rnd.Read(value)
+		if err := db.Set(key(i), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// next picks the key of the n-th operation of a run and whether it is a
+// Get, drawing from rnd.
+func (w Workload) next(rnd *rand.Rand, n int) (k int, read bool) {
+	k = rnd.Intn(w.Keys)
+	if w.Sequential {
+		k = n % w.Keys
+	}
+	return k, rnd.Float64() < w.ReadRatio
+}
+
+func key(i int) string {
+	return fmt.Sprintf("key%09d", i)
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// removeStore removes the data file at path and the files kept next to it.
+func removeStore(path string) error {
+	matches, err := filepath.Glob(path + "*")
+	if err != nil {
+		return err
+	}
+	for _, name := range matches {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package benchmarks
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aaydin-tr/endor"
+)
+
+// benchScale shrinks the workloads, so filling the store before each
+// benchmark does not take longer than measuring it.
+const benchScale = 0.1
+
+// benchmark runs the operations of w against a new store opened with opts,
+// b.N of them, spread over the goroutines of b.RunParallel when w is
+// concurrent.
+func benchmark(b *testing.B, opts endor.Options, w Workload) {
+	w = w.Scale(benchScale)
+	opts.SweepInterval = -1
+	db, err := endor.OpenWithOptions(filepath.Join(b.TempDir(), w.Name+".db"), opts)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	if err := fill(db, w); err != nil {
+		b.Fatal(err)
+	}
+	keys := make([]string, w.Keys)
+	for i := range keys {
+		keys[i] = key(i)
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(w.ValueSize))
+	b.ResetTimer()
+	if w.Concurrency <= 1 {
+		if err := ops(db, w, keys, rand.New(rand.NewSource(w.Seed+1)), 0, b.N); err != nil {
+			b.Fatal(err)
+		}
+		return
+	}
+	var g atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		g := g.Add(1)
+		rnd := rand.New(rand.NewSource(w.Seed + g))
+		for n := 0; pb.Next(); n++ {
+			if err := ops(db, w, keys, rnd, n, 1); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// ops issues count operations of w, the first of them the n-th of its
+// goroutine.
+func ops(db *endor.DB, w Workload, keys []string, rnd *rand.Rand, n, count int) error {
+	value := make([]byte, w.ValueSize)
+	for i := 0; i < count; i++ {
+		k, read := w.next(rnd, n+i)
+		var err error
+		if read {
+			_, err = db.Get(keys[k])
+		} else {
+			rnd.Read(value)
+			err = db.Set(keys[k], value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func BenchmarkWorkloads(b *testing.B) {
+	for _, w := range Workloads {
+		b.Run(w.Name, func(b *testing.B) {
+			benchmark(b, endor.Options{SyncPolicy: endor.SyncNever}, w)
+		})
+	}
+}
+
+func BenchmarkWriteBufferSize(b *testing.B) {
+	for _, size := range []int{0, 4 << 10, 64 << 10, 1 << 20} {
+		b.Run(fmt.Sprintf("bytes=%d", size), func(b *testing.B) {
+			benchmark(b, endor.Options{SyncPolicy: endor.SyncNever, WriteBufferSize: size}, SmallValues)
+		})
+	}
+}
+
+func BenchmarkReadLength(b *testing.B) {
+	for _, length := range []int{64, 256, 4 << 10} {
+		for _, w := range []Workload{RandomGet, LargeValues} {
+			w.ReadRatio = 1
+			b.Run(fmt.Sprintf("value=%d/bytes=%d", w.ValueSize, length), func(b *testing.B) {
+				benchmark(b, endor.Options{ReadLength: length}, w)
+			})
+		}
+	}
+}
+
+func BenchmarkSyncEvery(b *testing.B) {
+	for _, n := range []int{1, 16, 256} {
+		b.Run(fmt.Sprintf("writes=%d", n), func(b *testing.B) {
+			benchmark(b, endor.Options{SyncPolicy: endor.SyncEvery(n)}, SmallValues)
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package endor
+
+import "sync/atomic"
+
+// A bloom filter of the keys in the index lets Get answer most lookups of
+// missing keys without taking db.mu or looking in the index. It covers the
+// whole store, every segment of it included, and is saved next to the
+// checkpoint, so Open only has to add the keys of the records replayed past
+// it. Keys are only ever added: one that is deleted or expires, or that
+// compaction drops, stays set until the filter is rebuilt, which happens
+// once more keys were added than it was sized for.
+
+const (
+	// bloomBitsPerKey and bloomHashes keep false positives near 1%.
+	bloomBitsPerKey = 10
+	bloomHashes     = 7
+	// bloomMinKeys is the fewest keys a filter is sized for, so a small
+	// store is not rebuilt every few writes.
+	bloomMinKeys = 1024
+)
+
+// bloomFilter is safe for Gets reading it while a writer holding db.mu adds
+// to it. A nil filter holds every key.
+type bloomFilter struct {
+	bits []atomic.Uint64
+	// added counts the keys added and capacity the number it was sized
+	// for. Both are only used by writers, under db.mu.
+	added    int64
+	capacity int64
+}
+
+func newBloomFilter(keys int) *bloomFilter {
+	capacity := int64(2 * keys)
+	if capacity < bloomMinKeys {
+		capacity = bloomMinKeys
+	}
+	return &bloomFilter{bits: make([]atomic.Uint64, (capacity*bloomBitsPerKey+63)/64), capacity: capacity}
+}
+
+// bloomHash returns the two halves of the FNV-1a hash of key, which
+// positions derive the bits to use from. The second is odd, so its
+// multiples reach every bit.
+func bloomHash(key string) (uint64, uint64) {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h, h>>32 | 1
+}
+
+func (f *bloomFilter) add(key string) {
+	a, b := bloomHash(key)
+	m := uint64(len(f.bits)) * 64
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (a + i*b) % m
+		word := &f.bits[bit/64]
+		mask := uint64(1) << (bit % 64)
+		for {
+			old := word.Load()
+			if old&mask != 0 || word.CompareAndSwap(old, old|mask) {
+				break
+			}
+		}
+	}
+	f.added++
+}
+
+// mayContain reports whether key may be in the filter. It is never false
+// for a key that was added.
+func (f *bloomFilter) mayContain(key string) bool {
+	if f == nil {
+		return true
+	}
+	a, b := bloomHash(key)
+	m := uint64(len(f.bits)) * 64
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (a + i*b) % m
+		if f.bits[bit/64].Load()&(uint64(1)<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// addKey adds key, newly in the index, to the filter, rebuilding it from
+// the index once it holds more keys than it was sized for. Callers hold
+// db.mu.
+func (db *DB) addKey(key string) {
+	f := db.filter.Load()
+	if f == nil {
+		return
+	}
+	if f.added >= f.capacity {
+		db.buildFilter()
+		return
+	}
+	f.add(key)
+}
+
+// buildFilter replaces the filter with one of the keys in the index. Callers
+// hold db.mu, or have the store to themselves while opening it.
+func (db *DB) buildFilter() {
+	f := newBloomFilter(len(db.index))
+	for key := range db.index {
+		f.add(key)
+	}
+	db.filter.Store(f)
+}
+
+// savedFilter is the filter as saved to its sidecar, along with the
+// watermark of the checkpoint saved with it.
+type savedFilter struct {
+	Watermark watermark `json:"watermark"`
+	Added     int64     `json:"added"`
+	Capacity  int64     `json:"capacity"`
+	Bits      []uint64  `json:"bits"`
+}
+
+func (db *DB) filterPath() string {
+	return db.path + ".bloom"
+}
+
+// saveFilter writes the filter to its sidecar, as of the watermark w of the
+// checkpoint being saved. Callers hold db.mu.
+func (db *DB) saveFilter(w watermark) error {
+	f := db.filter.Load()
+	if f == nil {
+		return nil
+	}
+	s := savedFilter{Watermark: w, Added: f.added, Capacity: f.capacity, Bits: make([]uint64, len(f.bits))}
+	for i := range f.bits {
+		s.Bits[i] = f.bits[i].Load()
+	}
+	return db.writeState(db.filterPath(), s)
+}
+
+// loadFilter restores the filter saved with the checkpoint taken at w. One
+// saved with another checkpoint, or that can not be read, is left for Open
+// to rebuild from the index.
+func (db *DB) loadFilter(w watermark) error {
+	var s savedFilter
+	ok, err := db.readState(db.filterPath(), &s)
+	if err != nil || !ok || s.Watermark != w || len(s.Bits) == 0 {
+		return err
+	}
+	f := &bloomFilter{bits: make([]atomic.Uint64, len(s.Bits)), added: s.Added, capacity: s.Capacity}
+	for i, word := range s.Bits {
+		f.bits[i].Store(word)
+	}
+	db.filter.Store(f)
+	return nil
+}
@@ -0,0 +1,121 @@
+package endor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestGetMissDoesNotAllocate(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	for i := 0; i < 1000; i++ {
+		if err := db.Set(fmt.Sprintf("key-%d", i), []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	allocs := testing.AllocsPerRun(1000, func() {
+		if _, err := db.Get("missing"); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("Get of a missing key allocates %v times", allocs)
+	}
+}
+
+func TestBloomFilterKeepsEveryKey(t *testing.T) {
+	db, path := openTest(t, Options{})
+	// Enough keys to rebuild the filter a few times, some of them deleted
+	// and set again.
+	const n = 5000
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if err := db.Set(key, []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+		if i%3 == 0 {
+			if err := db.Delete(key); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Set(key, []byte("v")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	check := func(db *DB, when string) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			if _, err := db.Get(fmt.Sprintf("key-%d", i)); err != nil {
+				t.Fatalf("%s: Get key-%d = %v", when, i, err)
+			}
+		}
+		misses := 0
+		for i := 0; i < n; i++ {
+			if db.filter.Load().mayContain(fmt.Sprintf("missing-%d", i)) {
+				misses++
+			}
+		}
+		if misses > n/20 {
+			t.Errorf("%s: filter lets %d of %d missing keys through", when, misses, n)
+		}
+	}
+	check(db, "after writes")
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	check(db, "after compaction")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".bloom"); err != nil {
+		t.Fatalf("filter not saved: %v", err)
+	}
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(db, "after reopen")
+	if err := db.Set("new", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get("new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get("missing"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Get after Close = %v, want ErrClosed", err)
+	}
+
+	// A filter saved with another checkpoint is rebuilt.
+	if err := os.WriteFile(path+".bloom", []byte(`{"bits":[0]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check(db, "after a stale filter")
+}
+
+func BenchmarkGetMiss(b *testing.B) {
+	db, err := OpenInMemory()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 10000; i++ {
+		if err := db.Set(fmt.Sprintf("key-%d", i), []byte("value")); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db.Get("missing")
+	}
+}
@@ -0,0 +1,159 @@
+package endor
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Buckets share the data file and index of their DB. The records of a
+// bucket are stored under the bucket's name and the key, each preceded by a
+// NUL byte, which keeps them apart from the keys of the DB itself and of
+// every other bucket. Keys of the DB starting with a NUL byte are therefore
+// reserved.
+const bucketMark = "\x00"
+
+// isBucketKey reports whether key is stored in a bucket.
+func isBucketKey(key string) bool {
+	return strings.HasPrefix(key, bucketMark)
+}
+
+// Bucket is a named key space within a DB. Its keys are separate from those
+// of the DB and of other buckets: the same key can be set in each, and
+// Scan, Range and Watch of one never see the others. Writing to a bucket
+// creates it; there is nothing to set up.
+type Bucket struct {
+	db     *DB
+	name   string
+	prefix string
+}
+
+// Bucket returns the bucket called name. Operations on a bucket whose name
+// is empty or contains a NUL byte fail with ErrInvalidBucket.
+func (db *DB) Bucket(name string) *Bucket {
+	return &Bucket{db: db, name: name, prefix: bucketMark + name + bucketMark}
+}
+
+// Buckets returns the names of the buckets holding at least one live key,
+// sorted.
+func (db *DB) Buckets() []string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	now := time.Now().UnixNano()
+	seen := make(map[string]struct{})
+	for key, e := range db.index {
+		if !isBucketKey(key) || e.expired(now) {
+			continue
+		}
+		name, _, _ := strings.Cut(key[len(bucketMark):], bucketMark)
+		seen[name] = struct{}{}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Name returns the name of the bucket.
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+func (b *Bucket) valid() error {
+	if b.name == "" || strings.Contains(b.name, bucketMark) {
+		return ErrInvalidBucket
+	}
+	return nil
+}
+
+// key returns the key the DB stores key of the bucket under.
+func (b *Bucket) key(key string) (string, error) {
+	if err := b.valid(); err != nil {
+		return "", err
+	}
+	if key == "" {
+		return "", ErrEmptyKey
+	}
+	return b.prefix + key, nil
+}
+
+// Get returns the value of key in the bucket, or ErrKeyNotFound if it is
+// not set or has expired.
+func (b *Bucket) Get(key string) ([]byte, error) {
+	k, err := b.key(key)
+	if err != nil {
+		return nil, err
+	}
+	return b.db.Get(k)
+}
+
+// Set stores value under key in the bucket.
+func (b *Bucket) Set(key string, value []byte) error {
+	k, err := b.key(key)
+	if err != nil {
+		return err
+	}
+	return b.db.Set(k, value)
+}
+
+// SetWithTTL stores value under key in the bucket until ttl has passed.
+func (b *Bucket) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	k, err := b.key(key)
+	if err != nil {
+		return err
+	}
+	return b.db.SetWithTTL(k, value, ttl)
+}
+
+// Delete removes key from the bucket.
+func (b *Bucket) Delete(key string) error {
+	k, err := b.key(key)
+	if err != nil {
+		return err
+	}
+	return b.db.Delete(k)
+}
+
+// Scan returns an iterator over the keys of the bucket starting with
+// prefix. An invalid bucket has no keys.
+func (b *Bucket) Scan(prefix string) *Iterator {
+	if b.valid() != nil {
+		return &Iterator{db: b.db, pos: -1}
+	}
+	full := b.prefix + prefix
+	return b.db.iterate(len(b.prefix), func(key string) bool { return strings.HasPrefix(key, full) })
+}
+
+// Range returns an iterator over the keys k of the bucket with
+// start <= k < end. An empty end leaves the range unbounded above.
+func (b *Bucket) Range(start string, end string) *Iterator {
+	if b.valid() != nil {
+		return &Iterator{db: b.db, pos: -1}
+	}
+	lo, hi := b.prefix+start, b.prefix+end
+	return b.db.iterate(len(b.prefix), func(key string) bool {
+		return key >= lo && strings.HasPrefix(key, b.prefix) && (end == "" || key < hi)
+	})
+}
+
+// Watch is DB.Watch for the keys of the bucket. Events carry the keys as
+// the bucket knows them.
+func (b *Bucket) Watch(prefix string) (<-chan Event, CancelFunc) {
+	return b.db.watch(b.prefix+prefix, len(b.prefix))
+}
+
+// Drop deletes every key of the bucket in one batch, which removes the
+// bucket.
+func (b *Bucket) Drop() error {
+	if err := b.valid(); err != nil {
+		return err
+	}
+	var batch WriteBatch
+	it := b.db.iterate(0, func(key string) bool { return strings.HasPrefix(key, b.prefix) })
+	for it.Next() {
+		batch.Delete(it.Key())
+	}
+	return b.db.Write(&batch)
+}
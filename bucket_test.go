@@ -0,0 +1,115 @@
+package endor
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBuckets(t *testing.T) {
+	db, path := openTest(t, Options{})
+	users, orders := db.Bucket("users"), db.Bucket("orders")
+	if users.Name() != "users" {
+		t.Fatalf("Name = %q", users.Name())
+	}
+	// The same key can be set in the DB and in every bucket.
+	for _, w := range []struct {
+		set   func(string, []byte) error
+		value string
+	}{{db.Set, "db"}, {users.Set, "users"}, {orders.Set, "orders"}} {
+		for _, key := range []string{"a", "b"} {
+			if err := w.set(key, []byte(w.value+" "+key)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := users.SetWithTTL("tmp", []byte("x"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Bucket("expired").SetWithTTL("tmp", []byte("x"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if got, err := users.Get("a"); err != nil || string(got) != "users a" {
+		t.Fatalf("users Get a = %q, %v", got, err)
+	}
+	if _, err := users.Get("tmp"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get of an expired bucket key = %v, want ErrKeyNotFound", err)
+	}
+	if got := fmt.Sprint(db.Buckets()); got != "[orders users]" {
+		t.Fatalf("Buckets = %s, want [orders users]", got)
+	}
+	if got := fmt.Sprint(collect(t, db.Scan(""))); got != "[a=db a b=db b]" {
+		t.Fatalf("DB Scan = %s", got)
+	}
+	if got := fmt.Sprint(collect(t, db.Range("", ""))); got != "[a=db a b=db b]" {
+		t.Fatalf("DB Range = %s", got)
+	}
+	if got := fmt.Sprint(collect(t, users.Scan(""))); got != "[a=users a b=users b]" {
+		t.Fatalf("users Scan = %s", got)
+	}
+	if got := fmt.Sprint(collect(t, orders.Range("b", ""))); got != "[b=orders b]" {
+		t.Fatalf("orders Range = %s", got)
+	}
+	if got := fmt.Sprint(collect(t, orders.Range("a", "b"))); got != "[a=orders a]" {
+		t.Fatalf("orders Range a b = %s", got)
+	}
+
+	if err := users.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.Get("a"); err != nil || string(got) != "db a" {
+		t.Fatalf("deleting from a bucket removed the DB's key: %q, %v", got, err)
+	}
+
+	// Drop takes the bucket away as one batch, and the rest survives a
+	// reopen.
+	if err := orders.Drop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := fmt.Sprint(db.Buckets()); got != "[users]" {
+		t.Fatalf("Buckets after Drop = %s, want [users]", got)
+	}
+	if got := fmt.Sprint(collect(t, db.Bucket("users").Scan(""))); got != "[b=users b]" {
+		t.Fatalf("users Scan after reopening = %s", got)
+	}
+	if got, err := db.Get("b"); err != nil || string(got) != "db b" {
+		t.Fatalf("Get b after reopening = %q, %v", got, err)
+	}
+}
+
+func TestInvalidBuckets(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	for _, b := range []*Bucket{db.Bucket(""), db.Bucket("a\x00b")} {
+		if err := b.Set("k", []byte("v")); !errors.Is(err, ErrInvalidBucket) {
+			t.Fatalf("Set in bucket %q = %v, want ErrInvalidBucket", b.Name(), err)
+		}
+		if _, err := b.Get("k"); !errors.Is(err, ErrInvalidBucket) {
+			t.Fatalf("Get in bucket %q = %v, want ErrInvalidBucket", b.Name(), err)
+		}
+		if err := b.Delete("k"); !errors.Is(err, ErrInvalidBucket) {
+			t.Fatalf("Delete in bucket %q = %v, want ErrInvalidBucket", b.Name(), err)
+		}
+		if err := b.Drop(); !errors.Is(err, ErrInvalidBucket) {
+			t.Fatalf("Drop of bucket %q = %v, want ErrInvalidBucket", b.Name(), err)
+		}
+		if it := b.Scan(""); it.Next() {
+			t.Fatalf("Scan of bucket %q found %q", b.Name(), it.Key())
+		}
+		if it := b.Range("", ""); it.Next() {
+			t.Fatalf("Range of bucket %q found %q", b.Name(), it.Key())
+		}
+	}
+	if err := db.Bucket("b").Set("", []byte("v")); !errors.Is(err, ErrEmptyKey) {
+		t.Fatalf("Set of an empty key in a bucket = %v, want ErrEmptyKey", err)
+	}
+}
@@ -0,0 +1,92 @@
+package endor
+
+import (
+	"container/list"
+	"sync"
+)
+
+// valueCache keeps the values of the most recently read keys, so Get can
+// skip reading and decoding their records. A nil cache holds nothing.
+type valueCache struct {
+	// mu is separate from db.mu, since Gets holding db.mu for reading
+	// still update the recency order.
+	mu    sync.Mutex
+	max   int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type cached struct {
+	key   string
+	value []byte
+	codec string
+}
+
+func newValueCache(size int) *valueCache {
+	if size <= 0 {
+		return nil
+	}
+	return &valueCache{max: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// get returns a copy of the cached value of key and the codec it was
+// encoded with.
+func (c *valueCache) get(key string) ([]byte, string, bool) {
+	if c == nil {
+		return nil, "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, "", false
+	}
+	c.order.MoveToFront(el)
+	v := el.Value.(*cached)
+	return append([]byte(nil), v.value...), v.codec, true
+}
+
+// add caches a copy of value as the value of key, evicting the least
+// recently used key once the cache is full.
+func (c *valueCache) add(key string, value []byte, codec string) {
+	if c == nil {
+		return
+	}
+	value = append([]byte(nil), value...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		el.Value.(*cached).value = value
+		el.Value.(*cached).codec = codec
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&cached{key: key, value: value, codec: codec})
+	if c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cached).key)
+	}
+}
+
+func (c *valueCache) remove(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.order.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+func (c *valueCache) clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.items = make(map[string]*list.Element)
+}
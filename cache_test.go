@@ -0,0 +1,95 @@
+package endor
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// countingStorage counts the reads of the Storage it wraps.
+type countingStorage struct {
+	Storage
+	reads *atomic.Int64
+}
+
+func (s countingStorage) ReadAt(p []byte, off int64) (int, error) {
+	s.reads.Add(1)
+	return s.Storage.ReadAt(p, off)
+}
+
+func TestValueCache(t *testing.T) {
+	db, _ := openTest(t, Options{CacheSize: 2})
+	for _, key := range []string{"a", "b", "c"} {
+		if err := db.Set(key, []byte("value of "+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var reads atomic.Int64
+	db.file = countingStorage{db.file, &reads}
+	get := func(key, want string, fromFile bool) {
+		t.Helper()
+		before := reads.Load()
+		got, err := db.Get(key)
+		if err != nil || string(got) != want {
+			t.Fatalf("Get %s = %q, %v, want %q", key, got, err, want)
+		}
+		if read := reads.Load() > before; read != fromFile {
+			t.Fatalf("Get %s read the data file: %v, want %v", key, read, fromFile)
+		}
+		// The value returned is the caller's to change.
+		got[0] = 'X'
+	}
+	get("a", "value of a", true)
+	get("a", "value of a", false)
+	get("b", "value of b", true)
+	// Reading c evicts a, the least recently read.
+	get("c", "value of c", true)
+	get("b", "value of b", false)
+	get("a", "value of a", true)
+
+	// Writes drop the key, so the next Get reads the new value.
+	if err := db.Set("a", []byte("new a")); err != nil {
+		t.Fatal(err)
+	}
+	get("a", "new a", true)
+	get("a", "new a", false)
+	if err := db.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get("a"); err == nil {
+		t.Fatal("Get of a deleted key served from the cache")
+	}
+}
+
+func TestValueCacheEviction(t *testing.T) {
+	c := newValueCache(3)
+	for i := 0; i < 5; i++ {
+		c.add(fmt.Sprint(i), []byte{byte(i)}, "")
+	}
+	for i := 0; i < 5; i++ {
+		if _, _, ok := c.get(fmt.Sprint(i)); ok != (i >= 2) {
+			t.Fatalf("key %d cached %v after adding 5 to a cache of 3", i, ok)
+		}
+	}
+	c.add("2", []byte("again"), "gob")
+	if v, codec, ok := c.get("2"); !ok || string(v) != "again" || codec != "gob" {
+		t.Fatalf("updated entry = %q, %q, %v", v, codec, ok)
+	}
+	c.remove("2")
+	if _, _, ok := c.get("2"); ok {
+		t.Fatal("removed entry still cached")
+	}
+	c.clear()
+	if len(c.items) != 0 || c.order.Len() != 0 {
+		t.Fatalf("%d items left after clear", len(c.items))
+	}
+
+	// A cache of size zero is nil and holds nothing.
+	none := newValueCache(0)
+	none.add("a", []byte("1"), "")
+	if _, _, ok := none.get("a"); ok {
+		t.Fatal("a disabled cache returned a value")
+	}
+	none.remove("a")
+	none.clear()
+}
@@ -0,0 +1,137 @@
+package endor
+
+// checkpoint is the index as of a watermark, persisted so Open can resume
+// replaying the data file from the watermark.
+type checkpoint struct {
+	Watermark watermark `json:"watermark"`
+	Live      int64     `json:"live"`
+	// Records is the number of records up to the watermark. Checkpoints
+	// written before it was tracked leave it out.
+	Records int64 `json:"records,omitempty"`
+	// Entries maps each live key to its offset, length, expiry and
+	// version. Checkpoints written before versions were added leave the
+	// version out, which reads back as zero.
+	Entries map[string][4]int64 `json:"entries"`
+	// Merges maps the keys with operands queued by Merge to their offsets
+	// and lengths.
+	Merges map[string][][2]int64 `json:"merges,omitempty"`
+	// History maps the keys with kept revisions to them, oldest first.
+	History map[string][]checkpointRevision `json:"history,omitempty"`
+	// Expiring maps the keys OnExpire has yet to be called for to the
+	// offsets and lengths of their records, see ttl.go.
+	Expiring map[string][2]int64 `json:"expiring,omitempty"`
+}
+
+// checkpointRevision is a revision in a checkpoint, its entry written like
+// those of Entries.
+type checkpointRevision struct {
+	Entry   [4]int64   `json:"e"`
+	Merges  [][2]int64 `json:"m,omitempty"`
+	Deleted bool       `json:"d,omitempty"`
+}
+
+func (db *DB) checkpointPath() string {
+	return db.path + ".checkpoint"
+}
+
+// loadCheckpoint restores the index from the checkpoint file, and the bloom
+// filter saved with it, and returns the offset to replay the data file from.
+// Without a checkpoint that matches the data file, or of an empty one, it
+// returns the offset of the first record, so the whole file is replayed.
+func (db *DB) loadCheckpoint() (int64, error) {
+	var c checkpoint
+	ok, err := db.readState(db.checkpointPath(), &c)
+	if err != nil || !ok || c.Watermark.Offset == 0 {
+		return db.start, err
+	}
+	// covers compares against db.size, which is only known once loaded,
+	// so trust the checkpoint's own offset and check its last record.
+	db.size = c.Watermark.Offset
+	if !db.covers(c.Watermark) {
+		db.size = db.start
+		return db.start, nil
+	}
+	for key, e := range c.Entries {
+		db.index[key] = entry{offset: e[0], length: e[1], expires: e[2], version: db.versionOf(record{Version: uint64(e[3])})}
+	}
+	for key, ops := range c.Merges {
+		merges := make([]entry, len(ops))
+		for i, op := range ops {
+			merges[i] = entry{offset: op[0], length: op[1]}
+		}
+		if db.merges == nil {
+			db.merges = make(map[string][]entry)
+		}
+		db.merges[key] = merges
+	}
+	for key, revs := range c.History {
+		history := make([]revision, len(revs))
+		for i, rev := range revs {
+			e := rev.Entry
+			history[i] = revision{entry: entry{offset: e[0], length: e[1], expires: e[2], version: uint64(e[3])}, deleted: rev.Deleted}
+			for _, m := range rev.Merges {
+				history[i].merges = append(history[i].merges, entry{offset: m[0], length: m[1]})
+			}
+		}
+		if db.history == nil {
+			db.history = make(map[string][]revision)
+		}
+		db.history[key] = history
+	}
+	for key, e := range c.Expiring {
+		db.expire(key, entry{offset: e[0], length: e[1]})
+	}
+	db.touchByVersion()
+	db.live = c.Live
+	db.records = c.Records
+	db.last = c.Watermark.Last
+	db.checkpointed = c.Watermark.Offset
+	return c.Watermark.Offset, db.loadFilter(c.Watermark)
+}
+
+// saveCheckpoint writes a checkpoint of the index and the bloom filter,
+// unless nothing was written since the last one. Callers hold db.mu.
+func (db *DB) saveCheckpoint() error {
+	if db.readOnly || db.inMemory || db.size == db.checkpointed {
+		return nil
+	}
+	w, err := db.watermark()
+	if err != nil {
+		return err
+	}
+	c := checkpoint{Watermark: w, Live: db.live, Records: db.records, Entries: make(map[string][4]int64, len(db.index))}
+	for key, e := range db.index {
+		c.Entries[key] = [4]int64{e.offset, e.length, e.expires, int64(e.version)}
+	}
+	for key, merges := range db.merges {
+		if c.Merges == nil {
+			c.Merges = make(map[string][][2]int64)
+		}
+		for _, m := range merges {
+			c.Merges[key] = append(c.Merges[key], [2]int64{m.offset, m.length})
+		}
+	}
+	for key, revs := range db.history {
+		if c.History == nil {
+			c.History = make(map[string][]checkpointRevision)
+		}
+		for _, rev := range revs {
+			saved := checkpointRevision{Entry: [4]int64{rev.offset, rev.length, rev.expires, int64(rev.version)}, Deleted: rev.deleted}
+			for _, m := range rev.merges {
+				saved.Merges = append(saved.Merges, [2]int64{m.offset, m.length})
+			}
+			c.History[key] = append(c.History[key], saved)
+		}
+	}
+	for key, e := range db.expiring {
+		if c.Expiring == nil {
+			c.Expiring = make(map[string][2]int64)
+		}
+		c.Expiring[key] = [2]int64{e.offset, e.length}
+	}
+	if err := db.writeState(db.checkpointPath(), c); err != nil {
+		return err
+	}
+	db.checkpointed = db.size
+	return db.saveFilter(w)
+}
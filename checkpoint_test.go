@@ -0,0 +1,126 @@
+package endor
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	db, path := openTest(t, Options{})
+	want := map[string]string{"a": "1", "b": "1", "c": "1"}
+	for key, value := range want {
+		if err := db.Set(key, []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// reopen closes the store, puts checkpoint in place of the one Close
+	// took, unless it is nil, and checks the store opens as wanted.
+	reopen := func(when string, checkpoint []byte) {
+		t.Helper()
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if checkpoint != nil {
+			if err := os.WriteFile(path+".checkpoint", checkpoint, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var err error
+		if db, err = Open(path); err != nil {
+			t.Fatalf("%s: %v", when, err)
+		}
+		for key, value := range want {
+			if got, err := db.Get(key); err != nil || string(got) != value {
+				t.Fatalf("%s: Get %s = %q, %v, want %q", when, key, got, err, value)
+			}
+		}
+		if stats, err := db.Stats(); err != nil || stats.Keys != len(want) {
+			t.Fatalf("%s: Stats = %+v, %v, want %d keys", when, stats, err, len(want))
+		}
+	}
+	reopen("reopened", nil)
+	old, err := os.ReadFile(path + ".checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An older checkpoint of the same file resumes from its watermark and
+	// replays the records written since.
+	for key, value := range map[string]string{"b": "2", "d": "1"} {
+		if err := db.Set(key, []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+		want[key] = value
+	}
+	reopen("from an older checkpoint", old)
+
+	// Compact removes the checkpoint of the file it replaces, and Close
+	// takes one of the new file.
+	old, err = os.ReadFile(path + ".checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".checkpoint"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("checkpoint after Compact: %v, want it removed", err)
+	}
+	if err := db.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	delete(want, "a")
+	reopen("after Compact", nil)
+
+	// One of the file as it was before a compaction, put back, no longer
+	// matches the file and is ignored. Every key is overwritten, so no
+	// record of the copy is the one it ended with, or at its offset.
+	for _, key := range []string{"b", "c", "d"} {
+		if err := db.Set(key, []byte("3")); err != nil {
+			t.Fatal(err)
+		}
+		want[key] = "3"
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	reopen("from a checkpoint taken before Compact", old)
+
+	// So is one that does not parse.
+	reopen("from a corrupt checkpoint", []byte(`{"watermark":`))
+
+	// Open trusts the records the checkpoint covers without reading them:
+	// a record corrupted behind it only fails Open once the checkpoint is
+	// gone and the whole file is replayed. The last record is left alone,
+	// as Open checks it against the checkpoint.
+	var at int64
+	for _, key := range []string{"b", "c"} {
+		if e := db.index[key]; e.offset != db.last {
+			at = e.offset + e.length - 8
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[at] ^= 0x01
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if db, err = Open(path); err != nil {
+		t.Fatalf("Open from the checkpoint = %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path + ".checkpoint"); err != nil {
+		t.Fatal(err)
+	}
+	if db, err = Open(path); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Open replaying a corrupt record = %v, want ErrCorrupt", err)
+	}
+}
@@ -0,0 +1,105 @@
+// Command endor-bench runs the workloads of package benchmarks and prints
+// what each measured, so Options can be compared on one machine:
+//
+//	endor-bench -sync never -write-buffer 65536
+//	endor-bench -workload mixed,random-get -binary -cache 10000
+//
+// The stores are created in -dir and removed once measured.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aaydin-tr/endor"
+	"github.com/aaydin-tr/endor/benchmarks"
+)
+
+func main() {
+	dir := flag.String("dir", os.TempDir(), "directory to create the stores in")
+	names := flag.String("workload", "all", "comma separated workloads to run, or all")
+	scale := flag.Float64("scale", 1, "factor to multiply the keys and operations of every workload by")
+	binary := flag.Bool("binary", false, "write binary records instead of lines")
+	sync := flag.String("sync", "always", "sync policy: always, never, every=<n writes> or interval=<duration>")
+	writeBuffer := flag.Int("write-buffer", 0, "bytes of appends to buffer in memory, see Options.WriteBufferSize")
+	readLength := flag.Int("read-length", 0, "bytes to read a line with first, see Options.ReadLength")
+	cache := flag.Int("cache", 0, "values to cache, see Options.CacheSize")
+	mmap := flag.Bool("mmap", false, "serve reads from a memory mapping")
+	flag.Parse()
+
+	policy, err := parseSync(*sync)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "endor-bench:", err)
+		os.Exit(2)
+	}
+	opts := endor.Options{
+		BinaryRecords:   *binary,
+		SyncPolicy:      policy,
+		WriteBufferSize: *writeBuffer,
+		ReadLength:      *readLength,
+		CacheSize:       *cache,
+		MmapReads:       *mmap,
+		SweepInterval:   -1,
+	}
+	workloads, err := selectWorkloads(*names)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "endor-bench:", err)
+		os.Exit(2)
+	}
+	fmt.Printf("sync %v, write buffer %d, read length %d, binary %v\n", policy, *writeBuffer, *readLength, *binary)
+	for _, w := range workloads {
+		r, err := benchmarks.Run(*dir, opts, w.Scale(*scale))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "endor-bench: %s: %v\n", w.Name, err)
+			os.Exit(1)
+		}
+		fmt.Println(r)
+	}
+}
+
+func parseSync(s string) (endor.SyncPolicy, error) {
+	name, arg, _ := strings.Cut(s, "=")
+	switch name {
+	case "always":
+		return endor.SyncAlways, nil
+	case "never":
+		return endor.SyncNever, nil
+	case "every":
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return endor.SyncPolicy{}, fmt.Errorf("-sync %s: %w", s, err)
+		}
+		return endor.SyncEvery(n), nil
+	case "interval":
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			return endor.SyncPolicy{}, fmt.Errorf("-sync %s: %w", s, err)
+		}
+		return endor.SyncInterval(d), nil
+	}
+	return endor.SyncPolicy{}, fmt.Errorf("unknown sync policy %q", s)
+}
+
+func selectWorkloads(names string) ([]benchmarks.Workload, error) {
+	if names == "all" {
+		return benchmarks.Workloads, nil
+	}
+	var selected []benchmarks.Workload
+	for _, name := range strings.Split(names, ",") {
+		found := false
+		for _, w := range benchmarks.Workloads {
+			if w.Name == name {
+				selected = append(selected, w)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown workload %q", name)
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,279 @@
+// Command endor inspects and changes an endor store from the shell:
+//
+//	endor -db data.db get <key>
+//	endor -db data.db set <key> <value|->
+//	endor -db data.db del <key>
+//	endor -db data.db scan [-values] [prefix]
+//	endor -db data.db compact
+//	endor -db data.db verify [-quarantine]
+//	endor -db data.db stats
+//	endor -db data.db dump [-format=json|text] [prefix]
+//
+// Commands that only read open the store read-only, so they can run next to
+// other readers and next to a process holding the store for writing. The
+// others wait for that process, up to -timeout.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aaydin-tr/endor"
+)
+
+type command struct {
+	usage string
+	// write opens the store for writing instead of read-only.
+	write bool
+	run   func(db *endor.DB, args []string) error
+}
+
+var commands = map[string]command{
+	"get":     {usage: "get <key>", run: get},
+	"set":     {usage: "set <key> <value|->", write: true, run: set},
+	"del":     {usage: "del <key>", write: true, run: del},
+	"scan":    {usage: "scan [-values] [prefix]", run: scan},
+	"compact": {usage: "compact", write: true, run: compact},
+	"verify":  {usage: "verify [-quarantine]", run: verify},
+	"stats":   {usage: "stats", run: stats},
+	"dump":    {usage: "dump [-format=json|text] [prefix]", run: dump},
+}
+
+var order = []string{"get", "set", "del", "scan", "compact", "verify", "stats", "dump"}
+
+// dbPath is the data file named by -db.
+var dbPath string
+
+func main() {
+	flag.Usage = usage
+	flag.StringVar(&dbPath, "db", "", "path of the data file")
+	key := flag.String("key", os.Getenv("ENDOR_KEY"), "hex encoded encryption key, defaults to $ENDOR_KEY")
+	timeout := flag.Duration("timeout", 10*time.Second, "how long to wait for another process to release the store, 0 waits indefinitely")
+	flag.Parse()
+	if dbPath == "" || flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	name, args := flag.Arg(0), flag.Args()[1:]
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "endor: unknown command %q\n", name)
+		usage()
+		os.Exit(2)
+	}
+	// verify only needs to write when it quarantines.
+	write := cmd.write || name == "verify" && hasFlag(args, "quarantine")
+
+	if err := runCommand(*key, *timeout, write, cmd, args); err != nil {
+		fmt.Fprintln(os.Stderr, "endor:", err)
+		os.Exit(1)
+	}
+}
+
+func runCommand(key string, timeout time.Duration, write bool, cmd command, args []string) (err error) {
+	opts := endor.Options{LockTimeout: timeout, SweepInterval: -1, CheckpointInterval: -1}
+	if key != "" {
+		if opts.EncryptionKey, err = hex.DecodeString(key); err != nil {
+			return fmt.Errorf("invalid encryption key: %w", err)
+		}
+	}
+	var db *endor.DB
+	if write {
+		db, err = endor.OpenWithOptions(dbPath, opts)
+	} else {
+		if _, statErr := os.Stat(dbPath); statErr != nil {
+			return statErr
+		}
+		db, err = endor.OpenReadOnly(dbPath, opts)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := db.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	if err := cmd.run(db, args); !errors.Is(err, errUsage) {
+		return err
+	}
+	return fmt.Errorf("usage: endor %s", cmd.usage)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: endor -db <path> [flags] <command> [args]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, name := range order {
+		fmt.Fprintln(os.Stderr, "  "+commands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nflags:")
+	flag.PrintDefaults()
+}
+
+func hasFlag(args []string, name string) bool {
+	for _, a := range args {
+		a = strings.TrimLeft(a, "-")
+		if a == name || strings.HasPrefix(a, name+"=") {
+			return a != name+"=false"
+		}
+	}
+	return false
+}
+
+// errUsage is returned by a command called with the wrong arguments, which
+// then fails with its usage line.
+var errUsage = errors.New("wrong arguments")
+
+// exactArgs fails with errUsage unless args holds n arguments.
+func exactArgs(args []string, n int) error {
+	if len(args) != n {
+		return errUsage
+	}
+	return nil
+}
+
+func get(db *endor.DB, args []string) error {
+	if err := exactArgs(args, 1); err != nil {
+		return err
+	}
+	value, err := db.Get(args[0])
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(value)
+	return err
+}
+
+func set(db *endor.DB, args []string) error {
+	if err := exactArgs(args, 2); err != nil {
+		return err
+	}
+	value := []byte(args[1])
+	if args[1] == "-" {
+		var err error
+		if value, err = io.ReadAll(os.Stdin); err != nil {
+			return err
+		}
+	}
+	return db.Set(args[0], value)
+}
+
+func del(db *endor.DB, args []string) error {
+	if err := exactArgs(args, 1); err != nil {
+		return err
+	}
+	return db.Delete(args[0])
+}
+
+func scan(db *endor.DB, args []string) error {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	values := fs.Bool("values", false, "print each value after its key, separated by a tab")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return errUsage
+	}
+	it := db.Scan(fs.Arg(0))
+	for it.Next() {
+		if !*values {
+			fmt.Println(it.Key())
+			continue
+		}
+		value, err := it.Value()
+		if errors.Is(err, endor.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\t%s\n", it.Key(), value)
+	}
+	return nil
+}
+
+func compact(db *endor.DB, args []string) error {
+	if err := exactArgs(args, 0); err != nil {
+		return err
+	}
+	return db.Compact()
+}
+
+func verify(db *endor.DB, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	quarantine := fs.Bool("quarantine", false, "move corrupt records to a .quarantine file and drop their keys")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	report, err := db.Verify(*quarantine)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("records: %d\ncorrupt: %d\n", report.Records, len(report.Corrupt))
+	for _, offset := range report.Corrupt {
+		fmt.Printf("  offset %d\n", offset)
+	}
+	if len(report.Corrupt) > 0 {
+		return fmt.Errorf("%d corrupt records", len(report.Corrupt))
+	}
+	return nil
+}
+
+func stats(db *endor.DB, args []string) error {
+	if err := exactArgs(args, 0); err != nil {
+		return err
+	}
+	s, err := db.Stats()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("file bytes: %d\nlive bytes: %d\ndead bytes: %d\n", s.FileBytes, s.LiveBytes, s.DeadBytes)
+	fmt.Printf("keys: %d\nrecords: %d\ndead records: %d\nindex bytes: %d\n", s.Keys, s.Records, s.DeadRecords, s.IndexBytes)
+	return nil
+}
+
+// dumpItem is a line of dump -format=json. The value is base64 encoded.
+type dumpItem struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+func dump(db *endor.DB, args []string) error {
+	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
+	format := fs.String("format", "json", "output format: json for one object per line, text for tab separated lines")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return errUsage
+	}
+	if *format != "json" && *format != "text" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	it := db.Scan(fs.Arg(0))
+	for it.Next() {
+		value, err := it.Value()
+		if errors.Is(err, endor.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if *format == "text" {
+			fmt.Printf("%s\t%s\n", it.Key(), value)
+			continue
+		}
+		if err := enc.Encode(dumpItem{Key: it.Key(), Value: value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain runs the command instead of the tests when endor re-executes the
+// test binary as the command.
+func TestMain(m *testing.M) {
+	if os.Getenv("ENDOR_RUN_MAIN") == "1" {
+		os.Args = append(os.Args[:1], strings.Fields(os.Getenv("ENDOR_ARGS"))...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runEndor runs the command with args and stdin, returning its output and
+// exit code.
+func runEndor(t *testing.T, stdin string, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), "ENDOR_RUN_MAIN=1", "ENDOR_ARGS="+strings.Join(args, " "))
+	cmd.Stdin = strings.NewReader(stdin)
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		code = exit.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return out.String(), errOut.String(), code
+}
+
+func TestCommands(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "test.db")
+	run := func(stdin, want string, args ...string) {
+		t.Helper()
+		out, errOut, code := runEndor(t, stdin, append([]string{"-db", db}, args...)...)
+		if code != 0 || out != want {
+			t.Fatalf("endor %s = %q, %q, exit %d, want %q", strings.Join(args, " "), out, errOut, code, want)
+		}
+	}
+	run("", "", "set", "user:a", "one")
+	run("from stdin", "", "set", "user:b", "-")
+	run("", "", "set", "other", "x")
+	run("", "one", "get", "user:a")
+	run("", "user:a\nuser:b\n", "scan", "user:")
+	run("", "user:a\tone\nuser:b\tfrom stdin\n", "scan", "-values", "user:")
+	run("", `{"key":"user:a","value":"b25l"}`+"\n", "dump", "user:a")
+	run("", "other\tx\n", "dump", "-format=text", "other")
+	run("", "", "del", "other")
+	run("", "", "compact")
+	run("", "records: 2\ncorrupt: 0\n", "verify")
+	out, _, _ := runEndor(t, "", "-db", db, "stats")
+	if !strings.Contains(out, "keys: 2\n") {
+		t.Fatalf("stats = %q", out)
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	dir := t.TempDir()
+	db := filepath.Join(dir, "test.db")
+	if _, _, code := runEndor(t, "", "-db", db, "set", "a", "1"); code != 0 {
+		t.Fatalf("set exited %d", code)
+	}
+	for _, c := range []struct {
+		args   []string
+		code   int
+		stderr string
+	}{
+		{[]string{"get"}, 2, "usage: endor -db <path>"},
+		{[]string{"-db", db}, 2, "usage: endor -db <path>"},
+		{[]string{"-db", db, "frob"}, 2, `unknown command "frob"`},
+		{[]string{"-db", db, "get"}, 1, "usage: endor get <key>"},
+		{[]string{"-db", db, "get", "missing"}, 1, "key not found"},
+		{[]string{"-db", db, "dump", "-format=xml"}, 1, `unknown format "xml"`},
+		{[]string{"-db", filepath.Join(dir, "none.db"), "get", "a"}, 1, "no such file or directory"},
+		{[]string{"-db", db, "-key", "xyz", "get", "a"}, 1, "invalid encryption key"},
+	} {
+		_, errOut, code := runEndor(t, "", c.args...)
+		if code != c.code || !strings.Contains(errOut, c.stderr) {
+			t.Fatalf("endor %s = %q, exit %d, want exit %d and %q", strings.Join(c.args, " "), errOut, code, c.code, c.stderr)
+		}
+	}
+	// Reading a missing store does not create it.
+	if _, err := os.Stat(filepath.Join(dir, "none.db")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("get of a missing store created it: %v", err)
+	}
+}
+
+func TestEncryptedStore(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "test.db")
+	key := hex.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	if _, errOut, code := runEndor(t, "", "-db", db, "-key", key, "set", "a", "secret"); code != 0 {
+		t.Fatalf("set exited %d: %s", code, errOut)
+	}
+	if out, errOut, code := runEndor(t, "", "-db", db, "-key", key, "get", "a"); code != 0 || out != "secret" {
+		t.Fatalf("get with the key = %q, %q, exit %d", out, errOut, code)
+	}
+	if _, _, code := runEndor(t, "", "-db", db, "get", "a"); code == 0 {
+		t.Fatal("get without the key succeeded")
+	}
+}
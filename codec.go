@@ -0,0 +1,220 @@
+package endor
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Codec turns values into the bytes a DB stores and back. Typed, SetValue
+// and GetValue use one to store values of Go types; any serialization,
+// msgpack or protobuf for example, can be plugged in by implementing it.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// NamedCodec is a Codec with a name, which SetValue records along with
+// every value it encodes. GetValue then decodes the value with the codec
+// of that name, the built-in ones and those of the options included, even
+// after the codec of its key changed. Values encoded with a Codec without
+// a name are decoded with whatever codec their key has when read.
+type NamedCodec interface {
+	Codec
+	Name() string
+}
+
+var (
+	// JSONCodec encodes values with encoding/json.
+	JSONCodec Codec = jsonCodec{}
+
+	// GobCodec encodes values with encoding/gob. Every value carries its
+	// own type description, so it suits few large values better than many
+	// small ones.
+	GobCodec Codec = gobCodec{}
+
+	// RawCodec stores []byte and string values as they are, and decodes
+	// into a *[]byte or a *string.
+	RawCodec Codec = rawCodec{}
+)
+
+var builtinCodecs = []Codec{JSONCodec, GobCodec, RawCodec}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type rawCodec struct{}
+
+func (rawCodec) Name() string { return "raw" }
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("endor: raw codec can not encode %T", v)
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	switch v := v.(type) {
+	case *[]byte:
+		*v = append([]byte(nil), data...)
+	case *string:
+		*v = string(data)
+	default:
+		return fmt.Errorf("endor: raw codec can not decode into %T", v)
+	}
+	return nil
+}
+
+// codecName returns the name c records values under, empty if it has none.
+func codecName(c Codec) string {
+	if n, ok := c.(NamedCodec); ok {
+		return n.Name()
+	}
+	return ""
+}
+
+// SetValue encodes v with the codec of key and stores it under key.
+func (db *DB) SetValue(key string, v any) error {
+	return db.setValue(key, key, v)
+}
+
+// setValue is SetValue with the key errors name, which for a bucket is the
+// key within it.
+func (db *DB) setValue(key string, name string, v any) error {
+	c := db.codecFor(key)
+	data, err := c.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode %q: %w", name, err)
+	}
+	return db.writeContext(context.Background(), []record{{Op: opSet, Key: key, Value: data, Codec: codecName(c)}})
+}
+
+// GetValue decodes the value of key into v, which must be a pointer, or
+// returns ErrKeyNotFound if it is not set or has expired. The value is
+// decoded with the codec it was encoded with, see NamedCodec, or with the
+// codec of key. It fails with ErrUnknownCodec for a codec this store does
+// not know of.
+func (db *DB) GetValue(key string, v any) error {
+	return db.getValue(key, key, v)
+}
+
+// getValue is GetValue with the key errors name, as for setValue.
+func (db *DB) getValue(key string, name string, v any) error {
+	data, codec, err := db.get(context.Background(), key)
+	if err != nil {
+		return err
+	}
+	c, err := db.codecNamed(codec, db.codecFor(key))
+	if err == nil {
+		err = c.Unmarshal(data, v)
+	}
+	if err != nil {
+		return fmt.Errorf("decode %q: %w", name, err)
+	}
+	return nil
+}
+
+// codecFor returns the codec the values of key are encoded with: that of
+// its bucket, or of the options.
+func (db *DB) codecFor(key string) Codec {
+	if isBucketKey(key) {
+		name, _, _ := strings.Cut(key[len(bucketMark):], bucketMark)
+		db.codecsMu.RLock()
+		c := db.codecs[name]
+		db.codecsMu.RUnlock()
+		if c != nil {
+			return c
+		}
+	}
+	if db.opts.Codec != nil {
+		return db.opts.Codec
+	}
+	return JSONCodec
+}
+
+// codecNamed returns the codec called name, or fallback when name is
+// empty or fallback has that name.
+func (db *DB) codecNamed(name string, fallback Codec) (Codec, error) {
+	if name == "" || codecName(fallback) == name {
+		return fallback, nil
+	}
+	known := append([]Codec{db.opts.Codec}, db.opts.Codecs...)
+	db.codecsMu.RLock()
+	for _, c := range db.codecs {
+		known = append(known, c)
+	}
+	db.codecsMu.RUnlock()
+	for _, c := range append(known, builtinCodecs...) {
+		if c != nil && codecName(c) == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownCodec, name)
+}
+
+// UseCodec makes SetValue and GetValue on the bucket encode values with c
+// instead of the codec of the options. A nil c goes back to that one.
+func (b *Bucket) UseCodec(c Codec) {
+	b.db.codecsMu.Lock()
+	defer b.db.codecsMu.Unlock()
+	if c == nil {
+		delete(b.db.codecs, b.name)
+		return
+	}
+	if b.db.codecs == nil {
+		b.db.codecs = make(map[string]Codec)
+	}
+	b.db.codecs[b.name] = c
+}
+
+// SetValue encodes v with the codec of the bucket and stores it under key
+// in the bucket.
+func (b *Bucket) SetValue(key string, v any) error {
+	k, err := b.key(key)
+	if err != nil {
+		return err
+	}
+	return b.db.setValue(k, key, v)
+}
+
+// GetValue decodes the value of key in the bucket into v, as DB.GetValue
+// does.
+func (b *Bucket) GetValue(key string, v any) error {
+	k, err := b.key(key)
+	if err != nil {
+		return err
+	}
+	return b.db.getValue(k, key, v)
+}
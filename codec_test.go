@@ -0,0 +1,123 @@
+package endor
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+type point struct {
+	X, Y int
+}
+
+// prefixCodec is JSON behind a prefix, under a name of its own, or none
+// when name is empty.
+type prefixCodec struct{ name string }
+
+func (c prefixCodec) Marshal(v any) ([]byte, error) {
+	data, err := JSONCodec.Marshal(v)
+	return append([]byte("pfx:"), data...), err
+}
+
+func (c prefixCodec) Unmarshal(data []byte, v any) error {
+	rest, ok := bytes.CutPrefix(data, []byte("pfx:"))
+	if !ok {
+		return errors.New("missing prefix")
+	}
+	return JSONCodec.Unmarshal(rest, v)
+}
+
+type namedPrefixCodec struct{ prefixCodec }
+
+func (c namedPrefixCodec) Name() string { return c.name }
+
+func TestCodecs(t *testing.T) {
+	custom := namedPrefixCodec{prefixCodec{name: "prefix"}}
+	db, path := openTest(t, Options{Codec: GobCodec, Codecs: []Codec{custom}})
+	if err := db.SetValue("gob", point{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	db.Bucket("raw").UseCodec(RawCodec)
+	if err := db.Bucket("raw").SetValue("k", "as is"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.Bucket("raw").Get("k"); err != nil || string(got) != "as is" {
+		t.Fatalf("raw value stored as %q, %v", got, err)
+	}
+	db.Bucket("custom").UseCodec(custom)
+	if err := db.Bucket("custom").SetValue("k", point{3, 4}); err != nil {
+		t.Fatal(err)
+	}
+	// Encode errors name the key within its bucket.
+	if err := db.Bucket("raw").SetValue("bad", 42); err == nil || !strings.Contains(err.Error(), `encode "bad"`) {
+		t.Fatalf("raw SetValue of an int = %v, want an encode error naming the key", err)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(path + ".checkpoint")
+
+	// Every value decodes with the codec that encoded it, whatever the
+	// codecs are now, as long as the store knows of them.
+	db, err := OpenWithOptions(path, Options{Codecs: []Codec{custom}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p point
+	if err := db.GetValue("gob", &p); err != nil || p != (point{1, 2}) {
+		t.Fatalf("GetValue of a gob value with JSON the codec = %+v, %v", p, err)
+	}
+	var s string
+	if err := db.Bucket("raw").GetValue("k", &s); err != nil || s != "as is" {
+		t.Fatalf("GetValue of a raw value in a bucket without a codec = %q, %v", s, err)
+	}
+	if err := db.Bucket("custom").GetValue("k", &p); err != nil || p != (point{3, 4}) {
+		t.Fatalf("GetValue of a value of a codec in Codecs = %+v, %v", p, err)
+	}
+	if err := db.Bucket("missing").GetValue("k", &p); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("GetValue of a missing key = %v, want ErrKeyNotFound", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Bucket("custom").GetValue("k", &p); !errors.Is(err, ErrUnknownCodec) || !strings.Contains(err.Error(), `decode "k"`) {
+		t.Fatalf("GetValue of a value of a codec the store does not know = %v, want ErrUnknownCodec", err)
+	}
+}
+
+func TestUnnamedCodec(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	bucket := db.Bucket("b")
+	bucket.UseCodec(prefixCodec{})
+	if err := bucket.SetValue("k", point{5, 6}); err != nil {
+		t.Fatal(err)
+	}
+	// A value without a codec name decodes with the codec its key has
+	// when read.
+	var p point
+	if err := bucket.GetValue("k", &p); err != nil || p != (point{5, 6}) {
+		t.Fatalf("GetValue = %+v, %v", p, err)
+	}
+	bucket.UseCodec(nil)
+	if err := bucket.GetValue("k", &p); err == nil {
+		t.Fatal("GetValue with JSON of a prefixed value succeeded")
+	}
+	// Without a codec of its own the bucket uses JSON, the default.
+	if err := bucket.SetValue("k", point{7, 8}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := bucket.Get("k"); err != nil || string(got) != `{"X":7,"Y":8}` {
+		t.Fatalf("value stored as %q, %v, want JSON", got, err)
+	}
+}
@@ -0,0 +1,104 @@
+package endor
+
+import "context"
+
+// Writes are committed in groups. A write queues its encoded records and
+// takes db.mu; the writes queued while another held it wait behind it, and
+// whichever of them takes db.mu next appends the records of all of them
+// with a single append and sync, then marks them done. The others find
+// their write done once they get db.mu and return at once. Under load one
+// append and one sync so commit many writes, while a lone write commits as
+// it always did. The key locks keep writes to the same key out of one
+// group, so the condition of one never depends on another in the group.
+
+// pendingWrite is a write waiting in the commit queue.
+type pendingWrite struct {
+	records []record
+	bodies  [][]byte
+	// format is the format bodies were encoded in.
+	format recordFormat
+	// cond is checked with db.mu held before the write is appended, see
+	// writeIf.
+	cond func() error
+
+	// done and err are set by the write committing it, under db.mu.
+	done bool
+	err  error
+}
+
+// commit commits w, alone or along with the writes queued with it, giving
+// up with ctx.Err() if ctx is done before one of them takes db.mu for it.
+func (db *DB) commit(ctx context.Context, w *pendingWrite) error {
+	db.commitMu.Lock()
+	db.queue = append(db.queue, w)
+	db.commitMu.Unlock()
+
+	if err := db.lockContext(ctx); err != nil {
+		if db.withdraw(w) {
+			return err
+		}
+		// A group took w along already and holds db.mu until it is
+		// done, and an append that started runs to completion.
+		db.mu.Lock()
+	}
+	defer db.mu.Unlock()
+	if !w.done {
+		db.commitMu.Lock()
+		group := db.queue
+		db.queue = nil
+		db.commitMu.Unlock()
+		db.commitGroup(group)
+	}
+	return w.err
+}
+
+// withdraw takes w out of the queue, reporting false if a group took it
+// first.
+func (db *DB) withdraw(w *pendingWrite) bool {
+	db.commitMu.Lock()
+	defer db.commitMu.Unlock()
+	for i, queued := range db.queue {
+		if queued == w {
+			db.queue = append(db.queue[:i], db.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// commitGroup appends the records of the writes of group whose conditions
+// hold as one and marks all of them done. db.mu must be held.
+func (db *DB) commitGroup(group []*pendingWrite) {
+	var (
+		writes  []*pendingWrite
+		records []record
+		bodies  [][]byte
+	)
+	for _, w := range group {
+		w.done = true
+		switch {
+		case db.closed:
+			w.err = ErrClosed
+		case db.readOnly || db.follower:
+			w.err = ErrReadOnly
+		case w.cond != nil:
+			w.err = w.cond()
+		}
+		if w.err == nil {
+			w.err = db.reencode(w.format, w.records, w.bodies)
+		}
+		if w.err != nil {
+			continue
+		}
+		writes = append(writes, w)
+		records = append(records, w.records...)
+		bodies = append(bodies, w.bodies...)
+	}
+	if len(records) == 0 {
+		return
+	}
+	err := db.appendLocked(records, bodies)
+	for _, w := range writes {
+		w.err = err
+	}
+}
@@ -0,0 +1,122 @@
+package endor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// queueWrites starts writes with db.mu held, so they queue up behind it,
+// and returns once n of them are queued together with the function that
+// waits for their errors.
+func queueWrites(t *testing.T, db *DB, n int, write func(i int) error) func() []error {
+	t.Helper()
+	db.mu.Lock()
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = write(i)
+		}()
+	}
+	eventually(t, fmt.Sprintf("%d writes queued", n), func() bool {
+		db.commitMu.Lock()
+		defer db.commitMu.Unlock()
+		return len(db.queue) == n
+	})
+	return func() []error {
+		db.mu.Unlock()
+		wg.Wait()
+		return errs
+	}
+}
+
+func TestGroupCommit(t *testing.T) {
+	backend := newTestBackend()
+	db, _ := openTest(t, Options{Storage: backend})
+	if err := db.Set("cas", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	_, version, err := db.GetVersion("cas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	appends, syncs := backend.appends.Load(), backend.syncs.Load()
+
+	// The writes queued behind one another share one append and one
+	// sync, except the one whose condition fails, which alone is not
+	// written.
+	const writers = 10
+	wait := queueWrites(t, db, writers, func(i int) error {
+		if i == 0 {
+			return db.SetIfVersion("cas", []byte("stale"), version+1)
+		}
+		return db.Set(fmt.Sprintf("key-%03d", i), []byte(fmt.Sprint(i)))
+	})
+	errs := wait()
+	if !errors.Is(errs[0], ErrVersionMismatch) {
+		t.Fatalf("SetIfVersion in a group = %v, want ErrVersionMismatch", errs[0])
+	}
+	want := make(map[string]string)
+	for i := 1; i < writers; i++ {
+		if errs[i] != nil {
+			t.Fatalf("Set %d in a group = %v", i, errs[i])
+		}
+		want[fmt.Sprintf("key-%03d", i)] = fmt.Sprint(i)
+	}
+	if n := backend.appends.Load() - appends; n != 1 {
+		t.Fatalf("%d writes took %d appends, want 1", writers-1, n)
+	}
+	if n := backend.syncs.Load() - syncs; n != 1 {
+		t.Fatalf("%d writes took %d syncs, want 1", writers-1, n)
+	}
+	checkKeys(t, db, writers, want, "after a group commit")
+	if got, err := db.Get("cas"); err != nil || string(got) != "v" {
+		t.Fatalf("Get of the key whose condition failed = %q, %v", got, err)
+	}
+
+	// A failed sync fails every write of its group.
+	backend.failSync.Store(true)
+	wait = queueWrites(t, db, 3, func(i int) error {
+		return db.Set(fmt.Sprintf("failed-%d", i), []byte("v"))
+	})
+	for i, err := range wait() {
+		if !errors.Is(err, errBackend) {
+			t.Fatalf("write %d of a group whose sync failed = %v, want the sync's error", i, err)
+		}
+	}
+}
+
+func TestGroupCommitWithdraw(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	ctx, cancel := context.WithCancel(context.Background())
+	wait := queueWrites(t, db, 2, func(i int) error {
+		if i == 0 {
+			return db.SetContext(ctx, "withdrawn", []byte("v"))
+		}
+		return db.Set("kept", []byte("v"))
+	})
+	// A write given up on before a group takes it leaves the queue and
+	// is never written, while the rest of the queue is.
+	cancel()
+	eventually(t, "the cancelled write withdrawn", func() bool {
+		db.commitMu.Lock()
+		defer db.commitMu.Unlock()
+		return len(db.queue) == 1
+	})
+	errs := wait()
+	if !errors.Is(errs[0], context.Canceled) || errs[1] != nil {
+		t.Fatalf("writes = %v, want context.Canceled and nil", errs)
+	}
+	if _, err := db.Get("withdrawn"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get of a withdrawn write = %v, want ErrKeyNotFound", err)
+	}
+	if got, err := db.Get("kept"); err != nil || string(got) != "v" {
+		t.Fatalf("Get kept = %q, %v", got, err)
+	}
+}
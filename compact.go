@@ -0,0 +1,270 @@
+package endor
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Compact rewrites the data file with only the records of live keys, which
+// reclaims the space of overwritten, deleted and expired ones. Reads and
+// writes wait until it finishes. It returns ErrSnapshot while a Snapshot or
+// BackupTo is copying the data file, or a SnapshotIterator reads it where
+// it can not be replaced under one, and ErrReadOnly on a read-only store.
+func (db *DB) Compact() error {
+	return db.CompactContext(context.Background())
+}
+
+// CompactContext is like Compact but gives up once ctx is done, whether it
+// is still waiting for reads and writes to finish or already copying, and
+// returns ctx.Err(). The data file is left as it was.
+func (db *DB) CompactContext(ctx context.Context) (err error) {
+	defer db.observe(OpCompact, time.Now(), &err)
+	if err := db.lockContext(ctx); err != nil {
+		return err
+	}
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	if db.readOnly || db.follower {
+		return ErrReadOnly
+	}
+	if db.snapshots > 0 || db.iterators > 0 {
+		return ErrSnapshot
+	}
+	return db.compact(ctx)
+}
+
+// maybeCompact runs an automatic compaction when the dead space in the data
+// file crosses CompactRatio, or once it is twice MaxBytes, so the space of
+// evicted keys is reclaimed without a CompactRatio too. Callers hold db.mu. The write that triggered it
+// already succeeded, so a failed compaction is not reported to it; the data
+// file stays as it was and a later write tries again.
+func (db *DB) maybeCompact() {
+	if db.snapshots > 0 || db.iterators > 0 {
+		return
+	}
+	if db.opts.MaxBytes > 0 && db.size >= 2*db.opts.MaxBytes {
+		db.compact(context.Background())
+		return
+	}
+	if db.opts.CompactRatio <= 0 {
+		return
+	}
+	minBytes := db.opts.CompactMinBytes
+	if minBytes == 0 {
+		minBytes = DefaultCompactMinBytes
+	}
+	if db.size < minBytes || float64(db.size-db.live) < db.opts.CompactRatio*float64(db.size) {
+		return
+	}
+	db.compact(context.Background())
+}
+
+// compact writes the live records to a sibling file, which then replaces the
+// data file. The copy is written in the record format the options ask for,
+// which is how a data file moves from lines to binary records or back. The
+// data file is unlocked between closing it and reopening the
+// replacement, so another process could take the lock in that window; the
+// DB is closed if that happens. Once ctx is done the copy stops and the
+// sibling file is removed.
+func (db *DB) compact(ctx context.Context) error {
+	tmp := db.path + ".compact"
+	out, err := db.backend.Open(tmp)
+	if err != nil {
+		return err
+	}
+	err = out.Truncate(0)
+	format, start := formatFor(db.opts), int64(0)
+	var header fileHeader
+	if err == nil {
+		header, err = db.header.orNew()
+	}
+	if err == nil {
+		start, err = writeHeader(out, format, header)
+	}
+	var c *compacted
+	if err == nil {
+		c, err = db.copyLive(ctx, out, format, start)
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Join(err, db.backend.Remove(tmp))
+	}
+
+	// The checkpoint and saved indexes describe the file about to be
+	// replaced, and one left behind could pass for a checkpoint of the
+	// copy, which keeps its header. They are saved again from the new
+	// index.
+	for _, path := range []string{db.checkpointPath(), db.sidecarPath()} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return errors.Join(err, db.backend.Remove(tmp))
+		}
+	}
+	db.checkpointed = 0
+	if err := db.file.Close(); err != nil {
+		return errors.Join(err, db.backend.Remove(tmp))
+	}
+	err = db.backend.Replace(tmp, db.path)
+	file, openErr := db.backend.Open(db.path)
+	if openErr != nil {
+		db.closed = true
+		return errors.Join(err, openErr)
+	}
+	db.file = file
+	if err != nil {
+		// The rename failed, so the old file is back in place and the
+		// old index still describes it.
+		return err
+	}
+	db.setFormat(c.format)
+	db.start, db.header = start, header
+	db.index = c.index
+	db.merges = c.merges
+	db.history = c.history
+	db.expiring = c.expiring
+	db.size = c.size
+	db.live = c.size - c.dead
+	db.last = c.last
+	db.records = c.records
+	db.generation++
+	db.compacted = time.Now()
+	db.signalAppended()
+	db.gauges()
+	return nil
+}
+
+// compacted is what copyLive made of the data file: the format, index,
+// merges and history of the copy, its size and the offset of its last
+// record.
+type compacted struct {
+	format  recordFormat
+	index   map[string]entry
+	merges  map[string][]entry
+	history map[string][]revision
+	// expiring holds the copies of the expired records OnExpire has yet
+	// to be called for, and dead how many bytes they take.
+	expiring map[string]entry
+	dead     int64
+	size     int64
+	last     int64
+	records  int64
+}
+
+// append encodes r and appends it to out, reporting where it landed.
+func (c *compacted) append(db *DB, out Storage, r record) (entry, error) {
+	r.Batch = 0
+	body, err := db.encode(c.format, r)
+	if err != nil {
+		return entry{}, err
+	}
+	offset, err := out.Append(c.format.frame(body)...)
+	if err != nil {
+		return entry{}, err
+	}
+	length := int64(len(body)) + c.format.overhead()
+	c.size, c.last = offset+length, offset
+	c.records++
+	return entry{offset: offset, length: length, expires: r.Expires, version: r.Version}, nil
+}
+
+// copyLive appends the current record of every live key to out, which holds
+// the start bytes of its header, with the operands merged into it, in
+// format f and returns what out then holds. With history on
+// the revisions of every key are copied too, ahead of its current state,
+// and nothing is merged, so every state reads back as it did. It stops with
+// ctx.Err() once ctx is done.
+func (db *DB) copyLive(ctx context.Context, out Storage, f recordFormat, start int64) (*compacted, error) {
+	now := time.Now().UnixNano()
+	c := &compacted{format: f, index: make(map[string]entry, len(db.index)), size: start}
+	if db.keepsHistory() {
+		c.merges = make(map[string][]entry)
+		c.history = make(map[string][]revision, len(db.history))
+		for key, revs := range db.history {
+			for _, rev := range revs {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				copied, err := db.copyState(key, rev, out, c)
+				if err != nil {
+					return nil, err
+				}
+				c.history[key] = append(c.history[key], copied)
+			}
+		}
+	}
+	for key, e := range db.index {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if db.keepsHistory() {
+			copied, err := db.copyState(key, revision{entry: e, merges: db.merges[key]}, out, c)
+			if err != nil {
+				return nil, err
+			}
+			c.index[key] = copied.entry
+			if len(copied.merges) > 0 {
+				c.merges[key] = copied.merges
+			}
+			continue
+		}
+		if e.expired(now) {
+			if err := db.copyExpiring(key, e, out, c); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		r, err := db.readLive(key, e)
+		if err != nil {
+			return nil, err
+		}
+		// Stamps records from before versions with the one they were
+		// given on load.
+		r.Version = e.version
+		copied, err := c.append(db, out, r)
+		if err != nil {
+			return nil, err
+		}
+		c.index[key] = copied
+	}
+	for key, e := range db.expiring {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := db.copyExpiring(key, e, out, c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// copyExpiring copies the record of key at e, which expired, for OnExpire
+// to be called for it still. Without callbacks it is dropped like any dead
+// record.
+func (db *DB) copyExpiring(key string, e entry, out Storage, c *compacted) error {
+	if len(db.expireCallbacks()) == 0 || e.offset < 0 {
+		return nil
+	}
+	r, err := db.readRecord(e.offset)
+	if err != nil {
+		return err
+	}
+	copied, err := c.append(db, out, r)
+	if err != nil {
+		return err
+	}
+	if c.expiring == nil {
+		c.expiring = make(map[string]entry)
+	}
+	c.expiring[key] = copied
+	c.dead += copied.length
+	return nil
+}
@@ -0,0 +1,353 @@
+package endor
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+	"time"
+)
+
+// CompactSegments compacts a store with segments one segment at a time, so
+// each step only reads and writes a segment's worth of records. Every
+// sealed segment but the first, which holds the header, is rewritten with
+// only the records still in use when they take up less than it, or at most
+// 1-CompactRatio of it when CompactRatio is set, and removed when none are.
+// Deleted and expired keys leave a delete record behind, so the older
+// records of them in earlier segments stay overwritten; Compact drops
+// those too. A store without segments is compacted like Compact does. It
+// returns ErrSnapshot and ErrReadOnly as Compact does.
+func (db *DB) CompactSegments() error {
+	return db.CompactSegmentsContext(context.Background())
+}
+
+// CompactSegmentsContext is like CompactSegments but gives up once ctx is
+// done, returning ctx.Err(). The segments already rewritten stay so.
+func (db *DB) CompactSegmentsContext(ctx context.Context) (err error) {
+	defer db.observe(OpCompact, time.Now(), &err)
+	if err := db.lockContext(ctx); err != nil {
+		return err
+	}
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	if db.readOnly || db.follower {
+		return ErrReadOnly
+	}
+	if db.snapshots > 0 || db.iterators > 0 {
+		return ErrSnapshot
+	}
+	s, ok := db.file.(*segmentStorage)
+	if !ok {
+		return db.compact(ctx)
+	}
+
+	// Expired keys leave the index as the sweep takes them out, so their
+	// records are only kept while OnExpire callbacks are still due.
+	db.sweepLocked()
+	live := db.segmentLive(s)
+	compacted := false
+	defer func() {
+		if compacted {
+			db.generation++
+			db.compacted = time.Now()
+			db.signalAppended()
+			db.gauges()
+		}
+	}()
+	// Going from the last sealed segment down keeps the positions of the
+	// ones still to go as they were when live was counted.
+	for i := len(s.segments) - 2; i > 0; i-- {
+		size := s.segments[i].size
+		dead := size - live[i]
+		if dead <= 0 || (db.opts.CompactRatio > 0 && float64(dead) < db.opts.CompactRatio*float64(size)) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		changed, err := db.compactSegment(ctx, s, i)
+		if changed {
+			compacted = true
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// segmentLive returns how many bytes of the records compaction keeps each
+// segment holds. Callers hold db.mu.
+func (db *DB) segmentLive(s *segmentStorage) []int64 {
+	live := make([]int64, len(s.segments))
+	count := func(e entry) {
+		if e.offset >= 0 {
+			live[s.find(e.offset)] += e.length
+		}
+	}
+	for _, e := range db.index {
+		count(e)
+	}
+	for _, merges := range db.merges {
+		for _, m := range merges {
+			count(m)
+		}
+	}
+	for _, revs := range db.history {
+		for _, rev := range revs {
+			count(rev.entry)
+			for _, m := range rev.merges {
+				count(m)
+			}
+		}
+	}
+	if len(db.expireCallbacks()) > 0 {
+		for _, e := range db.expiring {
+			count(e)
+		}
+	}
+	return live
+}
+
+// compactSegment rewrites the i-th segment of s with only the records in
+// use, or removes it if there are none, and moves every entry to where its
+// record is then. It reports whether the segment was changed, which it may
+// have been even when it fails, once the new manifest is written. Callers
+// hold db.mu.
+func (db *DB) compactSegment(ctx context.Context, s *segmentStorage, i int) (bool, error) {
+	base, end := s.segments[i].base, s.segments[i].end()
+	in := func(offset int64) bool { return offset >= base && offset < end }
+
+	// keep maps the offsets of the records in use in the segment to the
+	// version of their key's entry, for records from before versions, and
+	// kept holds the keys of those not in the index.
+	keep := make(map[int64]uint64)
+	kept := make(map[string]bool)
+	for _, e := range db.index {
+		if in(e.offset) {
+			keep[e.offset] = e.version
+		}
+	}
+	note := func(key string, e entry) {
+		if in(e.offset) {
+			if _, ok := keep[e.offset]; !ok {
+				keep[e.offset] = 0
+			}
+			kept[key] = true
+		}
+	}
+	for key, merges := range db.merges {
+		for _, m := range merges {
+			note(key, m)
+		}
+	}
+	for key, revs := range db.history {
+		for _, rev := range revs {
+			note(key, rev.entry)
+			for _, m := range rev.merges {
+				note(key, m)
+			}
+		}
+	}
+	if len(db.expireCallbacks()) > 0 {
+		for key, e := range db.expiring {
+			note(key, e)
+		}
+	}
+
+	// A key the segment has records of that is neither set, kept nor
+	// revised was deleted, by a record of its own, or expired. Unless that
+	// record comes after the segment, which it does when the key's last
+	// record in the segment is a write that does not expire, the key gets
+	// a delete record, which keeps its older records overwritten when the
+	// store is replayed.
+	var copies []int64
+	tombstones := make(map[string]bool)
+	records := int64(0)
+	var scanErr error
+	err := db.format.scan(boundedStorage{db.file, end}, base, func(offset int64, body []byte) bool {
+		if scanErr = ctx.Err(); scanErr != nil {
+			return false
+		}
+		records++
+		if _, ok := keep[offset]; ok {
+			copies = append(copies, offset)
+			return true
+		}
+		r, err := db.format.unmarshal(body)
+		if err == nil {
+			err = db.openKey(&r)
+		}
+		if err != nil {
+			scanErr = err
+			return false
+		}
+		_, set := db.index[r.Key]
+		_, revised := db.history[r.Key]
+		if !set && !revised && !kept[r.Key] {
+			tombstones[r.Key] = r.Op == opDelete || r.Expires != 0
+		}
+		return true
+	})
+	for key, needed := range tombstones {
+		if !needed {
+			delete(tombstones, key)
+		}
+	}
+	if err == nil {
+		err = scanErr
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var out *fileStorage
+	id, written := 0, int64(0)
+	moved := make(map[int64]entry, len(copies))
+	if len(copies) > 0 || len(tombstones) > 0 {
+		if id, err = s.nextID(); err != nil {
+			return false, err
+		}
+		if out, err = openFileStorage(ctx, segmentName(s.name, id), db.opts, false); err != nil {
+			return false, err
+		}
+		written, err = db.copySegment(out, base, copies, keep, tombstones, moved)
+		if err == nil {
+			err = out.Sync()
+		}
+		if err != nil {
+			return false, errors.Join(err, closeAndRemove(out, segmentName(s.name, id)))
+		}
+		if out.size >= end-base {
+			// Nothing to gain, as with a segment of only delete
+			// records.
+			return false, closeAndRemove(out, segmentName(s.name, id))
+		}
+	}
+
+	// The checkpoint and saved indexes hold offsets that are about to
+	// move, and are saved again from the moved index.
+	for _, path := range []string{db.checkpointPath(), db.sidecarPath()} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return false, errors.Join(err, closeAndRemove(out, segmentName(s.name, id)))
+		}
+	}
+	db.checkpointed = 0
+	old, err := s.swap(i, out, id)
+	if err != nil {
+		return false, errors.Join(err, closeAndRemove(out, segmentName(s.name, id)))
+	}
+	db.moveEntries(base, end, moved, out)
+	db.records += written - records
+	// A segment that could not be removed is not listed any more, so the
+	// next open removes it.
+	return true, errors.Join(old.Close(), os.Remove(segmentName(s.name, old.id)))
+}
+
+func closeAndRemove(f *fileStorage, name string) error {
+	if f == nil {
+		return nil
+	}
+	return errors.Join(f.Close(), os.Remove(name))
+}
+
+// copySegment appends the records at copies, which are in order, and a
+// delete record for each of tombstones to out, noting in moved where each
+// copy landed, and returns how many records it wrote. Records are encoded
+// again, outside any batch, as Compact does.
+func (db *DB) copySegment(out *fileStorage, base int64, copies []int64, versions map[int64]uint64, tombstones map[string]bool, moved map[int64]entry) (int64, error) {
+	if err := out.Truncate(0); err != nil {
+		return 0, err
+	}
+	write := func(r record) (int64, int64, error) {
+		r.Batch = 0
+		body, err := db.encode(db.format, r)
+		if err != nil {
+			return 0, 0, err
+		}
+		offset, err := out.Append(db.format.frame(body)...)
+		return offset, int64(len(body)) + db.format.overhead(), err
+	}
+	for _, offset := range copies {
+		r, err := db.readRecord(offset)
+		if err != nil {
+			return 0, err
+		}
+		if r.Version == 0 {
+			r.Version = versions[offset]
+		}
+		at, length, err := write(r)
+		if err != nil {
+			return 0, err
+		}
+		moved[offset] = entry{offset: base + at, length: length}
+	}
+	deleted := make([]string, 0, len(tombstones))
+	for key := range tombstones {
+		deleted = append(deleted, key)
+	}
+	sort.Strings(deleted)
+	for _, key := range deleted {
+		if _, _, err := write(record{Op: opDelete, Key: key}); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(copies) + len(deleted)), nil
+}
+
+// moveEntries points the entries of the records that were copied out of
+// the segment between base and end at the copies in moved, and those past
+// it at where the segments after it moved down to. out is what replaced
+// the segment, if anything.
+func (db *DB) moveEntries(base, end int64, moved map[int64]entry, out *fileStorage) {
+	size := int64(0)
+	if out != nil {
+		size = out.size
+	}
+	shift := end - base - size
+	move := func(e entry, counted bool) entry {
+		switch {
+		case e.offset < base:
+		case e.offset >= end:
+			e.offset -= shift
+		default:
+			m := moved[e.offset]
+			if counted {
+				db.live += m.length - e.length
+			}
+			e.offset, e.length = m.offset, m.length
+		}
+		return e
+	}
+	for key, e := range db.index {
+		db.index[key] = move(e, true)
+	}
+	for _, merges := range db.merges {
+		for j, m := range merges {
+			merges[j] = move(m, true)
+		}
+	}
+	for _, revs := range db.history {
+		for j, rev := range revs {
+			revs[j].entry = move(rev.entry, true)
+			for k, m := range rev.merges {
+				rev.merges[k] = move(m, true)
+			}
+		}
+	}
+	for key, e := range db.expiring {
+		if _, ok := moved[e.offset]; !ok && e.offset >= base && e.offset < end {
+			// Without callbacks its record was dropped.
+			delete(db.expiring, key)
+			continue
+		}
+		db.expiring[key] = move(e, false)
+	}
+	db.size -= shift
+	if db.last >= end {
+		db.last -= shift
+	}
+}
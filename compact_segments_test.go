@@ -0,0 +1,173 @@
+package endor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// checkKeys fails unless db holds exactly want among the keys of the test.
+func checkKeys(t *testing.T, db *DB, keys int, want map[string]string, when string) {
+	t.Helper()
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("key-%03d", i)
+		got, err := db.Get(key)
+		value, ok := want[key]
+		switch {
+		case !ok && !errors.Is(err, ErrKeyNotFound):
+			t.Fatalf("%s: Get %s = %q, %v, want ErrKeyNotFound", when, key, got, err)
+		case ok && (err != nil || string(got) != value):
+			t.Fatalf("%s: Get %s = %q, %v, want %q", when, key, got, err, value)
+		}
+	}
+}
+
+func TestCompactSegments(t *testing.T) {
+	const keys = 300
+	opts := Options{SegmentSize: 4 << 10}
+	db, path := openTest(t, opts)
+	want := make(map[string]string)
+	set := func(key, value string, ttl time.Duration) {
+		t.Helper()
+		var err error
+		if ttl > 0 {
+			err = db.SetWithTTL(key, []byte(value), ttl)
+		} else {
+			err = db.Set(key, []byte(value))
+			want[key] = value
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < keys; i++ {
+		set(fmt.Sprintf("key-%03d", i), fmt.Sprintf("first value of key %d", i), 0)
+	}
+	// Overwrite, delete and let expire keys in the later segments, so the
+	// earlier ones are left mostly or entirely dead.
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("key-%03d", i)
+		switch i % 4 {
+		case 0:
+			set(key, fmt.Sprintf("second value of key %d", i), 0)
+		case 1:
+			if err := db.Delete(key); err != nil {
+				t.Fatal(err)
+			}
+			delete(want, key)
+		case 2:
+			set(key, "expires", time.Millisecond)
+			delete(want, key)
+		}
+	}
+	for i := 0; i < keys; i += 8 {
+		if err := db.Delete(fmt.Sprintf("key-%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+		delete(want, fmt.Sprintf("key-%03d", i))
+	}
+	time.Sleep(5 * time.Millisecond)
+	s := db.file.(*segmentStorage)
+	before, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CompactSegments(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.FileBytes >= before.FileBytes {
+		t.Fatalf("%d bytes compacted to %d", before.FileBytes, after.FileBytes)
+	}
+	if after.Keys != len(want) {
+		t.Fatalf("%d keys after compaction, want %d", after.Keys, len(want))
+	}
+	checkKeys(t, db, keys, want, "after compaction")
+	set("key-000", "after compaction", 0)
+	ids, err := segmentIDs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := segmentFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != len(s.segments) || len(files) != len(ids)-1 {
+		t.Fatalf("manifest lists %v, files %v, store has %d segments", ids, files, len(s.segments))
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once from the checkpoint, once replaying every segment, which must
+	// not bring back the keys whose delete records were compacted away.
+	for _, when := range []string{"after reopen", "after replay"} {
+		db, err := OpenWithOptions(path, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkKeys(t, db, keys, want, when)
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(path + ".checkpoint"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCompactSegmentsRemovesUnlistedFiles(t *testing.T) {
+	opts := Options{SegmentSize: 1 << 10}
+	db, path := openTest(t, opts)
+	for i := 0; i < 100; i++ {
+		if err := db.Set(fmt.Sprintf("key-%03d", i), []byte("a value long enough to fill segments")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 50; i++ {
+		if err := db.Set(fmt.Sprintf("key-%03d", i), []byte("again")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The segments after the first that held only the first 50 keys are
+	// left with nothing in use, and removed.
+	s := db.file.(*segmentStorage)
+	segments := len(s.segments)
+	if err := db.CompactSegments(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.segments) >= segments {
+		t.Fatalf("%d segments after compaction, had %d", len(s.segments), segments)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// A copy a crash kept from being swapped in.
+	stray := segmentName(path, 999)
+	if err := os.WriteFile(stray, []byte("partial copy"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := OpenWithOptions(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := os.Stat(stray); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("unlisted segment left in place: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		want := "a value long enough to fill segments"
+		if i < 50 {
+			want = "again"
+		}
+		if got, err := db.Get(fmt.Sprintf("key-%03d", i)); err != nil || string(got) != want {
+			t.Fatalf("Get key-%03d = %q, %v", i, got, err)
+		}
+	}
+}
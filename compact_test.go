@@ -0,0 +1,126 @@
+package endor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestCompact(t *testing.T) {
+	db, path := openTest(t, Options{})
+	want := map[string]string{}
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 20; i++ {
+			key, value := fmt.Sprintf("k%02d", i), fmt.Sprintf("v%d", round)
+			if err := db.Set(key, []byte(value)); err != nil {
+				t.Fatal(err)
+			}
+			want[key] = value
+		}
+	}
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("k%02d", i)
+		if err := db.Delete(key); err != nil {
+			t.Fatal(err)
+		}
+		delete(want, key)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.DeadBytes != 0 || stats.Compactions != 1 || stats.LastCompaction.IsZero() {
+		t.Fatalf("after Compact: %d dead bytes, %d compactions at %v", stats.DeadBytes, stats.Compactions, stats.LastCompaction)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Size() >= before.Size() {
+		t.Fatalf("Compact grew the data file from %d to %d bytes", before.Size(), after.Size())
+	}
+	checkKeys(t, db, len(want), want, "after Compact")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	checkKeys(t, db, len(want), want, "after reopening the compacted store")
+}
+
+func TestCompactErrors(t *testing.T) {
+	db, path := openTest(t, Options{})
+	if err := db.Set("k", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set("k", []byte("w")); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A cancelled compaction leaves the data file as it was.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := db.CompactContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("CompactContext with a cancelled context = %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != string(before) {
+		t.Fatalf("a cancelled compaction changed the data file: %v", err)
+	}
+	if _, err := os.Stat(path + ".compact"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("a cancelled compaction left its copy behind: %v", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Compact(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Compact of a closed store = %v, want ErrClosed", err)
+	}
+	ro, err := OpenReadOnly(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+	if err := ro.Compact(); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("Compact of a read-only store = %v, want ErrReadOnly", err)
+	}
+}
+
+func TestAutomaticCompaction(t *testing.T) {
+	db, _ := openTest(t, Options{CompactRatio: 0.5, CompactMinBytes: 1})
+	for i := 0; i < 50; i++ {
+		if err := db.Set("k", []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Compactions == 0 {
+		t.Fatal("overwriting one key 50 times never compacted the data file")
+	}
+	if float64(stats.DeadBytes) >= 0.5*float64(stats.FileBytes) {
+		t.Fatalf("%d of %d bytes dead after automatic compaction", stats.DeadBytes, stats.FileBytes)
+	}
+	if got, err := db.Get("k"); err != nil || string(got) != "49" {
+		t.Fatalf("Get(k) = %q, %v", got, err)
+	}
+}
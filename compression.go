@@ -0,0 +1,80 @@
+package endor
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+)
+
+// Compression selects how record values are compressed. Each record notes
+// the compression of its value, so more can be added without changing the
+// formats of the data file. Codecs are those of the standard library or
+// written here, so the store keeps no dependencies beyond golang.org/x/sys.
+type Compression uint8
+
+const (
+	CompressionNone Compression = iota
+	// CompressionDeflate compresses values with DEFLATE at the default
+	// level, which suits large text values such as JSON documents.
+	CompressionDeflate
+	// CompressionSnappy compresses values with Snappy, see snappy.go,
+	// which shrinks them less than DEFLATE but takes a fraction of the
+	// time, to write and to read back.
+	CompressionSnappy
+)
+
+// compress returns value compressed with c and the compression it ended up
+// stored with. A value that does not shrink is kept as is and reported as
+// CompressionNone, so short values do not pay for the codec's overhead.
+func compress(c Compression, value []byte) ([]byte, Compression, error) {
+	switch c {
+	case CompressionNone:
+		return value, CompressionNone, nil
+	case CompressionDeflate:
+		var buf bytes.Buffer
+		w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return nil, 0, err
+		}
+		if _, err := w.Write(value); err != nil {
+			return nil, 0, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, 0, err
+		}
+		if buf.Len() >= len(value) {
+			return value, CompressionNone, nil
+		}
+		return buf.Bytes(), CompressionDeflate, nil
+	case CompressionSnappy:
+		data := snappyEncode(value)
+		if len(data) >= len(value) {
+			return value, CompressionNone, nil
+		}
+		return data, CompressionSnappy, nil
+	}
+	return nil, 0, fmt.Errorf("unknown compression %d", c)
+}
+
+func decompress(c Compression, value []byte) ([]byte, error) {
+	switch c {
+	case CompressionNone:
+		return value, nil
+	case CompressionDeflate:
+		r := flate.NewReader(bytes.NewReader(value))
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCorrupt, err)
+		}
+		return data, nil
+	case CompressionSnappy:
+		data, err := snappyDecode(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCorrupt, err)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("%w: unknown compression %d", ErrCorrupt, c)
+}
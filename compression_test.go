@@ -0,0 +1,98 @@
+package endor
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	random := make([]byte, 100000)
+	rnd.Read(random)
+	values := map[string][]byte{
+		"empty":    {},
+		"short":    []byte("abc"),
+		"repeated": bytes.Repeat([]byte("endor "), 20000),
+		"random":   random,
+		"json":     bytes.Repeat([]byte(`{"id":12345,"name":"a name","tags":["x","y"]}`), 3000),
+		// A run longer than the reach of copies.
+		"far": append(append(append([]byte{}, random[:70000]...), bytes.Repeat([]byte{0}, 100)...), random[:1000]...),
+	}
+	for _, c := range []Compression{CompressionNone, CompressionDeflate, CompressionSnappy} {
+		for name, value := range values {
+			data, stored, err := compress(c, value)
+			if err != nil {
+				t.Fatalf("%d %s: %v", c, name, err)
+			}
+			if stored != CompressionNone && len(data) >= len(value) {
+				t.Fatalf("%d %s: %d bytes compressed to %d", c, name, len(value), len(data))
+			}
+			got, err := decompress(stored, data)
+			if err != nil {
+				t.Fatalf("%d %s: %v", c, name, err)
+			}
+			if !bytes.Equal(got, value) {
+				t.Fatalf("%d %s: value changed by the round trip", c, name)
+			}
+		}
+	}
+}
+
+func TestSnappyDecodesBlockFormat(t *testing.T) {
+	// "abcd" as a literal and a copy of 8 bytes from 4 back, with a
+	// 1 byte offset.
+	got, err := snappyDecode([]byte{12, 3 << 2, 'a', 'b', 'c', 'd', 1 | 4<<2, 4})
+	if err != nil || string(got) != "abcdabcdabcd" {
+		t.Fatalf("snappyDecode = %q, %v", got, err)
+	}
+	for _, data := range [][]byte{
+		{},
+		{12, 3 << 2, 'a', 'b'},
+		{12, 3 << 2, 'a', 'b', 'c', 'd', 1 | 4<<2, 5},
+		{4, 3 << 2, 'a', 'b', 'c', 'd', 1 | 4<<2, 4},
+		{0xff, 0xff, 0xff, 0xff, 0x0f, 0},
+	} {
+		if _, err := decompress(CompressionSnappy, data); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("decompress(%v) = %v, want ErrCorrupt", data, err)
+		}
+	}
+}
+
+func TestSnappyValuesReadBack(t *testing.T) {
+	value := bytes.Repeat([]byte("snappy value "), 1000)
+	for _, binary := range []bool{false, true} {
+		db, path := openTest(t, Options{Compression: CompressionSnappy, BinaryRecords: binary})
+		if err := db.Set("key", value); err != nil {
+			t.Fatal(err)
+		}
+		if stats, err := db.Stats(); err != nil || stats.FileBytes >= int64(len(value)) {
+			t.Fatalf("binary %v: %d byte file for a %d byte value (%v)", binary, stats.FileBytes, len(value), err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		// Records keep the compression they were written with.
+		db, err := OpenWithOptions(path, Options{Compression: CompressionDeflate, BinaryRecords: binary})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := db.Get("key"); err != nil || !bytes.Equal(got, value) {
+			t.Fatalf("binary %v: Get = %d bytes, %v", binary, len(got), err)
+		}
+		db.Close()
+	}
+}
+
+func TestCompressionErrors(t *testing.T) {
+	if _, err := decompress(CompressionDeflate, []byte("not deflate")); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("decompress of bad DEFLATE data = %v, want ErrCorrupt", err)
+	}
+	if _, err := decompress(Compression(99), []byte("x")); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("decompress with an unknown compression = %v, want ErrCorrupt", err)
+	}
+	if _, _, err := compress(Compression(99), []byte("x")); err == nil {
+		t.Fatal("compress with an unknown compression succeeded")
+	}
+}
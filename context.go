@@ -0,0 +1,47 @@
+package endor
+
+import (
+	"context"
+	"time"
+)
+
+// maxLockPoll caps the delay between the tries of lockContext.
+const maxLockPoll = 10 * time.Millisecond
+
+// lockContext takes db.mu for writing, giving up with ctx.Err() once ctx is
+// done. A sync.RWMutex can not be waited on with a deadline, so a context
+// that can be done polls TryLock with a growing delay instead.
+func (db *DB) lockContext(ctx context.Context) error {
+	return waitLock(ctx, db.mu.Lock, db.mu.TryLock)
+}
+
+// rlockContext is lockContext for reading.
+func (db *DB) rlockContext(ctx context.Context) error {
+	return waitLock(ctx, db.mu.RLock, db.mu.TryRLock)
+}
+
+func waitLock(ctx context.Context, lock func(), tryLock func() bool) error {
+	if ctx.Done() == nil {
+		lock()
+		return nil
+	}
+	delay := 50 * time.Microsecond
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if tryLock() {
+			return nil
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if delay *= 2; delay > maxLockPoll {
+			delay = maxLockPoll
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package endor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestContextVariantsGiveUpWaiting(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	if err := db.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold db.mu the way a long write or compaction does.
+	db.mu.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := db.GetContext(ctx, "a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetContext = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("GetContext gave up after %v", elapsed)
+	}
+	if err := db.SetContext(ctx, "a", []byte("2")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("SetContext = %v, want context.DeadlineExceeded", err)
+	}
+	if err := db.DeleteContext(ctx, "a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("DeleteContext = %v, want context.DeadlineExceeded", err)
+	}
+	if err := db.CompactContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("CompactContext = %v, want context.DeadlineExceeded", err)
+	}
+	done, stop := context.WithCancel(context.Background())
+	stop()
+	if err := db.SetContext(done, "a", []byte("3")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("SetContext with a cancelled context = %v, want context.Canceled", err)
+	}
+	if len(db.queue) != 0 {
+		t.Fatalf("%d writes left queued after giving up", len(db.queue))
+	}
+	db.mu.Unlock()
+
+	// The writes that gave up left nothing behind.
+	if got, err := db.Get("a"); err != nil || string(got) != "1" {
+		t.Fatalf("Get after the abandoned writes = %q, %v, want 1", got, err)
+	}
+
+	// Without a running write they go through as usual.
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := db.SetContext(ctx, "a", []byte("4")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.GetContext(ctx, "a"); err != nil || string(got) != "4" {
+		t.Fatalf("GetContext = %q, %v, want 4", got, err)
+	}
+	if err := db.DeleteContext(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetContext(ctx, "a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("GetContext of a deleted key = %v, want ErrKeyNotFound", err)
+	}
+	if err := db.CompactContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitLockPollsUntilFree(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	db.mu.Lock()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		db.mu.Unlock()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.rlockContext(ctx); err != nil {
+		t.Fatalf("rlockContext once the lock is free = %v", err)
+	}
+	db.mu.RUnlock()
+}
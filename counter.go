@@ -0,0 +1,82 @@
+package endor
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Increment adds delta to the integer stored under key and returns the
+// result. The value is kept as decimal text, so Get returns it as such, and
+// a key that is not set counts as zero. A value that is not an integer
+// fails with ErrNotInteger and one that would overflow with ErrOverflow,
+// leaving it as is. The key keeps its expiry time. The lock of the key is
+// held from reading to appending, so concurrent increments are never lost,
+// while writes to other keys go on.
+func (db *DB) Increment(key string, delta int64) (n int64, err error) {
+	r := record{Op: opSet, Key: key}
+	if err := db.checkSize(r); err != nil {
+		return 0, err
+	}
+	defer db.observe(OpSet, time.Now(), &err)
+	defer db.keys.lock([]record{r})()
+	current, err := db.current(key)
+	if err != nil {
+		return 0, err
+	}
+	if current != nil {
+		n, err = strconv.ParseInt(string(current.Value), 10, 64)
+		if err != nil {
+			return 0, ErrNotInteger
+		}
+		r.Expires = current.Expires
+	}
+	if delta > 0 && n > math.MaxInt64-delta || delta < 0 && n < math.MinInt64-delta {
+		return 0, ErrOverflow
+	}
+	n += delta
+	r.Value = strconv.AppendInt(nil, n, 10)
+	r.Version = db.nextVersions(1)
+	format := db.writeFormat()
+	body, err := db.encode(format, r)
+	if err != nil {
+		return 0, err
+	}
+	w := &pendingWrite{records: []record{r}, bodies: [][]byte{body}, format: format}
+	if err := db.commit(context.Background(), w); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// current returns the live record of key, nil if it is not set or expired,
+// failing like a write on a store that can not be written.
+func (db *DB) current(key string) (*record, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	if db.readOnly || db.follower {
+		return nil, ErrReadOnly
+	}
+	e, ok := db.index[key]
+	if !ok || e.expired(time.Now().UnixNano()) {
+		return nil, nil
+	}
+	r, err := db.readLive(key, e)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Decrement subtracts delta from the integer stored under key and returns
+// the result, like Increment.
+func (db *DB) Decrement(key string, delta int64) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, ErrOverflow
+	}
+	return db.Increment(key, -delta)
+}
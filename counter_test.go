@@ -0,0 +1,96 @@
+package endor
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIncrement(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	// A key that is not set counts as zero.
+	if n, err := db.Increment("n", 5); err != nil || n != 5 {
+		t.Fatalf("Increment of a new key = %d, %v, want 5", n, err)
+	}
+	if n, err := db.Decrement("n", 7); err != nil || n != -2 {
+		t.Fatalf("Decrement = %d, %v, want -2", n, err)
+	}
+	if got, err := db.Get("n"); err != nil || string(got) != "-2" {
+		t.Fatalf("Get of a counter = %q, %v, want -2", got, err)
+	}
+
+	// Failures leave the value as it was.
+	if err := db.Set("text", []byte("ten")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Increment("text", 1); !errors.Is(err, ErrNotInteger) {
+		t.Fatalf("Increment of text = %v, want ErrNotInteger", err)
+	}
+	if err := db.Set("max", []byte("9223372036854775806")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.Increment("max", 1); err != nil || n != math.MaxInt64 {
+		t.Fatalf("Increment to MaxInt64 = %d, %v", n, err)
+	}
+	for _, c := range []struct {
+		name string
+		do   func() (int64, error)
+	}{
+		{"Increment past MaxInt64", func() (int64, error) { return db.Increment("max", 1) }},
+		{"Decrement past MinInt64", func() (int64, error) { return db.Decrement("n", math.MaxInt64) }},
+		{"Decrement by MinInt64", func() (int64, error) { return db.Decrement("n", math.MinInt64) }},
+	} {
+		if _, err := c.do(); !errors.Is(err, ErrOverflow) {
+			t.Fatalf("%s = %v, want ErrOverflow", c.name, err)
+		}
+	}
+	for key, want := range map[string]string{"text": "ten", "max": "9223372036854775807", "n": "-2"} {
+		if got, _ := db.Get(key); string(got) != want {
+			t.Fatalf("%s holds %q after a failed update, want %q", key, got, want)
+		}
+	}
+	if _, err := db.Increment("", 1); !errors.Is(err, ErrEmptyKey) {
+		t.Fatalf("Increment of an empty key = %v, want ErrEmptyKey", err)
+	}
+
+	// The key keeps its expiry time.
+	if err := db.SetWithTTL("ttl", []byte("1"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	expires := db.index["ttl"].expires
+	if _, err := db.Increment("ttl", 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := db.index["ttl"].expires; got != expires {
+		t.Fatalf("Increment moved the expiry from %d to %d", expires, got)
+	}
+
+	db.Close()
+	if _, err := db.Increment("n", 1); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Increment after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestConcurrentIncrements(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	const workers, each = 8, 50
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < each; j++ {
+				if _, err := db.Increment("n", 1); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got, _ := db.Get("n"); string(got) != "400" {
+		t.Fatalf("counter = %s after %d increments, some were lost", got, workers*each)
+	}
+}
@@ -0,0 +1,751 @@
+package endor
+
+import (
+	"context"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aaydin-tr/endor/internal/fslock"
+)
+
+// DB is a key-value store kept in a single append-only data file. Every Set
+// and Delete appends a record, and an in-memory index maps each live key to
+// the offset of its latest record. The file is locked exclusively for as
+// long as the DB is open.
+type DB struct {
+	mu      sync.RWMutex
+	file    Storage
+	backend Backend
+	path    string
+	opts    Options
+	index   map[string]entry
+	closed  bool
+
+	// format is how the records of the data file are laid out and start
+	// the offset the first of them starts at, past the header.
+	format recordFormat
+	start  int64
+	// encoding is format again, for writes to encode their records in
+	// without db.mu, see writeFormat.
+	encoding atomic.Pointer[recordFormat]
+	// header holds the creation time and ID the header records.
+	header fileHeader
+
+	// readOnly is set by OpenReadOnly. The data file is then held under
+	// a shared lock, or none with FollowWrites or a writer holding it, and
+	// is never written.
+	readOnly bool
+
+	// inMemory is set by OpenInMemory. Nothing is then kept on disk, not
+	// even the checkpoint and index sidecar.
+	inMemory bool
+
+	// follower is set by Follow, whose store only changes through
+	// replication. unfollow stops the replication, or the following of
+	// FollowWrites, and unfollowed is closed once it has stopped.
+	follower   bool
+	unfollow   chan struct{}
+	unfollowed chan struct{}
+
+	// size is the length of the data file and live the part of it taken
+	// by the records the index points at. The rest is dead space that
+	// Compact reclaims.
+	size int64
+	live int64
+	// last is the offset of the last record in the data file.
+	last int64
+	// records counts the records in the data file, see Stats.
+	records int64
+
+	// snapshots counts the snapshots and replication streams copying from
+	// the data file, which keep compaction from replacing it under them.
+	snapshots int
+	// iterators counts the snapshot iterators reading the data file
+	// itself, which hold off compaction the same way.
+	iterators int
+
+	// generation counts the compactions, so a replication stream notices
+	// that the data file it was copying has been rewritten. compacted is
+	// when the last one finished.
+	generation uint64
+	compacted  time.Time
+
+	// flushes counts the syncs of the data file.
+	flushes int64
+
+	// appended is closed by signalAppended to wake the replication
+	// streams waiting for the data file to grow.
+	tailMu   sync.Mutex
+	appended chan struct{}
+
+	// txn is held by the open transaction, if any, so transactions run
+	// one at a time.
+	txn sync.Mutex
+
+	// merges holds the offsets and lengths of the operands Merge queued
+	// for a key since it was last set, oldest first. Their bytes count
+	// as live.
+	merges map[string][]entry
+
+	// history holds the past states of the keys, oldest first, when
+	// HistoryVersions is set. Their records count as live too.
+	history map[string][]revision
+
+	// cache holds recently read values when CacheSize is set.
+	cache *valueCache
+
+	// recency orders the keys by use when MaxBytes is set.
+	recency *recency
+
+	// filter holds the keys of the index, so Get can turn down most
+	// missing keys without db.mu, see bloom.go. It is nil while the store
+	// opens and once it is closed.
+	filter atomic.Pointer[bloomFilter]
+
+	// expiring holds the keys that expired and that OnExpire has yet to
+	// be called for, see ttl.go, with the offsets of their last records.
+	// Those records are dead, but compaction keeps them while there are
+	// callbacks.
+	expiring map[string]entry
+
+	// onExpire holds the callbacks added with OnExpire. The slice is
+	// replaced, never changed.
+	expireMu sync.RWMutex
+	onExpire []func(key string, value []byte)
+
+	// version is the highest record version handed out or seen.
+	version atomic.Uint64
+
+	// unsynced is set while SyncInterval has writes the background
+	// flusher has yet to sync, or SyncEvery writes it has yet to sync
+	// along with later ones, unsyncedWrites of them.
+	unsynced       bool
+	unsyncedWrites int
+
+	// checkpointed is the size of the data file the last checkpoint
+	// covered.
+	checkpointed int64
+
+	// indexes holds the secondary indexes created with CreateIndex and
+	// saved those persisted by an earlier session, loaded by the first
+	// CreateIndex.
+	indexes map[string]*secondary
+	saved   *sidecar
+
+	watchMu  sync.Mutex
+	watchers map[*watcher]struct{}
+
+	// hooks holds the hooks added with Use. The slice is replaced, never
+	// changed, so it can be used after hooksMu is released.
+	hooksMu sync.RWMutex
+	hooks   []Hook
+
+	// codecs maps the buckets given a codec with UseCodec to it.
+	codecsMu sync.RWMutex
+	codecs   map[string]Codec
+
+	// keys orders the writes to each key, see keyLocks.
+	keys keyLocks
+
+	// queue holds the writes waiting to be committed, see commit.
+	commitMu sync.Mutex
+	queue    []*pendingWrite
+
+	// sealer encrypts new records and opener decrypts stored ones. They
+	// only differ while Rekey rewrites the data file.
+	sealer cipher.AEAD
+	opener cipher.AEAD
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+type entry struct {
+	offset  int64
+	length  int64
+	expires int64
+	// version is the version of the record, see GetVersion.
+	version uint64
+}
+
+func (e entry) expired(now int64) bool {
+	return e.expires != 0 && e.expires <= now
+}
+
+// Open opens the store at path, creating the data file if needed, repairs
+// what a crash may have left behind and rebuilds the index from its records.
+func Open(path string) (*DB, error) {
+	return OpenWithOptions(path, Options{})
+}
+
+func OpenWithOptions(path string, opts Options) (*DB, error) {
+	return openDB(context.Background(), path, opts, false)
+}
+
+// OpenContext is like OpenWithOptions but gives up waiting for another
+// process to release the data file once ctx is done, failing with an error
+// that matches both fslock.ErrLocked and ctx.Err().
+func OpenContext(ctx context.Context, path string, opts Options) (*DB, error) {
+	return openDB(ctx, path, opts, false)
+}
+
+// OpenReadOnly opens the store at path for reading, so any number of
+// processes, reporting tools for example, can read it at once, alongside a
+// writer that holds it with Open. With no writer the data file is held under
+// a shared lock, which keeps writers out until it is closed; with one it is
+// read without a lock. The index reflects the data file as it was when
+// opened, unless FollowWrites keeps it up to date with the writer; writes,
+// Compact and Rekey fail with ErrReadOnly. A store kept in segments still
+// waits for the writer to close it.
+func OpenReadOnly(path string, opts Options) (*DB, error) {
+	return openDB(context.Background(), path, opts, true)
+}
+
+func openDB(ctx context.Context, path string, opts Options, readOnly bool) (*DB, error) {
+	aead, err := newCipher(opts.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	if opts.EncryptKeys && aead == nil {
+		return nil, errors.New("endor: EncryptKeys needs an EncryptionKey")
+	}
+	if opts.MaxBytes > 0 && opts.HistoryVersions > 0 {
+		return nil, errors.New("endor: MaxBytes can not be combined with HistoryVersions")
+	}
+	backend := opts.Storage
+	_, inMemory := backend.(*memoryBackend)
+	var file Storage
+	switch {
+	case readOnly && opts.FollowWrites:
+		if backend != nil || opts.SegmentSize > 0 || hasSegments(path) {
+			return nil, errors.New("endor: FollowWrites needs a data file, not a Storage or segments")
+		}
+		backend = fileBackend{opts: opts}
+		var followed *followedFile
+		if followed, err = openFollowedFile(path); err == nil {
+			file = followed
+		}
+	case backend == nil && (opts.SegmentSize > 0 || hasSegments(path)):
+		backend = segmentBackend{opts: opts}
+		file, err = openSegments(ctx, path, opts, readOnly)
+	case backend == nil && readOnly:
+		backend = fileBackend{opts: opts}
+		file, err = openReadOnlyFile(path, opts)
+	case backend == nil:
+		backend = fileBackend{opts: opts}
+		file, err = openFileStorage(ctx, path, opts, readOnly)
+	default:
+		file, err = backend.Open(path)
+	}
+	if errors.Is(err, fslock.ErrLocked) && opts.Storage == nil {
+		err = lockedBy(path, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{file: file, backend: backend, path: path, opts: opts, index: make(map[string]entry), readOnly: readOnly, inMemory: inMemory, cache: newValueCache(opts.CacheSize), recency: newRecency(opts.MaxBytes), sealer: aead, opener: aead}
+	if err := db.openFormat(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if !readOnly {
+		if err := db.recover(); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	from, err := db.loadCheckpoint()
+	if err == nil {
+		err = db.load(from)
+	}
+	if err == nil && db.filter.Load() == nil {
+		db.buildFilter()
+	}
+	if err == nil {
+		// MaxBytes may have been lowered since the last open.
+		err = db.evict()
+	}
+	if err == nil && opts.Storage == nil && !readOnly {
+		err = writePIDFile(path)
+	}
+	if err == nil && readOnly && opts.FollowWrites {
+		err = db.startFollowingWrites()
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if opts.Storage == nil {
+		openStores.add(db)
+	}
+	db.gauges()
+	db.startBackground()
+	return db, nil
+}
+
+// openFormat reads the format of the data file from its header, starting a
+// new file with a header for a new store, in the format the options ask
+// for. The header counts as live, since compaction keeps it too.
+func (db *DB) openFormat() error {
+	size, err := db.file.Size()
+	if err != nil {
+		return err
+	}
+	if size == 0 && !db.readOnly {
+		db.setFormat(formatFor(db.opts))
+		if db.header, err = newFileHeader(); err == nil {
+			db.start, err = writeHeader(db.file, db.format, db.header)
+		}
+	} else {
+		var format recordFormat
+		format, db.start, db.header, err = readHeader(db.file)
+		db.setFormat(format)
+	}
+	db.size, db.live = db.start, db.start
+	return err
+}
+
+// load replays the records of the data file from offset on into the index,
+// which holds the state up to offset restored from a checkpoint. A batch cut
+// short by a crash is left out and cut off the file, so its writes stay all
+// or nothing and later appends can not be mistaken for its missing records.
+// A read-only store can not repair the file, so it skips a torn batch or
+// last record without cutting it off.
+func (db *DB) load(from int64) error {
+	if ok, err := db.loadParallel(from); ok || err != nil {
+		return err
+	}
+	now := time.Now().UnixNano()
+	var (
+		loadErr error
+		torn    bool
+		pending []record
+		offsets []int64
+		lengths []int64
+		want    int
+	)
+	err := db.format.scan(db.file, from, func(offset int64, body []byte) bool {
+		if loadErr != nil {
+			// A record follows the bad one, so a crash did not tear it.
+			torn = false
+			return false
+		}
+		r, err := db.format.unmarshal(body)
+		if err == nil {
+			err = db.openKey(&r)
+		}
+		if err != nil {
+			loadErr = fmt.Errorf("%s: record at offset %d: %w", db.path, offset, err)
+			torn = db.readOnly
+			return true
+		}
+		length := int64(len(body)) + db.format.overhead()
+		if r.Batch > 0 {
+			pending, offsets, lengths, want = pending[:0], offsets[:0], lengths[:0], r.Batch
+		}
+		if want == 0 {
+			db.apply(r, offset, length, now)
+			return true
+		}
+		pending = append(pending, r)
+		offsets = append(offsets, offset)
+		lengths = append(lengths, length)
+		if len(pending) == want {
+			for i := range pending {
+				db.apply(pending[i], offsets[i], lengths[i], now)
+			}
+			want = 0
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if loadErr != nil && !torn {
+		return loadErr
+	}
+	if want > 0 && !db.readOnly {
+		return db.file.Truncate(offsets[0])
+	}
+	return nil
+}
+
+// apply updates the index for the record r of length bytes stored at
+// offset.
+func (db *DB) apply(r record, offset int64, length int64, now int64) {
+	db.size = offset + length
+	db.last = offset
+	db.records++
+	db.cache.remove(r.Key)
+	delete(db.expiring, r.Key)
+	if r.Op == opMerge {
+		db.applyMerge(r, offset, length, now)
+		db.recency.touch(r.Key)
+		return
+	}
+	_, wasSet := db.index[r.Key]
+	db.retire(r.Key)
+	if r.Op == opDelete {
+		delete(db.index, r.Key)
+		db.recency.remove(r.Key)
+		if wasSet && db.keepsHistory() {
+			db.keep(r.Key, revision{entry: entry{offset: offset, length: length, version: db.versionOf(r)}, deleted: true})
+			db.live += length
+		}
+		return
+	}
+	// With history on, an expired record stays a state of its key
+	// until the sweep retires it.
+	if r.expired(now) && !db.keepsHistory() {
+		delete(db.index, r.Key)
+		db.recency.remove(r.Key)
+		db.expire(r.Key, entry{offset: offset, length: length, expires: r.Expires, version: db.versionOf(r)})
+		return
+	}
+	db.index[r.Key] = entry{offset: offset, length: length, expires: r.Expires, version: db.versionOf(r)}
+	db.live += length
+	db.recency.touch(r.Key)
+	if !wasSet {
+		db.addKey(r.Key)
+	}
+}
+
+// Get returns the value of key, or ErrKeyNotFound if it is not set or has
+// expired. Most missing keys are turned down by a bloom filter of the index
+// without waiting for writers, and the rest by the index, so a miss never
+// reads the data file or allocates.
+func (db *DB) Get(key string) ([]byte, error) {
+	return db.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get but gives up waiting for a running write or
+// compaction once ctx is done, returning ctx.Err().
+func (db *DB) GetContext(ctx context.Context, key string) ([]byte, error) {
+	value, _, err := db.get(ctx, key)
+	return value, err
+}
+
+// get is GetContext that also returns the name of the codec the value was
+// encoded with, see record.Codec.
+func (db *DB) get(ctx context.Context, key string) (value []byte, codec string, err error) {
+	defer db.observe(OpGet, time.Now(), &err)
+	if hooks := db.currentHooks(); len(hooks) > 0 {
+		if err := beforeGet(hooks, key); err != nil {
+			return nil, "", err
+		}
+		defer afterGet(hooks, key, &value, &err)
+	}
+	if f := db.filter.Load(); f != nil && !f.mayContain(key) {
+		return nil, "", ErrKeyNotFound
+	}
+	if err := db.rlockContext(ctx); err != nil {
+		return nil, "", err
+	}
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, "", ErrClosed
+	}
+	e, ok := db.index[key]
+	if !ok || e.expired(time.Now().UnixNano()) {
+		return nil, "", ErrKeyNotFound
+	}
+	db.recency.touch(key)
+	if value, codec, ok := db.cache.get(key); ok {
+		return value, codec, nil
+	}
+	r, err := db.readLive(key, e)
+	if err != nil {
+		return nil, "", err
+	}
+	db.cache.add(key, r.Value, r.Codec)
+	return r.Value, r.Codec, nil
+}
+
+func (db *DB) readRecord(offset int64) (record, error) {
+	body, _, err := db.format.readAt(db.file, offset)
+	if err != nil {
+		return record{}, err
+	}
+	r, err := db.decode(body)
+	if err != nil {
+		return record{}, fmt.Errorf("%s: record at offset %d: %w", db.path, offset, err)
+	}
+	return r, nil
+}
+
+// encode turns r into the body of a record in format f, compressing and
+// then encrypting its value as the options ask. The value is sealed with
+// its key as additional data, so it can not be moved to another key
+// unnoticed.
+func (db *DB) encode(f recordFormat, r record) ([]byte, error) {
+	if r.Op != opDelete {
+		value, c, err := compress(db.opts.Compression, r.Value)
+		if err != nil {
+			return nil, err
+		}
+		r.Value, r.Compression = value, c
+		if db.sealer != nil {
+			r.Value, err = seal(db.sealer, r.Value, []byte(r.Key))
+			if err != nil {
+				return nil, err
+			}
+			r.Encrypted = true
+		}
+	}
+	if db.sealer != nil && db.opts.EncryptKeys {
+		sealed, err := seal(db.sealer, []byte(r.Key), nil)
+		if err != nil {
+			return nil, err
+		}
+		r.Key, r.SealedKey = "", sealed
+	}
+	return f.marshal(r)
+}
+
+// decode reverses encode for the format of the data file.
+func (db *DB) decode(body []byte) (record, error) {
+	r, err := db.format.unmarshal(body)
+	if err != nil {
+		return record{}, err
+	}
+	if err := db.openKey(&r); err != nil {
+		return record{}, err
+	}
+	if r.Encrypted {
+		if db.opener == nil {
+			return record{}, ErrNoKey
+		}
+		if r.Value, err = open(db.opener, r.Value, []byte(r.Key)); err != nil {
+			return record{}, err
+		}
+		r.Encrypted = false
+	}
+	if r.Compression != CompressionNone {
+		if r.Value, err = decompress(r.Compression, r.Value); err != nil {
+			return record{}, err
+		}
+		r.Compression = CompressionNone
+	}
+	return r, nil
+}
+
+// openKey restores the key of a record written with EncryptKeys.
+func (db *DB) openKey(r *record) error {
+	if r.SealedKey == nil {
+		return nil
+	}
+	if db.opener == nil {
+		return ErrNoKey
+	}
+	key, err := open(db.opener, r.SealedKey, nil)
+	if err != nil {
+		return err
+	}
+	r.Key, r.SealedKey = string(key), nil
+	return nil
+}
+
+// Set stores value under key and syncs the data file before returning.
+func (db *DB) Set(key string, value []byte) error {
+	return db.SetContext(context.Background(), key, value)
+}
+
+// SetContext is like Set but gives up waiting for a running write or
+// compaction once ctx is done, returning ctx.Err() without writing.
+func (db *DB) SetContext(ctx context.Context, key string, value []byte) error {
+	return db.writeContext(ctx, []record{{Op: opSet, Key: key, Value: value}})
+}
+
+// Delete removes key. Deleting a key that is not set is not an error.
+func (db *DB) Delete(key string) error {
+	return db.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext is like Delete but gives up waiting for a running write or
+// compaction once ctx is done, returning ctx.Err() without writing.
+func (db *DB) DeleteContext(ctx context.Context, key string) error {
+	return db.writeContext(ctx, []record{{Op: opDelete, Key: key}})
+}
+
+// Write commits every operation of b atomically with a single append and
+// one sync: after a crash either all of them are visible or none.
+func (db *DB) Write(b *WriteBatch) error {
+	if b.Len() == 0 {
+		return nil
+	}
+	records := append([]record(nil), b.records...)
+	if len(records) > 1 {
+		records[0].Batch = len(records)
+	}
+	return db.write(records)
+}
+
+// write appends records as one write, syncs the data file and then applies
+// them to the index.
+func (db *DB) write(records []record) error {
+	return db.writeContext(context.Background(), records)
+}
+
+// writeContext is write that gives up waiting for db.mu once ctx is done.
+// Once the append has started it runs to completion.
+func (db *DB) writeContext(ctx context.Context, records []record) error {
+	return db.writeIf(ctx, records, nil)
+}
+
+// writeIf is writeContext that first calls cond with db.mu held and writes
+// nothing if it fails, so the condition still holds when the records land.
+// A nil cond always writes.
+func (db *DB) writeIf(ctx context.Context, records []record, cond func() error) (err error) {
+	if len(records) > 0 {
+		defer db.observe(writeOp(records), time.Now(), &err)
+	}
+	if hooks := db.currentHooks(); len(hooks) > 0 {
+		if err := beforeWrite(hooks, records); err != nil {
+			return err
+		}
+		defer afterWrite(hooks, records, &err)
+	}
+	defer db.keys.lock(records)()
+	first := db.nextVersions(len(records))
+	format := db.writeFormat()
+	bodies := make([][]byte, len(records))
+	for i := range records {
+		if err := db.checkSize(records[i]); err != nil {
+			return err
+		}
+		records[i].Version = first + uint64(i)
+		body, err := db.encode(format, records[i])
+		if err != nil {
+			return err
+		}
+		bodies[i] = body
+	}
+	return db.commit(ctx, &pendingWrite{records: records, bodies: bodies, format: format, cond: cond})
+}
+
+// reencode encodes records again when a compaction moved the data file to
+// another format since they were encoded to bodies in format. db.mu must be
+// held.
+func (db *DB) reencode(format recordFormat, records []record, bodies [][]byte) error {
+	if format == db.format {
+		return nil
+	}
+	for i := range records {
+		body, err := db.encode(db.format, records[i])
+		if err != nil {
+			return err
+		}
+		bodies[i] = body
+	}
+	return nil
+}
+
+// writeFormat returns the format of the data file, which writes encode
+// their records in before they take db.mu. It does not wait for db.mu, so
+// writes queue up for the next group while one is appended; a compaction
+// changing the format in between is caught by reencode.
+func (db *DB) writeFormat() recordFormat {
+	return *db.encoding.Load()
+}
+
+// setFormat sets the format of the data file. db.mu must be held, unless
+// the store is still opening.
+func (db *DB) setFormat(f recordFormat) {
+	db.format = f
+	db.encoding.Store(&f)
+}
+
+// appendLocked appends the records, encoded to bodies, syncs them as the
+// sync policy asks and applies them. db.mu must be held.
+func (db *DB) appendLocked(records []record, bodies [][]byte) error {
+	offset, err := db.file.Append(db.frame(bodies)...)
+	if err != nil {
+		return err
+	}
+	if err := db.syncAppended(); err != nil {
+		return err
+	}
+	now := time.Now().UnixNano()
+	for i, r := range records {
+		length := int64(len(bodies[i])) + db.format.overhead()
+		db.apply(r, offset, length, now)
+		db.reindex(r, now)
+		offset += length
+	}
+	db.notify(records)
+	db.signalAppended()
+	// The write itself succeeded, so a failed eviction is not reported
+	// to it; the next write tries again.
+	db.evict()
+	db.maybeCompact()
+	db.gauges()
+	return nil
+}
+
+// frame returns the buffers that append bodies to the data file.
+func (db *DB) frame(bodies [][]byte) [][]byte {
+	bufs := make([][]byte, 0, 3*len(bodies))
+	for _, body := range bodies {
+		bufs = append(bufs, db.format.frame(body)...)
+	}
+	return bufs
+}
+
+// checkSize rejects a record with a key checkKey rejects, or with a key or
+// value past the limits of the options.
+func (db *DB) checkSize(r record) error {
+	if err := checkKey(r.Key); err != nil {
+		return err
+	}
+	switch {
+	case db.opts.MaxKeySize > 0 && len(r.Key) > db.opts.MaxKeySize:
+		return ErrKeyTooLarge
+	case db.opts.MaxValueSize > 0 && len(r.Value) > db.opts.MaxValueSize:
+		return ErrValueTooLarge
+	}
+	return nil
+}
+
+// checkKey rejects an empty key, and one that is not valid UTF-8: records
+// and checkpoints store keys as JSON strings, which would read such a key
+// back as another.
+func checkKey(key string) error {
+	switch {
+	case key == "":
+		return ErrEmptyKey
+	case !utf8.ValidString(key):
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+// Close stops background work and closes the data file, releasing its lock.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return ErrClosed
+	}
+	db.closed = true
+	saveErr := errors.Join(db.syncPending(), db.saveIndexes(), db.saveCheckpoint())
+	db.filter.Store(nil)
+	db.mu.Unlock()
+
+	db.signalAppended()
+	db.stopFollowing()
+	db.stopBackground()
+	db.closeWatchers()
+	err := errors.Join(saveErr, db.file.Close())
+	if db.opts.Storage == nil {
+		openStores.remove(db)
+		if !db.readOnly {
+			err = errors.Join(err, removePIDFile(db.path))
+		}
+	}
+	return err
+}
@@ -0,0 +1,212 @@
+package endor
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aaydin-tr/endor/internal/fslock"
+)
+
+func openTest(t *testing.T, opts Options) (*DB, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := OpenWithOptions(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, path
+}
+
+func TestInvalidUTF8KeyRejected(t *testing.T) {
+	for _, binary := range []bool{false, true} {
+		db, path := openTest(t, Options{BinaryRecords: binary})
+		key := string([]byte{'k', 0xff, 0xfe})
+		if err := db.Set(key, []byte("v")); !errors.Is(err, ErrInvalidKey) {
+			t.Fatalf("binary %v: Set = %v, want ErrInvalidKey", binary, err)
+		}
+		txn := db.Begin()
+		if err := txn.Set(key, []byte("v")); !errors.Is(err, ErrInvalidKey) {
+			t.Fatalf("binary %v: Txn.Set = %v, want ErrInvalidKey", binary, err)
+		}
+		txn.Rollback()
+		if err := db.Set("ключ", []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		db, err := OpenWithOptions(path, Options{BinaryRecords: binary})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := db.Get("ключ"); err != nil || string(got) != "v" {
+			t.Fatalf("binary %v: Get after reopen = %q, %v", binary, got, err)
+		}
+		if stats, err := db.Stats(); err != nil || stats.Keys != 1 {
+			t.Fatalf("binary %v: %d keys after reopen, want 1 (%v)", binary, stats.Keys, err)
+		}
+		db.Close()
+	}
+}
+
+func TestOpenReadOnlyAlongsideWriter(t *testing.T) {
+	db, path := openTest(t, Options{})
+	if err := db.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	// The writer holds the data file, so the reader opens it without a
+	// lock and sees it as it was when opened.
+	ro, err := OpenReadOnly(path, Options{})
+	if err != nil {
+		t.Fatalf("OpenReadOnly next to a writer = %v", err)
+	}
+	if err := db.Set("b", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ro.Get("a"); err != nil || string(got) != "1" {
+		t.Fatalf("Get(a) = %q, %v", got, err)
+	}
+	if _, err := ro.Get("b"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get(b) written after the open = %v, want ErrKeyNotFound", err)
+	}
+	if err := ro.Set("c", []byte("3")); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("Set on a read-only store = %v, want ErrReadOnly", err)
+	}
+	if err := ro.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// With no writer the reader takes a shared lock, which keeps a writer
+	// out until it closes.
+	ro, err = OpenReadOnly(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ro.Get("b"); err != nil || string(got) != "2" {
+		t.Fatalf("Get(b) after the writer closed = %q, %v", got, err)
+	}
+	if w, err := OpenWithOptions(path, Options{LockTimeout: 50 * time.Millisecond}); err == nil {
+		w.Close()
+		t.Fatal("Open succeeded while a reader held the shared lock")
+	}
+	if err := ro.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMmapReads(t *testing.T) {
+	for _, binary := range []bool{false, true} {
+		opts := Options{MmapReads: true, BinaryRecords: binary}
+		db, path := openTest(t, opts)
+		want := map[string]string{}
+		// Reads between writes make the mapping grow with the file.
+		for i := 0; i < 200; i++ {
+			key, value := fmt.Sprintf("k%03d", i%50), fmt.Sprintf("value %d", i)
+			if err := db.Set(key, []byte(value)); err != nil {
+				t.Fatal(err)
+			}
+			want[key] = value
+			if got, err := db.Get(key); err != nil || string(got) != value {
+				t.Fatalf("binary %v: Get(%s) = %q, %v, want %q", binary, key, got, err, value)
+			}
+		}
+		if _, err := db.Get("missing"); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("binary %v: Get(missing) = %v", binary, err)
+		}
+		// A compaction replaces the file under the mapping.
+		if err := db.Compact(); err != nil {
+			t.Fatal(err)
+		}
+		checkKeys(t, db, len(want), want, fmt.Sprintf("binary %v: after Compact", binary))
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		db, err := OpenWithOptions(path, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkKeys(t, db, len(want), want, fmt.Sprintf("binary %v: after reopen", binary))
+		db.Close()
+	}
+}
+
+// holdStore opens the store at path in a child process, which holds it
+// until the test ends. It returns the PID of the child.
+func holdStore(t *testing.T, path string) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperHoldsStore$")
+	cmd.Env = append(os.Environ(), "ENDOR_HOLD_STORE="+path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		stdin.Close()
+		cmd.Wait()
+	})
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil || line != "holding\n" {
+		t.Fatalf("child process said %q, %v", line, err)
+	}
+	return cmd.Process.Pid
+}
+
+// TestHelperHoldsStore is the child process of holdStore. It opens the
+// store, says so and keeps it open until its input is closed.
+func TestHelperHoldsStore(t *testing.T) {
+	path := os.Getenv("ENDOR_HOLD_STORE")
+	if path == "" {
+		return
+	}
+	db, err := OpenWithOptions(path, Options{SweepInterval: -1, CheckpointInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("holding")
+	io.Copy(io.Discard, os.Stdin)
+	db.Close()
+}
+
+func TestLockTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	pid := holdStore(t, path)
+
+	start := time.Now()
+	_, err := OpenWithOptions(path, Options{LockTimeout: 100 * time.Millisecond})
+	if !errors.Is(err, fslock.ErrLocked) || !errors.Is(err, fslock.ErrTimeout) {
+		t.Fatalf("Open of a held store = %v, want ErrLocked and ErrTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 5*time.Second {
+		t.Fatalf("Open gave up after %v, want about the 100ms timeout", elapsed)
+	}
+	// The error names the process holding the store.
+	if !strings.Contains(err.Error(), fmt.Sprintf("by process %d ", pid)) {
+		t.Fatalf("Open error %q does not name process %d", err, pid)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := OpenContext(ctx, path, Options{}); !errors.Is(err, fslock.ErrLocked) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("OpenContext of a held store = %v, want ErrLocked and the context error", err)
+	}
+}
@@ -0,0 +1,45 @@
+package endor
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+)
+
+// newCipher returns the AES-GCM cipher for key, or nil for an empty key,
+// which leaves records unencrypted.
+func newCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("endor: encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext under a fresh random nonce, which it prepends to
+// the ciphertext.
+func seal(aead cipher.AEAD, plaintext []byte, data []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, data), nil
+}
+
+// open reverses seal. A wrong key fails here the same way tampering does,
+// so both come back as ErrCorrupt.
+func open(aead cipher.AEAD, sealed []byte, data []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: sealed data too short", ErrCorrupt)
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,148 @@
+package endor
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptionAtRest(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	for _, encryptKeys := range []bool{false, true} {
+		opts := Options{EncryptionKey: key, EncryptKeys: encryptKeys}
+		db, path := openTest(t, opts)
+		if err := db.Set("secret-key", []byte("secret value")); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("secret value")) {
+			t.Fatalf("EncryptKeys %v: the value is in the data file in the clear", encryptKeys)
+		}
+		if got := bytes.Contains(data, []byte("secret-key")); got == encryptKeys {
+			t.Fatalf("EncryptKeys %v: key in the clear is %v", encryptKeys, got)
+		}
+
+		db, err = OpenWithOptions(path, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := db.Get("secret-key"); err != nil || string(got) != "secret value" {
+			t.Fatalf("EncryptKeys %v: Get after reopen = %q, %v", encryptKeys, got, err)
+		}
+		db.Close()
+	}
+}
+
+func TestEncryptionKeyErrors(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	db, path := openTest(t, Options{EncryptionKey: key})
+	if err := db.Set("k", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A wrong key fails to open records the way tampering does.
+	db, err := OpenWithOptions(path, Options{EncryptionKey: bytes.Repeat([]byte{2}, 32)})
+	if err == nil {
+		_, err = db.Get("k")
+		db.Close()
+	}
+	if !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("reading with the wrong key = %v, want ErrCorrupt", err)
+	}
+	db, err = Open(path)
+	if err == nil {
+		_, err = db.Get("k")
+		db.Close()
+	}
+	if !errors.Is(err, ErrNoKey) {
+		t.Fatalf("reading without a key = %v, want ErrNoKey", err)
+	}
+
+	other := filepath.Join(t.TempDir(), "other.db")
+	if _, err := OpenWithOptions(other, Options{EncryptionKey: []byte("short")}); err == nil {
+		t.Fatal("Open with a key of the wrong length succeeded")
+	}
+	if _, err := OpenWithOptions(other, Options{EncryptKeys: true}); err == nil {
+		t.Fatal("Open with EncryptKeys but no key succeeded")
+	}
+}
+
+func TestRekey(t *testing.T) {
+	oldKey, newKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	db, path := openTest(t, Options{EncryptionKey: oldKey})
+	for _, key := range []string{"a", "b"} {
+		if err := db.Set(key, []byte("value of "+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Rekey([]byte("short")); err == nil {
+		t.Fatal("Rekey with a key of the wrong length succeeded")
+	}
+	// The store keeps the old key after a failed Rekey.
+	if got, err := db.Get("a"); err != nil || string(got) != "value of a" {
+		t.Fatalf("Get after a failed Rekey = %q, %v", got, err)
+	}
+	if err := db.Rekey(newKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set("c", []byte("value of c")); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a": "value of a", "b": "value of b", "c": "value of c"}
+	checkKeys(t, db, len(want), want, "after Rekey")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := OpenWithOptions(path, Options{EncryptionKey: oldKey})
+	if err == nil {
+		_, err = db.Get("a")
+		db.Close()
+	}
+	if !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("reading with the key Rekey replaced = %v, want ErrCorrupt", err)
+	}
+	db, err = OpenWithOptions(path, Options{EncryptionKey: newKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkKeys(t, db, len(want), want, "after reopening with the new key")
+
+	// An empty key removes the encryption.
+	if err := db.Rekey(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkKeys(t, db, len(want), want, "after removing the encryption")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Rekey(newKey); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Rekey of a closed store = %v, want ErrClosed", err)
+	}
+	ro, err := OpenReadOnly(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+	if err := ro.Rekey(newKey); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("Rekey of a read-only store = %v, want ErrReadOnly", err)
+	}
+}
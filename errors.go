@@ -0,0 +1,30 @@
+package endor
+
+import "errors"
+
+var (
+	ErrKeyNotFound = errors.New("key not found")
+	ErrEmptyKey    = errors.New("key is empty")
+	ErrInvalidKey  = errors.New("key is not valid UTF-8")
+	ErrClosed      = errors.New("store is closed")
+	ErrCorrupt     = errors.New("corrupt record")
+	ErrSnapshot    = errors.New("snapshot in progress")
+	ErrTxnDone     = errors.New("transaction already committed or rolled back")
+	ErrNoKey       = errors.New("record is encrypted and no encryption key is set")
+	ErrReadOnly    = errors.New("store is opened read-only")
+	ErrIndexExists = errors.New("index already exists")
+	ErrNoIndex     = errors.New("no such index")
+
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrInvalidBucket    = errors.New("bucket name is empty or contains a NUL byte")
+	ErrKeyExists        = errors.New("key already exists")
+	ErrVersionMismatch  = errors.New("key changed since its version was read")
+	ErrNotInteger       = errors.New("value is not an integer")
+	ErrOverflow         = errors.New("integer overflow")
+	ErrNoMerger         = errors.New("no merger is set")
+	ErrKeyTooLarge      = errors.New("key is larger than MaxKeySize")
+	ErrValueTooLarge    = errors.New("value is larger than MaxValueSize")
+	ErrNotDataFile      = errors.New("file is not an endor data file")
+	ErrLockHeld         = errors.New("store is held by a running process")
+	ErrUnknownCodec     = errors.New("value is encoded with an unknown codec")
+)
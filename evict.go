@@ -0,0 +1,133 @@
+package endor
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+)
+
+// recency orders the keys of a store from least to most recently used, for
+// MaxBytes to evict the least recently used first. A nil recency tracks
+// nothing. Keys it holds may since have been deleted from the index, which
+// eviction skips.
+type recency struct {
+	// mu is separate from db.mu, since Gets holding db.mu for reading
+	// still update the order.
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+func newRecency(maxBytes int64) *recency {
+	if maxBytes <= 0 {
+		return nil
+	}
+	return &recency{order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// touch makes key the most recently used.
+func (r *recency) touch(key string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if el, ok := r.items[key]; ok {
+		r.order.MoveToFront(el)
+		return
+	}
+	r.items[key] = r.order.PushFront(key)
+}
+
+func (r *recency) remove(key string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if el, ok := r.items[key]; ok {
+		r.order.Remove(el)
+		delete(r.items, key)
+	}
+}
+
+// pop removes and returns the least recently used key.
+func (r *recency) pop() (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	oldest := r.order.Back()
+	if oldest == nil {
+		return "", false
+	}
+	key := r.order.Remove(oldest).(string)
+	delete(r.items, key)
+	return key, true
+}
+
+func (r *recency) clear() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.order.Init()
+	r.items = make(map[string]*list.Element)
+}
+
+// touchByVersion orders the keys of an index loaded from a checkpoint by
+// when they were last written, as their versions tell, since a checkpoint
+// does not record what was read. Callers hold db.mu.
+func (db *DB) touchByVersion() {
+	if db.recency == nil {
+		return
+	}
+	keys := make([]string, 0, len(db.index))
+	for key := range db.index {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return db.index[keys[i]].version < db.index[keys[j]].version })
+	for _, key := range keys {
+		db.recency.touch(key)
+	}
+}
+
+// evict deletes the least recently used keys while the live records take
+// more than MaxBytes, appending a delete for each like any other write, so
+// watchers see them go and replay keeps them gone. The space they took is
+// reclaimed by the next compaction. db.mu must be held.
+func (db *DB) evict() error {
+	max := db.opts.MaxBytes
+	if max <= 0 || db.live <= max || db.readOnly || db.follower {
+		return nil
+	}
+	var records []record
+	for freed := int64(0); db.live-freed > max; {
+		key, ok := db.recency.pop()
+		if !ok {
+			break
+		}
+		e, ok := db.index[key]
+		if !ok {
+			continue
+		}
+		freed += e.length
+		for _, m := range db.merges[key] {
+			freed += m.length
+		}
+		records = append(records, record{Op: opDelete, Key: key})
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	first := db.nextVersions(len(records))
+	bodies := make([][]byte, len(records))
+	for i := range records {
+		records[i].Version = first + uint64(i)
+		body, err := db.encode(db.format, records[i])
+		if err != nil {
+			return err
+		}
+		bodies[i] = body
+	}
+	return db.appendLocked(records, bodies)
+}
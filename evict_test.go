@@ -0,0 +1,112 @@
+package endor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMaxBytesEvicts(t *testing.T) {
+	// Measure a record first, so the cap holds exactly three of them.
+	measure, _ := openTest(t, Options{})
+	value := []byte(strings.Repeat("v", 200))
+	if err := measure.Set("key-000", value); err != nil {
+		t.Fatal(err)
+	}
+	length := measure.index["key-000"].length
+	max := headerSize + 3*length + length/2
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := OpenWithOptions(path, Options{MaxBytes: max})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, cancel := db.Watch("")
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		if err := db.Set(fmt.Sprintf("key-%03d", i), value); err != nil {
+			t.Fatal(err)
+		}
+		receive(t, events)
+	}
+	// Reading key-000 makes key-001 the least recently used, which goes
+	// once key-003 no longer fits, reported to watchers as a delete.
+	if _, err := db.Get("key-000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set("key-003", value); err != nil {
+		t.Fatal(err)
+	}
+	if ev := receive(t, events); ev.Type != EventSet || ev.Key != "key-003" {
+		t.Fatalf("first event %v %s, want the set of key-003", ev.Type, ev.Key)
+	}
+	if ev := receive(t, events); ev.Type != EventDelete || ev.Key != "key-001" {
+		t.Fatalf("second event %v %s, want the eviction of key-001", ev.Type, ev.Key)
+	}
+	want := map[string]string{"key-000": string(value), "key-002": string(value), "key-003": string(value)}
+	checkKeys(t, db, 4, want, "after eviction")
+	if stats, err := db.Stats(); err != nil || stats.LiveBytes > max {
+		t.Fatalf("%d live bytes after eviction, want at most %d (%v)", stats.LiveBytes, max, err)
+	}
+	cancel()
+
+	// Replay keeps evicted keys gone.
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path + ".checkpoint"); err != nil {
+		t.Fatal(err)
+	}
+	db, err = OpenWithOptions(path, Options{MaxBytes: max})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkKeys(t, db, 4, want, "after replay")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A lower cap evicts on open, keeping the keys written last.
+	db, err = OpenWithOptions(path, Options{MaxBytes: headerSize + length + length/2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	checkKeys(t, db, 4, map[string]string{"key-003": string(value)}, "after lowering MaxBytes")
+}
+
+func TestMaxBytesCompacts(t *testing.T) {
+	const max = 4 << 10
+	db, _ := openTest(t, Options{MaxBytes: max})
+	value := []byte(strings.Repeat("v", 100))
+	for i := 0; i < 200; i++ {
+		if err := db.Set(fmt.Sprintf("key-%03d", i), value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The data file is compacted whenever it reaches twice the cap, so it
+	// never grows far past it however much is written.
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Compactions == 0 || stats.FileBytes >= 2*max || stats.LiveBytes > max {
+		t.Fatalf("after 200 writes: %d compactions, %d bytes in the file, %d live", stats.Compactions, stats.FileBytes, stats.LiveBytes)
+	}
+	if got, err := db.Get("key-199"); err != nil || string(got) != string(value) {
+		t.Fatalf("Get of the last key written = %q, %v", got, err)
+	}
+	if _, err := db.Get("key-000"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get of the first key written = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestMaxBytesWithHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	if _, err := OpenWithOptions(path, Options{MaxBytes: 1 << 20, HistoryVersions: 2}); err == nil {
+		t.Fatal("MaxBytes with HistoryVersions opened")
+	}
+}
@@ -0,0 +1,260 @@
+package endor
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Format is a portable encoding of the contents of a store, written by
+// Export and read by Import.
+type Format int
+
+const (
+	// FormatJSONLines writes one JSON object per key:
+	// {"key":"k","value":"<base64>","expires":"<RFC 3339>"}, where expires
+	// is left out for keys without a TTL.
+	FormatJSONLines Format = iota
+	// FormatCSV writes a "key,value,expires" header followed by one row
+	// per key, with the value base64 encoded and expires in RFC 3339 or
+	// empty.
+	FormatCSV
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatJSONLines:
+		return "jsonl"
+	case FormatCSV:
+		return "csv"
+	default:
+		return "unknown"
+	}
+}
+
+// ExportOptions configures DB.Export.
+type ExportOptions struct {
+	// Prefix limits the export to the keys starting with it.
+	Prefix string
+}
+
+// Conflict tells Import what to do with a key that is already set.
+type Conflict int
+
+const (
+	// ConflictOverwrite replaces the current value.
+	ConflictOverwrite Conflict = iota
+	// ConflictSkip keeps the current value.
+	ConflictSkip
+	// ConflictError stops the import with ErrKeyExists.
+	ConflictError
+)
+
+// ImportOptions configures DB.Import.
+type ImportOptions struct {
+	// Prefix limits the import to the keys starting with it.
+	Prefix string
+
+	// OnConflict is what happens to keys that are already set. The zero
+	// value overwrites them.
+	OnConflict Conflict
+
+	// BatchSize is the number of keys committed per batch. Zero selects
+	// DefaultImportBatchSize.
+	BatchSize int
+}
+
+const DefaultImportBatchSize = 1000
+
+// exportItem is one key of an export.
+type exportItem struct {
+	Key     string     `json:"key"`
+	Value   []byte     `json:"value"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+var csvHeader = []string{"key", "value", "expires"}
+
+// Export writes the live keys, in order, with their values and expiry times
+// to w in format and returns how many it wrote. Bucket keys are included,
+// so an import restores the buckets too. Keys are listed when the export
+// starts and their values read as it reaches them, so writes made in the
+// meantime may or may not be seen.
+func (db *DB) Export(w io.Writer, format Format, opts ExportOptions) (int, error) {
+	var write func(item exportItem) error
+	var flush func() error
+	switch format {
+	case FormatJSONLines:
+		bw := bufio.NewWriter(w)
+		enc := json.NewEncoder(bw)
+		write = func(item exportItem) error { return enc.Encode(item) }
+		flush = bw.Flush
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return 0, err
+		}
+		write = func(item exportItem) error {
+			expires := ""
+			if item.Expires != nil {
+				expires = item.Expires.Format(time.RFC3339Nano)
+			}
+			return cw.Write([]string{item.Key, base64.StdEncoding.EncodeToString(item.Value), expires})
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	default:
+		return 0, fmt.Errorf("endor: unknown format %d", format)
+	}
+
+	n := 0
+	it := db.iterate(0, func(key string) bool { return strings.HasPrefix(key, opts.Prefix) })
+	for it.Next() {
+		item, err := db.exportItem(it.keys[it.pos])
+		if errors.Is(err, ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		if err := write(item); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, flush()
+}
+
+// exportItem reads the current value and expiry time of key.
+func (db *DB) exportItem(key string) (exportItem, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return exportItem{}, ErrClosed
+	}
+	e, ok := db.index[key]
+	if !ok || e.expired(time.Now().UnixNano()) {
+		return exportItem{}, ErrKeyNotFound
+	}
+	r, err := db.readLive(key, e)
+	if err != nil {
+		return exportItem{}, err
+	}
+	item := exportItem{Key: key, Value: r.Value}
+	if r.Expires != 0 {
+		t := time.Unix(0, r.Expires).UTC()
+		item.Expires = &t
+	}
+	return item, nil
+}
+
+// Import reads keys written by Export in format from r and stores them,
+// returning how many it stored. Keys whose expiry time has passed are
+// skipped. The keys are committed in batches of BatchSize, so an import
+// that fails part way keeps the batches committed before the failure.
+func (db *DB) Import(r io.Reader, format Format, opts ImportOptions) (int, error) {
+	var next func() (exportItem, error)
+	switch format {
+	case FormatJSONLines:
+		dec := json.NewDecoder(r)
+		next = func() (exportItem, error) {
+			var item exportItem
+			err := dec.Decode(&item)
+			return item, err
+		}
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = len(csvHeader)
+		header, err := cr.Read()
+		if err != nil {
+			return 0, err
+		}
+		if strings.Join(header, ",") != strings.Join(csvHeader, ",") {
+			return 0, fmt.Errorf("endor: csv header is %q, want %q", header, csvHeader)
+		}
+		next = func() (exportItem, error) {
+			row, err := cr.Read()
+			if err != nil {
+				return exportItem{}, err
+			}
+			return csvItem(row)
+		}
+	default:
+		return 0, fmt.Errorf("endor: unknown format %d", format)
+	}
+
+	size := opts.BatchSize
+	if size <= 0 {
+		size = DefaultImportBatchSize
+	}
+	var batch WriteBatch
+	n, line := 0, 0
+	commit := func() error {
+		if err := db.Write(&batch); err != nil {
+			return err
+		}
+		n += batch.Len()
+		batch.Reset()
+		return nil
+	}
+	now := time.Now()
+	for {
+		item, err := next()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return n, fmt.Errorf("endor: import item %d: %w", line, err)
+		}
+		if !strings.HasPrefix(item.Key, opts.Prefix) || item.Expires != nil && !item.Expires.After(now) {
+			continue
+		}
+		if opts.OnConflict != ConflictOverwrite {
+			_, err := db.Get(item.Key)
+			switch {
+			case err == nil && opts.OnConflict == ConflictSkip:
+				continue
+			case err == nil:
+				return n, fmt.Errorf("endor: import item %d: %q: %w", line, item.Key, ErrKeyExists)
+			case !errors.Is(err, ErrKeyNotFound):
+				return n, err
+			}
+		}
+		rec := record{Op: opSet, Key: item.Key, Value: item.Value}
+		if item.Expires != nil {
+			rec.Expires = item.Expires.UnixNano()
+		}
+		batch.records = append(batch.records, rec)
+		if batch.Len() == size {
+			if err := commit(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, commit()
+}
+
+func csvItem(row []string) (exportItem, error) {
+	value, err := base64.StdEncoding.DecodeString(row[1])
+	if err != nil {
+		return exportItem{}, err
+	}
+	item := exportItem{Key: row[0], Value: value}
+	if row[2] != "" {
+		t, err := time.Parse(time.RFC3339Nano, row[2])
+		if err != nil {
+			return exportItem{}, err
+		}
+		item.Expires = &t
+	}
+	return item, nil
+}
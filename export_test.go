@@ -0,0 +1,137 @@
+package endor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportImport(t *testing.T) {
+	for _, format := range []Format{FormatJSONLines, FormatCSV} {
+		t.Run(format.String(), func(t *testing.T) {
+			src, _ := openTest(t, Options{})
+			for _, key := range []string{"user:b", "user:a", "other"} {
+				if err := src.Set(key, []byte("value,\n\"of\" "+key)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := src.SetWithTTL("user:ttl", []byte("soon"), time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			if err := src.SetWithTTL("user:gone", []byte("x"), time.Millisecond); err != nil {
+				t.Fatal(err)
+			}
+			if err := src.Bucket("b").Set("k", []byte("in a bucket")); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(5 * time.Millisecond)
+
+			var buf bytes.Buffer
+			if n, err := src.Export(&buf, format, ExportOptions{}); err != nil || n != 5 {
+				t.Fatalf("Export = %d, %v, want 5 keys", n, err)
+			}
+			dst, _ := openTest(t, Options{})
+			if n, err := dst.Import(bytes.NewReader(buf.Bytes()), format, ImportOptions{BatchSize: 2}); err != nil || n != 5 {
+				t.Fatalf("Import = %d, %v, want 5 keys", n, err)
+			}
+			for _, key := range []string{"user:a", "user:b", "other"} {
+				if got, err := dst.Get(key); err != nil || string(got) != "value,\n\"of\" "+key {
+					t.Fatalf("imported %s = %q, %v", key, got, err)
+				}
+			}
+			if got, err := dst.Bucket("b").Get("k"); err != nil || string(got) != "in a bucket" {
+				t.Fatalf("imported bucket key = %q, %v", got, err)
+			}
+			if e := dst.index["user:ttl"]; e.expires != src.index["user:ttl"].expires {
+				t.Fatalf("imported expiry %d, want %d", e.expires, src.index["user:ttl"].expires)
+			}
+
+			// A prefix limits either side.
+			buf.Reset()
+			if n, err := src.Export(&buf, format, ExportOptions{Prefix: "user:"}); err != nil || n != 3 {
+				t.Fatalf("Export of user: = %d, %v, want 3 keys", n, err)
+			}
+			only, _ := openTest(t, Options{})
+			if n, err := only.Import(bytes.NewReader(buf.Bytes()), format, ImportOptions{Prefix: "user:a"}); err != nil || n != 1 {
+				t.Fatalf("Import of user:a = %d, %v, want 1 key", n, err)
+			}
+		})
+	}
+}
+
+func TestImportConflicts(t *testing.T) {
+	src, _ := openTest(t, Options{})
+	for i := 0; i < 4; i++ {
+		if err := src.Set(fmt.Sprintf("k%d", i), []byte("new")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if _, err := src.Export(&buf, FormatJSONLines, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	dst, _ := openTest(t, Options{})
+	if err := dst.Set("k2", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := dst.Import(bytes.NewReader(buf.Bytes()), FormatJSONLines, ImportOptions{OnConflict: ConflictSkip}); err != nil || n != 3 {
+		t.Fatalf("Import skipping conflicts = %d, %v, want 3 keys", n, err)
+	}
+	if got, _ := dst.Get("k2"); string(got) != "old" {
+		t.Fatalf("skipped key holds %q, want old", got)
+	}
+
+	// With ConflictError the batches before the conflict are kept and the
+	// one it is in is not.
+	fresh, _ := openTest(t, Options{})
+	if err := fresh.Set("k2", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	n, err := fresh.Import(bytes.NewReader(buf.Bytes()), FormatJSONLines, ImportOptions{OnConflict: ConflictError, BatchSize: 2})
+	if !errors.Is(err, ErrKeyExists) || n != 2 || !strings.Contains(err.Error(), `item 3: "k2"`) {
+		t.Fatalf("Import failing on conflicts = %d, %v, want 2 keys and ErrKeyExists for k2", n, err)
+	}
+	if _, err := fresh.Get("k1"); err != nil {
+		t.Fatalf("key of a committed batch = %v", err)
+	}
+	if _, err := fresh.Get("k3"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("key after the conflict = %v, want ErrKeyNotFound", err)
+	}
+
+	if n, err := dst.Import(bytes.NewReader(buf.Bytes()), FormatJSONLines, ImportOptions{}); err != nil || n != 4 {
+		t.Fatalf("Import overwriting = %d, %v, want 4 keys", n, err)
+	}
+	if got, _ := dst.Get("k2"); string(got) != "new" {
+		t.Fatalf("overwritten key holds %q, want new", got)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	for _, c := range []struct {
+		format Format
+		input  string
+		want   string
+	}{
+		{FormatJSONLines, `{"key":"a","value":"YQ=="}` + "\n{not json", "import item 2"},
+		{FormatJSONLines, `{"key":"a","value":"not base64!"}`, "import item 1"},
+		{FormatCSV, "name,data,ttl\n", "csv header"},
+		{FormatCSV, "key,value,expires\na,YQ==,yesterday\n", "import item 1"},
+		{FormatCSV, "key,value,expires\na,YQ==\n", "import item 1"},
+		{Format(9), "", "unknown format 9"},
+	} {
+		if _, err := db.Import(strings.NewReader(c.input), c.format, ImportOptions{}); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Fatalf("Import of %q as %s = %v, want an error about %s", c.input, c.format, err, c.want)
+		}
+	}
+	if _, err := db.Export(&bytes.Buffer{}, Format(9), ExportOptions{}); err == nil {
+		t.Fatal("Export in an unknown format succeeded")
+	}
+	if got := Format(9).String(); got != "unknown" {
+		t.Fatalf("Format(9) = %q, want unknown", got)
+	}
+}
@@ -0,0 +1,250 @@
+package endor
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aaydin-tr/endor/internal/fslock"
+)
+
+// fileStorage is the default Storage, a data file locked with fslock for as
+// long as it is open. Reads go through a reader sharing the lock, so they
+// neither wait for the FSLock's mutex nor conflict with its lock.
+type fileStorage struct {
+	file   *fslock.FSLock
+	reader *fslock.FSLockReader
+	// size is where the next append lands. The lock keeps other writers
+	// out, so only Append and Truncate move it.
+	size int64
+
+	// buf holds the appends WriteBufferSize keeps back, up to max bytes,
+	// which land in the file at written. Reads that reach them write them
+	// out first.
+	mu      sync.Mutex
+	buf     []byte
+	max     int
+	written atomic.Int64
+}
+
+// openFileStorage opens the data file at path, waiting for the lock until
+// ctx is done. A read-only storage is held under a shared lock.
+func openFileStorage(ctx context.Context, path string, opts Options, readOnly bool) (*fileStorage, error) {
+	var file *fslock.FSLock
+	var err error
+	if readOnly {
+		file, err = fslock.NewFSLockShared(path, readOnlyFileOptions(opts))
+	} else {
+		file, err = fslock.NewFSLockContext(ctx, path, fileOptions(opts))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newFileStorage(file, path, opts, readOnly)
+}
+
+// openReadOnlyFile opens the data file of a read-only store under a shared
+// lock. While a writer holds the file, it is read without a lock instead, as
+// it stood when opened: the way FollowWrites reads it, without following.
+func openReadOnlyFile(path string, opts Options) (Storage, error) {
+	file, err := fslock.TryLockShared(path, readOnlyFileOptions(opts))
+	if errors.Is(err, fslock.ErrLocked) || errors.Is(err, fslock.ErrAlreadyLockedInProcess) {
+		followed, err := openFollowedFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return followed, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s, err := newFileStorage(file, path, opts, true)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// newFileStorage wraps the locked data file at path.
+func newFileStorage(file *fslock.FSLock, path string, opts Options, readOnly bool) (*fileStorage, error) {
+	reader, err := file.NewReader()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		reader.Close()
+		file.Close()
+		return nil, err
+	}
+	s := &fileStorage{file: file, reader: reader, size: info.Size()}
+	s.written.Store(s.size)
+	if !readOnly {
+		s.max = opts.WriteBufferSize
+	}
+	return s, nil
+}
+
+// readOnlyFileOptions returns the options the data file of a read-only
+// store is opened with.
+func readOnlyFileOptions(opts Options) fslock.Options {
+	fileOpts := fileOptions(opts)
+	fileOpts.Mode = os.O_RDONLY
+	return fileOpts
+}
+
+// fileOptions returns the options the data file is opened with.
+func fileOptions(opts Options) fslock.Options {
+	return fslock.Options{
+		Mode:        os.O_CREATE | os.O_RDWR | os.O_APPEND,
+		MmapReads:   opts.MmapReads,
+		LockTimeout: opts.LockTimeout,
+		ReadLength:  opts.ReadLength,
+	}
+}
+
+func (s *fileStorage) Append(bufs ...[]byte) (int64, error) {
+	if s.max > 0 {
+		return s.buffer(bufs)
+	}
+	offset, n, err := s.file.WriteVectored(bufs...)
+	if err != nil {
+		return 0, err
+	}
+	s.size = offset + int64(n)
+	s.written.Store(s.size)
+	return offset, nil
+}
+
+// buffer appends bufs to the buffer, writing it out once it is full.
+func (s *fileStorage) buffer(bufs [][]byte) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offset := s.size
+	for _, b := range bufs {
+		s.buf = append(s.buf, b...)
+		s.size += int64(len(b))
+	}
+	if len(s.buf) >= s.max {
+		if err := s.flushLocked(); err != nil {
+			return 0, err
+		}
+	}
+	return offset, nil
+}
+
+// flush writes the buffer out to the file.
+func (s *fileStorage) flush() error {
+	if s.max == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flushLocked()
+}
+
+func (s *fileStorage) flushLocked() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	offset, n, err := s.file.WriteVectored(s.buf)
+	if err != nil {
+		return err
+	}
+	s.buf = s.buf[:0]
+	s.written.Store(offset + int64(n))
+	return nil
+}
+
+func (s *fileStorage) ReadAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > s.written.Load() {
+		if err := s.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return s.reader.ReadAt(p, off)
+}
+
+func (s *fileStorage) Size() (int64, error) {
+	return s.size, nil
+}
+
+func (s *fileStorage) Sync() error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+	return s.file.Flush()
+}
+
+// Truncate drops buffered appends past size without writing them out.
+func (s *fileStorage) Truncate(size int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if written := s.written.Load(); size >= written {
+		s.buf = s.buf[:size-written]
+		s.size = size
+		return nil
+	}
+	s.buf = s.buf[:0]
+	if err := s.file.Truncate(size); err != nil {
+		return err
+	}
+	s.size = size
+	s.written.Store(size)
+	return nil
+}
+
+func (s *fileStorage) Close() error {
+	return errors.Join(s.flush(), s.reader.Close(), s.file.Close())
+}
+
+func (s *fileStorage) ReadLineFrom(offset int64) ([]byte, int64, error) {
+	if err := s.flush(); err != nil {
+		return nil, offset, err
+	}
+	return s.file.ReadLineFrom(offset)
+}
+
+func (s *fileStorage) LinesFrom(offset int64, fn func(offset int64, line []byte) bool) error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+	return s.file.LinesFrom(offset, fn)
+}
+
+func (s *fileStorage) TruncateToLastLine() (int64, error) {
+	if err := s.flush(); err != nil {
+		return 0, err
+	}
+	removed, err := s.file.TruncateToLastLine()
+	if err == nil {
+		s.size -= removed
+		s.written.Store(s.size)
+	}
+	return removed, err
+}
+
+// fileBackend is the Backend of fileStorage, keeping each storage in the
+// file its name is the path of.
+type fileBackend struct {
+	opts Options
+}
+
+func (b fileBackend) Open(name string) (Storage, error) {
+	return openFileStorage(context.Background(), name, b.opts, false)
+}
+
+func (b fileBackend) Replace(from string, to string) error {
+	return fslock.Replace(from, to)
+}
+
+func (b fileBackend) Remove(name string) error {
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package endor
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// fileSize returns the size of the file at path on disk.
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestWriteBuffer(t *testing.T) {
+	db, path := openTest(t, Options{WriteBufferSize: 4 << 10, SyncPolicy: SyncNever, CheckpointInterval: -1})
+	for i := 0; i < 10; i++ {
+		if err := db.Set(fmt.Sprintf("key-%03d", i), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The writes are held back in memory, yet read back.
+	if size := fileSize(t, path); size != headerSize {
+		t.Fatalf("data file holds %d bytes with the writes buffered, want the %d of the header", size, headerSize)
+	}
+	want := make(map[string]string)
+	for i := 0; i < 10; i++ {
+		want[fmt.Sprintf("key-%03d", i)] = "value"
+	}
+	checkKeys(t, db, 10, want, "with the writes buffered")
+
+	// A full buffer is written out, and Close writes out the rest.
+	value := bytes.Repeat([]byte("v"), 5<<10)
+	if err := db.Set("key-010", value); err != nil {
+		t.Fatal(err)
+	}
+	want["key-010"] = string(value)
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := fileSize(t, path); size != stats.FileBytes {
+		t.Fatalf("data file holds %d bytes after the buffer filled, want %d", size, stats.FileBytes)
+	}
+	if err := db.Set("key-011", []byte("last")); err != nil {
+		t.Fatal(err)
+	}
+	want["key-011"] = "last"
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(path + ".checkpoint")
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	checkKeys(t, db, 12, want, "after reopen")
+}
+
+func TestWriteBufferSynced(t *testing.T) {
+	// A sync writes the buffer out first, so under SyncAlways every write
+	// is in the file once it returns.
+	db, path := openTest(t, Options{WriteBufferSize: 4 << 10})
+	if err := db.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := fileSize(t, path); size != stats.FileBytes || size == headerSize {
+		t.Fatalf("data file holds %d bytes after a synced write, want %d", size, stats.FileBytes)
+	}
+}
+
+func TestReadLength(t *testing.T) {
+	// Lines longer than ReadLength take more reads, and shorter ones
+	// read as well.
+	db, path := openTest(t, Options{ReadLength: 16})
+	want := map[string]string{"key-000": "short", "key-001": string(bytes.Repeat([]byte("long"), 1000))}
+	for key, value := range want {
+		if err := db.Set(key, []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkKeys(t, db, 2, want, "with a short ReadLength")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(path + ".checkpoint")
+	db, err := OpenWithOptions(path, Options{ReadLength: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	checkKeys(t, db, 2, want, "with a long ReadLength")
+}
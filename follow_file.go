@@ -0,0 +1,272 @@
+package endor
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/aaydin-tr/endor/internal/fslock"
+)
+
+// A read-only store opened with FollowWrites reads the data file the writer
+// appends to without locking it, and a goroutine waits for the file to
+// change and replays what was appended since into the index, the way
+// replication applies what it receives. A reader can see a record the
+// writer is still appending, so the records are only replayed up to the
+// last one that reads back whole, a batch once all of its records arrived.
+// A compaction replaces the data file and a repair cuts it short, either of
+// which has the new file loaded on the side and swapped in.
+
+// followPoll is the longest the data file goes unchecked where changes to
+// it are not reported, and how long Close may wait for the follower.
+const followPoll = 100 * time.Millisecond
+
+// followApply is how many records the follower replays under one lock.
+const followApply = 1024
+
+// followedFile is a data file read without a lock, which someone else
+// appends to.
+type followedFile struct {
+	f *os.File
+}
+
+func openFollowedFile(path string) (*followedFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &followedFile{f: f}, nil
+}
+
+func (s *followedFile) ReadAt(p []byte, off int64) (int, error) {
+	return s.f.ReadAt(p, off)
+}
+
+func (s *followedFile) Size() (int64, error) {
+	info, err := s.f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (s *followedFile) Append(bufs ...[]byte) (int64, error) {
+	return 0, ErrReadOnly
+}
+
+func (s *followedFile) Sync() error {
+	return nil
+}
+
+func (s *followedFile) Truncate(size int64) error {
+	return ErrReadOnly
+}
+
+func (s *followedFile) Close() error {
+	return s.f.Close()
+}
+
+// replaced reports whether path no longer names the file s reads.
+func (s *followedFile) replaced(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Between the writer removing and renaming it, on Windows.
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	own, err := s.f.Stat()
+	if err != nil {
+		return false, err
+	}
+	return !os.SameFile(info, own), nil
+}
+
+// startFollowingWrites starts following the writes to the data file of a
+// store opened with FollowWrites.
+func (db *DB) startFollowingWrites() error {
+	w, err := fslock.WatchFile(db.path)
+	if err != nil {
+		return err
+	}
+	db.unfollow = make(chan struct{})
+	db.unfollowed = make(chan struct{})
+	go db.followWrites(w)
+	return nil
+}
+
+// followWrites catches up with the data file whenever it changes, until
+// the store is closed.
+func (db *DB) followWrites(w *fslock.FileWatcher) {
+	defer close(db.unfollowed)
+	defer w.Close()
+	for {
+		select {
+		case <-db.unfollow:
+			return
+		default:
+		}
+		// A record that does not read back whole yet is read again once
+		// the file changes, so errors need no handling of their own.
+		db.catchUp()
+		w.Wait(followPoll)
+	}
+}
+
+// catchUp replays the records appended to the data file since it was last
+// read, or loads it again if it was replaced or cut short. Only the
+// follower changes db.file, db.format and db.size, so it reads them without
+// holding db.mu.
+func (db *DB) catchUp() error {
+	file := db.file.(*followedFile)
+	replaced, err := file.replaced(db.path)
+	if err != nil {
+		return err
+	}
+	size, err := file.Size()
+	if err != nil {
+		return err
+	}
+	if replaced || size < db.size {
+		return db.reload()
+	}
+	if size == db.size {
+		return nil
+	}
+
+	var (
+		ready    []record
+		offsets  []int64
+		batch    int
+		want     int
+		applyErr error
+	)
+	err = db.format.scan(boundedStorage{file, size}, db.size, func(offset int64, body []byte) bool {
+		r, err := db.decode(body)
+		if err != nil {
+			// Not written in full yet.
+			return false
+		}
+		if r.Batch > 0 {
+			ready, offsets, want = ready[:batch], offsets[:2*batch], r.Batch
+		}
+		ready = append(ready, r)
+		offsets = append(offsets, offset, int64(len(body))+db.format.overhead())
+		if want > 0 && len(ready)-batch < want {
+			return true
+		}
+		batch, want = len(ready), 0
+		if len(ready) >= followApply {
+			applyErr = db.applyFollowed(ready, offsets)
+			ready, offsets, batch = ready[:0], offsets[:0], 0
+		}
+		return applyErr == nil
+	})
+	if err != nil || applyErr != nil {
+		return errors.Join(err, applyErr)
+	}
+	return db.applyFollowed(ready[:batch], offsets[:2*batch])
+}
+
+// applyFollowed applies the records the follower read, which start at the
+// offsets and are of the lengths that offsets holds in pairs, and passes
+// them to watchers.
+func (db *DB) applyFollowed(records []record, offsets []int64) error {
+	if len(records) == 0 {
+		return nil
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	now := time.Now().UnixNano()
+	for i, r := range records {
+		db.apply(r, offsets[2*i], offsets[2*i+1], now)
+		db.reindex(r, now)
+	}
+	db.notify(records)
+	return nil
+}
+
+// reload loads the data file now at the path on the side and swaps it in
+// for the one the store read, telling watchers of the keys whose version
+// changed or that are gone. Iterators and streamed values still reading
+// the old file put it off until they are closed.
+func (db *DB) reload() error {
+	db.mu.RLock()
+	busy := db.iterators > 0 || db.snapshots > 0
+	db.mu.RUnlock()
+	if busy {
+		return nil
+	}
+	file, err := openFollowedFile(db.path)
+	if err != nil {
+		return err
+	}
+	fresh := &DB{path: db.path, opts: db.opts, file: file, index: make(map[string]entry), readOnly: true, recency: newRecency(db.opts.MaxBytes), opener: db.opener}
+	err = fresh.openFormat()
+	var from int64
+	if err == nil {
+		from, err = fresh.loadCheckpoint()
+	}
+	if err == nil {
+		err = fresh.load(from)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if fresh.filter.Load() == nil {
+		fresh.buildFilter()
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed || db.iterators > 0 || db.snapshots > 0 {
+		file.Close()
+		return nil
+	}
+	old, oldIndex := db.file, db.index
+	db.setFormat(fresh.format)
+	db.file, db.start, db.header = fresh.file, fresh.start, fresh.header
+	db.index, db.merges, db.history, db.expiring = fresh.index, fresh.merges, fresh.history, fresh.expiring
+	db.size, db.live, db.last, db.records = fresh.size, fresh.live, fresh.last, fresh.records
+	db.recency = fresh.recency
+	db.filter.Store(fresh.filter.Load())
+	db.cache.clear()
+	if v := fresh.version.Load(); v > 0 {
+		db.versionOf(record{Version: v})
+	}
+
+	var changed []record
+	for key := range oldIndex {
+		if _, ok := db.index[key]; !ok {
+			changed = append(changed, record{Op: opDelete, Key: key})
+		}
+	}
+	for key, e := range db.index {
+		if was, ok := oldIndex[key]; ok && was.version == e.version {
+			continue
+		}
+		r, err := db.readLive(key, e)
+		if err != nil {
+			return errors.Join(err, old.Close())
+		}
+		changed = append(changed, r)
+	}
+	for name, s := range db.indexes {
+		fresh := newSecondary(s.extract)
+		for key, e := range db.index {
+			r, err := db.readLive(key, e)
+			if err != nil {
+				return errors.Join(err, old.Close())
+			}
+			fresh.set(key, s.extract(r.Value))
+		}
+		db.indexes[name] = fresh
+	}
+	db.notify(changed)
+	return old.Close()
+}
@@ -0,0 +1,177 @@
+package endor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openFollower opens the store at path read-only, following the writes of
+// the process holding it.
+func openFollower(t *testing.T, path string) *DB {
+	t.Helper()
+	db, err := OpenReadOnly(path, Options{FollowWrites: true, SweepInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestFollowWrites(t *testing.T) {
+	for _, binary := range []bool{false, true} {
+		t.Run(fmt.Sprintf("binary=%v", binary), func(t *testing.T) {
+			writer, path := openTest(t, Options{BinaryRecords: binary, CheckpointInterval: -1})
+			if err := writer.Set("key-000", []byte("before")); err != nil {
+				t.Fatal(err)
+			}
+			reader := openFollower(t, path)
+			events, cancel := reader.Watch("")
+			defer cancel()
+
+			// Appends are replayed into the index as they arrive and
+			// passed to watchers in order.
+			if err := writer.Set("key-001", []byte("1")); err != nil {
+				t.Fatal(err)
+			}
+			var b WriteBatch
+			b.Set("key-002", []byte("2"))
+			b.Delete("key-000")
+			if err := writer.Write(&b); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range []string{"set key-001", "set key-002", "delete key-000"} {
+				if ev := receive(t, events); fmt.Sprintf("%v %s", ev.Type, ev.Key) != want {
+					t.Fatalf("event %v %s, want %s", ev.Type, ev.Key, want)
+				}
+			}
+			want := map[string]string{"key-001": "1", "key-002": "2"}
+			if !replicated(reader, 4, want) {
+				t.Fatal("reader does not hold what the writer wrote")
+			}
+			if err := reader.Set("key-003", []byte("3")); !errors.Is(err, ErrReadOnly) {
+				t.Fatalf("Set on a follower = %v, want ErrReadOnly", err)
+			}
+
+			// A compaction replaces the data file, which is loaded again;
+			// only keys that changed meanwhile reach watchers.
+			if err := writer.Set("key-001", []byte("one")); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.Compact(); err != nil {
+				t.Fatal(err)
+			}
+			want["key-001"] = "one"
+			eventually(t, "follower caught up with the compaction", func() bool { return replicated(reader, 4, want) })
+			if ev := receive(t, events); ev.Type != EventSet || ev.Key != "key-001" || string(ev.Value) != "one" {
+				t.Fatalf("event %v %s=%s after compaction, want the set of key-001", ev.Type, ev.Key, ev.Value)
+			}
+			eventually(t, "follower read the compacted file", func() bool {
+				stats, err := reader.Stats()
+				return err == nil && stats.DeadRecords == 0
+			})
+			if err := writer.Set("key-003", []byte("3")); err != nil {
+				t.Fatal(err)
+			}
+			want["key-003"] = "3"
+			eventually(t, "follower saw a write after the compaction", func() bool { return replicated(reader, 4, want) })
+			if ev := receive(t, events); ev.Key != "key-003" {
+				t.Fatalf("event %v %s, want the set of key-003", ev.Type, ev.Key)
+			}
+		})
+	}
+}
+
+func TestFollowWritesCutShort(t *testing.T) {
+	writer, path := openTest(t, Options{CheckpointInterval: -1})
+	for _, key := range []string{"key-000", "key-001"} {
+		if err := writer.Set(key, []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	last := writer.index["key-001"]
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reader := openFollower(t, path)
+	events, cancel := reader.Watch("")
+	defer cancel()
+
+	// A data file cut short, as a repair does, is read again and watchers
+	// are told of the keys that went.
+	if err := os.Truncate(path, last.offset); err != nil {
+		t.Fatal(err)
+	}
+	if ev := receive(t, events); ev.Type != EventDelete || ev.Key != "key-001" {
+		t.Fatalf("event %v %s, want the delete of key-001", ev.Type, ev.Key)
+	}
+	if !replicated(reader, 2, map[string]string{"key-000": "v"}) {
+		t.Fatal("reader does not hold what is left of the file")
+	}
+}
+
+func TestFollowWritesPartialRecord(t *testing.T) {
+	// Take a whole record from another store to append a piece at a time.
+	donor, donorPath := openTest(t, Options{})
+	if err := donor.Set("key-001", []byte("arrives late")); err != nil {
+		t.Fatal(err)
+	}
+	e := donor.index["key-001"]
+	donor.Close()
+	data, err := os.ReadFile(donorPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := data[e.offset : e.offset+e.length]
+
+	writer, path := openTest(t, Options{})
+	if err := writer.Set("key-000", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+	reader := openFollower(t, path)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// A record the writer is still appending is not replayed until it
+	// reads back whole.
+	if _, err := f.Write(line[:len(line)/2]); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(3 * followPoll)
+	if _, err := reader.Get("key-001"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get of a record half appended = %v, want ErrKeyNotFound", err)
+	}
+	if _, err := f.Write(line[len(line)/2:]); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "follower replayed the finished record", func() bool {
+		got, err := reader.Get("key-001")
+		return err == nil && string(got) == "arrives late"
+	})
+}
+
+func TestFollowWritesNeedsDataFile(t *testing.T) {
+	db, path := openTest(t, Options{})
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for name, opts := range map[string]Options{
+		"storage":  {FollowWrites: true, Storage: newTestBackend()},
+		"segments": {FollowWrites: true, SegmentSize: 1 << 10},
+	} {
+		db, err := OpenReadOnly(path, opts)
+		if err == nil {
+			db.Close()
+		}
+		if err == nil || !strings.Contains(err.Error(), "FollowWrites needs a data file") {
+			t.Fatalf("%s: OpenReadOnly with FollowWrites = %v, want it turned down", name, err)
+		}
+	}
+}
@@ -0,0 +1,506 @@
+package endor
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// The records of a data file are laid out in one of two formats, fixed for
+// the life of the file. Lines, the original one, are text: the checksum and
+// JSON of a record on a line of its own, see record. Binary records are
+// frames
+//
+//	length u32 | body | length u32
+//
+// whose body is
+//
+//	crc32c(rest of body) u32 | meta length u32 | meta | value
+//
+// where meta is the JSON of the record without its value, which follows as
+// is. Values then take no more room than their length and every record
+// reads back with reads of exactly its size. The length is repeated after
+// the body so Open can tell an intact last frame from a torn one without
+// reading the file from the start. Integers are big endian.
+//
+// A data file starts with a header naming the format and the store:
+//
+//	"endor" | format version u8 | header size u16 | created i64 | id [16]
+//
+// where created is the Unix time in nanoseconds the store was created at
+// and id its UUID. The header size lets later headers grow; Open reads what
+// it knows of one and starts the records past it. Headers written before
+// the creation time and ID were added end after the header size. Files
+// without a header hold lines, as every file did before the header was
+// introduced. A line starts with a hex digit or a brace, never with the
+// magic, and a file starting with neither is not a data file at all.
+
+const (
+	headerMagic = "endor"
+	headerSize  = 32
+	// shortHeader is the size of the headers without creation time and
+	// ID.
+	shortHeader = 8
+
+	// Format versions, as found in the header.
+	formatLines  byte = 1
+	formatBinary byte = 2
+
+	frameOverhead = 8
+)
+
+// errBadFrame is what readFrame returns for a frame cut short or whose
+// lengths disagree, after which the frames that follow can not be found.
+var errBadFrame = errors.New("bad frame")
+
+// recordFormat reads and writes the records of a data file in one format.
+// A body is a record as the format stores it, less the framing that
+// separates it from the next one: frame returns the buffers to append for
+// a body and overhead the bytes they add to it.
+type recordFormat interface {
+	version() byte
+	marshal(r record) ([]byte, error)
+	unmarshal(body []byte) (record, error)
+	frame(body []byte) [][]byte
+	overhead() int64
+
+	// readAt returns the body of the record at offset and the offset of
+	// the next one, or io.EOF at the end of s.
+	readAt(s Storage, offset int64) ([]byte, int64, error)
+
+	// scan calls fn for the body of every record of s from offset on,
+	// stopping early when fn returns false. A damaged tail is handed to
+	// fn as one body, which fails to unmarshal.
+	scan(s Storage, offset int64, fn func(offset int64, body []byte) bool) error
+
+	// read returns the body of the next record of a stream of them.
+	read(r *bufio.Reader) ([]byte, error)
+
+	// truncateTorn cuts a torn last record, whose append a crash cut
+	// short, off the records of s starting at start.
+	truncateTorn(s Storage, start int64) error
+}
+
+// formatFor returns the format new data files are written in with opts.
+func formatFor(opts Options) recordFormat {
+	if opts.BinaryRecords {
+		return binaryFormat{}
+	}
+	return lineFormat{}
+}
+
+func formatOf(version byte) (recordFormat, error) {
+	switch version {
+	case formatLines:
+		return lineFormat{}, nil
+	case formatBinary:
+		return binaryFormat{}, nil
+	}
+	return nil, fmt.Errorf("endor: unknown format version %d", version)
+}
+
+// FileHeader describes the data file of a store, as read from its header.
+type FileHeader struct {
+	// Version is the format version of the records: 1 for lines and 2
+	// for binary records.
+	Version int
+	// Created is when the store was created.
+	Created time.Time
+	// ID is the UUID the store was given when it was created. Compaction
+	// keeps it, and backups and followers of the store carry it too.
+	ID string
+}
+
+// Header returns the header of the data file. A data file written before
+// headers recorded the creation time and ID has neither, until it is
+// compacted and given new ones.
+func (db *DB) Header() FileHeader {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	h := FileHeader{Version: int(db.format.version())}
+	if db.header.id != ([16]byte{}) {
+		h.Created = time.Unix(0, db.header.created)
+		id := hex.EncodeToString(db.header.id[:])
+		h.ID = id[:8] + "-" + id[8:12] + "-" + id[12:16] + "-" + id[16:20] + "-" + id[20:]
+	}
+	return h
+}
+
+// fileHeader is what a header records besides the format. A zero one is
+// that of a data file that predates it.
+type fileHeader struct {
+	created int64
+	id      [16]byte
+}
+
+// newFileHeader returns the header of a store created now, with a random
+// UUID.
+func newFileHeader() (fileHeader, error) {
+	h := fileHeader{created: time.Now().UnixNano()}
+	if _, err := rand.Read(h.id[:]); err != nil {
+		return fileHeader{}, err
+	}
+	h.id[6] = h.id[6]&0x0f | 0x40
+	h.id[8] = h.id[8]&0x3f | 0x80
+	return h, nil
+}
+
+// orNew returns h, or a new header if h predates headers.
+func (h fileHeader) orNew() (fileHeader, error) {
+	if h.id != ([16]byte{}) {
+		return h, nil
+	}
+	return newFileHeader()
+}
+
+// readHeader returns the format of the data file in s, the offset its
+// first record starts at and its header.
+func readHeader(s Storage) (recordFormat, int64, fileHeader, error) {
+	size, err := s.Size()
+	if err != nil {
+		return nil, 0, fileHeader{}, err
+	}
+	buf := make([]byte, headerSize)
+	n, err := s.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return nil, 0, fileHeader{}, err
+	}
+	buf = buf[:n]
+	if !bytes.HasPrefix(buf, []byte(headerMagic)) {
+		if n > 0 && !startsLine(buf) {
+			return nil, 0, fileHeader{}, ErrNotDataFile
+		}
+		return lineFormat{}, 0, fileHeader{}, nil
+	}
+	f, start, h, err := parseHeader(buf)
+	if err == nil && start > size {
+		err = errors.New("endor: truncated header")
+	}
+	return f, start, h, err
+}
+
+// parseHeader parses the header at the start of buf, which holds all of it
+// or at least as much of it as is known.
+func parseHeader(buf []byte) (recordFormat, int64, fileHeader, error) {
+	if len(buf) < shortHeader {
+		return nil, 0, fileHeader{}, errors.New("endor: truncated header")
+	}
+	f, err := formatOf(buf[len(headerMagic)])
+	if err != nil {
+		return nil, 0, fileHeader{}, err
+	}
+	var h fileHeader
+	switch size := int(binary.BigEndian.Uint16(buf[6:])); {
+	case size < shortHeader:
+		return nil, 0, fileHeader{}, fmt.Errorf("endor: bad header size %d", size)
+	case size >= headerSize && len(buf) < headerSize:
+		return nil, 0, fileHeader{}, errors.New("endor: truncated header")
+	case size >= headerSize:
+		h.created = int64(binary.BigEndian.Uint64(buf[8:]))
+		copy(h.id[:], buf[16:headerSize])
+	}
+	return f, int64(binary.BigEndian.Uint16(buf[6:])), h, nil
+}
+
+// startsLine reports whether p, the start of a file without a header,
+// starts like a line: with a brace, or a hex checksum and a space.
+func startsLine(p []byte) bool {
+	if p[0] == '{' {
+		return true
+	}
+	for i, c := range p {
+		if i == checksumSize {
+			return c == ' '
+		}
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// writeHeader starts the empty storage s with a header for records in
+// format f and returns its size.
+func writeHeader(s Storage, f recordFormat, h fileHeader) (int64, error) {
+	buf := make([]byte, headerSize)
+	copy(buf, headerMagic)
+	buf[len(headerMagic)] = f.version()
+	binary.BigEndian.PutUint16(buf[6:], headerSize)
+	binary.BigEndian.PutUint64(buf[8:], uint64(h.created))
+	copy(buf[16:], h.id[:])
+	if _, err := s.Append(buf); err != nil {
+		return 0, err
+	}
+	return headerSize, nil
+}
+
+// copyHeader reads the header a stream of the data file starts with.
+func copyHeader(r io.Reader) ([]byte, error) {
+	header := make([]byte, shortHeader)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:len(headerMagic)]) != headerMagic {
+		return nil, errors.New("endor: missing header")
+	}
+	if size := int(binary.BigEndian.Uint16(header[6:])); size > shortHeader {
+		header = append(header, make([]byte, size-shortHeader)...)
+		if _, err := io.ReadFull(r, header[shortHeader:]); err != nil {
+			return nil, err
+		}
+	}
+	return header, nil
+}
+
+// lineFormat is the line format, see record.
+type lineFormat struct{}
+
+func (lineFormat) version() byte { return formatLines }
+
+func (lineFormat) marshal(r record) ([]byte, error) { return encodeRecord(r) }
+
+func (lineFormat) unmarshal(body []byte) (record, error) { return decodeRecord(body) }
+
+func (lineFormat) frame(body []byte) [][]byte { return [][]byte{body, newline} }
+
+func (lineFormat) overhead() int64 { return 1 }
+
+func (lineFormat) readAt(s Storage, offset int64) ([]byte, int64, error) {
+	return readLineFrom(s, offset)
+}
+
+func (lineFormat) scan(s Storage, offset int64, fn func(offset int64, body []byte) bool) error {
+	return linesFrom(s, offset, fn)
+}
+
+func (lineFormat) read(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	return line[:len(line)-1], nil
+}
+
+func (lineFormat) truncateTorn(s Storage, start int64) error {
+	_, err := truncateToLastLine(s, start)
+	return err
+}
+
+var newline = []byte{'\n'}
+
+// binaryFormat is the binary format.
+type binaryFormat struct{}
+
+func (binaryFormat) version() byte { return formatBinary }
+
+func (f binaryFormat) marshal(r record) ([]byte, error) {
+	body, err := f.head(r, len(r.Value))
+	if err != nil {
+		return nil, err
+	}
+	body = append(body, r.Value...)
+	binary.BigEndian.PutUint32(body, crc32.Checksum(body[4:], crcTable))
+	return body, nil
+}
+
+// head returns the start of the body of r, up to where its value starts,
+// with room for a value of n bytes after it and the checksum left zero.
+func (binaryFormat) head(r record, n int) ([]byte, error) {
+	r.Value = nil
+	meta, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, 8+len(meta), 8+len(meta)+n)
+	binary.BigEndian.PutUint32(head[4:], uint32(len(meta)))
+	copy(head[8:], meta)
+	return head, nil
+}
+
+// readHead reads the record at offset, framed in length bytes, without its
+// value. It returns the record, the offset and size of the value, the
+// checksum of the body up to the value and the checksum the whole body
+// has to have.
+func (binaryFormat) readHead(s Storage, offset int64, length int64) (r record, at int64, n int64, sum uint32, want uint32, err error) {
+	var buf [12]byte
+	if _, err := s.ReadAt(buf[:], offset); err != nil && err != io.EOF {
+		return record{}, 0, 0, 0, 0, err
+	}
+	body := int64(binary.BigEndian.Uint32(buf[:]))
+	metaLen := int64(binary.BigEndian.Uint32(buf[8:]))
+	if body+frameOverhead != length || metaLen > body-8 {
+		return record{}, 0, 0, 0, 0, fmt.Errorf("%w: bad frame at offset %d", ErrCorrupt, offset)
+	}
+	meta := make([]byte, metaLen)
+	if _, err := s.ReadAt(meta, offset+12); err != nil && err != io.EOF {
+		return record{}, 0, 0, 0, 0, err
+	}
+	if err := json.Unmarshal(meta, &r); err != nil {
+		return record{}, 0, 0, 0, 0, fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+	sum = crc32.Update(crc32.Checksum(buf[8:], crcTable), crcTable, meta)
+	return r, offset + 12 + metaLen, body - 8 - metaLen, sum, binary.BigEndian.Uint32(buf[4:]), nil
+}
+
+func (binaryFormat) unmarshal(body []byte) (record, error) {
+	if len(body) < 8 {
+		return record{}, fmt.Errorf("%w: short record", ErrCorrupt)
+	}
+	if crc32.Checksum(body[4:], crcTable) != binary.BigEndian.Uint32(body) {
+		return record{}, fmt.Errorf("%w: %w", ErrCorrupt, ErrChecksumMismatch)
+	}
+	n := binary.BigEndian.Uint32(body[4:])
+	if int64(n) > int64(len(body)-8) {
+		return record{}, fmt.Errorf("%w: meta overruns record", ErrCorrupt)
+	}
+	var r record
+	if err := json.Unmarshal(body[8:8+n], &r); err != nil {
+		return record{}, fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+	if value := body[8+n:]; len(value) > 0 {
+		r.Value = value
+	}
+	return r, nil
+}
+
+func (binaryFormat) frame(body []byte) [][]byte {
+	lengths := make([]byte, 8)
+	binary.BigEndian.PutUint32(lengths, uint32(len(body)))
+	binary.BigEndian.PutUint32(lengths[4:], uint32(len(body)))
+	return [][]byte{lengths[:4], body, lengths[4:]}
+}
+
+func (binaryFormat) overhead() int64 { return frameOverhead }
+
+func (binaryFormat) readAt(s Storage, offset int64) ([]byte, int64, error) {
+	size, err := s.Size()
+	if err != nil {
+		return nil, offset, err
+	}
+	if offset >= size {
+		return nil, offset, io.EOF
+	}
+	body, err := readFrame(io.NewSectionReader(s, offset, size-offset), size-offset)
+	if err != nil {
+		return nil, offset, fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+	return body, offset + int64(len(body)) + frameOverhead, nil
+}
+
+func (binaryFormat) scan(s Storage, offset int64, fn func(offset int64, body []byte) bool) error {
+	size, err := s.Size()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReaderSize(io.NewSectionReader(s, offset, size-offset), readChunk)
+	for offset < size {
+		body, err := readFrame(r, size-offset)
+		if err == errBadFrame {
+			tail := make([]byte, size-offset)
+			if _, err := s.ReadAt(tail, offset); err != nil && err != io.EOF {
+				return err
+			}
+			fn(offset, tail)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !fn(offset, body) {
+			return nil
+		}
+		offset += int64(len(body)) + frameOverhead
+	}
+	return nil
+}
+
+func (binaryFormat) read(r *bufio.Reader) ([]byte, error) {
+	return readFrame(r, -1)
+}
+
+// truncateTorn checks the last frame through the length it ends with and
+// only walks the frames from start when that does not add up. The walk
+// stops at a frame that runs past the end, which is cut off, or at one
+// whose lengths disagree, which is left for load to report since frames
+// follow it.
+func (binaryFormat) truncateTorn(s Storage, start int64) error {
+	size, err := s.Size()
+	if err != nil || size == start {
+		return err
+	}
+	buf := make([]byte, 4)
+	lengthAt := func(offset int64) (int64, error) {
+		if _, err := s.ReadAt(buf, offset); err != nil && err != io.EOF {
+			return 0, err
+		}
+		return int64(binary.BigEndian.Uint32(buf)), nil
+	}
+	if size-start >= frameOverhead {
+		n, err := lengthAt(size - 4)
+		if err != nil {
+			return err
+		}
+		if first := size - n - frameOverhead; first >= start {
+			m, err := lengthAt(first)
+			if err != nil || m == n {
+				return err
+			}
+		}
+	}
+	for offset := start; offset < size; {
+		if size-offset < frameOverhead {
+			return s.Truncate(offset)
+		}
+		n, err := lengthAt(offset)
+		if err != nil {
+			return err
+		}
+		end := offset + n + frameOverhead
+		if end > size {
+			return s.Truncate(offset)
+		}
+		m, err := lengthAt(end - 4)
+		if err != nil || m != n {
+			return err
+		}
+		offset = end
+	}
+	return nil
+}
+
+// readFrame reads a frame from r and returns its body. A limit of zero or
+// more is how many bytes r has left, so a damaged length is caught before
+// it is allocated. It returns io.EOF when r ends before the frame starts
+// and errBadFrame when it ends inside it.
+func readFrame(r io.Reader, limit int64) ([]byte, error) {
+	var lengths [4]byte
+	if _, err := io.ReadFull(r, lengths[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errBadFrame
+		}
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(lengths[:])
+	if limit >= 0 && int64(n)+frameOverhead > limit {
+		return nil, errBadFrame
+	}
+	body := make([]byte, int(n)+4)
+	if _, err := io.ReadFull(r, body); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errBadFrame
+		}
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(body[n:]) != n {
+		return nil, errBadFrame
+	}
+	return body[:n:n], nil
+}
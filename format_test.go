@@ -0,0 +1,327 @@
+package endor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestHeaderWithNewlinesKeptOnOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	header := make([]byte, headerSize)
+	copy(header, headerMagic)
+	header[len(headerMagic)] = lineFormat{}.version()
+	binary.BigEndian.PutUint16(header[6:], headerSize)
+	binary.BigEndian.PutUint64(header[8:], 1)
+	copy(header[16:], bytes.Repeat([]byte{'\n', 0x7f}, 8))
+	if err := os.WriteFile(path, header, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		db, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Set("key", []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, header) {
+		t.Fatalf("header changed to %q", data[:headerSize])
+	}
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got, err := db.Get("key"); err != nil || string(got) != "value" {
+		t.Fatalf("Get = %q, %v", got, err)
+	}
+}
+
+func TestTornFirstLineCutBackToHeader(t *testing.T) {
+	db, path := openTest(t, Options{})
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`0000 {"k":"torn`)
+	f.Close()
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if stats, err := db.Stats(); err != nil || stats.FileBytes != headerSize {
+		t.Fatalf("file is %d bytes after open, want %d (%v)", stats.FileBytes, headerSize, err)
+	}
+}
+
+func TestBinaryRecords(t *testing.T) {
+	db, path := openTest(t, Options{BinaryRecords: true})
+	if header := db.Header(); header.Version != int(formatBinary) {
+		t.Fatalf("new store has format %d, want %d", header.Version, formatBinary)
+	}
+	// Values are stored as they are, newlines and all.
+	value := []byte("raw\n\x00\xffvalue")
+	if err := db.Set("a", value); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set("b", []byte("value of b")); err != nil {
+		t.Fatal(err)
+	}
+	a, b := db.index["a"], db.index["b"]
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data[a.offset:a.offset+a.length], value) {
+		t.Fatal("value of a not stored as is")
+	}
+	if n := binary.BigEndian.Uint32(data[b.offset:]); int64(n)+frameOverhead != b.length || b.offset+b.length != int64(len(data)) {
+		t.Fatalf("frame of b at %d is %d bytes, want %d ending the file", b.offset, n, b.length-frameOverhead)
+	}
+
+	// A frame torn by a crash is cut off on open, by replay and from the
+	// checkpoint alike.
+	for _, replay := range []bool{false, true} {
+		torn := append(append([]byte(nil), data...), data[b.offset:b.offset+b.length-3]...)
+		if err := os.WriteFile(path, torn, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if replay {
+			if err := os.Remove(path + ".checkpoint"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		db, err := Open(path)
+		if err != nil {
+			t.Fatalf("replay %v: Open with a torn frame = %v", replay, err)
+		}
+		if stats, err := db.Stats(); err != nil || stats.FileBytes != int64(len(data)) {
+			t.Fatalf("replay %v: file is %d bytes after open, want %d (%v)", replay, stats.FileBytes, len(data), err)
+		}
+		if got, err := db.Get("a"); err != nil || !bytes.Equal(got, value) {
+			t.Fatalf("replay %v: Get a = %q, %v", replay, got, err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A damaged value fails its checksum.
+	corruptAt(t, path, a.offset+a.length-6)
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Get("a"); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Get of a damaged value = %v, want ErrCorrupt", err)
+	}
+	if got, err := db.Get("b"); err != nil || string(got) != "value of b" {
+		t.Fatalf("Get b = %q, %v", got, err)
+	}
+}
+
+func TestBinaryRecordsMigrateOnCompact(t *testing.T) {
+	db, path := openTest(t, Options{})
+	if err := db.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// An existing file of lines keeps its format until it is compacted.
+	db, err := OpenWithOptions(path, Options{BinaryRecords: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set("b", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if header := db.Header(); header.Version != int(formatLines) {
+		t.Fatalf("format %d before compaction, want %d", header.Version, formatLines)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if header := db.Header(); header.Version != int(formatBinary) {
+		t.Fatalf("format %d after compaction, want %d", header.Version, formatBinary)
+	}
+	for key, want := range map[string]string{"a": "1", "b": "2"} {
+		if got, err := db.Get(key); err != nil || string(got) != want {
+			t.Fatalf("after compaction: Get %s = %q, %v, want %q", key, got, err, want)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Opened without BinaryRecords, the file stays binary until the next
+	// compaction turns it back into lines.
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Set("c", []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	if header := db.Header(); header.Version != int(formatBinary) {
+		t.Fatalf("format %d after reopen, want %d", header.Version, formatBinary)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if header := db.Header(); header.Version != int(formatLines) {
+		t.Fatalf("format %d after compacting without BinaryRecords, want %d", header.Version, formatLines)
+	}
+	for key, want := range map[string]string{"a": "1", "b": "2", "c": "3"} {
+		if got, err := db.Get(key); err != nil || string(got) != want {
+			t.Fatalf("after compacting back: Get %s = %q, %v, want %q", key, got, err, want)
+		}
+	}
+}
+
+func TestFileHeader(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	before := time.Now()
+	db, path := openTest(t, Options{})
+	header := db.Header()
+	if header.Version != int(formatLines) || !uuid.MatchString(header.ID) {
+		t.Fatalf("new store has header %+v, want format %d and a UUID", header, formatLines)
+	}
+	if header.Created.Before(before) || header.Created.After(time.Now()) {
+		t.Fatalf("new store created at %v, want between %v and now", header.Created, before)
+	}
+	other, _ := openTest(t, Options{})
+	if other.Header().ID == header.ID {
+		t.Fatalf("two stores share the ID %s", header.ID)
+	}
+
+	// Compaction, reopening and backups keep the header.
+	if err := db.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if got := db.Header(); got != header {
+		t.Fatalf("header after Compact = %+v, want %+v", got, header)
+	}
+	backup := filepath.Join(t.TempDir(), "backup.db")
+	if err := db.BackupTo(backup); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := db.Header(); got != header {
+		t.Fatalf("header after reopen = %+v, want %+v", got, header)
+	}
+	db.Close()
+	restored, err := OpenFromBackup(backup, filepath.Join(t.TempDir(), "restored.db"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	if got := restored.Header(); got.ID != header.ID {
+		t.Fatalf("store restored from a backup has ID %s, want %s", got.ID, header.ID)
+	}
+}
+
+func TestOlderHeaders(t *testing.T) {
+	db, path := openTest(t, Options{})
+	if err := db.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := data[headerSize:]
+	short := make([]byte, shortHeader)
+	copy(short, headerMagic)
+	short[len(headerMagic)] = formatLines
+	binary.BigEndian.PutUint16(short[6:], shortHeader)
+
+	// Files with a header from before creation times and IDs, and files
+	// from before headers, read back without either until compacted.
+	for name, start := range map[string][]byte{"short header": short, "no header": nil} {
+		if err := os.WriteFile(path, append(append([]byte(nil), start...), records...), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(path + ".checkpoint")
+		db, err := Open(path)
+		if err != nil {
+			t.Fatalf("%s: Open = %v", name, err)
+		}
+		if header := db.Header(); header.Version != int(formatLines) || header.ID != "" || !header.Created.IsZero() {
+			t.Fatalf("%s: header %+v, want lines without an ID", name, header)
+		}
+		if got, err := db.Get("a"); err != nil || string(got) != "1" {
+			t.Fatalf("%s: Get = %q, %v", name, got, err)
+		}
+		if err := db.Compact(); err != nil {
+			t.Fatal(err)
+		}
+		if header := db.Header(); header.ID == "" || header.Created.IsZero() {
+			t.Fatalf("%s: header after Compact %+v, want a new ID", name, header)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBadHeaders(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"not a data file": []byte("hello, world\n"),
+		"unknown format":  []byte(headerMagic + "\x09\x00\x08"),
+		"truncated":       []byte(headerMagic + "\x01"),
+		"bad size":        []byte(headerMagic + "\x01\x00\x02"),
+		"cut short":       []byte(headerMagic + "\x01\x00\x20\x00"),
+	} {
+		path := filepath.Join(t.TempDir(), "test.db")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		db, err := Open(path)
+		if err == nil {
+			db.Close()
+			t.Fatalf("%s: Open succeeded", name)
+		}
+		if name == "not a data file" && !errors.Is(err, ErrNotDataFile) {
+			t.Fatalf("%s: Open = %v, want ErrNotDataFile", name, err)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package endor
+
+import (
+	"math"
+	"time"
+)
+
+// History keeps the last HistoryVersions states of every key next to its
+// current one, as records of the data file that no longer count as dead.
+// A state starts with the write that set or deleted the key, and the time
+// it started is the version of that write, which is its wall clock time
+// unless the clock went back. Merges add to the state they were merged
+// into rather than starting one.
+
+// revision is a past state of a key: the entry it was set to along with the
+// operands merged into it, or a delete.
+type revision struct {
+	entry
+	merges  []entry
+	deleted bool
+}
+
+// Revision is one state of a key returned by History.
+type Revision struct {
+	// Time is when the write that started the revision was made.
+	Time time.Time
+	// Value is the value the key had, nil for a delete.
+	Value   []byte
+	Deleted bool
+	// Expires is when the value expires, zero for one without a TTL.
+	Expires time.Time
+}
+
+func (db *DB) keepsHistory() bool {
+	return db.opts.HistoryVersions > 0
+}
+
+// retire takes the current state of key out of the live records, keeping
+// it as a revision when history is on. The caller replaces or removes the
+// index entry.
+func (db *DB) retire(key string) {
+	old, ok := db.index[key]
+	merges := db.merges[key]
+	delete(db.merges, key)
+	if !ok {
+		return
+	}
+	if db.keepsHistory() {
+		db.keep(key, revision{entry: old, merges: merges})
+		return
+	}
+	db.live -= old.length
+	for _, m := range merges {
+		db.live -= m.length
+	}
+}
+
+// keep adds rev as the latest revision of key, dropping the oldest one past
+// HistoryVersions.
+func (db *DB) keep(key string, rev revision) {
+	if db.history == nil {
+		db.history = make(map[string][]revision)
+	}
+	revs := append(db.history[key], rev)
+	for len(revs) > db.opts.HistoryVersions {
+		db.live -= revs[0].length
+		for _, m := range revs[0].merges {
+			db.live -= m.length
+		}
+		revs = revs[1:]
+	}
+	db.history[key] = revs
+}
+
+// readRevision returns the record rev stands for, merged up to version at,
+// with the version it started at.
+func (db *DB) readRevision(key string, rev revision, at uint64) (record, error) {
+	if rev.deleted {
+		return record{Op: opDelete, Key: key, Version: rev.version}, nil
+	}
+	r, err := db.readMerged(key, rev.entry, rev.merges, at)
+	if err == nil && r.Version == 0 {
+		// A record from before versions started with its key.
+		r.Version = rev.version
+	}
+	return r, err
+}
+
+// revisions returns the states of key, newest first: the current one, if
+// the key is in the index, followed by the kept revisions.
+func (db *DB) revisions(key string) []revision {
+	revs := db.history[key]
+	all := make([]revision, 0, len(revs)+1)
+	if e, ok := db.index[key]; ok {
+		all = append(all, revision{entry: e, merges: db.merges[key]})
+	}
+	for i := len(revs) - 1; i >= 0; i-- {
+		all = append(all, revs[i])
+	}
+	return all
+}
+
+// GetAt returns the value key had at t, or ErrKeyNotFound if it was not set,
+// deleted or expired then. Only the current state and the HistoryVersions
+// before it are known, so a t before all of them finds nothing either.
+func (db *DB) GetAt(key string, t time.Time) ([]byte, error) {
+	at := uint64(0)
+	if t.UnixNano() > 0 {
+		at = uint64(t.UnixNano())
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	for _, rev := range db.revisions(key) {
+		r, err := db.readRevision(key, rev, at)
+		if err != nil {
+			return nil, err
+		}
+		if r.Version > at {
+			continue
+		}
+		if r.Op == opDelete || r.expired(t.UnixNano()) {
+			return nil, ErrKeyNotFound
+		}
+		return r.Value, nil
+	}
+	return nil, ErrKeyNotFound
+}
+
+// History returns up to limit states of key, newest first, starting with
+// the current one, or all of them for a limit of zero. A key whose current
+// state is a delete or that expired still lists its revisions. Without
+// HistoryVersions only the current state is known.
+func (db *DB) History(key string, limit int) ([]Revision, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	revs := db.revisions(key)
+	if limit > 0 && len(revs) > limit {
+		revs = revs[:limit]
+	}
+	out := make([]Revision, 0, len(revs))
+	for _, rev := range revs {
+		r, err := db.readRevision(key, rev, math.MaxUint64)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, revisionOf(r))
+	}
+	return out, nil
+}
+
+func revisionOf(r record) Revision {
+	rev := Revision{Time: time.Unix(0, int64(r.Version)), Deleted: r.Op == opDelete}
+	if !rev.Deleted {
+		rev.Value = r.Value
+	}
+	if r.Expires != 0 {
+		rev.Expires = time.Unix(0, r.Expires)
+	}
+	return rev
+}
+
+// copyState appends the records of rev to out, the value it was set to
+// followed by the operands merged into it, or its delete, each keeping its
+// version, and returns rev as it is kept for out.
+func (db *DB) copyState(key string, rev revision, out Storage, c *compacted) (revision, error) {
+	var records []record
+	switch {
+	case rev.deleted:
+		records = append(records, record{Op: opDelete, Key: key, Version: rev.version})
+	case rev.offset >= 0:
+		r, err := db.readRecord(rev.offset)
+		if err != nil {
+			return revision{}, err
+		}
+		if r.Version == 0 && len(rev.merges) == 0 {
+			r.Version = rev.version
+		}
+		records = append(records, r)
+	}
+	for _, m := range rev.merges {
+		r, err := db.readRecord(m.offset)
+		if err != nil {
+			return revision{}, err
+		}
+		records = append(records, r)
+	}
+
+	copied := revision{entry: entry{offset: -1, expires: rev.expires, version: rev.version}, deleted: rev.deleted}
+	for i, r := range records {
+		e, err := c.append(db, out, r)
+		if err != nil {
+			return revision{}, err
+		}
+		if i == 0 && rev.offset >= 0 {
+			copied.offset, copied.length = e.offset, e.length
+		} else {
+			copied.merges = append(copied.merges, e)
+		}
+	}
+	return copied, nil
+}
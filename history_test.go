@@ -0,0 +1,127 @@
+package endor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// revisionsOf formats up to limit states of key, newest first, as their
+// values or "deleted".
+func revisionsOf(t *testing.T, db *DB, key string, limit int) string {
+	t.Helper()
+	revs, err := db.History(key, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var states []string
+	for _, rev := range revs {
+		if rev.Deleted {
+			states = append(states, "deleted")
+		} else {
+			states = append(states, string(rev.Value))
+		}
+	}
+	return fmt.Sprint(states)
+}
+
+func TestHistory(t *testing.T) {
+	opts := Options{HistoryVersions: 3}
+	db, path := openTest(t, opts)
+	// began[i] is when the i-th state of k began, as History tells.
+	var began []time.Time
+	for _, value := range []string{"v1", "v2", "", "v4", "v5"} {
+		var err error
+		if value == "" {
+			err = db.Delete("k")
+		} else {
+			err = db.Set("k", []byte(value))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		revs, err := db.History("k", 1)
+		if err != nil || len(revs) != 1 {
+			t.Fatalf("History of the current state = %v, %v", revs, err)
+		}
+		began = append(began, revs[0].Time)
+	}
+	if err := db.Set("other", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(when string) {
+		t.Helper()
+		// The current state and the three before it; v1 was dropped.
+		if got := revisionsOf(t, db, "k", 0); got != "[v5 v4 deleted v2]" {
+			t.Fatalf("%s: History = %s", when, got)
+		}
+		if got := revisionsOf(t, db, "k", 2); got != "[v5 v4]" {
+			t.Fatalf("%s: History limited to 2 = %s", when, got)
+		}
+		for i, want := range []string{"", "v2", "", "v4", "v5"} {
+			got, err := db.GetAt("k", began[i])
+			switch {
+			case want == "" && !errors.Is(err, ErrKeyNotFound):
+				t.Fatalf("%s: GetAt state %d = %q, %v, want ErrKeyNotFound", when, i, got, err)
+			case want != "" && (err != nil || string(got) != want):
+				t.Fatalf("%s: GetAt state %d = %q, %v, want %q", when, i, got, err, want)
+			}
+		}
+		if _, err := db.GetAt("k", began[0].Add(-time.Hour)); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("%s: GetAt before any state = %v, want ErrKeyNotFound", when, err)
+		}
+		if got, err := db.GetAt("k", time.Now()); err != nil || string(got) != "v5" {
+			t.Fatalf("%s: GetAt now = %q, %v", when, got, err)
+		}
+	}
+	check("as written")
+
+	// Revisions are no dead space: compaction keeps them.
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	check("after Compact")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, when := range []string{"from the checkpoint", "replaying the data file"} {
+		var err error
+		if db, err = OpenWithOptions(path, opts); err != nil {
+			t.Fatal(err)
+		}
+		check(when)
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(path + ".checkpoint"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.History("k", 0); !errors.Is(err, ErrClosed) {
+		t.Fatalf("History after Close = %v, want ErrClosed", err)
+	}
+	if _, err := db.GetAt("k", time.Now()); !errors.Is(err, ErrClosed) {
+		t.Fatalf("GetAt after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestHistoryOff(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	for _, value := range []string{"v1", "v2"} {
+		if err := db.Set("k", []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := revisionsOf(t, db, "k", 0); got != "[v2]" {
+		t.Fatalf("History without HistoryVersions = %s, want only the current state", got)
+	}
+	if got := revisionsOf(t, db, "missing", 0); got != "[]" {
+		t.Fatalf("History of a missing key = %s", got)
+	}
+	if _, err := OpenWithOptions(db.path+"2", Options{HistoryVersions: 1, MaxBytes: 1 << 20}); err == nil {
+		t.Fatal("HistoryVersions with MaxBytes opened")
+	}
+}
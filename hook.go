@@ -0,0 +1,108 @@
+package endor
+
+// Hook runs code around the reads and writes of a DB, for audit logs,
+// validation or transforming values, without wrapping the DB. Every field
+// is optional. Write hooks run for every record a Set, SetWithTTL, Delete,
+// batch or transaction writes, bucket keys included with the prefix the
+// bucket stores them under, but not for Increment and Merge, whose values
+// the store computes. Unlike Metrics, hooks are called without the store
+// locked, so they may use the DB themselves.
+type Hook struct {
+	// BeforeSet runs before value is written under key and returns the
+	// value to write instead, value itself to leave it as it is. An error
+	// rejects the write, and the rest of its batch, with that error.
+	BeforeSet func(key string, value []byte) ([]byte, error)
+	// AfterSet runs once the write of value under key returned err.
+	AfterSet func(key string, value []byte, err error)
+
+	// BeforeDelete runs before key is deleted. An error rejects the
+	// delete, and the rest of its batch, with that error.
+	BeforeDelete func(key string) error
+	// AfterDelete runs once the delete of key returned err.
+	AfterDelete func(key string, err error)
+
+	// BeforeGet runs before Get reads key. An error fails the Get with
+	// that error.
+	BeforeGet func(key string) error
+	// AfterGet runs once Get read value, or failed with err, and returns
+	// what Get returns instead, so it can undo what BeforeSet did to the
+	// value. It runs for the reads made through Get too, Iterator.Value,
+	// GetValue and Txn.Get among them; snapshot iterators, GetAt,
+	// History and exports return values as stored.
+	AfterGet func(key string, value []byte, err error) ([]byte, error)
+}
+
+// Use adds h to the hooks of the store. Hooks run in the order they were
+// added, each Before hook getting the value the one before it returned.
+func (db *DB) Use(h Hook) {
+	db.hooksMu.Lock()
+	defer db.hooksMu.Unlock()
+	// Copy on write, so a running operation keeps the hooks it started
+	// with.
+	db.hooks = append(db.hooks[:len(db.hooks):len(db.hooks)], h)
+}
+
+func (db *DB) currentHooks() []Hook {
+	db.hooksMu.RLock()
+	defer db.hooksMu.RUnlock()
+	return db.hooks
+}
+
+// beforeWrite runs the Before hooks for records, replacing the values they
+// transform.
+func beforeWrite(hooks []Hook, records []record) error {
+	for i := range records {
+		r := &records[i]
+		for _, h := range hooks {
+			var err error
+			switch {
+			case r.Op == opSet && h.BeforeSet != nil:
+				r.Value, err = h.BeforeSet(r.Key, r.Value)
+			case r.Op == opDelete && h.BeforeDelete != nil:
+				err = h.BeforeDelete(r.Key)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// afterWrite runs the After hooks for records, which were written with the
+// error *errp. It is meant to be deferred.
+func afterWrite(hooks []Hook, records []record, errp *error) {
+	for _, r := range records {
+		for _, h := range hooks {
+			switch {
+			case r.Op == opSet && h.AfterSet != nil:
+				h.AfterSet(r.Key, r.Value, *errp)
+			case r.Op == opDelete && h.AfterDelete != nil:
+				h.AfterDelete(r.Key, *errp)
+			}
+		}
+	}
+}
+
+// beforeGet runs the BeforeGet hooks for key.
+func beforeGet(hooks []Hook, key string) error {
+	for _, h := range hooks {
+		if h.BeforeGet == nil {
+			continue
+		}
+		if err := h.BeforeGet(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// afterGet runs the AfterGet hooks on the result of the Get of key. It is
+// meant to be deferred.
+func afterGet(hooks []Hook, key string, valuep *[]byte, errp *error) {
+	for _, h := range hooks {
+		if h.AfterGet != nil {
+			*valuep, *errp = h.AfterGet(key, *valuep, *errp)
+		}
+	}
+}
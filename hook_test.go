@@ -0,0 +1,186 @@
+package endor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	db, _ := openTest(t, Options{MaxValueSize: 16})
+	var calls []string
+	db.Use(Hook{
+		BeforeSet: func(key string, value []byte) ([]byte, error) {
+			calls = append(calls, "before set "+key)
+			return bytes.ToUpper(value), nil
+		},
+		AfterSet: func(key string, value []byte, err error) {
+			calls = append(calls, fmt.Sprintf("after set %s=%s %v", key, value, err))
+		},
+		BeforeDelete: func(key string) error {
+			calls = append(calls, "before delete "+key)
+			return nil
+		},
+		AfterDelete: func(key string, err error) {
+			calls = append(calls, fmt.Sprintf("after delete %s %v", key, err))
+		},
+		BeforeGet: func(key string) error {
+			calls = append(calls, "before get "+key)
+			return nil
+		},
+		AfterGet: func(key string, value []byte, err error) ([]byte, error) {
+			calls = append(calls, "after get "+key)
+			return bytes.ToLower(value), err
+		},
+	})
+	// A second hook sees the value the first returned.
+	db.Use(Hook{
+		BeforeSet: func(key string, value []byte) ([]byte, error) {
+			return append(value, '!'), nil
+		},
+	})
+	check := func(want ...string) {
+		t.Helper()
+		if fmt.Sprint(calls) != fmt.Sprint(want) {
+			t.Fatalf("hooks called as %q, want %q", calls, want)
+		}
+		calls = nil
+	}
+
+	if err := db.Set("a", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	check("before set a", "after set a=VALUE! <nil>")
+	if got, err := db.Get("a"); err != nil || string(got) != "value!" {
+		t.Fatalf("Get through AfterGet = %q, %v", got, err)
+	}
+	check("before get a", "after get a")
+	// Iterator values are read through Get, snapshot iterators return
+	// the value as stored.
+	if got := collect(t, db.Scan("")); fmt.Sprint(got) != "[a=value!]" {
+		t.Fatalf("Scan = %q, want the value AfterGet returned", got)
+	}
+	check("before get a", "after get a")
+	snap, err := db.NewSnapshotIterator("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !snap.Next() {
+		t.Fatal("snapshot iterator is empty")
+	}
+	if got, err := snap.Value(); err != nil || string(got) != "VALUE!" {
+		t.Fatalf("SnapshotIterator.Value = %q, %v, want the stored value", got, err)
+	}
+	if err := snap.Close(); err != nil {
+		t.Fatal(err)
+	}
+	check()
+
+	if err := db.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	check("before delete a", "after delete a <nil>")
+	if _, err := db.Get("a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get of a deleted key = %v, want ErrKeyNotFound", err)
+	}
+	check("before get a", "after get a")
+
+	// A write that fails reports its error to the After hooks.
+	if err := db.Set("big", bytes.Repeat([]byte("v"), 16)); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("Set of a value the hooks made too large = %v, want ErrValueTooLarge", err)
+	}
+	check("before set big", "after set big="+string(bytes.Repeat([]byte("V"), 16))+"! "+ErrValueTooLarge.Error())
+
+	// Bucket keys reach the hooks with their prefix; Increment and Merge
+	// skip them.
+	if err := db.Bucket("b").Set("k", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	key := bucketMark + "b" + bucketMark + "k"
+	check("before set "+key, "after set "+key+"=V! <nil>")
+	if _, err := db.Increment("n", 1); err != nil {
+		t.Fatal(err)
+	}
+	check()
+}
+
+func TestHookRejects(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	errRejected := errors.New("rejected")
+	var after []string
+	db.Use(Hook{
+		BeforeSet: func(key string, value []byte) ([]byte, error) {
+			if key == "bad" {
+				return nil, errRejected
+			}
+			return value, nil
+		},
+		AfterSet: func(key string, value []byte, err error) {
+			after = append(after, key)
+		},
+		BeforeDelete: func(key string) error {
+			if key == "kept" {
+				return errRejected
+			}
+			return nil
+		},
+		BeforeGet: func(key string) error {
+			if key == "secret" {
+				return errRejected
+			}
+			return nil
+		},
+	})
+	if err := db.Set("kept", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set("secret", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	after = nil
+
+	// A rejected record rejects the rest of its batch, before anything is
+	// written or the After hooks run.
+	var b WriteBatch
+	b.Set("good", []byte("3"))
+	b.Set("bad", []byte("4"))
+	if err := db.Write(&b); !errors.Is(err, errRejected) {
+		t.Fatalf("Write of a rejected batch = %v, want the hook's error", err)
+	}
+	if _, err := db.Get("good"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get of a key of a rejected batch = %v, want ErrKeyNotFound", err)
+	}
+	if len(after) != 0 {
+		t.Fatalf("AfterSet ran for %q of a rejected batch", after)
+	}
+	if err := db.Delete("kept"); !errors.Is(err, errRejected) {
+		t.Fatalf("rejected Delete = %v, want the hook's error", err)
+	}
+	if got, err := db.Get("kept"); err != nil || string(got) != "1" {
+		t.Fatalf("Get after a rejected Delete = %q, %v", got, err)
+	}
+	if _, err := db.Get("secret"); !errors.Is(err, errRejected) {
+		t.Fatalf("rejected Get = %v, want the hook's error", err)
+	}
+}
+
+func TestHooksUseTheDB(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	// Hooks run without the store locked, so they may read and write it.
+	db.Use(Hook{
+		AfterSet: func(key string, value []byte, err error) {
+			if err == nil && key != "audit" {
+				if err := db.Set("audit", []byte(key)); err != nil {
+					t.Error(err)
+				}
+			}
+		},
+	})
+	if err := db.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.Get("audit"); err != nil || string(got) != "a" {
+		t.Fatalf("Get of what the hook wrote = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,120 @@
+package fslock
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestWriteVectored(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	payload := []byte("payload\n")
+	header := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	offset, n, err := f.WriteVectored(header, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != int64(len("first\n")) || n != len(header)+len(payload) {
+		t.Fatalf("WriteVectored = %d, %d, want %d, %d", offset, n, len("first\n"), len(header)+len(payload))
+	}
+	data, err := f.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "first\n" + string(header) + string(payload); string(data) != want {
+		t.Fatalf("file holds %q, want %q", data, want)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE, MaxBytes: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for i := 0; i < 2; i++ {
+		if err := f.Write([]byte("0123456789")); err != nil {
+			t.Fatalf("Write %d up to the limit = %v", i, err)
+		}
+	}
+	if err := f.Write([]byte("x")); !errors.Is(err, ErrMaxSizeExceeded) {
+		t.Fatalf("Write past the limit = %v, want ErrMaxSizeExceeded", err)
+	}
+	if _, _, err := f.WriteVectored([]byte("x"), []byte("y")); !errors.Is(err, ErrMaxSizeExceeded) {
+		t.Fatalf("WriteVectored past the limit = %v, want ErrMaxSizeExceeded", err)
+	}
+	if data, err := f.Read(); err != nil || len(data) != 20 {
+		t.Fatalf("file holds %q, %v, want the 20 bytes before the limit", data, err)
+	}
+}
+
+func TestMaxBytesUnderConcurrentAppends(t *testing.T) {
+	const limit = 100 * 10
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE, MaxBytes: limit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				err := f.Write([]byte("012345678\n"))
+				if errors.Is(err, ErrMaxSizeExceeded) {
+					return
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if data, err := f.Read(); err != nil || len(data) != limit {
+		t.Fatalf("file holds %d bytes, %v, want %d", len(data), err, limit)
+	}
+}
+
+func TestAppendLineTerminatesOnce(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want := ""
+	for _, tc := range []struct{ in, out string }{
+		{"plain", "plain\n"},
+		{"terminated\n", "terminated\n"},
+		{"", "\n"},
+		{"\n", "\n"},
+		{"two\n\n", "two\n\n"},
+	} {
+		n, err := f.AppendLine([]byte(tc.in))
+		if err != nil || n != len(tc.out) {
+			t.Fatalf("AppendLine(%q) = %d, %v, want %d", tc.in, n, err, len(tc.out))
+		}
+		want += tc.out
+	}
+	// Write adds no terminator of its own.
+	if err := f.Write([]byte("raw")); err != nil {
+		t.Fatal(err)
+	}
+	want += "raw"
+	if data, err := f.Read(); err != nil || string(data) != want {
+		t.Fatalf("file holds %q, %v, want %q", data, err, want)
+	}
+}
@@ -0,0 +1,104 @@
+package fslock
+
+// WriteVectored appends bufs in order as one logical write, without
+// concatenating them first. It returns the offset the first buffer landed at
+// and the total number of bytes written.
+func (f *FSLock) WriteVectored(bufs ...[]byte) (offset int64, total int, err error) {
+	defer f.wrap("write", &err)
+	f.lock()
+	defer f.unlock()
+
+	if f.kind == LockShared {
+		return 0, 0, ErrReadOnly
+	}
+	if f.flushErr != nil {
+		return 0, 0, f.flushErr
+	}
+	offset, err = f.end()
+	if err != nil {
+		return 0, 0, err
+	}
+	size := int64(0)
+	for _, buf := range bufs {
+		size += int64(len(buf))
+	}
+	if err := f.checkMaxBytes(offset, size); err != nil {
+		return offset, 0, err
+	}
+	if f.mirror != nil && f.mirrorStrict {
+		if err := f.copyToMirror(bufs...); err != nil {
+			return offset, 0, err
+		}
+	}
+
+	total = 0
+	for _, buf := range bufs {
+		n, err := f.appendData(buf)
+		total += n
+		if err != nil {
+			return offset, total, err
+		}
+	}
+	if f.mirror != nil && !f.mirrorStrict {
+		f.copyToMirror(bufs...)
+	}
+	return offset, total, f.wrote()
+}
+
+// WriteAt writes p at offset, overwriting existing data or extending the
+// file. It needs the RandomAccess option and returns ErrAppendOnly without
+// it. Writes at an offset are not copied to a mirror.
+func (f *FSLock) WriteAt(p []byte, offset int64) (n int, err error) {
+	defer f.wrap("write", &err)
+	if !f.opts.RandomAccess {
+		return 0, ErrAppendOnly
+	}
+	if offset < 0 {
+		return 0, ErrInvalidOffset
+	}
+	f.lock()
+	defer f.unlock()
+
+	if f.kind == LockShared {
+		return 0, ErrReadOnly
+	}
+	if f.flushErr != nil {
+		return 0, f.flushErr
+	}
+	if err := f.drain(); err != nil {
+		return 0, err
+	}
+	end, err := fileSize(f.handler)
+	if err != nil {
+		return 0, err
+	}
+	if offset+int64(len(p)) > end {
+		if err := f.checkMaxBytes(offset, int64(len(p))); err != nil {
+			return 0, err
+		}
+	}
+	n, err = f.writeFileAt(p, offset)
+	if err != nil {
+		return n, err
+	}
+	return n, f.wrote()
+}
+
+// AppendOrdered appends p only if the file currently ends at expectedOffset,
+// returning ErrOffsetConflict otherwise. On success it returns the new end of
+// file, which is the expected offset of the next ordered append.
+func (f *FSLock) AppendOrdered(p []byte, expectedOffset int64) (end int64, err error) {
+	defer f.wrap("write", &err)
+	f.lock()
+	defer f.unlock()
+
+	end, err = f.end()
+	if err != nil {
+		return 0, err
+	}
+	if end != expectedOffset {
+		return end, ErrOffsetConflict
+	}
+	n, err := f.write(p)
+	return end + int64(n), err
+}
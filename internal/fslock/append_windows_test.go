@@ -0,0 +1,111 @@
+package fslock
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"golang.org/x/sys/windows"
+)
+
+func TestAppendOrderedRace(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	record := []byte("record\n")
+	expected := int64(0)
+	for round := 0; round < 50; round++ {
+		start := make(chan struct{})
+		errs := make([]error, 2)
+		ends := make([]int64, 2)
+		var wg sync.WaitGroup
+		for i := range errs {
+			i := i
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				ends[i], errs[i] = f.AppendOrdered(record, expected)
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		conflicts := 0
+		for i, err := range errs {
+			switch {
+			case errors.Is(err, ErrOffsetConflict):
+				conflicts++
+			case err != nil:
+				t.Fatalf("round %d: AppendOrdered = %v", round, err)
+			}
+			// Both learn where the file ends now, to retry from.
+			if ends[i] != expected+int64(len(record)) {
+				t.Fatalf("round %d: AppendOrdered returned end %d, want %d", round, ends[i], expected+int64(len(record)))
+			}
+		}
+		if conflicts != 1 {
+			t.Fatalf("round %d: %d of 2 appends conflicted, want 1", round, conflicts)
+		}
+		expected += int64(len(record))
+	}
+	if _, size, err := f.Size(); err != nil || size != expected {
+		t.Fatalf("Size = %d, %v, want %d", size, err, expected)
+	}
+}
+
+func TestWriteAtPatchesInRandomAccessMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	f, err := NewFSLockWithOptions(path, Options{Mode: defaultFileMode | os.O_CREATE, RandomAccess: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, line := range []string{"first\n", "second\n"} {
+		if _, err := f.AppendLine([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := f.WriteAt([]byte("FIRST"), 0); err != nil || n != 5 {
+		t.Fatalf("WriteAt = %d, %v", n, err)
+	}
+	// Appends still go to the end, although the patch left the file
+	// pointer inside the file.
+	if _, err := f.AppendLine([]byte("third")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := f.Read(); err != nil || string(data) != "FIRST\nsecond\nthird\n" {
+		t.Fatalf("file holds %q, %v", data, err)
+	}
+}
+
+func TestAppendOnlyWritesLandAtEnd(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("FIRST"), 0); !errors.Is(err, ErrAppendOnly) {
+		t.Fatalf("WriteAt in append mode = %v, want ErrAppendOnly", err)
+	}
+	// Move the file pointer back to the start, as a stale idea of the end
+	// of file would; O_APPEND still puts the write at the end.
+	if _, err := windows.Seek(f.handler, 0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Write([]byte("second\n")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := f.Read(); err != nil || string(data) != "first\nsecond\n" {
+		t.Fatalf("file holds %q, %v", data, err)
+	}
+}
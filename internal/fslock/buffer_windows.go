@@ -0,0 +1,68 @@
+package fslock
+
+import "errors"
+
+// appendData queues data behind the write buffer when one is configured, or
+// writes it straight to the file otherwise. Data at least as large as the
+// buffer bypasses it after draining what was queued before.
+func (f *FSLock) appendData(data []byte) (n int, err error) {
+	if f.tail != nil {
+		defer func() { f.tail.feed(data[:n]) }()
+	}
+	size := f.opts.WriteBufferSize
+	if size <= 0 {
+		return f.writeFile(data)
+	}
+	if len(f.wbuf)+len(data) > size {
+		if err := f.drain(); err != nil {
+			return 0, err
+		}
+	}
+	if len(data) >= size {
+		return f.writeFile(data)
+	}
+	if f.wbuf == nil {
+		f.wbuf = make([]byte, 0, size)
+	}
+	f.wbuf = append(f.wbuf, data...)
+	f.dirty = true
+	f.summary.valid = false
+	return len(data), nil
+}
+
+// drain writes the buffered data to the file. Whatever could not be written
+// stays buffered.
+func (f *FSLock) drain() error {
+	if len(f.wbuf) == 0 {
+		return nil
+	}
+	n, err := f.writeFile(f.wbuf)
+	if errors.Is(err, ErrShortWrite) {
+		// Whatever follows the torn write is cut off by the repair, so
+		// appending the rest would only grow the damage.
+		f.wbuf = f.wbuf[:0]
+		return err
+	}
+	f.wbuf = f.wbuf[:copy(f.wbuf, f.wbuf[n:])]
+	return err
+}
+
+// drainForRead makes buffered writes visible to the read that follows,
+// unless the options ask reads to see on-disk data only.
+func (f *FSLock) drainForRead() error {
+	if f.opts.WriteBufferSize <= 0 || f.opts.ReadSkipsBuffer {
+		return nil
+	}
+	f.lock()
+	defer f.unlock()
+	return f.drain()
+}
+
+// end returns the logical end of file, buffered data included.
+func (f *FSLock) end() (int64, error) {
+	size, err := fileSize(f.handler)
+	if err != nil {
+		return 0, err
+	}
+	return size + int64(len(f.wbuf)), nil
+}
@@ -0,0 +1,51 @@
+package fslock
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadSeesBufferedWrites(t *testing.T) {
+	for _, skip := range []bool{false, true} {
+		f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE, WriteBufferSize: 4096, ReadSkipsBuffer: skip})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Write([]byte("on disk\n")); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Write([]byte("buffered\n")); err != nil {
+			t.Fatal(err)
+		}
+
+		// By default reads write the buffer out first and see everything;
+		// with ReadSkipsBuffer they see only what reached the file.
+		want, wantLines := "on disk\nbuffered\n", "[on disk buffered]"
+		if skip {
+			want, wantLines = "on disk\n", "[on disk]"
+		}
+		if data, err := f.Read(); err != nil || string(data) != want {
+			t.Fatalf("ReadSkipsBuffer %v: Read = %q, %v, want %q", skip, data, err, want)
+		}
+		var lines []string
+		if err := f.Lines(func(offset int64, line []byte) bool {
+			lines = append(lines, string(line))
+			return true
+		}); err != nil || fmt.Sprint(lines) != wantLines {
+			t.Fatalf("ReadSkipsBuffer %v: Lines = %q, %v, want %s", skip, lines, err, wantLines)
+		}
+
+		if err := f.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if data, err := f.Read(); err != nil || string(data) != "on disk\nbuffered\n" {
+			t.Fatalf("ReadSkipsBuffer %v: Read after Flush = %q, %v", skip, data, err)
+		}
+		f.Close()
+	}
+}
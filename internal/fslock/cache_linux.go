@@ -0,0 +1,18 @@
+package fslock
+
+import "golang.org/x/sys/unix"
+
+// DropCache asks the OS to release the cached pages of the file, for example
+// after a one-off full scan, with posix_fadvise(POSIX_FADV_DONTNEED). Dirty
+// pages are not dropped, so the file is synced first. It is best effort and
+// may keep some pages.
+func (f *FSLock) DropCache() (err error) {
+	defer f.wrap("dropcache", &err)
+	f.lock()
+	defer f.unlock()
+
+	if err := f.flush(); err != nil {
+		return err
+	}
+	return mapError(unix.Fadvise(f.fd, 0, 0, unix.FADV_DONTNEED))
+}
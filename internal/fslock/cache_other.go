@@ -0,0 +1,13 @@
+//go:build unix && !linux
+
+package fslock
+
+// DropCache would ask the OS to release the cached pages of the file, but
+// this platform has no call for it, so it only syncs the file. It is best
+// effort on every platform, so callers need not tell the difference.
+func (f *FSLock) DropCache() (err error) {
+	defer f.wrap("dropcache", &err)
+	f.lock()
+	defer f.unlock()
+	return f.flush()
+}
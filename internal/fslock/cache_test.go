@@ -0,0 +1,30 @@
+package fslock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDropCacheKeepsData(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Write([]byte("one\ntwo\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Read(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.DropCache(); err != nil {
+		t.Fatalf("DropCache = %v", err)
+	}
+	if data, err := f.Read(); err != nil || string(data) != "one\ntwo\n" {
+		t.Fatalf("Read after DropCache = %q, %v", data, err)
+	}
+	if err := f.Write([]byte("three\n")); err != nil {
+		t.Fatalf("Write after DropCache = %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package fslock
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// DropCache asks the OS to release the cached pages of the file, for example
+// after a one-off full scan. Windows has no direct advice call, so dirty data
+// is flushed and a short-lived unbuffered handle is opened, which makes the
+// cache manager purge the file. It is best effort and may keep some pages.
+func (f *FSLock) DropCache() (err error) {
+	defer f.wrap("dropcache", &err)
+	f.lock()
+	defer f.unlock()
+
+	if err := f.flush(); err != nil {
+		return err
+	}
+
+	name, err := utf16Path(f.file.Name())
+	if err != nil {
+		return err
+	}
+	h, err := windows.CreateFile(name, windows.GENERIC_READ, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE, nil, windows.OPEN_EXISTING, windows.FILE_FLAG_NO_BUFFERING, 0)
+	if err != nil {
+		return err
+	}
+	return windows.CloseHandle(h)
+}
@@ -0,0 +1,38 @@
+package fslock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCloseSyncsAndReleasesLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	syncs := 0
+	opts := Options{
+		Mode:     defaultFileMode | os.O_CREATE,
+		Observer: Observer{OnSync: func() { syncs++ }},
+	}
+	f, err := NewFSLockWithOptions(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Write([]byte("record\n")); err != nil {
+		t.Fatal(err)
+	}
+	if !lockedElsewhere(t, path, true) {
+		t.Fatal("file not locked while open")
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if syncs != 1 {
+		t.Fatalf("Close synced %d times, want once", syncs)
+	}
+	if lockedElsewhere(t, path, false) {
+		t.Fatal("lock still held after Close")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "record\n" {
+		t.Fatalf("file holds %q, %v after Close", data, err)
+	}
+}
@@ -0,0 +1,21 @@
+package fslock
+
+import "encoding/json"
+
+// Codec converts the values of a RecordStore to and from record payloads.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec encodes values with encoding/json. It is the default codec of a
+// RecordStore.
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,135 @@
+package fslock
+
+import (
+	"bytes"
+
+	"golang.org/x/sys/windows"
+)
+
+// lineReader serves lines from a block read ahead of the cursor, so many
+// short lines cost a single read.
+type lineReader struct {
+	blockSize int
+	buf       []byte
+	// start and end bound the unread part of buf and offset is the file
+	// offset right after buf[end-1].
+	start  int
+	end    int
+	offset int64
+}
+
+// NextLine returns the line at the read cursor and advances the cursor past
+// it. A final line without a newline is returned as is; after it NextLine
+// returns EOF.
+func (f *FSLock) NextLine() (line []byte, err error) {
+	defer f.wrap("read", &err)
+	f.lock()
+	defer f.unlock()
+	f.stats.reads.Add(1)
+	if !f.opts.ReadSkipsBuffer {
+		if err := f.drain(); err != nil {
+			return nil, err
+		}
+	}
+	line, offset, err := f.cursor.next(f.readHandle(), f.file.Name())
+	if err == nil {
+		f.lineRead(offset, line)
+	}
+	return line, err
+}
+
+// Rewind moves the read cursor back to the start of the file and drops any
+// buffered data, so the next NextLine returns the first line.
+func (f *FSLock) Rewind() {
+	f.lock()
+	defer f.unlock()
+	f.cursor.reset()
+}
+
+func (r *lineReader) reset() {
+	r.start, r.end, r.offset = 0, 0, 0
+}
+
+// next returns the line at the cursor. Whenever a read comes back short the
+// file is checked against the path it was opened from, and ErrFileChanged is
+// returned if it was truncated below the cursor or replaced.
+func (r *lineReader) next(h readHandle, path string) ([]byte, int64, error) {
+	if r.buf == nil {
+		r.buf = make([]byte, r.blockSize)
+	}
+
+	for {
+		unread := r.buf[r.start:r.end]
+		if i := bytes.IndexByte(unread, '\n'); i >= 0 {
+			return r.take(i, i+1)
+		}
+
+		if r.start > 0 {
+			r.end = copy(r.buf, unread)
+			r.start = 0
+		}
+		if r.end == len(r.buf) {
+			grown := make([]byte, len(r.buf)*2)
+			copy(grown, r.buf[:r.end])
+			r.buf = grown
+		}
+
+		n, err := h.readAt(r.buf[r.end:], r.offset)
+		if err != nil {
+			return nil, r.lineOffset(), err
+		}
+		if n < len(r.buf)-r.end {
+			if err := r.verify(h.handler, path); err != nil {
+				return nil, r.lineOffset(), err
+			}
+		}
+		if n == 0 {
+			if r.end > r.start {
+				return r.take(r.end-r.start, r.end-r.start)
+			}
+			return nil, r.offset, EOF
+		}
+		r.end += n
+		r.offset += int64(n)
+	}
+}
+
+func (r *lineReader) verify(handler windows.Handle, path string) error {
+	size, err := fileSize(handler)
+	if err != nil {
+		return err
+	}
+	if size < r.offset {
+		return ErrFileChanged
+	}
+
+	opened, err := handleIdentity(handler)
+	if err != nil {
+		return err
+	}
+	onDisk, err := pathIdentity(path)
+	if err == windows.ERROR_FILE_NOT_FOUND {
+		return ErrFileChanged
+	}
+	if err != nil {
+		return err
+	}
+	if opened != onDisk {
+		return ErrFileChanged
+	}
+	return nil
+}
+
+// take returns a copy of the first length unread bytes and consumes advance
+// bytes, the line plus its newline if it has one.
+func (r *lineReader) take(length int, advance int) ([]byte, int64, error) {
+	offset := r.lineOffset()
+	line := make([]byte, length)
+	copy(line, r.buf[r.start:])
+	r.start += advance
+	return line, offset, nil
+}
+
+func (r *lineReader) lineOffset() int64 {
+	return r.offset - int64(r.end-r.start)
+}
@@ -0,0 +1,254 @@
+package fslock
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNextLineFailsOnTruncation(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE, ReadBufferSize: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for i := 0; i < 100; i++ {
+		if _, err := f.AppendLine([]byte(fmt.Sprintf("line %03d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The clone reads with a cursor of its own, which Truncate through f
+	// leaves where it was.
+	r, err := f.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for i := 0; i < 3; i++ {
+		if _, err := r.NextLine(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Truncate(32); err != nil {
+		t.Fatal(err)
+	}
+
+	// The lines already read ahead may still come back, but never an EOF
+	// that passes the cut-off file as complete.
+	for i := 3; i < 100; i++ {
+		line, err := r.NextLine()
+		if errors.Is(err, ErrFileChanged) {
+			return
+		}
+		if err != nil {
+			t.Fatalf("NextLine after truncation = %v, want ErrFileChanged", err)
+		}
+		if want := fmt.Sprintf("line %03d", i); string(line) != want {
+			t.Fatalf("NextLine after truncation = %q, want %q", line, want)
+		}
+	}
+	t.Fatal("read every line of a truncated file")
+}
+
+func TestRewindRestartsIteration(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE, ReadBufferSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for i := 0; i < 10; i++ {
+		if _, err := f.AppendLine([]byte(fmt.Sprintf("line %d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	all := func() []string {
+		t.Helper()
+		var lines []string
+		for {
+			line, err := f.NextLine()
+			if err == EOF {
+				return lines
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines = append(lines, string(line))
+		}
+	}
+	first := all()
+	if len(first) != 10 || first[0] != "line 0" || first[9] != "line 9" {
+		t.Fatalf("first pass read %q", first)
+	}
+	f.Rewind()
+	if again := all(); fmt.Sprint(again) != fmt.Sprint(first) {
+		t.Fatalf("pass after Rewind read %q, want %q", again, first)
+	}
+
+	// Rewinding part way drops the lines read ahead too.
+	f.Rewind()
+	for i := 0; i < 3; i++ {
+		if _, err := f.NextLine(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Rewind()
+	for i := 0; i < 2; i++ {
+		if line, err := f.NextLine(); err != nil || string(line) != fmt.Sprintf("line %d", i) {
+			t.Fatalf("NextLine %d after a Rewind part way = %q, %v", i, line, err)
+		}
+	}
+}
+
+func TestOnLineReadSeesCursorReads(t *testing.T) {
+	var seen []string
+	opts := Options{
+		Mode: defaultFileMode | os.O_CREATE,
+		Observer: Observer{OnLineRead: func(offset int64, line []byte) {
+			seen = append(seen, fmt.Sprintf("%d:%s", offset, line))
+		}},
+	}
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, line := range []string{"one", "two", "three"} {
+		if _, err := f.AppendLine([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for {
+		if _, err := f.NextLine(); errors.Is(err, EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := "[0:one 4:two 8:three]"; fmt.Sprint(seen) != want {
+		t.Fatalf("hook saw %v for NextLine, want %s", seen, want)
+	}
+	seen = nil
+	if _, _, err := f.ReadLinesAt(4, 2); err != nil {
+		t.Fatal(err)
+	}
+	if want := "[4:two 8:three]"; fmt.Sprint(seen) != want {
+		t.Fatalf("hook saw %v for ReadLinesAt, want %s", seen, want)
+	}
+}
+
+func TestEmptyFileIteration(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if line, err := f.NextLine(); !errors.Is(err, EOF) {
+		t.Fatalf("NextLine = %q, %v, want EOF", line, err)
+	}
+	if lines, next, err := f.ReadLinesAt(0, 3); !errors.Is(err, EOF) || len(lines) != 0 || next != 0 {
+		t.Fatalf("ReadLinesAt = %q, %d, %v, want EOF", lines, next, err)
+	}
+	if _, _, err := f.LastLineOffset(); !errors.Is(err, EOF) {
+		t.Fatalf("LastLineOffset = %v, want EOF", err)
+	}
+	if _, _, err := f.LastRecordOffset(); !errors.Is(err, EOF) {
+		t.Fatalf("LastRecordOffset = %v, want EOF", err)
+	}
+	visit := func(offset int64, payload []byte, err error) bool {
+		t.Fatal("Records returned a record")
+		return false
+	}
+	if err := f.Records(visit); err != nil {
+		t.Fatalf("Records = %v", err)
+	}
+	if err := f.ReverseRecords(func(int64, []byte) bool {
+		t.Fatal("ReverseRecords returned a record")
+		return false
+	}); err != nil {
+		t.Fatalf("ReverseRecords = %v", err)
+	}
+	if bad, err := f.ScanIntegrity(); err != nil || bad != -1 {
+		t.Fatalf("ScanIntegrity = %d, %v, want -1", bad, err)
+	}
+}
+
+func TestNextLineMatchesReadLineFrom(t *testing.T) {
+	var lines []string
+	for i := 0; i < 200; i++ {
+		lines = append(lines, strings.Repeat(fmt.Sprint(i%10), i%37))
+	}
+	// Buffers smaller than a line, that lines straddle, and larger than the
+	// file.
+	for _, size := range []int{8, 64, 1000, 0} {
+		f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE, ReadBufferSize: size})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range lines {
+			if _, err := f.AppendLine([]byte(line)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		offset := int64(0)
+		for i := range lines {
+			line, err := f.NextLine()
+			if err != nil {
+				t.Fatalf("ReadBufferSize %d: NextLine %d = %v", size, i, err)
+			}
+			want, next, err := f.ReadLineFrom(offset)
+			if err != nil || !bytes.Equal(line, want) {
+				t.Fatalf("ReadBufferSize %d: NextLine %d = %q, ReadLineFrom(%d) = %q, %v", size, i, line, offset, want, err)
+			}
+			offset = next
+		}
+		if _, err := f.NextLine(); !errors.Is(err, EOF) {
+			t.Fatalf("ReadBufferSize %d: NextLine past the end = %v, want EOF", size, err)
+		}
+		f.Close()
+	}
+}
+
+func BenchmarkNextLine(b *testing.B) {
+	f, err := NewFSLockWithOptions(filepath.Join(b.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	const lines = 100000
+	var data []byte
+	for i := 0; i < lines; i++ {
+		data = append(data, fmt.Sprintf("line %06d\n", i)...)
+	}
+	if err := f.Write(data); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("NextLine", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			f.Rewind()
+			for j := 0; j < lines; j++ {
+				if _, err := f.NextLine(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("ReadLineFrom", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			offset := int64(0)
+			for j := 0; j < lines; j++ {
+				_, next, err := f.ReadLineFrom(offset)
+				if err != nil {
+					b.Fatal(err)
+				}
+				offset = next
+			}
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package fslock
+
+// DrainAll consumes the file as a FIFO queue: it passes every line to fn and,
+// once all of them were processed, truncates the file to zero under the
+// exclusive lock. When fn fails nothing is removed and its error returned,
+// unless the DrainCommitsPartial option is set, in which case the lines
+// processed before the failure are removed and the rest kept. fn runs with
+// f locked and must not call back into f.
+func (f *FSLock) DrainAll(fn func(line []byte) error) (err error) {
+	defer f.wrap("drain", &err)
+	f.lock()
+	defer f.unlock()
+
+	if err := f.drain(); err != nil {
+		return err
+	}
+	h := f.readHandle()
+	size, err := fileSize(h.handler)
+	if err != nil {
+		return err
+	}
+
+	offset := int64(0)
+	for offset < size {
+		line, err := h.readAtToEndOfLine(offset, f.readLength())
+		if err == EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if fnErr := fn(line); fnErr != nil {
+			if f.opts.DrainCommitsPartial && offset > 0 {
+				if err := f.dropPrefix(offset, size); err != nil {
+					return err
+				}
+			}
+			return fnErr
+		}
+		offset += int64(len(line)) + 1
+	}
+	return f.dropPrefix(size, size)
+}
+
+// dropPrefix removes the first n bytes of a file of size bytes by rewriting
+// the rest at the start. The append handle can not shift data in place, so
+// the rest is held in memory while the file is truncated and rewritten.
+func (f *FSLock) dropPrefix(n int64, size int64) error {
+	var rest []byte
+	if n < size {
+		rest = make([]byte, size-n)
+		read, err := f.readHandle().readAt(rest, n)
+		if err != nil {
+			return err
+		}
+		rest = rest[:read]
+	}
+	if err := f.truncate(0); err != nil {
+		return err
+	}
+	f.cursor.reset()
+	if len(rest) > 0 {
+		if _, err := f.writeFile(rest); err != nil {
+			return err
+		}
+	}
+	return f.flush()
+}
@@ -0,0 +1,75 @@
+package fslock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// queue opens a new file holding lines, one per line.
+func queue(t *testing.T, opts Options, lines ...string) *FSLock {
+	t.Helper()
+	opts.Mode = defaultFileMode | os.O_CREATE
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "queue"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	for _, line := range lines {
+		if _, err := f.AppendLine([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return f
+}
+
+func TestDrainAll(t *testing.T) {
+	f := queue(t, Options{}, "one", "two", "three")
+	var got []string
+	if err := f.DrainAll(func(line []byte) error {
+		got = append(got, string(line))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != "[one two three]" {
+		t.Fatalf("DrainAll passed %q", got)
+	}
+	if data, err := f.Read(); err != nil || len(data) != 0 {
+		t.Fatalf("file holds %q, %v after DrainAll", data, err)
+	}
+	// The queue goes on from empty.
+	if _, err := f.AppendLine([]byte("four")); err != nil {
+		t.Fatal(err)
+	}
+	if line, err := f.NextLine(); err != nil || string(line) != "four" {
+		t.Fatalf("NextLine after DrainAll = %q, %v", line, err)
+	}
+}
+
+func TestDrainAllFailure(t *testing.T) {
+	failed := errors.New("processing failed")
+	for _, tc := range []struct {
+		partial bool
+		want    string
+	}{
+		{false, "one\ntwo\nthree\n"},
+		{true, "two\nthree\n"},
+	} {
+		f := queue(t, Options{DrainCommitsPartial: tc.partial}, "one", "two", "three")
+		err := f.DrainAll(func(line []byte) error {
+			if string(line) == "two" {
+				return failed
+			}
+			return nil
+		})
+		if !errors.Is(err, failed) {
+			t.Fatalf("DrainAll with a failing fn = %v, want %v", err, failed)
+		}
+		if data, err := f.Read(); err != nil || string(data) != tc.want {
+			t.Fatalf("DrainCommitsPartial %v: file holds %q, %v, want %q", tc.partial, data, err, tc.want)
+		}
+	}
+}
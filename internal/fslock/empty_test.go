@@ -0,0 +1,40 @@
+package fslock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEmptyFile(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if data, err := f.Read(); err != nil || data == nil || len(data) != 0 {
+		t.Fatalf("Read = %q (nil %v), %v, want an empty slice", data, data == nil, err)
+	}
+	if line, err := f.ReadAtToEndOfLine(0, 1); !errors.Is(err, EOF) {
+		t.Fatalf("ReadAtToEndOfLine = %q, %v, want EOF", line, err)
+	}
+	if line, _, err := f.ReadLineFrom(0); !errors.Is(err, EOF) {
+		t.Fatalf("ReadLineFrom = %q, %v, want EOF", line, err)
+	}
+	if err := f.Lines(func(int64, []byte) bool {
+		t.Fatal("Lines returned a line")
+		return false
+	}); err != nil {
+		t.Fatalf("Lines = %v", err)
+	}
+	r, err := f.NewReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if data, err := r.Read(); err != nil || len(data) != 0 {
+		t.Fatalf("reader Read = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,67 @@
+package fslock
+
+import (
+	"errors"
+	"io"
+)
+
+// Every platform maps its native errors onto these sentinels, so callers can
+// use errors.Is without branching on GOOS. The native error stays reachable
+// through errors.Is and errors.As as well.
+var (
+	EOF                = io.EOF
+	ErrInvalidOffset   = errors.New("invalid offset")
+	ErrAlreadyLocked   = errors.New("file is already locked")
+	ErrNotLocked       = errors.New("file is not locked")
+	ErrClosed          = errors.New("file already closed")
+	ErrReadOnly        = errors.New("file is read-only")
+	ErrCorrupt         = errors.New("corrupt record")
+	ErrNoSpace         = errors.New("no space left on device")
+	ErrTimeout         = errors.New("operation timed out")
+	ErrRecordTooLarge  = errors.New("record too large")
+	ErrFileChanged     = errors.New("file changed during read")
+	ErrOffsetConflict  = errors.New("file end does not match expected offset")
+	ErrNotSeekable     = errors.New("file does not support offset reads or locking")
+	ErrMaxSizeExceeded = errors.New("write would exceed the maximum file size")
+
+	ErrAlreadyLockedInProcess = errors.New("file is already locked by this process")
+	ErrInvalidOptions         = errors.New("invalid options")
+	ErrNotFound               = errors.New("no matching line")
+	ErrAppendOnly             = errors.New("file is opened for appending only")
+	ErrChecksumMismatch       = errors.New("record checksum mismatch")
+	ErrShortWrite             = errors.New("short write")
+
+	// ErrLocked is the error TryLock returns, and NewFSLockTimeout once
+	// its timeout passes, when another process holds the lock. It is the
+	// same value as ErrAlreadyLocked.
+	ErrLocked = ErrAlreadyLocked
+)
+
+// PathError records the operation and the file behind a failure. Unwrap
+// returns the underlying error, so errors.Is and errors.As keep working.
+type PathError struct {
+	Op   string
+	Path string
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	return e.Op + " " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// pathError wraps err in a PathError unless it is nil, EOF, which callers
+// compare against directly, or already carries a path.
+func pathError(op string, path string, err error) error {
+	if err == nil || err == EOF {
+		return err
+	}
+	var pe *PathError
+	if errors.As(err, &pe) {
+		return err
+	}
+	return &PathError{Op: op, Path: path, Err: err}
+}
@@ -0,0 +1,39 @@
+package fslock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContendedLockIsErrAlreadyLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	release := holdLock(t, path)
+	defer release()
+	_, err := TryLock(path, defaultFileMode)
+	if !errors.Is(err, ErrAlreadyLocked) {
+		t.Fatalf("TryLock of a held lock = %v, want ErrAlreadyLocked", err)
+	}
+	var pe *PathError
+	if !errors.As(err, &pe) || pe.Path != path {
+		t.Fatalf("TryLock error %v does not name %s", err, path)
+	}
+}
+
+func TestDiskFullIsErrNoSpace(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	failWrites(t, diskFull)
+	err = f.Write([]byte("record\n"))
+	if !errors.Is(err, ErrNoSpace) {
+		t.Fatalf("Write on a full disk = %v, want ErrNoSpace", err)
+	}
+	// The native error stays reachable too.
+	if !errors.Is(err, diskFull) {
+		t.Fatalf("Write on a full disk = %v, does not wrap %v", err, diskFull)
+	}
+}
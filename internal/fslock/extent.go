@@ -0,0 +1,90 @@
+package fslock
+
+// extent is where the data of a file logically ends, tracked apart from its
+// physical size, which a hole at the tail of the file, left for example by
+// growing it with SetEndOfFile or ftruncate, puts further out. Writes
+// through the FSLock advance it. When the file was changed some other way,
+// which shows as a physical size other than the one known, it is derived
+// again from the holes the file system reports, never from the bytes read
+// back, so data that ends in zeros is not taken for a hole.
+type extent struct {
+	logical  int64
+	physical int64
+	known    bool
+}
+
+// appended accounts for n bytes appended at the physical end of the file.
+func (e *extent) appended(n int) {
+	if e.known && n > 0 {
+		e.physical += int64(n)
+		e.logical = e.physical
+	}
+}
+
+// wroteAt accounts for n bytes written at offset.
+func (e *extent) wroteAt(offset int64, n int) {
+	if !e.known {
+		return
+	}
+	end := offset + int64(n)
+	if end > e.physical {
+		e.physical = end
+	}
+	if end > e.logical {
+		e.logical = end
+	}
+}
+
+// truncated accounts for the file being cut to size.
+func (e *extent) truncated(size int64) {
+	if !e.known {
+		return
+	}
+	e.physical = size
+	if e.logical > size {
+		e.logical = size
+	}
+}
+
+// logicalSize returns the logical end of the file and its physical size.
+// f.mu must be held.
+func (f *FSLock) logicalSize() (logical int64, physical int64, err error) {
+	h := f.readHandle()
+	physical, err = h.size()
+	if err != nil {
+		return 0, 0, err
+	}
+	if f.extent.known && f.extent.physical == physical {
+		return f.extent.logical, physical, nil
+	}
+	logical, err = h.logicalEnd(physical)
+	return logical, physical, err
+}
+
+// deriveExtent works out the logical end of the file afresh. f.mu must be
+// held for writing, or f not yet shared.
+func (f *FSLock) deriveExtent() error {
+	f.extent.known = false
+	logical, physical, err := f.logicalSize()
+	if err != nil {
+		return err
+	}
+	f.extent = extent{logical: logical, physical: physical, known: true}
+	return nil
+}
+
+// logicalEnd derives the logical end of a file of physical bytes. A file
+// whose last allocated range ends before its physical end ends in a hole,
+// and its data with the last line before the hole; the rest of the range,
+// allocated a block at a time, is zeros the file system filled in.
+func (h readHandle) logicalEnd(physical int64) (int64, error) {
+	data, err := h.dataEnd(physical)
+	if err != nil || data >= physical {
+		return physical, err
+	}
+	last, err := h.lastIndexByte(data, '\n')
+	if err != nil {
+		return 0, err
+	}
+	return last + 1, nil
+}
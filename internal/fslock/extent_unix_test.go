@@ -0,0 +1,73 @@
+//go:build unix
+
+package fslock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readLines(t *testing.T, f *FSLock) []string {
+	t.Helper()
+	var lines []string
+	if err := f.Lines(func(offset int64, line []byte) bool {
+		lines = append(lines, string(line))
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+func TestLinesStopBeforeTrailingHole(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	if err := os.WriteFile(path, []byte("one\ntwo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Growing the file leaves a hole where file systems support them, and
+	// zeros that were never written where they do not.
+	if err := os.Truncate(path, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFSLock(path, defaultFileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	h := f.readHandle()
+	if data, err := h.dataEnd(1 << 20); err != nil || data == 1<<20 {
+		t.Skipf("file system reports no holes (%v)", err)
+	}
+	if lines := readLines(t, f); len(lines) != 2 || lines[0] != "one" || lines[1] != "two" {
+		t.Fatalf("Lines = %q, want the two lines before the hole", lines)
+	}
+}
+
+func TestLinesKeepTrailingZeros(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	f, err := NewFSLock(path, defaultFileMode|os.O_CREATE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.AppendLine([]byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Write([]byte("two\x00\x00")); err != nil {
+		t.Fatal(err)
+	}
+	if lines := readLines(t, f); len(lines) != 2 || lines[1] != "two\x00\x00" {
+		t.Fatalf("Lines = %q", lines)
+	}
+	f.Close()
+
+	// Derived again on open, from the holes alone.
+	f, err = NewFSLock(path, defaultFileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if lines := readLines(t, f); len(lines) != 2 || lines[1] != "two\x00\x00" {
+		t.Fatalf("Lines after reopen = %q", lines)
+	}
+}
@@ -0,0 +1,41 @@
+package fslock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLinesStopAtLogicalEnd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	f, err := NewFSLock(path, defaultFileMode|os.O_CREATE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Preallocate(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"one", "two\x00"} {
+		if _, err := f.AppendLine([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var lines []string
+	if err := f.Lines(func(offset int64, line []byte) bool {
+		lines = append(lines, string(line))
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || lines[0] != "one" || lines[1] != "two\x00" {
+		t.Fatalf("Lines = %q", lines)
+	}
+	logical, physical, err := f.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logical != 9 || physical != 9 {
+		t.Fatalf("Size = %d, %d, want 9, 9", logical, physical)
+	}
+}
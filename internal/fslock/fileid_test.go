@@ -0,0 +1,40 @@
+package fslock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileID(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log")
+	fileID := func(name string) uint64 {
+		t.Helper()
+		f, err := NewFSLockWithOptions(name, Options{Mode: defaultFileMode | os.O_CREATE})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		id, err := f.FileID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	id := fileID(path)
+	if again := fileID(filepath.Join(dir, ".", "log")); again != id {
+		t.Fatalf("FileID through another path = %x, want %x", again, id)
+	}
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if renamed := fileID(path + ".1"); renamed != id {
+		t.Fatalf("FileID after rename = %x, want %x", renamed, id)
+	}
+	// The renamed file still exists, so the new one can not reuse its inode.
+	if recreated := fileID(path); recreated == id {
+		t.Fatalf("FileID of the recreated file = %x, same as the old one", recreated)
+	}
+}
@@ -0,0 +1,30 @@
+//go:build unix
+
+package fslock
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+
+	"golang.org/x/sys/unix"
+)
+
+// FileID returns an identity of the open file that stays the same for the
+// life of the file, whatever path it is reached through, and differs from
+// that of a file later created under the same name. It folds the device and
+// inode numbers into 64 bits.
+func (f *FSLock) FileID() (id uint64, err error) {
+	defer f.wrap("stat", &err)
+	f.rlock()
+	defer f.runlock()
+	var st unix.Stat_t
+	if err := unix.Fstat(f.fd, &st); err != nil {
+		return 0, mapError(err)
+	}
+	var b [16]byte
+	binary.LittleEndian.PutUint64(b[0:], uint64(st.Dev))
+	binary.LittleEndian.PutUint64(b[8:], uint64(st.Ino))
+	h := fnv.New64a()
+	h.Write(b[:])
+	return h.Sum64(), nil
+}
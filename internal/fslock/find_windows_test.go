@@ -0,0 +1,36 @@
+package fslock
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindFirst(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, line := range []string{"a=1", "b=2", "c=3", "b=4"} {
+		if _, err := f.AppendLine([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key := func(k string) func([]byte) bool {
+		return func(line []byte) bool { return bytes.HasPrefix(line, []byte(k+"=")) }
+	}
+
+	// The first of two matches wins.
+	if line, offset, err := f.FindFirst(key("b")); err != nil || string(line) != "b=2" || offset != 4 {
+		t.Fatalf("FindFirst(b) = %q at %d, %v, want \"b=2\" at 4", line, offset, err)
+	}
+	if line, offset, err := f.FindFirst(key("c")); err != nil || string(line) != "c=3" || offset != 8 {
+		t.Fatalf("FindFirst(c) = %q at %d, %v, want \"c=3\" at 8", line, offset, err)
+	}
+	if line, _, err := f.FindFirst(key("d")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("FindFirst(d) = %q, %v, want ErrNotFound", line, err)
+	}
+}
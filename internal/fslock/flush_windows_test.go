@@ -0,0 +1,265 @@
+package fslock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// failFlushes makes every sync fail with err until restore is called or
+// the test ends.
+func failFlushes(t *testing.T, err error) (restore func()) {
+	saved := flushFileBuffers
+	flushFileBuffers = func(windows.Handle) error { return err }
+	restore = func() { flushFileBuffers = saved }
+	t.Cleanup(restore)
+	return restore
+}
+
+func TestFlushErrorIsRetained(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Write([]byte("one\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	failed := windows.ERROR_IO_DEVICE
+	restore := failFlushes(t, failed)
+	if err := f.Flush(); !errors.Is(err, failed) {
+		t.Fatalf("Flush = %v, want %v", err, failed)
+	}
+	restore()
+	for i := 0; i < 2; i++ {
+		if err := f.Write([]byte("two\n")); !errors.Is(err, failed) {
+			t.Fatalf("Write %d after a failed Flush = %v, want %v", i, err, failed)
+		}
+	}
+	if err := f.Flush(); !errors.Is(err, failed) {
+		t.Fatalf("Flush after a failed Flush = %v, want %v", err, failed)
+	}
+	if data, err := f.Read(); err != nil || string(data) != "one\n" {
+		t.Fatalf("file holds %q, %v", data, err)
+	}
+
+	if err := f.ClearError(); !errors.Is(err, failed) {
+		t.Fatalf("ClearError = %v, want %v", err, failed)
+	}
+	if err := f.ClearError(); err != nil {
+		t.Fatalf("second ClearError = %v", err)
+	}
+	if err := f.Write([]byte("two\n")); err != nil {
+		t.Fatalf("Write after ClearError = %v", err)
+	}
+	if err := f.Flush(); err != nil {
+		t.Fatalf("Flush after ClearError = %v", err)
+	}
+}
+
+func TestFlushErrorIsRetainedByWaiters(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// The first sync blocks until released and then fails; any later one
+	// would succeed.
+	failed := windows.ERROR_IO_DEVICE
+	saved := flushFileBuffers
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls atomic.Int64
+	flushFileBuffers = func(h windows.Handle) error {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-release
+			return failed
+		}
+		return saved(h)
+	}
+	t.Cleanup(func() { flushFileBuffers = saved })
+
+	flush := func() <-chan error {
+		done := make(chan error, 1)
+		go func() { done <- f.Flush() }()
+		return done
+	}
+	if err := f.Write([]byte("one\n")); err != nil {
+		t.Fatal(err)
+	}
+	first := flush()
+	<-started
+	// This write reaches the OS after the failing sync began, so its Flush
+	// waits for that sync and then finds itself uncovered.
+	if err := f.Write([]byte("two\n")); err != nil {
+		t.Fatal(err)
+	}
+	second := flush()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	for i, done := range []<-chan error{first, second} {
+		if err := <-done; !errors.Is(err, failed) {
+			t.Fatalf("Flush %d = %v, want %v", i, err, failed)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("%d syncs, want none after the failure", n)
+	}
+}
+
+func TestCloseReleasesLockAfterFailedSync(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	f, err := NewFSLockWithOptions(path, Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Write([]byte("record\n")); err != nil {
+		t.Fatal(err)
+	}
+	failed := windows.ERROR_IO_DEVICE
+	restore := failFlushes(t, failed)
+	if err := f.Close(); !errors.Is(err, failed) {
+		t.Fatalf("Close = %v, want %v", err, failed)
+	}
+	restore()
+	// The failed sync did not stop Close from unlocking and closing.
+	if lockedElsewhere(t, path, false) {
+		t.Fatal("lock still held after a Close whose sync failed")
+	}
+	g, err := NewFSLock(path, defaultFileMode)
+	if err != nil {
+		t.Fatalf("NewFSLock after Close = %v", err)
+	}
+	g.Close()
+}
+
+func TestFlushErrorNamesOpAndPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	f, err := NewFSLockWithOptions(path, Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Write([]byte("one\n")); err != nil {
+		t.Fatal(err)
+	}
+	failFlushes(t, windows.ERROR_IO_DEVICE)
+	err = f.Flush()
+	var pe *PathError
+	if !errors.As(err, &pe) || pe.Op != "flush" || pe.Path != path {
+		t.Fatalf("Flush = %#v, want a flush PathError for %s", err, path)
+	}
+	var errno windows.Errno
+	if !errors.As(err, &errno) || errno != windows.ERROR_IO_DEVICE {
+		t.Fatalf("Flush = %v, does not unwrap to the errno", err)
+	}
+	f.ClearError()
+}
+
+func TestConcurrentFlushesCoalesce(t *testing.T) {
+	syncs := 0
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{
+		Mode:     defaultFileMode | os.O_CREATE,
+		Observer: Observer{OnSync: func() { syncs++ }},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// Slow syncs down, so that callers pile up behind the one in flight.
+	saved := flushFileBuffers
+	var issued atomic.Int64
+	flushFileBuffers = func(h windows.Handle) error {
+		issued.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		return saved(h)
+	}
+	t.Cleanup(func() { flushFileBuffers = saved })
+
+	const callers = 50
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := f.Write([]byte("record\n")); err != nil {
+				t.Error(err)
+				return
+			}
+			if err := f.Flush(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := issued.Load(); n >= callers/5 || int64(syncs) != n {
+		t.Fatalf("%d Flush calls issued %d syncs, %d observed", callers, n, syncs)
+	}
+	if data, err := f.Read(); err != nil || len(data) != callers*len("record\n") {
+		t.Fatalf("file holds %d bytes, %v", len(data), err)
+	}
+}
+
+func TestBarrierCoversCompletedWrites(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// durable is how much of the file the completed syncs cover: the size
+	// it had when each of them started.
+	var mu sync.Mutex
+	durable := int64(0)
+	saved := flushFileBuffers
+	flushFileBuffers = func(h windows.Handle) error {
+		size, err := fileSize(h)
+		if err != nil {
+			return err
+		}
+		time.Sleep(time.Millisecond)
+		if err := saved(h); err != nil {
+			return err
+		}
+		mu.Lock()
+		if size > durable {
+			durable = size
+		}
+		mu.Unlock()
+		return nil
+	}
+	t.Cleanup(func() { flushFileBuffers = saved })
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				offset, n, err := f.WriteVectored([]byte("record\n"))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if err := f.Barrier(); err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				covered := durable
+				mu.Unlock()
+				if end := offset + int64(n); covered < end {
+					t.Errorf("Barrier returned with the write ending at %d not yet synced, syncs cover %d bytes", end, covered)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,90 @@
+package fslock
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// flushGroup coalesces concurrent Flush calls, much like a group commit:
+// while one caller syncs the file, the others wait for it and return without
+// a sync of their own when it covered their writes.
+type flushGroup struct {
+	// written counts the writes handed to the OS and synced is the count
+	// covered by the last completed sync.
+	written atomic.Int64
+
+	mu      sync.Mutex
+	cond    sync.Cond
+	running bool
+	synced  int64
+}
+
+// covered records that a sync completed covering the first seq writes.
+func (g *flushGroup) covered(seq int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if seq > g.synced {
+		g.synced = seq
+	}
+}
+
+// syncThrough returns once a sync that started after the first seq writes
+// has completed, running one itself when none is in flight. It is called
+// without the FSLock mutex, so writers can keep appending during the sync.
+func (f *FSLock) syncThrough(seq int64) error {
+	g := &f.group
+	g.mu.Lock()
+	if g.cond.L == nil {
+		g.cond.L = &g.mu
+	}
+	for g.synced < seq && g.running {
+		g.cond.Wait()
+	}
+	if g.synced >= seq {
+		g.mu.Unlock()
+		return nil
+	}
+	g.running = true
+	start := g.written.Load()
+	g.mu.Unlock()
+
+	// A sync that failed while this caller waited is retained like any
+	// other, so a fresh sync that happens to succeed must not hide it.
+	f.lock()
+	err := f.flushErr
+	f.unlock()
+	if err == nil {
+		err = f.runSync(start)
+	}
+
+	g.mu.Lock()
+	g.running = false
+	if err == nil && start > g.synced {
+		g.synced = start
+	}
+	g.cond.Broadcast()
+	g.mu.Unlock()
+	return err
+}
+
+// runSync syncs the file on behalf of the group, retaining a failure. start
+// is the write count when the sync was claimed.
+func (f *FSLock) runSync(start int64) error {
+	err := flushFileBuffers(f.handler)
+
+	f.lock()
+	if err != nil {
+		f.flushErr = pathError("flush", f.file.Name(), mapError(err))
+		err = f.flushErr
+	} else {
+		if f.group.written.Load() == start && len(f.wbuf) == 0 {
+			f.dirty = false
+		}
+		f.stats.flushes.Add(1)
+	}
+	f.unlock()
+	if err == nil && f.opts.Observer.OnSync != nil {
+		f.opts.Observer.OnSync()
+	}
+	return err
+}
@@ -0,0 +1,192 @@
+package fslock
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// FollowPollInterval bounds how long WaitForGrowth goes without checking the
+// file size. Where directory change notifications are unavailable, as on
+// some network filesystems, it is the polling period.
+var FollowPollInterval = 250 * time.Millisecond
+
+const notifyBufferSize = 4096
+
+var (
+	// readDirectoryChanges and closeHandle back the directory watcher, so
+	// tests can make notifications fail and see what gets closed.
+	readDirectoryChanges = windows.ReadDirectoryChanges
+	closeHandle          = windows.CloseHandle
+)
+
+// WaitForGrowth blocks until the file is larger than size and returns its new
+// size. It sleeps on change notifications for the parent directory rather
+// than polling, falling back to polling when notifications are unavailable.
+// A positive timeout bounds the wait, after which ErrTimeout is returned.
+func (r *FSLockReader) WaitForGrowth(size int64, timeout time.Duration) (int64, error) {
+	n, err := waitForGrowth(r.handler, r.path, size, timeout)
+	return n, pathError("follow", r.path, err)
+}
+
+func waitForGrowth(handler windows.Handle, path string, size int64, timeout time.Duration) (int64, error) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	// Without a watcher, or once notifications fail and the loop drops it,
+	// the wait polls instead.
+	w, _ := watchFile(path)
+	defer func() {
+		if w != nil {
+			w.close()
+		}
+	}()
+
+	for {
+		current, err := fileSize(handler)
+		if err != nil {
+			return 0, err
+		}
+		if current > size {
+			return current, nil
+		}
+
+		wait := FollowPollInterval
+		if !deadline.IsZero() {
+			left := time.Until(deadline)
+			if left <= 0 {
+				return current, ErrTimeout
+			}
+			if left < wait {
+				wait = left
+			}
+		}
+		if w != nil {
+			if err := w.wait(wait); err == nil {
+				continue
+			}
+			w.close()
+			w = nil
+		}
+		time.Sleep(wait)
+	}
+}
+
+// dirWatcher waits for size and last-write changes to one file through
+// ReadDirectoryChangesW on its parent directory. Changes that arrive between
+// waits are queued by the system and delivered together, so a burst of
+// appends wakes the waiter once.
+type dirWatcher struct {
+	dir     windows.Handle
+	name    string
+	ov      *windows.Overlapped
+	buf     []byte
+	pending bool
+}
+
+func watchFile(path string) (*dirWatcher, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := utf16Path(filepath.Dir(abs))
+	if err != nil {
+		return nil, err
+	}
+	share := uint32(windows.FILE_SHARE_READ | windows.FILE_SHARE_WRITE | windows.FILE_SHARE_DELETE)
+	flags := uint32(windows.FILE_FLAG_BACKUP_SEMANTICS | windows.FILE_FLAG_OVERLAPPED)
+	h, err := windows.CreateFile(dir, windows.FILE_LIST_DIRECTORY, share, nil, windows.OPEN_EXISTING, flags, 0)
+	if err != nil {
+		return nil, err
+	}
+	ov, err := newOverlapped()
+	if err != nil {
+		windows.CloseHandle(h)
+		return nil, err
+	}
+	return &dirWatcher{dir: h, name: filepath.Base(abs), ov: ov, buf: make([]byte, notifyBufferSize)}, nil
+}
+
+// wait blocks for up to d or until the watched file changes.
+func (w *dirWatcher) wait(d time.Duration) error {
+	deadline := time.Now().Add(d)
+	for {
+		if !w.pending {
+			mask := uint32(windows.FILE_NOTIFY_CHANGE_SIZE | windows.FILE_NOTIFY_CHANGE_LAST_WRITE)
+			if err := readDirectoryChanges(w.dir, &w.buf[0], uint32(len(w.buf)), false, mask, nil, w.ov, 0); err != nil {
+				return err
+			}
+			w.pending = true
+		}
+
+		left := time.Until(deadline)
+		if left <= 0 {
+			return nil
+		}
+		ms := uint32(left.Milliseconds())
+		if ms == 0 {
+			ms = 1
+		}
+		s, err := windows.WaitForSingleObject(w.ov.HEvent, ms)
+		switch s {
+		case windows.WAIT_OBJECT_0:
+		case uint32(windows.WAIT_TIMEOUT):
+			return nil
+		default:
+			return err
+		}
+
+		w.pending = false
+		var n uint32
+		if err := windows.GetOverlappedResult(w.dir, w.ov, &n, false); err != nil {
+			return err
+		}
+		windows.ResetEvent(w.ov.HEvent)
+		if w.matches(n) {
+			return nil
+		}
+	}
+}
+
+// matches reports whether the n bytes of notifications in the buffer
+// include the watched file. An empty result means the system dropped
+// notifications, which could have included it.
+func (w *dirWatcher) matches(n uint32) bool {
+	if n == 0 {
+		return true
+	}
+	for off := uint32(0); off < n; {
+		info := (*windows.FileNotifyInformation)(unsafe.Pointer(&w.buf[off]))
+		name := unsafe.Slice(&info.FileName, info.FileNameLength/2)
+		if strings.EqualFold(windows.UTF16ToString(name), w.name) {
+			return true
+		}
+		if info.NextEntryOffset == 0 {
+			break
+		}
+		off += info.NextEntryOffset
+	}
+	return false
+}
+
+// close cancels the pending read and closes the handles. Calling it again
+// does nothing, so a handle number the system has since reused is never
+// closed by mistake.
+func (w *dirWatcher) close() {
+	if w.dir == 0 {
+		return
+	}
+	if w.pending {
+		var n uint32
+		windows.CancelIoEx(w.dir, w.ov)
+		windows.GetOverlappedResult(w.dir, w.ov, &n, true)
+		w.pending = false
+	}
+	closeHandle(w.dir)
+	closeHandle(w.ov.HEvent)
+	w.dir, w.ov.HEvent = 0, 0
+}
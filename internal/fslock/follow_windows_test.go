@@ -0,0 +1,113 @@
+package fslock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// cpuTime returns the user and kernel time this process has used so far.
+func cpuTime(t *testing.T) time.Duration {
+	t.Helper()
+	var creation, exit, kernel, user windows.Filetime
+	if err := windows.GetProcessTimes(windows.CurrentProcess(), &creation, &exit, &kernel, &user); err != nil {
+		t.Fatal(err)
+	}
+	// The times are counts of 100ns intervals, not dates.
+	ticks := func(ft windows.Filetime) int64 { return int64(ft.HighDateTime)<<32 | int64(ft.LowDateTime) }
+	return time.Duration(ticks(kernel)+ticks(user)) * 100
+}
+
+func TestWaitForGrowthWakesOnAppend(t *testing.T) {
+	saved := FollowPollInterval
+	FollowPollInterval = 10 * time.Second
+	t.Cleanup(func() { FollowPollInterval = saved })
+
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := f.NewReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	const idle = 300 * time.Millisecond
+	cpu, start := cpuTime(t), time.Now()
+	go func() {
+		time.Sleep(idle)
+		if err := f.Write([]byte("record\n")); err != nil {
+			t.Error(err)
+		}
+	}()
+	size, err := r.WaitForGrowth(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+	if size != int64(len("record\n")) {
+		t.Fatalf("WaitForGrowth = %d", size)
+	}
+	// The append is noticed long before the next poll would have run, and
+	// the wait before it was spent asleep.
+	if elapsed > FollowPollInterval/2 {
+		t.Fatalf("WaitForGrowth took %v with a poll interval of %v", elapsed, FollowPollInterval)
+	}
+	if used := cpuTime(t) - cpu; used > idle/2 {
+		t.Fatalf("waiting %v used %v of CPU", elapsed, used)
+	}
+}
+
+func TestWaitForGrowthFallsBackToPolling(t *testing.T) {
+	saved := FollowPollInterval
+	FollowPollInterval = 20 * time.Millisecond
+	t.Cleanup(func() { FollowPollInterval = saved })
+	// Notifications fail once the watcher is set up, as they do on some
+	// network filesystems, and every close is counted.
+	closes := map[windows.Handle]int{}
+	savedRead, savedClose := readDirectoryChanges, closeHandle
+	readDirectoryChanges = func(windows.Handle, *byte, uint32, bool, uint32, *uint32, *windows.Overlapped, uintptr) error {
+		return windows.ERROR_INVALID_FUNCTION
+	}
+	closeHandle = func(h windows.Handle) error {
+		closes[h]++
+		return windows.CloseHandle(h)
+	}
+	t.Cleanup(func() { readDirectoryChanges, closeHandle = savedRead, savedClose })
+
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := f.NewReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		if err := f.Write([]byte("record\n")); err != nil {
+			t.Error(err)
+		}
+	}()
+	if size, err := r.WaitForGrowth(0, 5*time.Second); err != nil || size != int64(len("record\n")) {
+		t.Fatalf("WaitForGrowth = %d, %v", size, err)
+	}
+	// The directory handle and the event of the dropped watcher are each
+	// closed once, not again when the wait returns.
+	if len(closes) != 2 {
+		t.Fatalf("closed %v, want the directory and the event", closes)
+	}
+	for h, n := range closes {
+		if n != 1 {
+			t.Fatalf("handle %v closed %d times", h, n)
+		}
+	}
+}
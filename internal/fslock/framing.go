@@ -0,0 +1,65 @@
+package fslock
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// A framed record is laid out as
+//
+//	length uint32 | crc32c(payload) uint32 | payload | length uint32
+//
+// with every integer little endian. The trailing length allows walking the
+// log backwards from its end.
+const (
+	frameHeaderSize  = 8
+	frameTrailerSize = 4
+	frameOverhead    = frameHeaderSize + frameTrailerSize
+)
+
+// MaxRecordSize bounds the payload length accepted when decoding, so a
+// garbage length read from a damaged file is rejected instead of allocated.
+var MaxRecordSize uint32 = 64 << 20
+
+// RecoveryReport describes the outcome of scanning a framed log.
+type RecoveryReport struct {
+	// ScannedBytes is how much of the file was examined.
+	ScannedBytes int64
+	// ValidRecords counts the records before the first damaged one.
+	ValidRecords int64
+	// TruncatedAt is the offset of the first damaged record, where the
+	// valid part of the log ends, or -1 when every record is valid.
+	TruncatedAt int64
+	// FirstError is the error the first damaged record failed with.
+	FirstError error
+}
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+func encodeFrame(payload []byte) []byte {
+	frame := make([]byte, frameOverhead+len(payload))
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(frame[4:8], crc32.Checksum(payload, crcTable))
+	copy(frame[frameHeaderSize:], payload)
+	binary.LittleEndian.PutUint32(frame[frameHeaderSize+len(payload):], uint32(len(payload)))
+	return frame
+}
+
+func decodeFrameHeader(header []byte) (length uint32, sum uint32) {
+	return binary.LittleEndian.Uint32(header[0:4]), binary.LittleEndian.Uint32(header[4:8])
+}
+
+// checkFrameBody validates the trailer that follows a header and, when verify
+// is set, the payload checksum. A bad checksum in an otherwise intact frame
+// is reported as ErrChecksumMismatch, since the frames after it can still be
+// found.
+func checkFrameBody(body []byte, length uint32, sum uint32, verify bool) ([]byte, error) {
+	payload := body[:length]
+	if binary.LittleEndian.Uint32(body[length:]) != length {
+		return nil, ErrCorrupt
+	}
+	if verify && crc32.Checksum(payload, crcTable) != sum {
+		return nil, ErrChecksumMismatch
+	}
+	return payload, nil
+}
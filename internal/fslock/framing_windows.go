@@ -0,0 +1,198 @@
+package fslock
+
+import (
+	"errors"
+	"fmt"
+)
+
+// WriteRecord appends payload as a single framed record and returns the
+// offset the record starts at.
+func (f *FSLock) WriteRecord(payload []byte) (offset int64, err error) {
+	defer f.wrap("write", &err)
+	if uint32(len(payload)) > MaxRecordSize {
+		return 0, ErrRecordTooLarge
+	}
+	frame := encodeFrame(payload)
+
+	f.lock()
+	defer f.unlock()
+	offset, err = f.end()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.write(frame); err != nil {
+		return 0, err
+	}
+	return offset, nil
+}
+
+// ReadRecordAt reads the framed record starting at offset and returns its
+// payload together with the offset of the next record.
+func (f *FSLock) ReadRecordAt(offset int64) (payload []byte, next int64, err error) {
+	defer f.wrap("read", &err)
+	if err := f.drainForRead(); err != nil {
+		return nil, offset, err
+	}
+	f.rlock()
+	defer f.runlock()
+	f.stats.reads.Add(1)
+	size, err := fileSize(f.handler)
+	if err != nil {
+		return nil, offset, err
+	}
+	return f.readHandle().readRecordAt(offset, size)
+}
+
+// Records calls fn for every framed record from the start of the file, until
+// fn returns false. Each payload's checksum is verified unless the
+// SkipChecksums option is set; a record that fails it is passed to fn with
+// a nil payload and ErrChecksumMismatch, and iteration continues past it if
+// fn returns true. A record whose framing is damaged ends iteration with an
+// error naming its offset.
+func (f *FSLock) Records(fn func(offset int64, payload []byte, err error) bool) (err error) {
+	defer f.wrap("read", &err)
+	if err := f.drainForRead(); err != nil {
+		return err
+	}
+	f.rlock()
+	defer f.runlock()
+
+	h := f.readHandle()
+	size, err := fileSize(h.handler)
+	if err != nil {
+		return err
+	}
+	offset := int64(0)
+	for offset < size {
+		payload, next, err := h.readFrameAt(offset, size, !f.opts.SkipChecksums)
+		if err != nil && err != ErrChecksumMismatch {
+			return fmt.Errorf("record at offset %d: %w", offset, err)
+		}
+		if !fn(offset, payload, err) {
+			return nil
+		}
+		offset = next
+	}
+	return nil
+}
+
+// ScanIntegrity validates every framed record and returns the offset of the
+// first one that is corrupt or truncated, or -1 when the whole file is valid.
+func (f *FSLock) ScanIntegrity() (firstBad int64, err error) {
+	defer f.wrap("read", &err)
+	if err := f.drainForRead(); err != nil {
+		return -1, err
+	}
+	f.rlock()
+	defer f.runlock()
+	report, err := f.readHandle().scanRecords()
+	return report.TruncatedAt, err
+}
+
+// Recover scans the framed records like ScanIntegrity and truncates the file
+// at the first corrupt or partial record, discarding the damaged tail. The
+// report tells what was kept and where the file was cut. Writes refused
+// after an ErrShortWrite proceed again once it returns.
+func (f *FSLock) Recover() (report RecoveryReport, err error) {
+	defer f.wrap("truncate", &err)
+	f.lock()
+	defer f.unlock()
+
+	if err := f.drain(); err != nil && !errors.Is(err, ErrShortWrite) {
+		return RecoveryReport{TruncatedAt: -1}, err
+	}
+	report, err = f.readHandle().scanRecords()
+	if err != nil {
+		return report, err
+	}
+	if report.TruncatedAt >= 0 {
+		if err := f.truncate(report.TruncatedAt); err != nil {
+			return report, err
+		}
+	}
+	f.repaired()
+	return report, nil
+}
+
+// scanRecords walks the framed records from the start of the file and stops
+// at the first one that fails validation.
+func (h readHandle) scanRecords() (RecoveryReport, error) {
+	report := RecoveryReport{TruncatedAt: -1}
+	size, err := fileSize(h.handler)
+	if err != nil {
+		return report, err
+	}
+
+	offset := int64(0)
+	for offset < size {
+		_, next, err := h.readRecordAt(offset, size)
+		if err == ErrCorrupt {
+			report.TruncatedAt = offset
+			report.FirstError = err
+			break
+		}
+		if err != nil {
+			report.FirstError = err
+			return report, err
+		}
+		report.ValidRecords++
+		report.ScannedBytes = next
+		offset = next
+	}
+	if report.TruncatedAt >= 0 {
+		report.ScannedBytes = size
+	}
+	return report, nil
+}
+
+func (h readHandle) readRecordAt(offset int64, size int64) ([]byte, int64, error) {
+	payload, next, err := h.readFrameAt(offset, size, true)
+	if err == ErrChecksumMismatch {
+		err = ErrCorrupt
+	}
+	return payload, next, err
+}
+
+// readFrameAt reads the frame at offset. On ErrChecksumMismatch next still
+// points past the damaged frame.
+func (h readHandle) readFrameAt(offset int64, size int64, verify bool) ([]byte, int64, error) {
+	if offset >= size {
+		return nil, offset, EOF
+	}
+	if size-offset < frameOverhead {
+		return nil, offset, ErrCorrupt
+	}
+
+	header := make([]byte, frameHeaderSize)
+	n, err := h.readAt(header, offset)
+	if err != nil {
+		return nil, offset, err
+	}
+	if n < frameHeaderSize {
+		return nil, offset, ErrCorrupt
+	}
+
+	length, sum := decodeFrameHeader(header)
+	if length > MaxRecordSize || int64(length) > size-offset-frameOverhead {
+		return nil, offset, ErrCorrupt
+	}
+
+	body := make([]byte, int(length)+frameTrailerSize)
+	n, err = h.readAt(body, offset+frameHeaderSize)
+	if err != nil {
+		return nil, offset, err
+	}
+	if n < len(body) {
+		return nil, offset, ErrCorrupt
+	}
+
+	next := offset + frameOverhead + int64(length)
+	payload, err := checkFrameBody(body, length, sum, verify)
+	if err == ErrChecksumMismatch {
+		return nil, next, err
+	}
+	if err != nil {
+		return nil, offset, err
+	}
+	return payload, next, nil
+}
@@ -0,0 +1,227 @@
+package fslock
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// framedFile writes payloads as framed records to a new file and returns its
+// path and the offset of every record.
+func framedFile(t *testing.T, payloads ...string) (string, []int64) {
+	t.Helper()
+	var data []byte
+	var offsets []int64
+	for _, p := range payloads {
+		offsets = append(offsets, int64(len(data)))
+		data = append(data, encodeFrame([]byte(p))...)
+	}
+	path := filepath.Join(t.TempDir(), "log")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path, append(offsets, int64(len(data)))
+}
+
+func TestRecoverReport(t *testing.T) {
+	path, offsets := framedFile(t, "one", "two", "three")
+	f, err := NewFSLock(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// A record torn by a crash: a header promising more than follows.
+	torn := encodeFrame([]byte("a record that was cut off"))[:12]
+	if err := f.Write(torn); err != nil {
+		t.Fatal(err)
+	}
+	size := offsets[3] + int64(len(torn))
+
+	report, err := f.Recover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RecoveryReport{ScannedBytes: size, ValidRecords: 3, TruncatedAt: offsets[3], FirstError: ErrCorrupt}
+	if report.ScannedBytes != want.ScannedBytes || report.ValidRecords != want.ValidRecords || report.TruncatedAt != want.TruncatedAt || !errors.Is(report.FirstError, ErrCorrupt) {
+		t.Fatalf("Recover = %+v, want %+v", report, want)
+	}
+	if _, physical, err := f.Size(); err != nil || physical != offsets[3] {
+		t.Fatalf("size after Recover = %d, %v, want %d", physical, err, offsets[3])
+	}
+
+	report, err = f.Recover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (RecoveryReport{ScannedBytes: offsets[3], ValidRecords: 3, TruncatedAt: -1}); report != want {
+		t.Fatalf("Recover of a valid file = %+v, want %+v", report, want)
+	}
+}
+
+func TestRecoverReportStopsAtBadChecksum(t *testing.T) {
+	path, offsets := framedFile(t, "one", "two", "three")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[offsets[1]+frameHeaderSize] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFSLock(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if bad, err := f.ScanIntegrity(); err != nil || bad != offsets[1] {
+		t.Fatalf("ScanIntegrity = %d, %v, want %d", bad, err, offsets[1])
+	}
+	report, err := f.Recover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ValidRecords != 1 || report.TruncatedAt != offsets[1] || report.ScannedBytes != offsets[3] || !errors.Is(report.FirstError, ErrCorrupt) {
+		t.Fatalf("Recover = %+v", report)
+	}
+}
+
+func TestRecordsReportsBadChecksum(t *testing.T) {
+	path, offsets := framedFile(t, "one", "two", "three")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[offsets[1]+frameHeaderSize] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	type record struct {
+		offset  int64
+		payload string
+		err     error
+	}
+	records := func(opts Options, stop bool) []record {
+		t.Helper()
+		f, err := NewFSLockWithOptions(path, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		var got []record
+		if err := f.Records(func(offset int64, payload []byte, err error) bool {
+			got = append(got, record{offset, string(payload), err})
+			return err == nil || !stop
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	check := func(got []record, want ...record) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("Records saw %+v, want %+v", got, want)
+		}
+		for i := range want {
+			if got[i].offset != want[i].offset || got[i].payload != want[i].payload || !errors.Is(got[i].err, want[i].err) || (want[i].err == nil) != (got[i].err == nil) {
+				t.Fatalf("Records saw %+v, want %+v", got, want)
+			}
+		}
+	}
+
+	one, bad, three := record{offsets[0], "one", nil}, record{offsets[1], "", ErrChecksumMismatch}, record{offsets[2], "three", nil}
+	// The scrubber learns the offset of the corrupt record and either goes
+	// on past it or stops there.
+	check(records(Options{}, false), one, bad, three)
+	check(records(Options{}, true), one, bad)
+	// Without verification the damaged payload goes unnoticed.
+	garbled := string([]byte{'t' ^ 0xff, 'w', 'o'})
+	check(records(Options{SkipChecksums: true}, false), one, record{offsets[1], garbled, nil}, three)
+}
+
+func TestRecoverLiftsShortWriteStop(t *testing.T) {
+	path, offsets := framedFile(t, "one", "two")
+	f, err := NewFSLock(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	restore := shortWrites(t, 10)
+	if _, err := f.WriteRecord([]byte("a record that was cut off")); !errors.Is(err, ErrShortWrite) {
+		t.Fatalf("short WriteRecord = %v, want ErrShortWrite", err)
+	}
+	restore()
+	if _, err := f.WriteRecord([]byte("three")); !errors.Is(err, ErrShortWrite) {
+		t.Fatalf("WriteRecord after a short write = %v, want ErrShortWrite", err)
+	}
+
+	report, err := f.Recover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ValidRecords != 2 || report.TruncatedAt != offsets[2] {
+		t.Fatalf("Recover = %+v", report)
+	}
+	if offset, err := f.WriteRecord([]byte("three")); err != nil || offset != offsets[2] {
+		t.Fatalf("WriteRecord after Recover = %d, %v, want %d", offset, err, offsets[2])
+	}
+}
+
+func TestScanIntegrity(t *testing.T) {
+	scan := func(path string) int64 {
+		t.Helper()
+		f, err := NewFSLock(path, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		bad, err := f.ScanIntegrity()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bad
+	}
+	damage := func(path string, edit func(data []byte) []byte) {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, edit(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path, _ := framedFile(t, "one", "two", "three")
+	if bad := scan(path); bad != -1 {
+		t.Fatalf("ScanIntegrity of a good file = %d, want -1", bad)
+	}
+
+	path, offsets := framedFile(t, "one", "two", "three")
+	damage(path, func(data []byte) []byte {
+		data[offsets[1]+frameHeaderSize+1] ^= 0xff
+		return data
+	})
+	if bad := scan(path); bad != offsets[1] {
+		t.Fatalf("ScanIntegrity with a corrupt middle record = %d, want %d", bad, offsets[1])
+	}
+
+	path, offsets = framedFile(t, "one", "two", "three")
+	damage(path, func(data []byte) []byte { return data[:offsets[3]-2] })
+	if bad := scan(path); bad != offsets[2] {
+		t.Fatalf("ScanIntegrity with a truncated final record = %d, want %d", bad, offsets[2])
+	}
+
+	// A length far past the end of file is reported, not allocated or read.
+	path, offsets = framedFile(t, "one", "two")
+	damage(path, func(data []byte) []byte {
+		binary.LittleEndian.PutUint32(data[offsets[1]:], 0xfffffff0)
+		return data
+	})
+	if bad := scan(path); bad != offsets[1] {
+		t.Fatalf("ScanIntegrity with a garbage length = %d, want %d", bad, offsets[1])
+	}
+}
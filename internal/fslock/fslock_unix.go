@@ -1 +1,568 @@
+//go:build unix
+
 package fslock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// FSLock on Unix locks the file with flock(2), which Linux and Darwin both
+// provide. It implements the core of the Windows API: opening and locking,
+// appends, line reads, syncing, truncation and closing. Options it does not
+// implement are rejected by NewFSLockWithOptions with ErrInvalidOptions.
+type FSLock struct {
+	file     *os.File
+	fd       int
+	mu       sync.RWMutex
+	flushErr error
+	dirty    bool
+	opts     Options
+	writes   int
+	kind     LockKind
+	stats    counters
+	key      string
+	extent   extent
+	seek     sync.Mutex
+
+	view mmapView
+}
+
+var (
+	defaultFileMode = os.O_APPEND | os.O_RDWR
+
+	// DefaultReadLength is the ReadLength lines are read with by default.
+	DefaultReadLength = 4096
+
+	// writeFile issues writes, so tests can make them come back short.
+	writeFile = unix.Write
+)
+
+func NewFSLock(fileName string, mode int) (*FSLock, error) {
+	return NewFSLockWithOptions(fileName, Options{Mode: mode})
+}
+
+func NewFSLockWithOptions(fileName string, opts Options) (*FSLock, error) {
+	return openLocked(context.Background(), fileName, opts, unix.LOCK_EX)
+}
+
+// NewFSLockTimeout is like NewFSLock but gives up waiting for another
+// process to release the lock after timeout, failing with an error that
+// matches both ErrLocked and ErrTimeout.
+func NewFSLockTimeout(fileName string, mode int, timeout time.Duration) (*FSLock, error) {
+	return NewFSLockWithOptions(fileName, Options{Mode: mode, LockTimeout: timeout})
+}
+
+// NewFSLockContext is like NewFSLockWithOptions but also gives up waiting
+// for another process to release the lock once ctx is done, failing with an
+// error that matches both ErrLocked and ctx.Err().
+func NewFSLockContext(ctx context.Context, fileName string, opts Options) (*FSLock, error) {
+	return openLocked(ctx, fileName, opts, unix.LOCK_EX)
+}
+
+// NewFSLockShared opens the file under a shared lock, which any number of
+// processes can hold at once while writers are kept out. A zero Mode opens
+// the file read-only, and writes through the FSLock fail with ErrReadOnly.
+func NewFSLockShared(fileName string, opts Options) (*FSLock, error) {
+	return openLocked(context.Background(), fileName, opts, unix.LOCK_SH)
+}
+
+// TryLockShared is like NewFSLockShared but fails with ErrLocked instead of
+// waiting when another process holds the lock exclusively.
+func TryLockShared(fileName string, opts Options) (*FSLock, error) {
+	return openLocked(context.Background(), fileName, opts, unix.LOCK_SH|unix.LOCK_NB)
+}
+
+// TryLock is like NewFSLock but fails with ErrLocked instead of waiting when
+// another process holds the lock.
+func TryLock(fileName string, mode int) (*FSLock, error) {
+	return TryLockWithOptions(fileName, Options{Mode: mode})
+}
+
+// TryLockWithOptions is like NewFSLockWithOptions but fails with ErrLocked
+// instead of waiting when another process holds the lock.
+func TryLockWithOptions(fileName string, opts Options) (*FSLock, error) {
+	return openLocked(context.Background(), fileName, opts, unix.LOCK_EX|unix.LOCK_NB)
+}
+
+func openLocked(ctx context.Context, fileName string, opts Options, how int) (*FSLock, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, pathError("open", fileName, err)
+	}
+	if err := unsupported(opts); err != nil {
+		return nil, pathError("open", fileName, err)
+	}
+	key, err := lockKey(fileName)
+	if err != nil {
+		return nil, pathError("open", fileName, err)
+	}
+	if err := register(key); err != nil {
+		return nil, pathError("lock", fileName, err)
+	}
+	fs, err := newFSLock(ctx, fileName, opts, how)
+	if err != nil {
+		unregister(key)
+		return nil, err
+	}
+	fs.key = key
+	return fs, nil
+}
+
+// unsupported rejects the options only the Windows backend implements.
+func unsupported(o Options) error {
+	for _, c := range []struct {
+		name string
+		set  bool
+	}{
+		{"SyncInterval", o.SyncInterval > 0},
+		{"ReadTimeout", o.ReadTimeout > 0},
+		{"Inheritable", o.Inheritable},
+		{"WriteBufferSize", o.WriteBufferSize > 0},
+		{"TailBuffer", o.TailBuffer > 0},
+		{"RandomAccess", o.RandomAccess},
+		{"FixedRecordSize", o.FixedRecordSize > 0},
+		{"DrainCommitsPartial", o.DrainCommitsPartial},
+	} {
+		if c.set {
+			return fmt.Errorf("%w: %s is not supported on this platform", ErrInvalidOptions, c.name)
+		}
+	}
+	return nil
+}
+
+func newFSLock(ctx context.Context, fileName string, opts Options, how int) (*FSLock, error) {
+	// O_RDONLY is zero, so a zero Mode only selects the read-write default
+	// under an exclusive lock.
+	mode := opts.Mode
+	if mode == 0 && how&unix.LOCK_SH == 0 {
+		mode = defaultFileMode
+	}
+	file, err := openFile(fileName, mode, opts)
+	if err != nil {
+		return nil, err
+	}
+	// Pipes and character devices can neither be read at an offset nor
+	// locked, so reject them before anything relies on either.
+	if info, err := file.Stat(); err != nil || !info.Mode().IsRegular() {
+		file.Close()
+		if err == nil {
+			err = ErrNotSeekable
+		}
+		return nil, pathError("open", fileName, err)
+	}
+	fs := &FSLock{file: file, fd: int(file.Fd()), opts: opts}
+	if err := fs.lockFileContext(ctx, how); err != nil {
+		file.Close()
+		return nil, pathError("lock", fileName, err)
+	}
+	fs.kind = LockExclusive
+	if how&unix.LOCK_SH != 0 {
+		fs.kind = LockShared
+	}
+	if err := fs.deriveExtent(); err != nil {
+		file.Close()
+		return nil, pathError("stat", fileName, err)
+	}
+	return fs, nil
+}
+
+// Unlock releases the lock and closes the file without syncing it. With
+// DeleteOnClose the file is removed first, as Close does.
+func (f *FSLock) Unlock() (err error) {
+	defer f.wrap("unlock", &err)
+	defer unregister(f.key)
+	f.lock()
+	defer f.unlock()
+	var removeErr error
+	if f.opts.DeleteOnClose {
+		removeErr = os.Remove(f.file.Name())
+	}
+	f.kind = LockNone
+	f.view.close()
+	closeErr := mapError(f.file.Close())
+	if removeErr != nil {
+		return removeErr
+	}
+	return closeErr
+}
+
+func (f *FSLock) Write(data []byte) (err error) {
+	defer f.wrap("write", &err)
+	f.lock()
+	defer f.unlock()
+	_, err = f.write(data)
+	return err
+}
+
+// WriteSync appends p and syncs the file before returning, under a single
+// acquisition of the lock. It returns the offset p was written at.
+func (f *FSLock) WriteSync(p []byte) (offset int64, err error) {
+	defer f.wrap("write", &err)
+	f.lock()
+	defer f.unlock()
+
+	offset, err = fileSize(f.fd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.write(p); err != nil {
+		return offset, err
+	}
+	return offset, f.flush()
+}
+
+// AppendLine appends p terminated by exactly one newline, adding it only if
+// p does not already end with one. It returns the number of bytes written.
+func (f *FSLock) AppendLine(p []byte) (n int, err error) {
+	defer f.wrap("write", &err)
+	if len(p) == 0 || p[len(p)-1] != '\n' {
+		line := make([]byte, len(p)+1)
+		copy(line, p)
+		line[len(p)] = '\n'
+		p = line
+	}
+
+	f.lock()
+	defer f.unlock()
+	return f.write(p)
+}
+
+// WriteVectored appends bufs in order as one logical write, without
+// concatenating them first. It returns the offset the first buffer landed at
+// and the total number of bytes written.
+func (f *FSLock) WriteVectored(bufs ...[]byte) (offset int64, total int, err error) {
+	defer f.wrap("write", &err)
+	f.lock()
+	defer f.unlock()
+
+	if err := f.writable(); err != nil {
+		return 0, 0, err
+	}
+	offset, err = fileSize(f.fd)
+	if err != nil {
+		return 0, 0, err
+	}
+	size := int64(0)
+	for _, buf := range bufs {
+		size += int64(len(buf))
+	}
+	if err := f.checkMaxBytes(offset, size); err != nil {
+		return offset, 0, err
+	}
+	total = 0
+	for _, buf := range bufs {
+		n, err := writeFile(f.fd, buf)
+		f.extent.appended(n)
+		if err != nil {
+			return offset, total, mapError(err)
+		}
+		total += n
+		if err := f.wroteBytes(n, len(buf)); err != nil {
+			return offset, total, err
+		}
+	}
+	return offset, total, f.wrote()
+}
+
+func (f *FSLock) write(data []byte) (int, error) {
+	if err := f.writable(); err != nil {
+		return 0, err
+	}
+	if f.opts.MaxBytes > 0 {
+		end, err := fileSize(f.fd)
+		if err != nil {
+			return 0, err
+		}
+		if err := f.checkMaxBytes(end, int64(len(data))); err != nil {
+			return 0, err
+		}
+	}
+	n, err := writeFile(f.fd, data)
+	f.extent.appended(n)
+	if err != nil {
+		return n, mapError(err)
+	}
+	if err := f.wroteBytes(n, len(data)); err != nil {
+		return n, err
+	}
+	return n, f.wrote()
+}
+
+func (f *FSLock) writable() error {
+	if f.kind == LockShared {
+		return ErrReadOnly
+	}
+	return f.flushErr
+}
+
+// wroteBytes accounts for n of want bytes reaching the file. The file ends
+// inside a record after a short write, so further writes are refused until
+// TruncateToLastLine cuts the torn record off.
+func (f *FSLock) wroteBytes(n int, want int) error {
+	f.dirty = true
+	if n < want {
+		f.flushErr = pathError("write", f.file.Name(), fmt.Errorf("%w: wrote %d of %d bytes", ErrShortWrite, n, want))
+		return f.flushErr
+	}
+	f.stats.bytesWritten.Add(int64(n))
+	return nil
+}
+
+// checkMaxBytes rejects a write of n bytes at end that would grow the file
+// past the MaxBytes option. Callers hold the write lock, so the check can not
+// race with another append.
+func (f *FSLock) checkMaxBytes(end, n int64) error {
+	if f.opts.MaxBytes > 0 && end+n > f.opts.MaxBytes {
+		return ErrMaxSizeExceeded
+	}
+	return nil
+}
+
+// wrote accounts for one logical write and runs the periodic sync policy.
+func (f *FSLock) wrote() error {
+	if f.opts.SyncEveryN > 0 {
+		f.writes++
+		if f.writes >= f.opts.SyncEveryN {
+			f.writes = 0
+			return f.flush()
+		}
+	}
+	return nil
+}
+
+// Flush syncs the file to disk. A failed sync is retained and returned by
+// every following Write and Flush until it is acknowledged with ClearError.
+func (f *FSLock) Flush() (err error) {
+	defer f.wrap("flush", &err)
+	f.lock()
+	defer f.unlock()
+	return f.flush()
+}
+
+// Barrier returns once every write that completed before the call is
+// durable. Writes are never buffered on Unix, so it is the same as Flush.
+func (f *FSLock) Barrier() (err error) {
+	defer f.wrap("barrier", &err)
+	f.lock()
+	defer f.unlock()
+	return f.flush()
+}
+
+func (f *FSLock) flush() error {
+	if f.flushErr != nil {
+		return f.flushErr
+	}
+	if err := syncFile(f.fd); err != nil {
+		f.flushErr = pathError("flush", f.file.Name(), mapError(err))
+		return f.flushErr
+	}
+	f.dirty = false
+	f.stats.flushes.Add(1)
+	if f.opts.Observer.OnSync != nil {
+		f.opts.Observer.OnSync()
+	}
+	return nil
+}
+
+// ClearError acknowledges a retained flush error and returns it.
+func (f *FSLock) ClearError() error {
+	f.lock()
+	defer f.unlock()
+	err := f.flushErr
+	f.flushErr = nil
+	return err
+}
+
+// Close syncs pending writes, releases the lock and closes the file. With
+// DeleteOnClose the file is removed first, while it is still locked.
+func (f *FSLock) Close() (err error) {
+	defer f.wrap("close", &err)
+	defer unregister(f.key)
+	f.lock()
+	defer f.unlock()
+
+	var syncErr error
+	if f.dirty {
+		syncErr = f.flush()
+	}
+	var removeErr error
+	if f.opts.DeleteOnClose {
+		removeErr = os.Remove(f.file.Name())
+	}
+	f.view.close()
+	unlockErr := mapError(unix.Flock(f.fd, unix.LOCK_UN))
+	closeErr := f.file.Close()
+	f.kind = LockNone
+	if pe, ok := closeErr.(*os.PathError); ok {
+		closeErr = mapError(pe.Err)
+	}
+	for _, err := range []error{syncErr, removeErr, unlockErr, closeErr} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FSLock) Read() (data []byte, err error) {
+	defer f.wrap("read", &err)
+	f.rlock()
+	defer f.runlock()
+	f.stats.reads.Add(1)
+	return f.readHandle().readAll()
+}
+
+// ReadAtToEndOfLine returns the line starting at offset, reading length bytes
+// at a time until the newline is found. A negative offset returns
+// ErrInvalidOffset and an offset at or past the end of file returns EOF.
+func (f *FSLock) ReadAtToEndOfLine(offset int64, length int) (line []byte, err error) {
+	defer f.wrap("read", &err)
+	f.rlock()
+	defer f.runlock()
+	f.stats.reads.Add(1)
+	if f.opts.MmapReads {
+		line, err = f.view.lineAt(f.fd, offset)
+	} else {
+		line, err = f.readHandle().readAtToEndOfLine(offset, length)
+	}
+	if err == nil {
+		f.lineRead(offset, line)
+	}
+	return line, err
+}
+
+func (f *FSLock) lineRead(offset int64, line []byte) {
+	if f.opts.Observer.OnLineRead != nil {
+		f.opts.Observer.OnLineRead(offset, line)
+	}
+}
+
+// ReadLineFrom reads the line starting at offset using Options.ReadLength as
+// the initial buffer length and returns it along with the offset of the next
+// line.
+func (f *FSLock) ReadLineFrom(offset int64) ([]byte, int64, error) {
+	line, err := f.ReadAtToEndOfLine(offset, f.readLength())
+	if err != nil {
+		return nil, offset, err
+	}
+	return line, offset + int64(len(line)) + 1, nil
+}
+
+// Lines calls fn for every line up to the logical end of the file, stopping
+// early when fn returns false. A hole at the tail of the file is not read
+// as lines.
+func (f *FSLock) Lines(fn func(offset int64, line []byte) bool) error {
+	return f.LinesFrom(0, fn)
+}
+
+// LinesFrom is like Lines but starts at offset, which must be the start of a
+// line, so a caller that already processed the file up to offset only reads
+// what was appended since.
+func (f *FSLock) LinesFrom(offset int64, fn func(offset int64, line []byte) bool) (err error) {
+	defer f.wrap("read", &err)
+	if offset < 0 {
+		return ErrInvalidOffset
+	}
+	f.rlock()
+	defer f.runlock()
+
+	h := f.readHandle()
+	end, _, err := f.logicalSize()
+	if err != nil {
+		return err
+	}
+	for offset < end {
+		line, err := h.readAtToEndOfLine(offset, f.readLength())
+		if err == EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if offset+int64(len(line)) > end {
+			line = line[:end-offset]
+		}
+		f.lineRead(offset, line)
+		if !fn(offset, line) {
+			return nil
+		}
+		offset += int64(len(line)) + 1
+	}
+	return nil
+}
+
+func (f *FSLock) wrap(op string, err *error) {
+	*err = pathError(op, f.file.Name(), *err)
+}
+
+func (f *FSLock) Stats() FSLockStats {
+	return f.stats.snapshot()
+}
+
+func (f *FSLock) lock() {
+	if !f.opts.NoMutex {
+		f.stats.waiters.Add(1)
+		f.mu.Lock()
+		f.stats.waiters.Add(-1)
+	}
+}
+
+func (f *FSLock) unlock() {
+	if !f.opts.NoMutex {
+		f.mu.Unlock()
+	}
+}
+
+func (f *FSLock) rlock() {
+	if !f.opts.NoMutex {
+		f.stats.waiters.Add(1)
+		f.mu.RLock()
+		f.stats.waiters.Add(-1)
+	}
+}
+
+func (f *FSLock) runlock() {
+	if !f.opts.NoMutex {
+		f.mu.RUnlock()
+	}
+}
+
+func (f *FSLock) readHandle() readHandle {
+	return readHandle{fd: f.fd, seek: &f.seek}
+}
+
+func fileSize(fd int) (int64, error) {
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return 0, mapError(err)
+	}
+	return st.Size, nil
+}
+
+// mapError wraps a native error with the portable sentinel it corresponds
+// to, leaving unknown errors untouched.
+func mapError(err error) error {
+	var kind error
+	switch err {
+	case nil:
+		return nil
+	case unix.EWOULDBLOCK:
+		kind = ErrAlreadyLocked
+	case unix.EBADF:
+		kind = ErrClosed
+	case unix.EACCES, unix.EPERM, unix.EROFS:
+		kind = ErrReadOnly
+	case unix.ENOSPC, unix.EDQUOT:
+		kind = ErrNoSpace
+	case unix.ETIMEDOUT:
+		kind = ErrTimeout
+	default:
+		return err
+	}
+	return fmt.Errorf("%w: %w", kind, err)
+}
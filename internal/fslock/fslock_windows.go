@@ -1,17 +1,51 @@
 package fslock
 
 import (
-	"errors"
+	"bytes"
+	"context"
+	"fmt"
 	"os"
+	"runtime"
 	"sync"
+	"time"
+	"unsafe"
 
 	"golang.org/x/sys/windows"
 )
 
 type FSLock struct {
-	file    os.File
-	mu      sync.RWMutex
-	handler windows.Handle
+	file     os.File
+	mu       sync.RWMutex
+	handler  windows.Handle
+	flushErr error
+	dirty    bool
+	opts     Options
+	cursor   lineReader
+	writes   int
+	kind     LockKind
+	stats    counters
+	summary  summary
+	wbuf     []byte
+	tail     *ring
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+	key      string
+	group    flushGroup
+	extent   extent
+
+	mirror       *FSLock
+	mirrorStrict bool
+
+	// cloned marks an FSLock made by Clone, which shares the OS lock of
+	// the one it was cloned from and leaves releasing it to that one.
+	cloned bool
+
+	view mmapView
+
+	// remote marks a file on a network share, whose reads do not take
+	// events from the pool.
+	remote bool
 }
 
 const (
@@ -20,119 +54,768 @@ const (
 )
 
 var (
-	EOF             = errors.New("EOF")
 	defaultFileMode = windows.O_APPEND | windows.O_RDWR
+
+	// DefaultReadLength is the ReadLength lines are read with by default.
+	DefaultReadLength = 4096
+
+	// flushFileBuffers syncs the locked handle, so tests can make syncs
+	// fail.
+	flushFileBuffers = windows.FlushFileBuffers
+
+	// readFile and writeFile issue reads and writes, so tests can make
+	// them come back short.
+	readFile  = windows.ReadFile
+	writeFile = windows.WriteFile
+
+	// x/sys does not wrap CancelSynchronousIo, which timed reads need.
+	procCancelSynchronousIo = windows.NewLazySystemDLL("kernel32.dll").NewProc("CancelSynchronousIo")
 )
 
 func NewFSLock(fileName string, mode int) (*FSLock, error) {
-	if mode == 0 {
-		mode = defaultFileMode
-	}
+	return NewFSLockWithOptions(fileName, Options{Mode: mode})
+}
+
+func NewFSLockWithOptions(fileName string, opts Options) (*FSLock, error) {
+	return openLocked(context.Background(), fileName, opts, windows.LOCKFILE_EXCLUSIVE_LOCK)
+}
 
-	f, err := os.OpenFile(fileName, mode, 0666)
+// NewFSLockTimeout is like NewFSLock but gives up waiting for another
+// process to release the lock after timeout, failing with an error that
+// matches both ErrLocked and ErrTimeout.
+func NewFSLockTimeout(fileName string, mode int, timeout time.Duration) (*FSLock, error) {
+	return NewFSLockWithOptions(fileName, Options{Mode: mode, LockTimeout: timeout})
+}
+
+// NewFSLockContext is like NewFSLockWithOptions but also gives up waiting
+// for another process to release the lock once ctx is done, failing with an
+// error that matches both ErrLocked and ctx.Err().
+func NewFSLockContext(ctx context.Context, fileName string, opts Options) (*FSLock, error) {
+	return openLocked(ctx, fileName, opts, windows.LOCKFILE_EXCLUSIVE_LOCK)
+}
+
+// NewFSLockShared opens the file under a shared lock, which any number of
+// processes can hold at once while writers are kept out. A zero Mode opens
+// the file read-only, and writes through the FSLock fail with ErrReadOnly.
+func NewFSLockShared(fileName string, opts Options) (*FSLock, error) {
+	return openLocked(context.Background(), fileName, opts, 0)
+}
+
+// TryLockShared is like NewFSLockShared but fails with ErrLocked instead of
+// waiting when another process holds the lock exclusively.
+func TryLockShared(fileName string, opts Options) (*FSLock, error) {
+	return openLocked(context.Background(), fileName, opts, windows.LOCKFILE_FAIL_IMMEDIATELY)
+}
+
+// TryLock is like NewFSLock but fails with ErrLocked instead of waiting when
+// another process holds the lock.
+func TryLock(fileName string, mode int) (*FSLock, error) {
+	return TryLockWithOptions(fileName, Options{Mode: mode})
+}
+
+// TryLockWithOptions is like NewFSLockWithOptions but fails with
+// ErrAlreadyLocked instead of waiting when another process holds the lock.
+func TryLockWithOptions(fileName string, opts Options) (*FSLock, error) {
+	return openLocked(context.Background(), fileName, opts, windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY)
+}
+
+func openLocked(ctx context.Context, fileName string, opts Options, flags uint32) (*FSLock, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, pathError("open", fileName, err)
+	}
+	key, err := lockKey(fileName)
+	if err != nil {
+		return nil, pathError("open", fileName, err)
+	}
+	if err := register(key); err != nil {
+		return nil, pathError("lock", fileName, err)
+	}
+	fs, err := newFSLock(ctx, fileName, opts, flags)
 	if err != nil {
+		unregister(key)
 		return nil, err
 	}
-	fs := &FSLock{file: *f, mu: sync.RWMutex{}, handler: windows.Handle(f.Fd())}
+	fs.key = key
+	fs.startSyncer()
+	return fs, nil
+}
 
-	ol, err := newOverlapped()
+func newFSLock(ctx context.Context, fileName string, opts Options, flags uint32) (*FSLock, error) {
+	// O_RDONLY is zero, so a zero Mode only selects the read-write default
+	// under an exclusive lock.
+	mode := opts.Mode
+	if mode == 0 && flags&windows.LOCKFILE_EXCLUSIVE_LOCK != 0 {
+		mode = defaultFileMode
+	}
+	if opts.RandomAccess {
+		mode &^= windows.O_APPEND
+	}
+	h, err := openFile(fileName, mode, opts)
 	if err != nil {
 		return nil, err
 	}
-	defer windows.CloseHandle(ol.HEvent)
-	err = windows.LockFileEx(fs.handler, windows.LOCKFILE_EXCLUSIVE_LOCK, reserved, allBytes, allBytes, ol)
-	if err != nil && err != windows.ERROR_IO_PENDING {
-		return nil, err
+	// Pipes and character devices can neither be read at an offset nor
+	// locked, so reject them before anything relies on either.
+	if t, err := windows.GetFileType(h); err != nil || t != windows.FILE_TYPE_DISK {
+		windows.CloseHandle(h)
+		if err == nil {
+			err = ErrNotSeekable
+		}
+		return nil, pathError("open", fileName, err)
+	}
+	f := os.NewFile(uintptr(h), fileName)
+	fs := &FSLock{file: *f, mu: sync.RWMutex{}, handler: h, opts: opts, remote: isRemote(h)}
+	fs.cursor.blockSize = opts.ReadBufferSize
+	if fs.cursor.blockSize <= 0 {
+		fs.cursor.blockSize = DefaultReadBufferSize
 	}
 
-	s, err := windows.WaitForSingleObject(ol.HEvent, uint32(windows.INFINITE))
-	switch s {
-	case windows.WAIT_OBJECT_0:
-		return fs, nil
-	default:
-		return nil, err
+	// From here on the os.File owns the handle, so failures close it
+	// through it, clearing the finalizer that would close it again.
+	if err := fs.lockFileContext(ctx, flags); err != nil {
+		f.Close()
+		return nil, pathError("lock", fileName, err)
+	}
+	fs.kind = LockExclusive
+	if flags&windows.LOCKFILE_EXCLUSIVE_LOCK == 0 {
+		fs.kind = LockShared
+	}
+	if err := fs.deriveExtent(); err != nil {
+		f.Close()
+		return nil, pathError("stat", fileName, err)
+	}
+	if opts.TailBuffer > 0 {
+		if err := fs.loadTail(); err != nil {
+			f.Close()
+			return nil, pathError("read", fileName, err)
+		}
+	}
+	return fs, nil
+}
+
+func (f *FSLock) Unlock() (err error) {
+	defer f.wrap("unlock", &err)
+	f.stopSyncer()
+	defer unregister(f.key)
+	f.lock()
+	defer f.unlock()
+	f.kind = LockNone
+	f.view.close()
+	err = f.file.Close()
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	return mapError(err)
+}
+
+func (f *FSLock) Write(data []byte) (err error) {
+	defer f.wrap("write", &err)
+	f.lock()
+	defer f.unlock()
+	_, err = f.write(data)
+	return err
+}
+
+// WriteSync appends p and syncs the file before returning, under a single
+// acquisition of the lock. It returns the offset p was written at.
+func (f *FSLock) WriteSync(p []byte) (offset int64, err error) {
+	defer f.wrap("write", &err)
+	f.lock()
+	defer f.unlock()
+
+	offset, err = f.end()
+	if err != nil {
+		return 0, err
 	}
+	if _, err := f.write(p); err != nil {
+		return offset, err
+	}
+	return offset, f.flush()
 }
 
-func (f *FSLock) Unlock() error {
-	return windows.CloseHandle(f.handler)
+// AppendLine appends p terminated by exactly one newline, adding it only if
+// p does not already end with one. It returns the number of bytes written.
+func (f *FSLock) AppendLine(p []byte) (n int, err error) {
+	defer f.wrap("write", &err)
+	if len(p) == 0 || p[len(p)-1] != '\n' {
+		line := make([]byte, len(p)+1)
+		copy(line, p)
+		line[len(p)] = '\n'
+		p = line
+	}
+
+	f.lock()
+	defer f.unlock()
+	return f.write(p)
 }
 
-func (f *FSLock) Write(data []byte) error {
-	f.mu.Lock()
-	defer f.mu.Unlock()
+func (f *FSLock) write(data []byte) (int, error) {
+	if f.kind == LockShared {
+		return 0, ErrReadOnly
+	}
+	if f.flushErr != nil {
+		return 0, f.flushErr
+	}
+	if f.opts.MaxBytes > 0 {
+		end, err := f.end()
+		if err != nil {
+			return 0, err
+		}
+		if err := f.checkMaxBytes(end, int64(len(data))); err != nil {
+			return 0, err
+		}
+	}
+	if f.mirror != nil && f.mirrorStrict {
+		if err := f.copyToMirror(data); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.appendData(data)
+	if err != nil {
+		return n, err
+	}
+	if f.mirror != nil && !f.mirrorStrict {
+		f.copyToMirror(data)
+	}
+	return n, f.wrote()
+}
+
+func (f *FSLock) writeFile(data []byte) (int, error) {
+	if !f.opts.RandomAccess {
+		return f.writeFileAt(data, -1)
+	}
+	// Without O_APPEND a write lands at the file pointer, which positioned
+	// reads move as well, so appends name the end of file explicitly.
+	size, err := fileSize(f.handler)
+	if err != nil {
+		return 0, err
+	}
+	return f.writeFileAt(data, size)
+}
+
+// writeFileAt writes data at offset, or where the handle writes by default
+// when offset is negative.
+func (f *FSLock) writeFileAt(data []byte, offset int64) (int, error) {
+	var ov *windows.Overlapped
+	if offset >= 0 {
+		ov = &windows.Overlapped{Offset: uint32(offset), OffsetHigh: uint32(offset >> 32)}
+	}
 	done := uint32(0)
-	return windows.WriteFile(f.handler, data, &done, nil)
+	err := writeFile(f.handler, data, &done, ov)
+	if offset < 0 {
+		f.extent.appended(int(done))
+	} else {
+		f.extent.wroteAt(offset, int(done))
+	}
+	if err != nil {
+		return int(done), mapError(err)
+	}
+	if int(done) < len(data) {
+		// The file now ends inside a record. Refuse further writes until
+		// TruncateToLastLine or Recover cuts the torn record off.
+		f.dirty = true
+		f.summary.valid = false
+		f.flushErr = pathError("write", f.file.Name(), fmt.Errorf("%w: wrote %d of %d bytes", ErrShortWrite, done, len(data)))
+		return int(done), f.flushErr
+	}
+	f.dirty = true
+	f.summary.valid = false
+	f.stats.bytesWritten.Add(int64(done))
+	f.group.written.Add(1)
+	return int(done), nil
 }
 
-func (f *FSLock) Flush() error {
-	f.mu.Lock()
-	defer f.mu.Unlock()
-	return windows.FlushFileBuffers(f.handler)
+// checkMaxBytes rejects a write of n bytes at end that would grow the file
+// past the MaxBytes option. Callers hold the write lock, so the check can not
+// race with another append.
+func (f *FSLock) checkMaxBytes(end, n int64) error {
+	if f.opts.MaxBytes > 0 && end+n > f.opts.MaxBytes {
+		return ErrMaxSizeExceeded
+	}
+	return nil
 }
 
-func (f *FSLock) Close() error {
-	return windows.CloseHandle(f.handler)
+// wrote accounts for one logical write and runs the periodic sync policy.
+func (f *FSLock) wrote() error {
+	if f.opts.SyncEveryN > 0 {
+		f.writes++
+		if f.writes >= f.opts.SyncEveryN {
+			f.writes = 0
+			return f.flush()
+		}
+	}
+	return nil
 }
 
-func (f *FSLock) Read() ([]byte, error) {
-	f.mu.RLock()
-	defer f.mu.RUnlock()
-	fileInfo := windows.ByHandleFileInformation{}
-	err := windows.GetFileInformationByHandle(f.handler, &fileInfo)
+// Flush writes out the buffer and syncs the file to disk. Concurrent
+// callers share syncs: one that finds a sync in flight waits for it, and
+// only syncs again if that one started before its own writes reached the
+// OS. A failed sync is retained and returned by every following Write and
+// Flush until it is acknowledged with ClearError.
+func (f *FSLock) Flush() (err error) {
+	defer f.wrap("flush", &err)
+	return f.syncAll()
+}
+
+// Barrier returns once every write that completed before the call is
+// durable, whichever goroutine issued it. Writes still in the shared buffer
+// are written out first, and the sync it waits for is ordered after the last
+// of them by the write sequence.
+func (f *FSLock) Barrier() (err error) {
+	defer f.wrap("barrier", &err)
+	return f.syncAll()
+}
+
+// syncAll writes out the buffer and waits for a sync covering every write
+// handed to the OS so far.
+func (f *FSLock) syncAll() (err error) {
+	f.lock()
+	if f.flushErr != nil {
+		err = f.flushErr
+	} else {
+		err = f.drain()
+	}
+	seq := f.group.written.Load()
+	f.unlock()
 	if err != nil {
+		return err
+	}
+	return f.syncThrough(seq)
+}
+
+func (f *FSLock) flush() error {
+	if f.flushErr != nil {
+		return f.flushErr
+	}
+	if err := f.drain(); err != nil {
+		return err
+	}
+	seq := f.group.written.Load()
+	if err := flushFileBuffers(f.handler); err != nil {
+		f.flushErr = pathError("flush", f.file.Name(), mapError(err))
+		return f.flushErr
+	}
+	f.group.covered(seq)
+	f.dirty = false
+	f.stats.flushes.Add(1)
+	if f.opts.Observer.OnSync != nil {
+		f.opts.Observer.OnSync()
+	}
+	return nil
+}
+
+// ClearError acknowledges a retained flush error and returns it.
+func (f *FSLock) ClearError() error {
+	f.lock()
+	defer f.unlock()
+	err := f.flushErr
+	f.flushErr = nil
+	return err
+}
+
+// Close shuts f down in order: it writes out and syncs pending data, releases
+// the OS lock and closes the file. Each step runs even when an earlier one
+// failed, and the first error is returned.
+func (f *FSLock) Close() (err error) {
+	defer f.wrap("close", &err)
+	f.stopSyncer()
+	defer unregister(f.key)
+	f.lock()
+	defer f.unlock()
+
+	syncErr := f.drain()
+	if syncErr == nil && f.dirty {
+		syncErr = f.flush()
+	}
+	var unlockErr error
+	if !f.cloned {
+		unlockErr = f.unlockFile()
+	}
+	f.view.close()
+	// The os.File owns the handle, so closing it closes the handle exactly
+	// once and clears the finalizer that would close it again later.
+	closeErr := f.file.Close()
+	f.kind = LockNone
+	if pe, ok := closeErr.(*os.PathError); ok {
+		closeErr = mapError(pe.Err)
+	}
+	for _, err := range []error{syncErr, unlockErr, closeErr} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FSLock) Read() (data []byte, err error) {
+	defer f.wrap("read", &err)
+	if err := f.drainForRead(); err != nil {
 		return nil, err
 	}
+	f.rlock()
+	defer f.runlock()
+	f.stats.reads.Add(1)
+	return f.readHandle().readAll()
+}
 
-	data := make([]byte, fileInfo.FileSizeLow+1)
-	var n uint32
-	ov, err := newOverlapped()
-	if err != nil {
+// ReadAtToEndOfLine returns the line starting at offset, reading length bytes
+// at a time until the newline is found. A negative offset returns
+// ErrInvalidOffset and an offset at or past the end of file returns EOF.
+func (f *FSLock) ReadAtToEndOfLine(offset int64, length int) (line []byte, err error) {
+	defer f.wrap("read", &err)
+	if err := f.drainForRead(); err != nil {
 		return nil, err
 	}
-	defer windows.CloseHandle(ov.HEvent)
+	f.rlock()
+	defer f.runlock()
+	f.stats.reads.Add(1)
+	if f.opts.MmapReads {
+		line, err = f.view.lineAt(f.handler, offset)
+	} else {
+		line, err = f.readHandle().readAtToEndOfLine(offset, length)
+	}
+	if err == nil {
+		f.lineRead(offset, line)
+	}
+	return line, err
+}
 
-	err = windows.ReadFile(f.handler, data, &n, ov)
-	if err != nil && err == windows.ERROR_IO_PENDING {
-		if err = windows.GetOverlappedResult(f.handler, ov, &n, true); err != nil {
-			return nil, err
+func (f *FSLock) lineRead(offset int64, line []byte) {
+	if f.opts.Observer.OnLineRead != nil {
+		f.opts.Observer.OnLineRead(offset, line)
+	}
+}
+
+// ReadLineFrom reads the line starting at offset using Options.ReadLength as
+// the initial buffer length and returns it along with the offset of the next
+// line.
+func (f *FSLock) ReadLineFrom(offset int64) ([]byte, int64, error) {
+	line, err := f.ReadAtToEndOfLine(offset, f.readLength())
+	if err != nil {
+		return nil, offset, err
+	}
+	return line, offset + int64(len(line)) + 1, nil
+}
+
+// ReadLinesAt returns up to n complete lines starting at offset and the offset
+// to resume from, just past the last returned line. A trailing line without a
+// newline is not returned. Fewer than n lines come back with EOF at the end of
+// file, so pages can be chained until EOF without gaps or overlaps.
+func (f *FSLock) ReadLinesAt(offset int64, n int) (lines [][]byte, next int64, err error) {
+	defer f.wrap("read", &err)
+	if err := f.drainForRead(); err != nil {
+		return nil, offset, err
+	}
+	f.rlock()
+	defer f.runlock()
+	f.stats.reads.Add(1)
+
+	h := f.readHandle()
+	size, err := fileSize(h.handler)
+	if err != nil {
+		return nil, offset, err
+	}
+	next = offset
+	for len(lines) < n {
+		line, err := h.readAtToEndOfLine(next, f.readLength())
+		if err != nil {
+			return lines, next, err
 		}
+		if next+int64(len(line)) >= size {
+			return lines, next, EOF
+		}
+		f.lineRead(next, line)
+		lines = append(lines, line)
+		next += int64(len(line)) + 1
 	}
+	return lines, next, nil
+}
 
-	return data[:n], nil
+func (f *FSLock) wrap(op string, err *error) {
+	*err = pathError(op, f.file.Name(), *err)
 }
 
-func (f *FSLock) ReadAtToEndOfLine(offset int64, length int) ([]byte, error) {
-	f.mu.RLock()
-	defer f.mu.RUnlock()
+func (f *FSLock) Stats() FSLockStats {
+	return f.stats.snapshot()
+}
 
-	data := make([]byte, length)
-	var n uint32
-	ov, err := newOverlappedWithOffset(uint32(offset))
+func (f *FSLock) lock() {
+	if !f.opts.NoMutex {
+		f.stats.waiters.Add(1)
+		f.mu.Lock()
+		f.stats.waiters.Add(-1)
+	}
+}
+
+func (f *FSLock) unlock() {
+	if !f.opts.NoMutex {
+		f.mu.Unlock()
+	}
+}
+
+func (f *FSLock) rlock() {
+	if !f.opts.NoMutex {
+		f.stats.waiters.Add(1)
+		f.mu.RLock()
+		f.stats.waiters.Add(-1)
+	}
+}
+
+func (f *FSLock) runlock() {
+	if !f.opts.NoMutex {
+		f.mu.RUnlock()
+	}
+}
+
+func (h readHandle) readAll() ([]byte, error) {
+	size, err := fileSize(h.handler)
 	if err != nil {
 		return nil, err
 	}
-	defer windows.CloseHandle(ov.HEvent)
+	if size == 0 {
+		return []byte{}, nil
+	}
 
-	err = windows.ReadFile(f.handler, data, &n, ov)
-	if err != nil && err == windows.ERROR_IO_PENDING {
-		if err = windows.GetOverlappedResult(f.handler, ov, &n, true); err != nil {
+	// A single ReadFile may return less than asked for on large files, so
+	// keep reading until the buffer is full or the file ends.
+	data := make([]byte, size)
+	read := 0
+	for read < len(data) {
+		n, err := h.readAt(data[read:], int64(read))
+		if err != nil {
 			return nil, err
 		}
+		if n == 0 {
+			break
+		}
+		read += n
 	}
+	return data[:read], nil
+}
 
-	if n == 0 {
+func (h readHandle) readAtToEndOfLine(offset int64, length int) ([]byte, error) {
+	if offset < 0 {
+		return nil, ErrInvalidOffset
+	}
+	size, err := fileSize(h.handler)
+	if err != nil {
+		return nil, err
+	}
+	if offset >= size {
 		return nil, EOF
 	}
+	if length <= 0 {
+		length = DefaultReadLength
+	}
+
+	return h.readLine(offset, length)
+}
+
+// readLine reads blocks of length bytes from offset, appending each to the
+// line until a newline or the end of file is found, so long lines cost one
+// read per block rather than a re-read per doubling.
+func (h readHandle) readLine(offset int64, length int) ([]byte, error) {
+	var line []byte
+	block := make([]byte, length)
+	for {
+		n, err := h.readAt(block, offset+int64(len(line)))
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			if len(line) == 0 {
+				return nil, EOF
+			}
+			return line, nil
+		}
+
+		if i := bytes.IndexByte(block[:n], '\n'); i >= 0 {
+			return append(line, block[:i]...), nil
+		}
+		line = append(line, block[:n]...)
+		if n < length {
+			return line, nil
+		}
+	}
+}
+
+// readHandle performs positioned reads on a file handle. A non-zero timeout
+// bounds how long a read may block; on expiry the read is cancelled and
+// ErrTimeout returned, leaving the handle usable.
+type readHandle struct {
+	handler windows.Handle
+	timeout time.Duration
+	remote  bool
+}
+
+func (f *FSLock) readHandle() readHandle {
+	return readHandle{handler: f.handler, timeout: f.opts.ReadTimeout, remote: f.remote}
+}
+
+func (h readHandle) size() (int64, error) {
+	return fileSize(h.handler)
+}
+
+func (h readHandle) readAt(data []byte, offset int64) (int, error) {
+	var n uint32
+	ov, release, err := h.overlappedAt(offset)
+	if err != nil {
+		return 0, err
+	}
+	// The handle is not opened for overlapped I/O, so the structure only
+	// positions the read, which has finished with the event by the time
+	// ReadFile returns.
+	defer release()
+
+	if h.timeout > 0 {
+		err = h.readTimed(data, &n, ov)
+	} else {
+		err = readFile(h.handler, data, &n, ov)
+	}
+	if err == ErrTimeout {
+		return 0, err
+	}
+	if err != nil && err != windows.ERROR_HANDLE_EOF {
+		return 0, mapError(err)
+	}
+	return int(n), nil
+}
+
+// readTimed issues the read on a thread pinned for the purpose and, if it is
+// still blocked once the timeout passes, cancels it with CancelSynchronousIo.
+// Reads on a synchronous handle can not be abandoned any other way.
+func (h readHandle) readTimed(data []byte, n *uint32, ov *windows.Overlapped) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	thread, err := windows.OpenThread(windows.THREAD_TERMINATE, false, windows.GetCurrentThreadId())
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(thread)
+
+	// mu keeps the timer from cancelling anything once the read is over,
+	// when the thread may have moved on to other I/O. A cancel that finds
+	// nothing to cancel raced the start of the read and is retried.
+	var mu sync.Mutex
+	reading, cancelled := true, false
+	timer := time.AfterFunc(h.timeout, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for reading && !cancelled {
+			if cancelSynchronousIo(thread) != windows.ERROR_NOT_FOUND {
+				cancelled = true
+				break
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+		}
+	})
+	err = readFile(h.handler, data, n, ov)
+	mu.Lock()
+	reading = false
+	mu.Unlock()
+	timer.Stop()
+	if cancelled && err == windows.ERROR_OPERATION_ABORTED {
+		return ErrTimeout
+	}
+	return err
+}
 
-	// TODO last char is \n
-	for i := 0; i < len(data); i++ {
-		if data[i] == '\n' {
-			return data[:i], nil
+// overlappedAt returns the structure positioning a read at offset and a
+// function that releases its event. Local reads take events from the pool.
+// A read on a network share that the redirector abandons, as when the
+// connection drops, may signal its event after the fact, so reads there use
+// an event of their own and close it.
+func (h readHandle) overlappedAt(offset int64) (*windows.Overlapped, func(), error) {
+	if !h.remote {
+		ov, err := newOverlappedWithOffset(offset)
+		if err != nil {
+			return nil, nil, err
 		}
+		return ov, func() { putEvent(ov.HEvent) }, nil
 	}
+	ov, err := newOverlapped()
+	if err != nil {
+		return nil, nil, err
+	}
+	ov.Offset, ov.OffsetHigh = uint32(offset), uint32(offset>>32)
+	return ov, func() { windows.CloseHandle(ov.HEvent) }, nil
+}
 
-	return f.ReadAtToEndOfLine(offset, length*2)
+// isRemote reports whether h is a file on a network share. Only remote
+// files have protocol information, so the query fails for local ones.
+func isRemote(h windows.Handle) bool {
+	var info [29]uint32 // FILE_REMOTE_PROTOCOL_INFO
+	return windows.GetFileInformationByHandleEx(h, windows.FileRemoteProtocolInfo, (*byte)(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))) == nil
+}
+
+func cancelSynchronousIo(thread windows.Handle) error {
+	r, _, err := procCancelSynchronousIo.Call(uintptr(thread))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+func fileSize(handler windows.Handle) (int64, error) {
+	fileInfo := windows.ByHandleFileInformation{}
+	err := windows.GetFileInformationByHandle(handler, &fileInfo)
+	if err != nil {
+		return 0, err
+	}
+	return int64(fileInfo.FileSizeHigh)<<32 | int64(fileInfo.FileSizeLow), nil
+}
+
+// truncate cuts the file to size and syncs it. The locked handle is usually
+// opened for appending only, which lacks the right to move the end of file,
+// so a short-lived sibling handle does the work.
+func (f *FSLock) truncate(size int64) error {
+	f.summary.valid = false
+	f.view.close()
+
+	name, err := utf16Path(f.file.Name())
+	if err != nil {
+		return err
+	}
+	h, err := windows.CreateFile(name, windows.GENERIC_WRITE, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE, nil, windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return mapError(err)
+	}
+	defer windows.CloseHandle(h)
+
+	info := struct{ EndOfFile int64 }{EndOfFile: size}
+	err = windows.SetFileInformationByHandle(h, windows.FileEndOfFileInfo, (*byte)(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)))
+	if err != nil {
+		return mapError(err)
+	}
+	f.extent.truncated(size)
+	return mapError(windows.FlushFileBuffers(h))
+}
+
+// mapError wraps a native error with the portable sentinel it corresponds
+// to, leaving unknown errors untouched.
+func mapError(err error) error {
+	var kind error
+	switch err {
+	case nil:
+		return nil
+	case windows.ERROR_LOCK_VIOLATION, windows.ERROR_SHARING_VIOLATION, windows.ERROR_LOCK_FAILED:
+		kind = ErrAlreadyLocked
+	case windows.ERROR_NOT_LOCKED:
+		kind = ErrNotLocked
+	case windows.ERROR_INVALID_HANDLE:
+		kind = ErrClosed
+	case windows.ERROR_ACCESS_DENIED, windows.ERROR_WRITE_PROTECT:
+		kind = ErrReadOnly
+	case windows.ERROR_DISK_FULL, windows.ERROR_HANDLE_DISK_FULL:
+		kind = ErrNoSpace
+	case windows.WAIT_TIMEOUT, windows.ERROR_TIMEOUT, windows.ERROR_SEM_TIMEOUT:
+		kind = ErrTimeout
+	default:
+		return err
+	}
+	return fmt.Errorf("%w: %w", kind, err)
 }
 
 func newOverlapped() (*windows.Overlapped, error) {
@@ -145,15 +828,45 @@ func newOverlapped() (*windows.Overlapped, error) {
 	return &windows.Overlapped{HEvent: event}, nil
 }
 
-func newOverlappedWithOffset(offest uint32) (*windows.Overlapped, error) {
-	manualReset := uint32(1)
-	initialState := uint32(0)
-	event, err := windows.CreateEvent(nil, manualReset, initialState, nil)
+// eventPool keeps idle manual-reset events for positioned reads of local
+// files, so a read does not pay for a CreateEvent and CloseHandle pair, which
+// adds up for line by line reads. The pool is bounded since events left in it
+// are never closed.
+var eventPool = make(chan windows.Handle, 16)
+
+func getEvent() (windows.Handle, error) {
+	select {
+	case event := <-eventPool:
+		return event, nil
+	default:
+		manualReset := uint32(1)
+		initialState := uint32(0)
+		return windows.CreateEvent(nil, manualReset, initialState, nil)
+	}
+}
+
+// putEvent returns an event to the pool. It is left signalled, since
+// ReadFile resets the event of the structure it is given when it starts.
+func putEvent(event windows.Handle) {
+	select {
+	case eventPool <- event:
+	default:
+		windows.CloseHandle(event)
+	}
+}
+
+// newOverlappedWithOffset returns an overlapped structure for a read at
+// offset whose event comes from the pool. Release it with putEvent. The
+// offset is split over Offset and OffsetHigh, so reads past 4GB land where
+// they should instead of wrapping around to the start of the file.
+func newOverlappedWithOffset(offset int64) (*windows.Overlapped, error) {
+	event, err := getEvent()
 	if err != nil {
 		return nil, err
 	}
 	return &windows.Overlapped{
-		HEvent: event,
-		Offset: offest,
+		HEvent:     event,
+		Offset:     uint32(offset),
+		OffsetHigh: uint32(offset >> 32),
 	}, nil
 }
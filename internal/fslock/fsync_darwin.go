@@ -0,0 +1,13 @@
+package fslock
+
+import "golang.org/x/sys/unix"
+
+// syncFile uses F_FULLFSYNC, since fsync on Darwin only hands the data to
+// the drive, which may keep it in its volatile cache. Filesystems that do
+// not support it fall back to fsync.
+func syncFile(fd int) error {
+	if _, err := unix.FcntlInt(uintptr(fd), unix.F_FULLFSYNC, 0); err == nil {
+		return nil
+	}
+	return unix.Fsync(fd)
+}
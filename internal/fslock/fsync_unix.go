@@ -0,0 +1,14 @@
+//go:build unix && !darwin
+
+package fslock
+
+import "golang.org/x/sys/unix"
+
+func syncFile(fd int) error {
+	for {
+		err := unix.Fsync(fd)
+		if err != unix.EINTR {
+			return err
+		}
+	}
+}
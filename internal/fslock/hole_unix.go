@@ -0,0 +1,42 @@
+//go:build linux || darwin || freebsd
+
+package fslock
+
+import "golang.org/x/sys/unix"
+
+// dataEnd returns where the last range of data of the file ends, as lseek
+// with SEEK_DATA and SEEK_HOLE reports them, or physical where the file
+// system reports none. The seeks move the file offset, which appends
+// without O_APPEND write at, so it is put back after.
+func (h readHandle) dataEnd(physical int64) (int64, error) {
+	if h.seek != nil {
+		h.seek.Lock()
+		defer h.seek.Unlock()
+	}
+	current, err := unix.Seek(h.fd, 0, unix.SEEK_CUR)
+	if err != nil {
+		return 0, mapError(err)
+	}
+	defer unix.Seek(h.fd, current, unix.SEEK_SET)
+
+	end := int64(0)
+	for end < physical {
+		data, err := unix.Seek(h.fd, end, unix.SEEK_DATA)
+		if err == unix.ENXIO {
+			// Only a hole follows.
+			break
+		}
+		if err != nil {
+			return physical, nil
+		}
+		hole, err := unix.Seek(h.fd, data, unix.SEEK_HOLE)
+		if err != nil {
+			return physical, nil
+		}
+		end = hole
+	}
+	if end > physical {
+		end = physical
+	}
+	return end, nil
+}
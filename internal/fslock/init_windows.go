@@ -0,0 +1,39 @@
+package fslock
+
+import (
+	"context"
+
+	"golang.org/x/sys/windows"
+)
+
+// EnsureInitialized creates fileName holding defaultContent, synced, unless
+// it already has content, and reports whether it wrote it. The check and the
+// write happen under the exclusive lock, so of several racing callers, in
+// this process or others, exactly one writes the content and the rest see
+// it. An existing empty file counts as absent, since it may be one another
+// caller just created and has not filled yet.
+func EnsureInitialized(fileName string, defaultContent []byte) (created bool, err error) {
+	// Going around the registry lets callers in this process wait their
+	// turn on the OS lock instead of failing with ErrAlreadyLockedInProcess.
+	f, err := newFSLock(context.Background(), fileName, Options{Mode: windows.O_CREAT | windows.O_RDWR | windows.O_APPEND}, windows.LOCKFILE_EXCLUSIVE_LOCK)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	size, err := fileSize(f.handler)
+	if err != nil {
+		return false, pathError("stat", fileName, err)
+	}
+	if size > 0 {
+		return false, nil
+	}
+	if _, err := f.WriteSync(defaultContent); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,53 @@
+package fslock
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestEnsureInitializedCreatesOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	content := []byte("defaults\n")
+
+	const callers = 20
+	var created atomic.Int32
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			ok, err := EnsureInitialized(path, content)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if ok {
+				created.Add(1)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	if n := created.Load(); n != 1 {
+		t.Fatalf("%d of %d callers created the file, want 1", n, callers)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != string(content) {
+		t.Fatalf("file holds %q, %v, want %q", data, err, content)
+	}
+
+	// Content already there is left alone.
+	if err := os.WriteFile(path, []byte("edited\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := EnsureInitialized(path, content); err != nil || ok {
+		t.Fatalf("EnsureInitialized of a filled file = %v, %v", ok, err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "edited\n" {
+		t.Fatalf("file holds %q, %v after EnsureInitialized", data, err)
+	}
+}
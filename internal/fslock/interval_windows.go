@@ -0,0 +1,49 @@
+package fslock
+
+import "time"
+
+// startSyncer runs the SyncInterval policy in the background until
+// stopSyncer is called.
+func (f *FSLock) startSyncer() {
+	if f.opts.SyncInterval <= 0 {
+		return
+	}
+	f.stop = make(chan struct{})
+	f.stopped = make(chan struct{})
+	go f.syncLoop(f.opts.SyncInterval)
+}
+
+// syncLoop writes out the buffer and syncs the file on every tick that finds
+// unsynced data, so the last writes before an idle period become durable
+// within one interval.
+func (f *FSLock) syncLoop(interval time.Duration) {
+	defer close(f.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			f.lock()
+			if f.dirty {
+				// A failed sync is retained in flushErr and surfaces on
+				// the next write; a failed drain keeps the data buffered
+				// for the next tick.
+				f.flush()
+			}
+			f.unlock()
+		}
+	}
+}
+
+// stopSyncer stops the background syncer and waits for it to exit. It must
+// be called without holding the mutex, which the syncer needs to finish a
+// tick in progress.
+func (f *FSLock) stopSyncer() {
+	if f.stop == nil {
+		return
+	}
+	f.stopOnce.Do(func() { close(f.stop) })
+	<-f.stopped
+}
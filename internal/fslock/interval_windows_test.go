@@ -0,0 +1,52 @@
+package fslock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSyncIntervalDrainsBuffer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	synced := make(chan struct{}, 1)
+	f, err := NewFSLockWithOptions(path, Options{
+		Mode:            defaultFileMode | os.O_CREATE,
+		WriteBufferSize: 4096,
+		ReadSkipsBuffer: true,
+		SyncInterval:    20 * time.Millisecond,
+		Observer: Observer{OnSync: func() {
+			select {
+			case synced <- struct{}{}:
+			default:
+			}
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, record := range []string{"one", "two", "three"} {
+		if _, err := f.AppendLine([]byte(record)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-synced:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no sync after going idle")
+	}
+
+	// Reads skip the buffer, so they see what a crash would leave: f is
+	// never closed or flushed before it.
+	data, err := f.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "one\ntwo\nthree\n" {
+		t.Fatalf("file holds %q after an idle interval", data)
+	}
+	if s := f.Stats(); s.Flushes == 0 {
+		t.Fatalf("Stats = %+v, want a flush", s)
+	}
+}
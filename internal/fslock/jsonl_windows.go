@@ -0,0 +1,40 @@
+package fslock
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// WriteJSON appends v marshalled as a single JSON line. Nothing is written
+// when marshalling fails.
+func (f *FSLock) WriteJSON(v any) (err error) {
+	defer f.wrap("write", &err)
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = f.AppendLine(data)
+	return err
+}
+
+// ReadJSON decodes every line of f into a T and passes it to fn along with
+// the line offset, stopping early when fn returns false. Blank lines are
+// skipped.
+func ReadJSON[T any](f *FSLock, fn func(offset int64, v T) bool) error {
+	var decodeErr error
+	err := f.Lines(func(offset int64, line []byte) bool {
+		if len(line) == 0 {
+			return true
+		}
+		var v T
+		if err := json.Unmarshal(line, &v); err != nil {
+			decodeErr = pathError("decode", f.file.Name(), fmt.Errorf("line at offset %d: %w", offset, err))
+			return false
+		}
+		return fn(offset, v)
+	})
+	if err != nil {
+		return err
+	}
+	return decodeErr
+}
@@ -0,0 +1,68 @@
+package fslock
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type job struct {
+	ID   int      `json:"id"`
+	Name string   `json:"name"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+func TestJSONLinesRoundTrip(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "jobs.jsonl"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	jobs := []job{{1, "build", []string{"ci"}}, {2, "test, with a comma", nil}, {3, "línea\nwith a newline", []string{"a", "b"}}}
+	for _, j := range jobs {
+		if err := f.WriteJSON(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A value that can not be marshalled leaves no partial line behind.
+	_, before, _ := f.Size()
+	if err := f.WriteJSON(math.Inf(1)); err == nil {
+		t.Fatal("WriteJSON of +Inf succeeded")
+	}
+	if _, after, _ := f.Size(); after != before {
+		t.Fatalf("failed WriteJSON grew the file from %d to %d bytes", before, after)
+	}
+
+	var got []job
+	if err := ReadJSON(f, func(offset int64, j job) bool {
+		got = append(got, j)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(jobs) {
+		t.Fatalf("ReadJSON = %+v, want %+v", got, jobs)
+	}
+}
+
+func TestReadJSONDecodeError(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "jobs.jsonl"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, line := range []string{`{"id":1}`, `not json`, `{"id":3}`} {
+		if _, err := f.AppendLine([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n := 0
+	err = ReadJSON(f, func(int64, job) bool { n++; return true })
+	var pe *PathError
+	if !errors.As(err, &pe) || pe.Op != "decode" || n != 1 {
+		t.Fatalf("ReadJSON over a bad line = %v after %d values", err, n)
+	}
+}
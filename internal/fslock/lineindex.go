@@ -0,0 +1,73 @@
+package fslock
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// LineIndex holds the start offset of every complete line of a file, up to
+// End, so a line can be found by number without scanning.
+type LineIndex struct {
+	source  uint64
+	end     int64
+	offsets []int64
+}
+
+// Len returns the number of indexed lines.
+func (x *LineIndex) Len() int {
+	return len(x.offsets)
+}
+
+// Offset returns the start offset of line i.
+func (x *LineIndex) Offset(i int) int64 {
+	return x.offsets[i]
+}
+
+// End returns the offset just past the last indexed line.
+func (x *LineIndex) End() int64 {
+	return x.end
+}
+
+// An index file is a header followed by one little endian uint64 per line:
+//
+//	magic [4]byte | version uint32 | source FileID uint64 | end uint64 | count uint64
+const (
+	indexMagic      = "ELIX"
+	indexVersion    = 1
+	indexHeaderSize = 32
+)
+
+func (x *LineIndex) encode() []byte {
+	data := make([]byte, indexHeaderSize+8*len(x.offsets))
+	copy(data, indexMagic)
+	binary.LittleEndian.PutUint32(data[4:], indexVersion)
+	binary.LittleEndian.PutUint64(data[8:], x.source)
+	binary.LittleEndian.PutUint64(data[16:], uint64(x.end))
+	binary.LittleEndian.PutUint64(data[24:], uint64(len(x.offsets)))
+	for i, offset := range x.offsets {
+		binary.LittleEndian.PutUint64(data[indexHeaderSize+8*i:], uint64(offset))
+	}
+	return data
+}
+
+func decodeIndex(data []byte) (*LineIndex, error) {
+	if len(data) < indexHeaderSize || string(data[:4]) != indexMagic {
+		return nil, fmt.Errorf("%w: not a line index", ErrCorrupt)
+	}
+	if v := binary.LittleEndian.Uint32(data[4:]); v != indexVersion {
+		return nil, fmt.Errorf("%w: line index version %d", ErrCorrupt, v)
+	}
+	count := binary.LittleEndian.Uint64(data[24:])
+	if count != uint64(len(data)-indexHeaderSize)/8 || (len(data)-indexHeaderSize)%8 != 0 {
+		return nil, fmt.Errorf("%w: line index length", ErrCorrupt)
+	}
+	x := &LineIndex{
+		source:  binary.LittleEndian.Uint64(data[8:]),
+		end:     int64(binary.LittleEndian.Uint64(data[16:])),
+		offsets: make([]int64, count),
+	}
+	for i := range x.offsets {
+		x.offsets[i] = int64(binary.LittleEndian.Uint64(data[indexHeaderSize+8*i:]))
+	}
+	return x, nil
+}
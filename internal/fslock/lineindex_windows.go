@@ -0,0 +1,67 @@
+package fslock
+
+import "os"
+
+// indexBatch is how many lines an index build reads at a time.
+const indexBatch = 1024
+
+// BuildIndex scans f and indexes every complete line.
+func BuildIndex(f *FSLock) (*LineIndex, error) {
+	id, err := f.FileID()
+	if err != nil {
+		return nil, err
+	}
+	x := &LineIndex{source: id}
+	return x, x.extend(f)
+}
+
+// SaveIndex writes x to path, replacing any earlier index atomically.
+func (x *LineIndex) SaveIndex(path string) error {
+	return pathError("write", path, replaceFile(path, x.encode()))
+}
+
+// LoadIndex loads the index saved at path for src. An index of the same file
+// is extended over lines appended since it was saved; one that is missing,
+// damaged, or made for another file or a longer one is rebuilt by a full
+// scan.
+func LoadIndex(path string, src *FSLock) (*LineIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return BuildIndex(src)
+	}
+	x, err := decodeIndex(data)
+	if err != nil {
+		return BuildIndex(src)
+	}
+	id, err := src.FileID()
+	if err != nil {
+		return nil, err
+	}
+	_, size, err := src.Size()
+	if err != nil {
+		return nil, err
+	}
+	if x.source != id || x.end > size {
+		return BuildIndex(src)
+	}
+	return x, x.extend(src)
+}
+
+// extend indexes the complete lines of f past x.end.
+func (x *LineIndex) extend(f *FSLock) error {
+	for {
+		lines, next, err := f.ReadLinesAt(x.end, indexBatch)
+		offset := x.end
+		for _, line := range lines {
+			x.offsets = append(x.offsets, offset)
+			offset += int64(len(line)) + 1
+		}
+		x.end = next
+		if err == EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
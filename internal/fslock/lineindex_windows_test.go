@@ -0,0 +1,120 @@
+package fslock
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLineIndexSaveAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	path, indexPath := filepath.Join(dir, "log"), filepath.Join(dir, "log.index")
+	reads := 0
+	open := func() *FSLock {
+		t.Helper()
+		f, err := NewFSLockWithOptions(path, Options{
+			Mode:     defaultFileMode | os.O_CREATE,
+			Observer: Observer{OnLineRead: func(int64, []byte) { reads++ }},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	appendLines := func(f *FSLock, lines ...string) {
+		t.Helper()
+		for _, line := range lines {
+			if _, err := f.AppendLine([]byte(line)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	load := func(f *FSLock, want string, wantReads int) *LineIndex {
+		t.Helper()
+		reads = 0
+		x, err := LoadIndex(indexPath, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var offsets []int64
+		for i := 0; i < x.Len(); i++ {
+			offsets = append(offsets, x.Offset(i))
+		}
+		if got := fmt.Sprint(offsets, x.End()); got != want || reads != wantReads {
+			t.Fatalf("loaded offsets and end %s after %d line reads, want %s after %d", got, reads, want, wantReads)
+		}
+		return x
+	}
+
+	f := open()
+	appendLines(f, "one", "two", "three")
+	x, err := BuildIndex(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := x.SaveIndex(indexPath); err != nil {
+		t.Fatal(err)
+	}
+	load(f, "[0 4 8] 14", 0)
+
+	// Only the lines appended since the save are read.
+	appendLines(f, "four", "five")
+	x = load(f, "[0 4 8 14 19] 24", 2)
+	if err := x.SaveIndex(indexPath); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// A rotated file is indexed afresh, however its index looks.
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	f = open()
+	defer f.Close()
+	appendLines(f, "a", "b")
+	load(f, "[0 2] 4", 2)
+
+	// So is the file behind a damaged index.
+	if err := os.WriteFile(indexPath, []byte("ELIX garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	load(f, "[0 2] 4", 2)
+}
+
+func TestLineIndexRebuildsAfterTruncation(t *testing.T) {
+	dir := t.TempDir()
+	path, indexPath := filepath.Join(dir, "log"), filepath.Join(dir, "log.index")
+	f, err := NewFSLockWithOptions(path, Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, line := range []string{"one", "two", "three"} {
+		if _, err := f.AppendLine([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	x, err := BuildIndex(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := x.SaveIndex(indexPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same file, now shorter than the index claims.
+	if err := f.Truncate(4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.AppendLine([]byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	x, err = LoadIndex(indexPath, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Len() != 2 || x.Offset(1) != 4 || x.End() != 11 {
+		t.Fatalf("index after truncation has %d lines, end %d", x.Len(), x.End())
+	}
+}
@@ -0,0 +1,47 @@
+package fslock
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOnLineRead(t *testing.T) {
+	var seen []string
+	opts := Options{
+		Mode: defaultFileMode | os.O_CREATE,
+		Observer: Observer{OnLineRead: func(offset int64, line []byte) {
+			seen = append(seen, fmt.Sprintf("%d:%s", offset, line))
+		}},
+	}
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, line := range []string{"one", "two", "three"} {
+		if _, err := f.AppendLine([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	if err := f.Lines(func(offset int64, line []byte) bool {
+		got = append(got, fmt.Sprintf("%d:%s", offset, line))
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "[0:one 4:two 8:three]"; fmt.Sprint(seen) != want || fmt.Sprint(got) != want {
+		t.Fatalf("hook saw %v and Lines returned %v, want %s", seen, got, want)
+	}
+
+	seen = nil
+	if _, err := f.ReadAtToEndOfLine(4, 0); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(seen) != "[4:two]" {
+		t.Fatalf("hook saw %v for ReadAtToEndOfLine", seen)
+	}
+}
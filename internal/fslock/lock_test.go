@@ -0,0 +1,65 @@
+package fslock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockType(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	f, err := NewFSLockWithOptions(path, Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind := f.LockType(); kind != LockExclusive {
+		t.Fatalf("LockType of an exclusive lock = %v", kind)
+	}
+	if err := f.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if kind := f.LockType(); kind != LockNone {
+		t.Fatalf("LockType after Unlock = %v", kind)
+	}
+
+	s, err := NewFSLockShared(path, Options{Mode: os.O_RDONLY})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind := s.LockType(); kind != LockShared {
+		t.Fatalf("LockType of a shared lock = %v", kind)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if kind := s.LockType(); kind != LockNone {
+		t.Fatalf("LockType after Close = %v", kind)
+	}
+}
+
+func TestTryLockShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	release := holdLock(t, path)
+	start := time.Now()
+	if _, err := TryLockShared(path, Options{}); !errors.Is(err, ErrLocked) {
+		t.Fatalf("TryLockShared of an exclusively held lock = %v, want ErrLocked", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("TryLockShared waited %v for the lock", elapsed)
+	}
+	release()
+
+	f, err := TryLockShared(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if kind := f.LockType(); kind != LockShared {
+		t.Fatalf("LockType = %v, want LockShared", kind)
+	}
+	if !lockedElsewhere(t, path, false) || lockedElsewhere(t, path, true) {
+		t.Fatal("a shared lock should keep out exclusive locks only")
+	}
+}
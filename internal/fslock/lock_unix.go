@@ -0,0 +1,76 @@
+//go:build unix
+
+package fslock
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// LockType returns the kind of OS lock f currently holds. It is LockNone once
+// f is closed.
+func (f *FSLock) LockType() LockKind {
+	f.rlock()
+	defer f.runlock()
+	return f.kind
+}
+
+// lockFile locks the whole file with how. Without LOCK_NB it waits for as
+// long as it takes, or up to the LockTimeout option.
+func (f *FSLock) lockFile(how int) error {
+	return f.lockFileContext(context.Background(), how)
+}
+
+// lockFileContext is lockFile that also gives up waiting once ctx is done.
+func (f *FSLock) lockFileContext(ctx context.Context, how int) error {
+	start := time.Now()
+	var err error
+	if (f.opts.LockTimeout > 0 || ctx.Done() != nil) && how&unix.LOCK_NB == 0 {
+		var deadline time.Time
+		if f.opts.LockTimeout > 0 {
+			deadline = start.Add(f.opts.LockTimeout)
+		}
+		err = f.pollLock(ctx, how, deadline)
+	} else {
+		err = f.flock(how)
+	}
+	wait := time.Since(start)
+	if err != nil {
+		// Only a try fails at once; a wait that gave up still waited.
+		if how&unix.LOCK_NB != 0 {
+			if errors.Is(err, ErrLocked) {
+				lockCounters.failedTries.Add(1)
+			}
+		} else {
+			lockCounters.waited(wait)
+		}
+		return err
+	}
+	lockCounters.acquired(wait)
+	if f.opts.Observer.OnLockWait != nil {
+		f.opts.Observer.OnLockWait(wait)
+	}
+	return nil
+}
+
+// pollLock tries to take the lock until ctx is done or deadline, unless it
+// is zero, passes, backing off between tries. A blocking flock can only be
+// interrupted by a signal, so polling is the portable way to bound the wait.
+func (f *FSLock) pollLock(ctx context.Context, how int, deadline time.Time) error {
+	return poll(ctx, deadline, func() error {
+		return f.flock(how | unix.LOCK_NB)
+	})
+}
+
+func (f *FSLock) flock(how int) error {
+	for {
+		err := unix.Flock(f.fd, how)
+		if err == unix.EINTR {
+			continue
+		}
+		return mapError(err)
+	}
+}
@@ -0,0 +1,139 @@
+package fslock
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// Downgrade turns the exclusive lock into a shared one without ever leaving
+// the file unlocked: a shared lock is taken over the exclusive one through
+// the same handle, and unlocking once then releases just the exclusive lock.
+// Other processes may take shared locks afterwards while writers stay out.
+// Writes through f fail with ErrReadOnly until Upgrade.
+func (f *FSLock) Downgrade() (err error) {
+	defer f.wrap("lock", &err)
+	f.lock()
+	defer f.unlock()
+
+	if f.kind != LockExclusive {
+		return nil
+	}
+	if err := f.drain(); err != nil {
+		return err
+	}
+	if err := f.lockFile(0); err != nil {
+		return err
+	}
+	if err := f.unlockFile(); err != nil {
+		return err
+	}
+	f.kind = LockShared
+	return nil
+}
+
+// Upgrade turns a shared lock taken by Downgrade back into an exclusive one.
+// Windows can not convert a shared lock in place, so the shared lock is
+// released first: another writer may acquire the file in that window, in
+// which case Upgrade blocks until that writer releases it. Callers must not
+// assume the file is unchanged since Downgrade.
+func (f *FSLock) Upgrade() (err error) {
+	defer f.wrap("lock", &err)
+	f.lock()
+	defer f.unlock()
+
+	if f.kind != LockShared {
+		return nil
+	}
+	if err := f.unlockFile(); err != nil {
+		return err
+	}
+	f.kind = LockNone
+	if err := f.lockFile(windows.LOCKFILE_EXCLUSIVE_LOCK); err != nil {
+		return err
+	}
+	f.kind = LockExclusive
+	f.summary.valid = false
+	return nil
+}
+
+// LockType returns the kind of OS lock f currently holds. It is LockNone once
+// f is closed, or when an Upgrade failed after releasing the shared lock.
+func (f *FSLock) LockType() LockKind {
+	f.rlock()
+	defer f.runlock()
+	return f.kind
+}
+
+// lockFile locks the whole file with flags. Without LOCKFILE_FAIL_IMMEDIATELY
+// it waits for as long as it takes, or up to the LockTimeout option.
+func (f *FSLock) lockFile(flags uint32) error {
+	return f.lockFileContext(context.Background(), flags)
+}
+
+// lockFileContext is lockFile that also gives up waiting once ctx is done.
+func (f *FSLock) lockFileContext(ctx context.Context, flags uint32) error {
+	start := time.Now()
+	var err error
+	if (f.opts.LockTimeout > 0 || ctx.Done() != nil) && flags&windows.LOCKFILE_FAIL_IMMEDIATELY == 0 {
+		var deadline time.Time
+		if f.opts.LockTimeout > 0 {
+			deadline = start.Add(f.opts.LockTimeout)
+		}
+		err = f.pollLock(ctx, flags, deadline)
+	} else {
+		err = f.lockFileEx(flags)
+	}
+	wait := time.Since(start)
+	if err != nil {
+		// Only a try fails at once; a wait that gave up still waited.
+		if flags&windows.LOCKFILE_FAIL_IMMEDIATELY != 0 {
+			if errors.Is(err, ErrLocked) {
+				lockCounters.failedTries.Add(1)
+			}
+		} else {
+			lockCounters.waited(wait)
+		}
+		return err
+	}
+	lockCounters.acquired(wait)
+	if f.opts.Observer.OnLockWait != nil {
+		f.opts.Observer.OnLockWait(wait)
+	}
+	return nil
+}
+
+// pollLock tries to take the lock until ctx is done or deadline, unless it
+// is zero, passes, backing off between tries. The handle is not opened for
+// overlapped I/O, so a waiting LockFileEx can not be cancelled and polling is
+// the only way to bound the wait.
+func (f *FSLock) pollLock(ctx context.Context, flags uint32, deadline time.Time) error {
+	return poll(ctx, deadline, func() error {
+		return f.lockFileEx(flags | windows.LOCKFILE_FAIL_IMMEDIATELY)
+	})
+}
+
+func (f *FSLock) lockFileEx(flags uint32) error {
+	ol, err := newOverlapped()
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(ol.HEvent)
+	err = windows.LockFileEx(f.handler, flags, reserved, allBytes, allBytes, ol)
+	if err != nil && err != windows.ERROR_IO_PENDING {
+		return mapError(err)
+	}
+
+	s, err := windows.WaitForSingleObject(ol.HEvent, uint32(windows.INFINITE))
+	if s != windows.WAIT_OBJECT_0 {
+		return mapError(err)
+	}
+	return nil
+}
+
+func (f *FSLock) unlockFile() error {
+	ol := &windows.Overlapped{}
+	return mapError(windows.UnlockFileEx(f.handler, reserved, allBytes, allBytes, ol))
+}
@@ -0,0 +1,130 @@
+package fslock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/windows"
+)
+
+// holdLock locks path exclusively through a handle of its own, which
+// LockFileEx treats as another holder even within this process.
+func holdLock(t *testing.T, path string) (release func()) {
+	t.Helper()
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := windows.CreateFile(name, windows.GENERIC_READ|windows.GENERIC_WRITE, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE, nil, windows.OPEN_ALWAYS, windows.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ol := &windows.Overlapped{}
+	if err := windows.LockFileEx(h, windows.LOCKFILE_EXCLUSIVE_LOCK, reserved, allBytes, allBytes, ol); err != nil {
+		windows.CloseHandle(h)
+		t.Fatal(err)
+	}
+	return func() {
+		windows.UnlockFileEx(h, reserved, allBytes, allBytes, ol)
+		windows.CloseHandle(h)
+	}
+}
+
+// lockedElsewhere reports whether path is locked against a handle of its
+// own, which LockFileEx treats as another holder even within this process.
+// shared tries a shared lock instead of an exclusive one.
+func lockedElsewhere(t *testing.T, path string, shared bool) bool {
+	t.Helper()
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := windows.CreateFile(name, windows.GENERIC_READ, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE, nil, windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer windows.CloseHandle(h)
+	flags := uint32(windows.LOCKFILE_FAIL_IMMEDIATELY)
+	if !shared {
+		flags |= windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+	ol := &windows.Overlapped{}
+	switch err := windows.LockFileEx(h, flags, reserved, allBytes, allBytes, ol); err {
+	case nil:
+		windows.UnlockFileEx(h, reserved, allBytes, allBytes, ol)
+		return false
+	case windows.ERROR_LOCK_VIOLATION:
+		return true
+	default:
+		t.Fatal(err)
+		return false
+	}
+}
+
+func TestDowngradeLetsReadersIn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	f, err := NewFSLockWithOptions(path, Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if !lockedElsewhere(t, path, true) {
+		t.Fatal("a shared lock was granted next to the exclusive one")
+	}
+
+	if err := f.Downgrade(); err != nil {
+		t.Fatal(err)
+	}
+	if kind := f.LockType(); kind != LockShared {
+		t.Fatalf("LockType after Downgrade = %v", kind)
+	}
+	if lockedElsewhere(t, path, true) {
+		t.Fatal("a shared lock was refused after Downgrade")
+	}
+	if !lockedElsewhere(t, path, false) {
+		t.Fatal("an exclusive lock was granted after Downgrade")
+	}
+	if err := f.Write([]byte("x\n")); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("Write after Downgrade = %v, want ErrReadOnly", err)
+	}
+
+	if err := f.Upgrade(); err != nil {
+		t.Fatal(err)
+	}
+	if kind := f.LockType(); kind != LockExclusive {
+		t.Fatalf("LockType after Upgrade = %v", kind)
+	}
+	if !lockedElsewhere(t, path, true) {
+		t.Fatal("a shared lock was granted after Upgrade")
+	}
+	if err := f.Write([]byte("x\n")); err != nil {
+		t.Fatalf("Write after Upgrade = %v", err)
+	}
+}
+
+func TestLockTypeThroughDowngrade(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "lock"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		name string
+		do   func() error
+		want LockKind
+	}{
+		{"open", func() error { return nil }, LockExclusive},
+		{"Downgrade", f.Downgrade, LockShared},
+		{"second Downgrade", f.Downgrade, LockShared},
+		{"Unlock", f.Unlock, LockNone},
+	}
+	for _, step := range steps {
+		if err := step.do(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if kind := f.LockType(); kind != step.want {
+			t.Fatalf("LockType after %s = %v, want %v", step.name, kind, step.want)
+		}
+	}
+}
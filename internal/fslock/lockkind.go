@@ -0,0 +1,23 @@
+package fslock
+
+// LockKind is the kind of OS lock an FSLock holds on its file.
+type LockKind int
+
+const (
+	LockNone LockKind = iota
+	LockShared
+	LockExclusive
+)
+
+func (k LockKind) String() string {
+	switch k {
+	case LockNone:
+		return "none"
+	case LockShared:
+		return "shared"
+	case LockExclusive:
+		return "exclusive"
+	default:
+		return "unknown"
+	}
+}
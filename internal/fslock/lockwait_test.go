@@ -0,0 +1,41 @@
+package fslock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOnLockWait(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	var waits []time.Duration
+	opts := Options{
+		Mode:     defaultFileMode | os.O_CREATE,
+		Observer: Observer{OnLockWait: func(d time.Duration) { waits = append(waits, d) }},
+	}
+	f, err := NewFSLockWithOptions(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if len(waits) != 1 || waits[0] > 50*time.Millisecond {
+		t.Fatalf("uncontended waits = %v, want one close to zero", waits)
+	}
+
+	const held = 100 * time.Millisecond
+	release := holdLock(t, path)
+	go func() {
+		time.Sleep(held)
+		release()
+	}()
+	if f, err = NewFSLockWithOptions(path, opts); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	// The wait only starts once the file is open, a little after the
+	// peer started holding the lock.
+	if len(waits) != 2 || waits[1] < held*3/4 {
+		t.Fatalf("waits = %v, want the second to last about %v", waits, held)
+	}
+}
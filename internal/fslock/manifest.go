@@ -0,0 +1,63 @@
+package fslock
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// Segment describes one segment file of a multi-file log.
+type Segment struct {
+	Name     string `json:"name"`
+	Start    int64  `json:"start"`
+	End      int64  `json:"end"`
+	Checksum uint32 `json:"checksum"`
+}
+
+// Manifest lists the segments of a multi-file log in a file of its own, so
+// readers can find them without listing the directory. Updates replace the
+// file atomically under a lock on a sibling ".lock" file, so a reader sees
+// either the old list or the new one and concurrent updaters never lose each
+// other's changes.
+type Manifest struct {
+	path     string
+	segments []Segment
+}
+
+// LoadManifest reads the manifest at path. A missing file is an empty
+// manifest.
+func LoadManifest(path string) (*Manifest, error) {
+	m := &Manifest{path: path}
+	return m, m.Load()
+}
+
+// Load rereads the manifest from disk.
+func (m *Manifest) Load() error {
+	segments, err := readManifest(m.path)
+	if err != nil {
+		return err
+	}
+	m.segments = segments
+	return nil
+}
+
+// Segments returns the segments as of the last Load or update.
+func (m *Manifest) Segments() []Segment {
+	return append([]Segment(nil), m.segments...)
+}
+
+func readManifest(path string) ([]Segment, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var segments []Segment
+	if err := json.Unmarshal(data, &segments); err != nil {
+		return nil, pathError("decode", path, err)
+	}
+	return segments, nil
+}
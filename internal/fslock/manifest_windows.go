@@ -0,0 +1,111 @@
+package fslock
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// Add records seg, replacing the segment of the same name if there is one.
+func (m *Manifest) Add(seg Segment) error {
+	return m.update(func(segments []Segment) ([]Segment, error) {
+		for i := range segments {
+			if segments[i].Name == seg.Name {
+				segments[i] = seg
+				return segments, nil
+			}
+		}
+		return append(segments, seg), nil
+	})
+}
+
+// Remove drops the segment called name, returning ErrNotFound if the
+// manifest does not list it.
+func (m *Manifest) Remove(name string) error {
+	return m.update(func(segments []Segment) ([]Segment, error) {
+		for i := range segments {
+			if segments[i].Name == name {
+				return append(segments[:i], segments[i+1:]...), nil
+			}
+		}
+		return nil, ErrNotFound
+	})
+}
+
+// update applies fn to the segments on disk and atomically replaces the
+// manifest with the result. The manifest is reread under the lock so that
+// changes made by other updaters since Load are kept.
+func (m *Manifest) update(fn func([]Segment) ([]Segment, error)) (err error) {
+	// Like EnsureInitialized, bypass the registry so updaters in this
+	// process queue on the OS lock.
+	lock, err := newFSLock(context.Background(), m.path+".lock", Options{Mode: windows.O_CREAT | windows.O_RDWR | windows.O_APPEND}, windows.LOCKFILE_EXCLUSIVE_LOCK)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := lock.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	segments, err := readManifest(m.path)
+	if err != nil {
+		return err
+	}
+	segments, err = fn(segments)
+	if err != nil {
+		return pathError("update", m.path, err)
+	}
+	data, err := json.Marshal(segments)
+	if err != nil {
+		return pathError("encode", m.path, err)
+	}
+	if err := replaceFile(m.path, data); err != nil {
+		return pathError("update", m.path, err)
+	}
+	m.segments = segments
+	return nil
+}
+
+// replaceFile writes data to a temporary sibling of path, syncs it and
+// renames it over path. A crash at any point leaves either the old file or
+// the new one in place, plus at worst a stale temporary file that the next
+// replace overwrites.
+func replaceFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return Replace(tmp, path)
+}
+
+// Replace renames from over to, replacing to if it exists, and syncs the
+// directory so the rename survives a crash. Neither file may be open.
+func Replace(from string, to string) error {
+	src, err := utf16Path(from)
+	if err != nil {
+		return err
+	}
+	dst, err := utf16Path(to)
+	if err != nil {
+		return err
+	}
+	if err := windows.MoveFileEx(src, dst, windows.MOVEFILE_REPLACE_EXISTING|windows.MOVEFILE_WRITE_THROUGH); err != nil {
+		return pathError("rename", from, mapError(err))
+	}
+	return pathError("sync", to, syncDir(filepath.Dir(to)))
+}
@@ -0,0 +1,95 @@
+package fslock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest")
+	m, err := LoadManifest(path)
+	if err != nil || len(m.Segments()) != 0 {
+		t.Fatalf("missing manifest loads %v, %v, want it empty", m.Segments(), err)
+	}
+	a := Segment{Name: "a", Start: 0, End: 100, Checksum: 1}
+	b := Segment{Name: "b", Start: 100, End: 250, Checksum: 2}
+	for _, seg := range []Segment{a, b} {
+		if err := m.Add(seg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Adding a segment again replaces it in place.
+	b.End, b.Checksum = 300, 3
+	if err := m.Add(b); err != nil {
+		t.Fatal(err)
+	}
+	check := func(want ...Segment) {
+		t.Helper()
+		if fmt.Sprint(m.Segments()) != fmt.Sprint(want) {
+			t.Fatalf("Segments = %v, want %v", m.Segments(), want)
+		}
+		loaded, err := LoadManifest(path)
+		if err != nil || fmt.Sprint(loaded.Segments()) != fmt.Sprint(want) {
+			t.Fatalf("LoadManifest = %v, %v, want %v", loaded.Segments(), err, want)
+		}
+	}
+	check(a, b)
+
+	if err := m.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	check(b)
+	if err := m.Remove("a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("removing a twice = %v, want ErrNotFound", err)
+	}
+	check(b)
+
+	// An update made through another Manifest since Load is kept.
+	other, err := LoadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Add(a); err != nil {
+		t.Fatal(err)
+	}
+	c := Segment{Name: "c", Start: 300, End: 400}
+	if err := m.Add(c); err != nil {
+		t.Fatal(err)
+	}
+	check(b, a, c)
+}
+
+func TestManifestSurvivesInterruptedUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest")
+	m, err := LoadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := Segment{Name: "a", End: 100}
+	if err := m.Add(a); err != nil {
+		t.Fatal(err)
+	}
+	// An update that crashed before its rename leaves a half-written
+	// temporary file behind, which readers must not see.
+	if err := os.WriteFile(path+".tmp", []byte(`[{"name":"a","end":100},{"na`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadManifest(path)
+	if err != nil || fmt.Sprint(loaded.Segments()) != fmt.Sprint([]Segment{a}) {
+		t.Fatalf("LoadManifest after interrupted update = %v, %v", loaded.Segments(), err)
+	}
+	// The next update overwrites the stale file.
+	b := Segment{Name: "b", Start: 100, End: 200}
+	if err := loaded.Add(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Load(); err != nil || fmt.Sprint(m.Segments()) != fmt.Sprint([]Segment{a, b}) {
+		t.Fatalf("Load after recovery = %v, %v", m.Segments(), err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("temporary file left after a completed update: %v", err)
+	}
+}
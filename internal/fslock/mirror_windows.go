@@ -0,0 +1,22 @@
+package fslock
+
+// WithMirror copies every later write to f onto dst as well, under dst's own
+// lock, for a hot copy of the file. In strict mode dst is written first and
+// a mirror failure fails the write before f is touched. Otherwise f is
+// written first and mirror failures are only reported to
+// Observer.OnMirrorError. A nil dst stops mirroring. It returns f.
+func (f *FSLock) WithMirror(dst *FSLock, strict bool) *FSLock {
+	f.lock()
+	defer f.unlock()
+	f.mirror = dst
+	f.mirrorStrict = strict
+	return f
+}
+
+func (f *FSLock) copyToMirror(bufs ...[]byte) error {
+	_, _, err := f.mirror.WriteVectored(bufs...)
+	if err != nil && f.opts.Observer.OnMirrorError != nil {
+		f.opts.Observer.OnMirrorError(err)
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package fslock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mirrorPair opens a primary and a mirror that refuses to grow past limit
+// bytes, mirroring the first onto the second. It returns the errors the
+// primary reported to its observer.
+func mirrorPair(t *testing.T, strict bool, limit int64) (primary, mirror *FSLock, reported *[]error) {
+	t.Helper()
+	dir := t.TempDir()
+	var errs []error
+	opts := Options{
+		Mode:     defaultFileMode | os.O_CREATE,
+		Observer: Observer{OnMirrorError: func(err error) { errs = append(errs, err) }},
+	}
+	primary, err := NewFSLockWithOptions(filepath.Join(dir, "primary"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { primary.Close() })
+	mirror, err = NewFSLockWithOptions(filepath.Join(dir, "mirror"), Options{Mode: defaultFileMode | os.O_CREATE, MaxBytes: limit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mirror.Close() })
+	return primary.WithMirror(mirror, strict), mirror, &errs
+}
+
+func TestStrictMirrorFailureAbortsWrite(t *testing.T) {
+	primary, mirror, reported := mirrorPair(t, true, 10)
+	if err := primary.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.Write([]byte("second\n")); !errors.Is(err, ErrMaxSizeExceeded) {
+		t.Fatalf("Write the mirror refused = %v, want ErrMaxSizeExceeded", err)
+	}
+	for _, f := range []*FSLock{primary, mirror} {
+		if data, err := f.Read(); err != nil || string(data) != "first\n" {
+			t.Fatalf("file holds %q, %v", data, err)
+		}
+	}
+	if len(*reported) != 1 {
+		t.Fatalf("observer saw %v", *reported)
+	}
+}
+
+func TestBestEffortMirrorFailureIsReported(t *testing.T) {
+	primary, mirror, reported := mirrorPair(t, false, 10)
+	for _, record := range []string{"first\n", "second\n"} {
+		if err := primary.Write([]byte(record)); err != nil {
+			t.Fatalf("Write(%q) = %v", record, err)
+		}
+	}
+	if data, err := primary.Read(); err != nil || string(data) != "first\nsecond\n" {
+		t.Fatalf("primary holds %q, %v", data, err)
+	}
+	if data, err := mirror.Read(); err != nil || string(data) != "first\n" {
+		t.Fatalf("mirror holds %q, %v", data, err)
+	}
+	if len(*reported) != 1 || !errors.Is((*reported)[0], ErrMaxSizeExceeded) {
+		t.Fatalf("observer saw %v, want one ErrMaxSizeExceeded", *reported)
+	}
+}
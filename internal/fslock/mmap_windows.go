@@ -0,0 +1,108 @@
+package fslock
+
+import (
+	"bytes"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// mmapView is a read-only mapping of the file backing the MmapReads option.
+// It covers the file as it was when last mapped and is remapped when a read
+// reaches past it. Its own mutex lets reads, which only hold the FSLock's
+// read lock, remap it safely.
+type mmapView struct {
+	mu      sync.RWMutex
+	mapping windows.Handle
+	addr    uintptr
+	data    []byte
+}
+
+// lineAt returns a copy of the line starting at offset, served from the
+// mapping. It follows readAtToEndOfLine: a final line without a newline is
+// returned as is and an offset at or past the end of file returns EOF.
+func (v *mmapView) lineAt(handler windows.Handle, offset int64) ([]byte, error) {
+	if offset < 0 {
+		return nil, ErrInvalidOffset
+	}
+	if line, ok := v.find(offset); ok {
+		return line, nil
+	}
+
+	v.mu.Lock()
+	err := v.remap(handler)
+	v.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if line, ok := v.find(offset); ok {
+		return line, nil
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if offset >= int64(len(v.data)) {
+		return nil, EOF
+	}
+	return append([]byte(nil), v.data[offset:]...), nil
+}
+
+// find looks for a complete line at offset within the current mapping.
+func (v *mmapView) find(offset int64) ([]byte, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if offset >= int64(len(v.data)) {
+		return nil, false
+	}
+	rest := v.data[offset:]
+	i := bytes.IndexByte(rest, '\n')
+	if i < 0 {
+		return nil, false
+	}
+	return append([]byte(nil), rest[:i]...), true
+}
+
+// remap maps the whole file as it is now, unless the mapping already covers
+// it. Callers hold v.mu.
+func (v *mmapView) remap(handler windows.Handle) error {
+	size, err := fileSize(handler)
+	if err != nil {
+		return err
+	}
+	if size <= int64(len(v.data)) {
+		return nil
+	}
+	v.unmap()
+
+	mapping, err := windows.CreateFileMapping(handler, nil, windows.PAGE_READONLY, uint32(size>>32), uint32(size), nil)
+	if err != nil {
+		return mapError(err)
+	}
+	addr, err := windows.MapViewOfFile(mapping, windows.FILE_MAP_READ, 0, 0, uintptr(size))
+	if err != nil {
+		windows.CloseHandle(mapping)
+		return mapError(err)
+	}
+	v.mapping, v.addr = mapping, addr
+	v.data = unsafe.Slice((*byte)(*(*unsafe.Pointer)(unsafe.Pointer(&addr))), size)
+	return nil
+}
+
+// close drops the mapping. Windows refuses to shrink a file while a view of
+// it is mapped, so it must run before the file is truncated, as well as
+// before the handle is closed.
+func (v *mmapView) close() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.unmap()
+}
+
+func (v *mmapView) unmap() {
+	if v.data == nil {
+		return
+	}
+	windows.UnmapViewOfFile(v.addr)
+	windows.CloseHandle(v.mapping)
+	v.mapping, v.addr, v.data = 0, 0, nil
+}
@@ -0,0 +1,68 @@
+package fslock
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+)
+
+// MultiLock holds the locks of several files acquired in a deterministic
+// order, so two processes locking the same set can not deadlock.
+type MultiLock struct {
+	names []string
+	locks []*FSLock
+}
+
+// LockAll locks every named file in sorted absolute-path order. If any lock
+// fails, the ones already acquired are released before returning the error.
+func LockAll(names ...string) (*MultiLock, error) {
+	paths := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		path, err := filepath.Abs(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	m := &MultiLock{names: paths, locks: make([]*FSLock, 0, len(paths))}
+	for _, path := range paths {
+		l, err := NewFSLock(path, 0)
+		if err != nil {
+			return nil, errors.Join(err, m.Unlock())
+		}
+		m.locks = append(m.locks, l)
+	}
+	return m, nil
+}
+
+// Lock returns the FSLock held for name, or nil if name is not part of m.
+func (m *MultiLock) Lock(name string) *FSLock {
+	path, err := filepath.Abs(name)
+	if err != nil {
+		return nil
+	}
+	for i, n := range m.names {
+		if n == path && i < len(m.locks) {
+			return m.locks[i]
+		}
+	}
+	return nil
+}
+
+// Unlock releases the locks in the reverse order they were acquired.
+func (m *MultiLock) Unlock() error {
+	var errs []error
+	for i := len(m.locks) - 1; i >= 0; i-- {
+		if err := m.locks[i].Unlock(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	m.locks = m.locks[:0]
+	return errors.Join(errs...)
+}
@@ -0,0 +1,83 @@
+package fslock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockAllOrdersLocks(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	for _, name := range []string{a, b} {
+		if err := os.WriteFile(name, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Both goroutines name the files in opposite orders. Within a process a
+	// held lock fails fast instead of blocking, so each retries until it
+	// holds both.
+	deadline := time.Now().Add(10 * time.Second)
+	var wg sync.WaitGroup
+	for _, names := range [][]string{{a, b}, {b, a}} {
+		names := names
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for round := 0; round < 20; round++ {
+				m, err := LockAll(names...)
+				for errors.Is(err, ErrAlreadyLockedInProcess) && time.Now().Before(deadline) {
+					time.Sleep(time.Millisecond)
+					m, err = LockAll(names...)
+				}
+				if err != nil {
+					t.Errorf("LockAll(%q) = %v", names, err)
+					return
+				}
+				for _, name := range names {
+					if err := m.Lock(name).Write([]byte("x\n")); err != nil {
+						t.Error(err)
+					}
+				}
+				if err := m.Unlock(); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for _, name := range []string{a, b} {
+		if data, err := os.ReadFile(name); err != nil || len(data) != 2*20*2 {
+			t.Fatalf("%s holds %d bytes, %v", name, len(data), err)
+		}
+	}
+}
+
+func TestLockAllReleasesOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	for _, name := range []string{a, b} {
+		if err := os.WriteFile(name, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	held, err := NewFSLock(b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Close()
+
+	if _, err := LockAll(b, a); !errors.Is(err, ErrAlreadyLockedInProcess) {
+		t.Fatalf("LockAll with b held = %v", err)
+	}
+	// a sorts first and was locked before b failed, so it must be free.
+	l, err := TryLock(a, 0)
+	if err != nil {
+		t.Fatalf("a still locked after LockAll failed: %v", err)
+	}
+	l.Close()
+}
@@ -0,0 +1,87 @@
+package fslock
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentWritesAndReads(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	const writers, lines = 8, 100
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		w := w
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < lines; i++ {
+				if _, err := f.AppendLine([]byte(fmt.Sprintf("writer %d line %03d", w, i))); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < lines/10; i++ {
+				if _, err := f.Read(); err != nil {
+					t.Error(err)
+					return
+				}
+				if err := f.Flush(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Every line arrived whole, and each writer's in order.
+	data, err := f.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := make([]int, writers)
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		var w, i int
+		if _, err := fmt.Sscanf(line, "writer %d line %d", &w, &i); err != nil || w < 0 || w >= writers || i != next[w] {
+			t.Fatalf("unexpected line %q", line)
+		}
+		next[w]++
+	}
+	for w, n := range next {
+		if n != lines {
+			t.Fatalf("writer %d has %d lines, want %d", w, n, lines)
+		}
+	}
+}
+
+func BenchmarkAppend(b *testing.B) {
+	line := []byte("a short line of about forty bytes or so")
+	for _, noMutex := range []bool{false, true} {
+		b.Run(fmt.Sprint("NoMutex=", noMutex), func(b *testing.B) {
+			f, err := NewFSLockWithOptions(filepath.Join(b.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE, NoMutex: noMutex})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer f.Close()
+			b.SetBytes(int64(len(line)) + 1)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := f.AppendLine(line); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
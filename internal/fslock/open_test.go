@@ -0,0 +1,147 @@
+package fslock
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDeleteOnClose(t *testing.T) {
+	dir := t.TempDir()
+	for _, release := range []string{"Close", "Unlock"} {
+		path := filepath.Join(dir, release+".lock")
+		f, err := NewFSLockWithOptions(path, Options{Mode: defaultFileMode | os.O_CREATE, DeleteOnClose: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Write([]byte("owner\n")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("%s: lock file missing while held: %v", release, err)
+		}
+		if release == "Close" {
+			err = f.Close()
+		} else {
+			err = f.Unlock()
+		}
+		if err != nil {
+			t.Fatalf("%s = %v", release, err)
+		}
+		if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("lock file left after %s: %v", release, err)
+		}
+
+		// The path is free for the next holder.
+		f, err = NewFSLockWithOptions(path, Options{Mode: defaultFileMode | os.O_CREATE, DeleteOnClose: true})
+		if err != nil {
+			t.Fatalf("%s: reopening = %v", release, err)
+		}
+		f.Close()
+	}
+}
+
+func TestDirSyncOnCreate(t *testing.T) {
+	dir := t.TempDir()
+	var synced []string
+	opts := Options{
+		Mode:     defaultFileMode | os.O_CREATE,
+		Observer: Observer{OnDirSync: func(dir string) { synced = append(synced, dir) }},
+	}
+	open := func(name string, opts Options) {
+		t.Helper()
+		f, err := NewFSLockWithOptions(filepath.Join(dir, name), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	open("new", opts)
+	if len(synced) != 1 || synced[0] != dir {
+		t.Fatalf("directories synced on create = %q, want %q", synced, dir)
+	}
+	// Opening an existing file creates no entry to make durable.
+	open("new", opts)
+	if len(synced) != 1 {
+		t.Fatalf("directories synced on reopen = %q", synced)
+	}
+	skip := opts
+	skip.SkipDirSync = true
+	open("skipped", skip)
+	if len(synced) != 1 {
+		t.Fatalf("directories synced with SkipDirSync = %q", synced)
+	}
+}
+
+func TestWriteThrough(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	syncs := 0
+	opts := Options{
+		Mode:         defaultFileMode | os.O_CREATE,
+		WriteThrough: true,
+		Observer:     Observer{OnSync: func() { syncs++ }},
+	}
+	f, err := NewFSLockWithOptions(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range []string{"first\n", "second\n"} {
+		if err := f.Write([]byte(record)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Plain writes, with no sync behind them, are already in the file.
+	if syncs != 0 {
+		t.Fatalf("%d syncs before Close", syncs)
+	}
+	r, err := f.NewReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := r.Read(); err != nil || string(data) != "first\nsecond\n" {
+		t.Fatalf("reader sees %q, %v", data, err)
+	}
+	r.Close()
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = NewFSLock(path, defaultFileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if data, err := f.Read(); err != nil || string(data) != "first\nsecond\n" {
+		t.Fatalf("reopened file holds %q, %v", data, err)
+	}
+}
+
+func TestMissingDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "a", "b")
+	path := filepath.Join(dir, "log")
+
+	_, err := NewFSLock(path, defaultFileMode|os.O_CREATE)
+	if !errors.Is(err, fs.ErrNotExist) || !strings.Contains(err.Error(), "directory "+dir+" does not exist") {
+		t.Fatalf("NewFSLock in a missing directory = %v", err)
+	}
+
+	f, err := NewFSLockWithOptions(path, Options{Mode: defaultFileMode | os.O_CREATE, MkdirAll: true, DirPerm: 0o700})
+	if err != nil {
+		t.Fatalf("NewFSLockWithOptions with MkdirAll = %v", err)
+	}
+	defer f.Close()
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		t.Fatalf("MkdirAll left %s as %v, %v", dir, info, err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o700 {
+		t.Fatalf("%s created with mode %v, want DirPerm 0700", dir, info.Mode().Perm())
+	}
+}
@@ -0,0 +1,108 @@
+//go:build unix
+
+package fslock
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// openFile opens name like os.OpenFile would for mode, applying the flags
+// selected by opts.
+func openFile(name string, mode int, opts Options) (*os.File, error) {
+	if opts.MkdirAll {
+		perm := opts.DirPerm
+		if perm == 0 {
+			perm = DefaultDirPerm
+		}
+		if err := os.MkdirAll(filepath.Dir(name), perm); err != nil {
+			return nil, &PathError{Op: "mkdir", Path: name, Err: err}
+		}
+	}
+	if opts.WriteThrough {
+		mode |= os.O_SYNC
+	}
+
+	file, created, err := createFile(name, mode)
+	err = unwrapPathError(err)
+	if errors.Is(err, fs.ErrNotExist) {
+		dir := filepath.Dir(name)
+		if _, statErr := os.Stat(dir); errors.Is(statErr, fs.ErrNotExist) {
+			err = fmt.Errorf("directory %s does not exist: %w", dir, err)
+		}
+	}
+	if err != nil {
+		return nil, &PathError{Op: "open", Path: name, Err: err}
+	}
+
+	if created && !opts.SkipDirSync {
+		dir := filepath.Dir(name)
+		if err := syncDir(dir); err != nil {
+			file.Close()
+			return nil, &PathError{Op: "sync", Path: dir, Err: err}
+		}
+		if opts.Observer.OnDirSync != nil {
+			opts.Observer.OnDirSync(dir)
+		}
+	}
+	return file, nil
+}
+
+// createFile opens name and reports whether it created the file. O_CREATE
+// without O_EXCL is split into an exclusive create and a plain open, since
+// open(2) does not tell the two outcomes apart.
+func createFile(name string, mode int) (*os.File, bool, error) {
+	if mode&os.O_CREATE == 0 || mode&os.O_EXCL != 0 {
+		file, err := os.OpenFile(name, mode, 0o644)
+		return file, err == nil && mode&os.O_CREATE != 0, err
+	}
+
+	for {
+		file, err := os.OpenFile(name, mode|os.O_EXCL, 0o644)
+		if err == nil {
+			return file, true, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, false, err
+		}
+		file, err = os.OpenFile(name, mode&^os.O_CREATE, 0o644)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return file, false, err
+		}
+		// Removed between the two calls, try creating it again.
+	}
+}
+
+// unwrapPathError strips the PathError os.OpenFile adds, since openFile
+// returns its own.
+func unwrapPathError(err error) error {
+	if pe, ok := err.(*os.PathError); ok {
+		return pe.Err
+	}
+	return err
+}
+
+// syncDir flushes the directory so the entry of a newly created file
+// survives a crash, not just its contents.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return syncFile(int(d.Fd()))
+}
+
+// Replace renames from over to, replacing to if it exists, and syncs the
+// directory so the rename survives a crash.
+func Replace(from string, to string) error {
+	if err := unix.Rename(from, to); err != nil {
+		return pathError("rename", from, mapError(err))
+	}
+	return pathError("sync", to, syncDir(filepath.Dir(to)))
+}
@@ -0,0 +1,58 @@
+//go:build unix
+
+package fslock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestRejectsPipesAndDevices(t *testing.T) {
+	fifo := filepath.Join(t.TempDir(), "fifo")
+	if err := unix.Mkfifo(fifo, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{fifo, os.DevNull} {
+		f, err := NewFSLock(path, os.O_RDWR)
+		if err == nil {
+			f.Close()
+		}
+		if !errors.Is(err, ErrNotSeekable) {
+			t.Fatalf("NewFSLock(%s) = %v, want ErrNotSeekable", path, err)
+		}
+	}
+}
+
+func TestWriteThroughOpensSynchronously(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	for _, writeThrough := range []bool{false, true} {
+		f, err := NewFSLockWithOptions(path, Options{Mode: defaultFileMode | os.O_CREATE, WriteThrough: writeThrough})
+		if err != nil {
+			t.Fatal(err)
+		}
+		flags, err := unix.FcntlInt(uintptr(f.fd), unix.F_GETFL, 0)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := flags&unix.O_SYNC == unix.O_SYNC; got != writeThrough {
+			t.Fatalf("WriteThrough %v opened with O_SYNC %v", writeThrough, got)
+		}
+	}
+}
+
+func TestMissingDirectoryMessage(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "missing")
+	path := filepath.Join(dir, "log")
+	_, err := NewFSLock(path, defaultFileMode|os.O_CREATE)
+	// The path is named once by the PathError, not again by the error
+	// os.OpenFile wraps.
+	want := "open " + path + ": directory " + dir + " does not exist: no such file or directory"
+	if err == nil || err.Error() != want {
+		t.Fatalf("NewFSLock in a missing directory = %v, want %q", err, want)
+	}
+}
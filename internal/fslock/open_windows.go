@@ -0,0 +1,177 @@
+package fslock
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+const fileWriteEA = 0x10
+
+// openFile opens name like os.OpenFile would for mode, but through
+// CreateFile directly so the flags selected by opts can be applied.
+func openFile(name string, mode int, opts Options) (windows.Handle, error) {
+	if opts.MkdirAll {
+		perm := opts.DirPerm
+		if perm == 0 {
+			perm = DefaultDirPerm
+		}
+		if err := os.MkdirAll(filepath.Dir(name), perm); err != nil {
+			return windows.InvalidHandle, &PathError{Op: "mkdir", Path: name, Err: err}
+		}
+	}
+
+	path, err := utf16Path(name)
+	if err != nil {
+		return windows.InvalidHandle, &PathError{Op: "open", Path: name, Err: err}
+	}
+
+	var access uint32
+	switch mode & (windows.O_RDONLY | windows.O_WRONLY | windows.O_RDWR) {
+	case windows.O_RDONLY:
+		access = windows.GENERIC_READ
+	case windows.O_WRONLY:
+		access = windows.GENERIC_WRITE
+	case windows.O_RDWR:
+		access = windows.GENERIC_READ | windows.GENERIC_WRITE
+	}
+	if mode&windows.O_CREAT != 0 {
+		access |= windows.GENERIC_WRITE
+	}
+	if mode&windows.O_APPEND != 0 {
+		// Dropping FILE_WRITE_DATA makes every write land at the end of
+		// file. The other rights GENERIC_WRITE grants are kept so that
+		// syncing still works. Truncating on open needs the full right.
+		if mode&windows.O_TRUNC == 0 {
+			access &^= windows.GENERIC_WRITE
+		}
+		access |= windows.FILE_APPEND_DATA | windows.FILE_WRITE_ATTRIBUTES | fileWriteEA | windows.STANDARD_RIGHTS_WRITE | windows.SYNCHRONIZE
+	}
+
+	share := uint32(windows.FILE_SHARE_READ | windows.FILE_SHARE_WRITE)
+	attrs := uint32(windows.FILE_ATTRIBUTE_NORMAL)
+	if opts.DeleteOnClose {
+		access |= windows.DELETE
+		share |= windows.FILE_SHARE_DELETE
+		attrs |= windows.FILE_FLAG_DELETE_ON_CLOSE
+	}
+	if opts.WriteThrough {
+		attrs |= windows.FILE_FLAG_WRITE_THROUGH
+	}
+
+	var create uint32
+	switch {
+	case mode&(windows.O_CREAT|windows.O_EXCL) == (windows.O_CREAT | windows.O_EXCL):
+		create = windows.CREATE_NEW
+	case mode&(windows.O_CREAT|windows.O_TRUNC) == (windows.O_CREAT | windows.O_TRUNC):
+		create = windows.CREATE_ALWAYS
+	case mode&windows.O_CREAT == windows.O_CREAT:
+		create = windows.OPEN_ALWAYS
+	case mode&windows.O_TRUNC == windows.O_TRUNC:
+		create = windows.TRUNCATE_EXISTING
+	default:
+		create = windows.OPEN_EXISTING
+	}
+
+	h, created, err := createFile(path, access, share, create, attrs)
+	if err == windows.ERROR_PATH_NOT_FOUND {
+		err = fmt.Errorf("directory %s does not exist: %w", filepath.Dir(name), err)
+	}
+	if err != nil {
+		return windows.InvalidHandle, &PathError{Op: "open", Path: name, Err: err}
+	}
+
+	// A locked handle leaked into a child process keeps the lock alive
+	// after this process exits, so inheritance is explicitly opt-in.
+	inherit := uint32(0)
+	if opts.Inheritable {
+		inherit = windows.HANDLE_FLAG_INHERIT
+	}
+	if err := windows.SetHandleInformation(h, windows.HANDLE_FLAG_INHERIT, inherit); err != nil {
+		windows.CloseHandle(h)
+		return windows.InvalidHandle, &PathError{Op: "open", Path: name, Err: err}
+	}
+
+	if created && !opts.SkipDirSync {
+		dir := filepath.Dir(name)
+		if err := syncDir(dir); err != nil {
+			windows.CloseHandle(h)
+			return windows.InvalidHandle, &PathError{Op: "sync", Path: dir, Err: err}
+		}
+		if opts.Observer.OnDirSync != nil {
+			opts.Observer.OnDirSync(dir)
+		}
+	}
+	return h, nil
+}
+
+// createFile calls CreateFile and reports whether it created the file.
+// OPEN_ALWAYS is split into CREATE_NEW and OPEN_EXISTING, since CreateFile
+// only tells the two apart through the last error of a successful call.
+func createFile(path *uint16, access uint32, share uint32, create uint32, attrs uint32) (windows.Handle, bool, error) {
+	if create != windows.OPEN_ALWAYS {
+		h, err := windows.CreateFile(path, access, share, nil, create, attrs, 0)
+		created := create == windows.CREATE_NEW || create == windows.CREATE_ALWAYS
+		return h, created && err == nil, err
+	}
+
+	for {
+		h, err := windows.CreateFile(path, access, share, nil, windows.CREATE_NEW, attrs, 0)
+		if err == nil {
+			return h, true, nil
+		}
+		if err != windows.ERROR_FILE_EXISTS {
+			return h, false, err
+		}
+		h, err = windows.CreateFile(path, access, share, nil, windows.OPEN_EXISTING, attrs, 0)
+		if err != windows.ERROR_FILE_NOT_FOUND {
+			return h, false, err
+		}
+		// Removed between the two calls, try creating it again.
+	}
+}
+
+// syncDir flushes the directory so the entry of a newly created file
+// survives a crash, not just its contents.
+func syncDir(dir string) error {
+	path, err := utf16Path(dir)
+	if err != nil {
+		return err
+	}
+	h, err := windows.CreateFile(path, windows.GENERIC_READ|windows.GENERIC_WRITE, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE, nil, windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(h)
+	return windows.FlushFileBuffers(h)
+}
+
+// maxPath is the path length beyond which Win32 calls need the extended
+// `\\?\` form.
+const maxPath = 260
+
+// utf16Path converts name for a direct Win32 call. A path whose absolute form
+// reaches MAX_PATH is passed absolute and cleaned with the `\\?\` prefix,
+// which lifts the limit but also skips the normalisation Win32 would
+// otherwise do.
+func utf16Path(name string) (*uint16, error) {
+	if strings.HasPrefix(name, `\\?\`) {
+		return windows.UTF16PtrFromString(name)
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(abs) < maxPath {
+		return windows.UTF16PtrFromString(name)
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		abs = `\\?\UNC\` + abs[2:]
+	} else {
+		abs = `\\?\` + abs
+	}
+	return windows.UTF16PtrFromString(abs)
+}
@@ -0,0 +1,116 @@
+package fslock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+func TestHelperHoldsInheritedHandles(t *testing.T) {
+	if os.Getenv("FSLOCK_TEST_HELPER") != "sleep" {
+		t.Skip("only runs as the child process of TestInheritable")
+	}
+	time.Sleep(time.Minute)
+}
+
+// startChild runs this test binary asleep in a child process created with
+// every inheritable handle, as CreateProcess callers other than os/exec
+// often do, and returns a function that ends it.
+func startChild(t *testing.T) (stop func()) {
+	t.Helper()
+	t.Setenv("FSLOCK_TEST_HELPER", "sleep")
+	cmdline, err := windows.UTF16PtrFromString(syscall.EscapeArg(os.Args[0]) + " -test.run=^TestHelperHoldsInheritedHandles$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	si := windows.StartupInfo{}
+	si.Cb = uint32(unsafe.Sizeof(si))
+	var pi windows.ProcessInformation
+	if err := windows.CreateProcess(nil, cmdline, nil, nil, true, 0, nil, nil, &si, &pi); err != nil {
+		t.Fatal(err)
+	}
+	windows.CloseHandle(pi.Thread)
+	return func() {
+		windows.TerminateProcess(pi.Process, 1)
+		windows.WaitForSingleObject(pi.Process, windows.INFINITE)
+		windows.CloseHandle(pi.Process)
+	}
+}
+
+func TestInheritable(t *testing.T) {
+	for _, inheritable := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "lock")
+		f, err := NewFSLockWithOptions(path, Options{Mode: defaultFileMode | os.O_CREATE, Inheritable: inheritable})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stop := startChild(t)
+		// Unlock only closes the handle, so the lock lasts for as long as
+		// a child holds a copy of it.
+		if err := f.Unlock(); err != nil {
+			stop()
+			t.Fatal(err)
+		}
+		locked := lockedElsewhere(t, path, false)
+		stop()
+		if locked != inheritable {
+			t.Fatalf("Inheritable %v: locked while the child runs = %v", inheritable, locked)
+		}
+		for deadline := time.Now().Add(5 * time.Second); lockedElsewhere(t, path, false); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("Inheritable %v: still locked after the child exited", inheritable)
+			}
+		}
+	}
+}
+
+func TestRejectsPipesAndDevices(t *testing.T) {
+	name := fmt.Sprintf(`\\.\pipe\fslock-test-%d`, os.Getpid())
+	pipeName, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := windows.CreateNamedPipe(pipeName, windows.PIPE_ACCESS_DUPLEX, windows.PIPE_TYPE_BYTE, 1, 4096, 4096, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer windows.CloseHandle(server)
+
+	for _, path := range []string{name, `\\.\NUL`} {
+		f, err := NewFSLock(path, os.O_RDWR)
+		if err == nil {
+			f.Close()
+		}
+		if !errors.Is(err, ErrNotSeekable) {
+			t.Fatalf("NewFSLock(%s) = %v, want ErrNotSeekable", path, err)
+		}
+	}
+}
+
+func TestUTF16PathPrefixesLongPaths(t *testing.T) {
+	dir := t.TempDir()
+	long := filepath.Join(dir, strings.Repeat("d", maxPath))
+	for _, tc := range []struct{ in, want string }{
+		{filepath.Join(dir, "log"), filepath.Join(dir, "log")},
+		{filepath.Join(dir, "журнал.log"), filepath.Join(dir, "журнал.log")},
+		{long, `\\?\` + long},
+		{`\\?\` + long, `\\?\` + long},
+		{`\\server\share\` + strings.Repeat("d", maxPath), `\\?\UNC\server\share\` + strings.Repeat("d", maxPath)},
+	} {
+		p, err := utf16Path(tc.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := windows.UTF16PtrToString(p); got != tc.want {
+			t.Fatalf("utf16Path(%.40q) = %.60q, want %.60q", tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package fslock
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Options configures an FSLock opened with NewFSLockWithOptions.
+type Options struct {
+	// Mode holds the flags passed when opening the file. Zero selects the
+	// platform default of read-write append.
+	Mode int
+
+	// NoMutex skips the in-process mutex around Write, Read and Flush. It
+	// only makes sense when a single goroutine uses the FSLock; concurrent
+	// callers must serialize access themselves.
+	NoMutex bool
+
+	// ReadBufferSize is the block size NextLine reads at a time. Zero
+	// selects DefaultReadBufferSize.
+	ReadBufferSize int
+
+	// ReadLength is how many bytes ReadLineFrom, Lines and the other reads
+	// of whole lines read first, reading as much again until the newline
+	// turns up. Lines that mostly fit in it take a single read. Zero
+	// selects DefaultReadLength.
+	ReadLength int
+
+	// SyncEveryN syncs the file after every N successful writes, bounding
+	// the records lost on a crash to N. Close syncs any remainder. Zero
+	// disables periodic syncing.
+	SyncEveryN int
+
+	// SyncInterval writes out the buffer and syncs the file in the
+	// background at this interval whenever writes are pending, so data
+	// written just before an idle period is not left unsynced. It needs
+	// the mutex, so it can not be combined with NoMutex. Zero disables it.
+	SyncInterval time.Duration
+
+	// LockTimeout bounds how long opening, and Upgrade, wait for another
+	// process to release the lock before failing with ErrLocked. Zero waits
+	// indefinitely.
+	LockTimeout time.Duration
+
+	// ReadTimeout bounds how long a read may block before it is cancelled
+	// with ErrTimeout, which matters for stalled network shares. Zero waits
+	// indefinitely.
+	ReadTimeout time.Duration
+
+	// DeleteOnClose removes the file once its last handle is closed, which
+	// suits pure coordination lock files that should not persist.
+	DeleteOnClose bool
+
+	// Inheritable lets child processes inherit the locked handle. It is off
+	// by default since an inherited handle keeps the lock held for as long
+	// as the child runs.
+	Inheritable bool
+
+	// SkipDirSync skips syncing the parent directory after the file is
+	// created. Without that sync a crash can lose the new file even when
+	// its contents were synced.
+	SkipDirSync bool
+
+	// MkdirAll creates the missing parent directories of the file with
+	// DirPerm before opening it. Without it a missing directory fails the
+	// open with an error naming the directory.
+	MkdirAll bool
+
+	// DirPerm is the mode of the directories MkdirAll creates. Zero selects
+	// DefaultDirPerm.
+	DirPerm os.FileMode
+
+	// WriteThrough opens the file with FILE_FLAG_WRITE_THROUGH, so each
+	// write reaches the disk before it returns and no separate sync is
+	// needed. Every write then pays the latency a sync would, which is far
+	// slower than batching writes behind one Flush.
+	WriteThrough bool
+
+	// WriteBufferSize buffers up to this many bytes of writes in memory
+	// before handing them to the OS. Flush and Close write the buffer out.
+	// Zero writes straight through.
+	WriteBufferSize int
+
+	// ReadSkipsBuffer makes reads return only what has reached the file.
+	// By default reads first write out the buffer so they observe every
+	// completed write.
+	ReadSkipsBuffer bool
+
+	// TailBuffer keeps the last TailBuffer lines appended in memory,
+	// whichever write appended them, seeded from the end of the file on
+	// open, for Tail to return without touching the file.
+	TailBuffer int
+
+	// RandomAccess opens the file without O_APPEND so WriteAt can patch
+	// earlier offsets. Appends then name the end of file explicitly, which
+	// is only safe while the OS lock keeps other writers out. By default
+	// the handle can only append, so no write, however stale its idea of
+	// the end of file, can overwrite existing data.
+	RandomAccess bool
+
+	// SkipChecksums makes Records hand out payloads without verifying
+	// their checksums, trading bit rot detection for CPU.
+	SkipChecksums bool
+
+	// FixedRecordSize is the slot size of AppendSlot, ReadIndex and
+	// WriteIndex, which treat the file as an array of records each
+	// zero-padded to this many bytes. Zero leaves the slot API unusable.
+	FixedRecordSize int
+
+	// DrainCommitsPartial makes DrainAll remove the lines processed before
+	// a failure instead of keeping the whole file. The unprocessed rest is
+	// rewritten at the start of the file, which a crash can interrupt.
+	DrainCommitsPartial bool
+
+	// MaxBytes rejects writes with ErrMaxSizeExceeded when they would grow
+	// the file past this many bytes. Zero means no limit.
+	MaxBytes int64
+
+	// MmapReads serves ReadAtToEndOfLine, and so ReadLineFrom, from a
+	// read-only memory mapping of the file, so a read of a warm file is a
+	// memory copy instead of a system call. The mapping is extended when a
+	// read reaches past it, which costs one remap after each batch of
+	// appends. It needs a readable Mode.
+	MmapReads bool
+
+	// Clock supplies the time for WriteStamped. Nil selects time.Now;
+	// tests can fix it for deterministic timestamps.
+	Clock func() time.Time
+
+	Observer Observer
+}
+
+// Observer receives notifications about the internals of an FSLock. Nil
+// hooks are skipped.
+type Observer struct {
+	// OnSync is called after every successful sync of the file.
+	OnSync func()
+
+	// OnLockWait is called once the OS lock is acquired with the time spent
+	// waiting for it, which is close to zero when it was not contended.
+	OnLockWait func(d time.Duration)
+
+	// OnDirSync is called after the parent directory of a newly created
+	// file was synced.
+	OnDirSync func(dir string)
+
+	// OnMirrorError is called when copying a write to the mirror set with
+	// WithMirror fails.
+	OnMirrorError func(err error)
+
+	// OnLineRead is called with every line NextLine, Lines, ReadLinesAt
+	// and ReadAtToEndOfLine return, before the caller sees it. The slice
+	// may be reused once the hook returns, so it must be copied to be kept.
+	OnLineRead func(offset int64, line []byte)
+}
+
+const (
+	DefaultReadBufferSize = 64 << 10
+	DefaultDirPerm        = 0o755
+)
+
+// readLength returns the ReadLength lines are read with.
+func (f *FSLock) readLength() int {
+	if f.opts.ReadLength > 0 {
+		return f.opts.ReadLength
+	}
+	return DefaultReadLength
+}
+
+// Validate reports the first setting that is out of range or contradicts
+// another one. NewFSLockWithOptions calls it, so bad options fail at open
+// instead of at the first write.
+func (o Options) Validate() error {
+	for _, c := range []struct {
+		name  string
+		value int64
+	}{
+		{"ReadBufferSize", int64(o.ReadBufferSize)},
+		{"ReadLength", int64(o.ReadLength)},
+		{"SyncEveryN", int64(o.SyncEveryN)},
+		{"ReadTimeout", int64(o.ReadTimeout)},
+		{"LockTimeout", int64(o.LockTimeout)},
+		{"SyncInterval", int64(o.SyncInterval)},
+		{"WriteBufferSize", int64(o.WriteBufferSize)},
+		{"TailBuffer", int64(o.TailBuffer)},
+		{"MaxBytes", int64(o.MaxBytes)},
+		{"FixedRecordSize", int64(o.FixedRecordSize)},
+	} {
+		if c.value < 0 {
+			return fmt.Errorf("%w: %s is negative", ErrInvalidOptions, c.name)
+		}
+	}
+
+	if o.SyncInterval > 0 && o.NoMutex {
+		return fmt.Errorf("%w: SyncInterval can not be combined with NoMutex", ErrInvalidOptions)
+	}
+	readOnly := o.Mode != 0 && o.Mode&(os.O_WRONLY|os.O_RDWR) == 0
+	if readOnly && (o.WriteBufferSize > 0 || o.SyncEveryN > 0 || o.SyncInterval > 0) {
+		return fmt.Errorf("%w: write buffering and sync policies need a writable Mode", ErrInvalidOptions)
+	}
+	if o.MmapReads && o.Mode&(os.O_WRONLY|os.O_RDWR) == os.O_WRONLY {
+		return fmt.Errorf("%w: MmapReads needs a readable Mode", ErrInvalidOptions)
+	}
+	if o.ReadSkipsBuffer && o.WriteBufferSize == 0 {
+		return fmt.Errorf("%w: ReadSkipsBuffer needs WriteBufferSize", ErrInvalidOptions)
+	}
+	return nil
+}
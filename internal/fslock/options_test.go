@@ -0,0 +1,43 @@
+package fslock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		opts Options
+		want string
+	}{
+		{Options{ReadBufferSize: -1}, "ReadBufferSize is negative"},
+		{Options{MaxBytes: -1}, "MaxBytes is negative"},
+		{Options{SyncInterval: time.Second, NoMutex: true}, "SyncInterval can not be combined with NoMutex"},
+		{Options{Mode: os.O_RDONLY | os.O_APPEND, SyncEveryN: 10}, "need a writable Mode"},
+		{Options{Mode: os.O_WRONLY, MmapReads: true}, "MmapReads needs a readable Mode"},
+		{Options{ReadSkipsBuffer: true}, "ReadSkipsBuffer needs WriteBufferSize"},
+	} {
+		err := tc.opts.Validate()
+		if !errors.Is(err, ErrInvalidOptions) || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("Validate(%+v) = %v, want %q", tc.opts, err, tc.want)
+		}
+	}
+	if err := (Options{Mode: defaultFileMode, SyncEveryN: 10, ReadLength: 128}).Validate(); err != nil {
+		t.Fatalf("Validate of good options = %v", err)
+	}
+}
+
+func TestInvalidOptionsFailAtOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	_, err := NewFSLockWithOptions(path, Options{Mode: defaultFileMode | os.O_CREATE, SyncEveryN: -1})
+	if !errors.Is(err, ErrInvalidOptions) {
+		t.Fatalf("NewFSLockWithOptions = %v, want ErrInvalidOptions", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("invalid options still created the file: %v", err)
+	}
+}
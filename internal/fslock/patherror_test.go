@@ -0,0 +1,49 @@
+package fslock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log")
+	check := func(err error, op, path string, cause error) {
+		t.Helper()
+		var pe *PathError
+		if !errors.As(err, &pe) {
+			t.Fatalf("error %v is not a *PathError", err)
+		}
+		if pe.Op != op || pe.Path != path {
+			t.Fatalf("error %v has Op %q and Path %q, want %q and %q", err, pe.Op, pe.Path, op, path)
+		}
+		if !errors.Is(err, cause) {
+			t.Fatalf("error %v does not unwrap to %v", err, cause)
+		}
+	}
+
+	f, err := NewFSLockWithOptions(path, Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, err = f.ReadAtToEndOfLine(-1, 0)
+	check(err, "read", path, ErrInvalidOffset)
+
+	failWrites(t, diskFull)
+	err = f.Write([]byte("record\n"))
+	check(err, "write", path, diskFull)
+	check(err, "write", path, ErrNoSpace)
+
+	held := filepath.Join(dir, "held")
+	release := holdLock(t, held)
+	defer release()
+	_, err = TryLock(held, defaultFileMode)
+	check(err, "lock", held, ErrAlreadyLocked)
+
+	missing := filepath.Join(dir, "missing", "log")
+	_, err = NewFSLock(missing, defaultFileMode|os.O_CREATE)
+	check(err, "open", missing, os.ErrNotExist)
+}
@@ -0,0 +1,38 @@
+package fslock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLongAndUnicodePaths(t *testing.T) {
+	dir := t.TempDir()
+	long := dir
+	for len(long) < 300 {
+		long = filepath.Join(long, strings.Repeat("d", 50))
+	}
+	for _, path := range []string{
+		filepath.Join(long, "log"),
+		filepath.Join(dir, "журнал-日志-é.log"),
+	} {
+		f, err := NewFSLockWithOptions(path, Options{Mode: defaultFileMode | os.O_CREATE, MkdirAll: true})
+		if err != nil {
+			t.Fatalf("open %d byte path: %v", len(path), err)
+		}
+		if _, err := TryLock(path, defaultFileMode); !errors.Is(err, ErrAlreadyLockedInProcess) {
+			t.Fatalf("second lock of %d byte path = %v", len(path), err)
+		}
+		if _, err := f.AppendLine([]byte("record")); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if data, err := os.ReadFile(path); err != nil || string(data) != "record\n" {
+			t.Fatalf("file at %s holds %q, %v", path, data, err)
+		}
+	}
+}
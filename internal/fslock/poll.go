@@ -0,0 +1,49 @@
+package fslock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxLockPoll caps the delay between the tries of poll.
+const maxLockPoll = 100 * time.Millisecond
+
+// poll calls try, which attempts to take a lock without waiting, until it
+// returns anything but ErrAlreadyLocked, backing off between calls. It gives
+// up once ctx is done or deadline, unless it is zero, passes, returning the
+// last ErrAlreadyLocked wrapped with ctx.Err() or ErrTimeout.
+func poll(ctx context.Context, deadline time.Time, try func() error) error {
+	delay := time.Millisecond
+	for {
+		err := try()
+		if !errors.Is(err, ErrAlreadyLocked) {
+			return err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("%w: %w", err, ctxErr)
+		}
+		wait := delay
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return fmt.Errorf("%w: %w", err, ErrTimeout)
+			}
+			if wait > remaining {
+				wait = remaining
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w: %w", err, ctx.Err())
+		case <-timer.C:
+		}
+		if delay *= 2; delay > maxLockPoll {
+			delay = maxLockPoll
+		}
+	}
+}
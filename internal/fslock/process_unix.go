@@ -0,0 +1,15 @@
+//go:build unix
+
+package fslock
+
+import "golang.org/x/sys/unix"
+
+// ProcessAlive reports whether a process with the given PID is running on
+// this host. A process this one may not signal still counts as running.
+func ProcessAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := unix.Kill(pid, 0)
+	return err == nil || err == unix.EPERM
+}
@@ -0,0 +1,11 @@
+package fslock
+
+// Range is the half-open byte range [Start, End) of a file.
+type Range struct {
+	Start int64
+	End   int64
+}
+
+func (r Range) Len() int64 {
+	return r.End - r.Start
+}
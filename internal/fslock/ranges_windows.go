@@ -0,0 +1,98 @@
+package fslock
+
+import (
+	"bytes"
+	"errors"
+)
+
+var errInvalidSplit = errors.New("split count must be positive")
+
+// SplitRanges divides the file into at most n ranges of roughly equal size
+// for parallel scanning. Every boundary is moved forward to the start of the
+// next line, so no line spans two ranges; together the ranges cover the file
+// exactly once.
+func (f *FSLock) SplitRanges(n int) (ranges []Range, err error) {
+	defer f.wrap("read", &err)
+	if n <= 0 {
+		return nil, errInvalidSplit
+	}
+	if err := f.drainForRead(); err != nil {
+		return nil, err
+	}
+	f.rlock()
+	defer f.runlock()
+
+	h := f.readHandle()
+	size, err := fileSize(h.handler)
+	if err != nil {
+		return nil, err
+	}
+
+	ranges = make([]Range, 0, n)
+	start := int64(0)
+	for i := 1; i <= n && start < size; i++ {
+		end := size
+		if i < n {
+			end, err = h.lineStart(size * int64(i) / int64(n))
+			if err != nil {
+				return nil, err
+			}
+		}
+		if end > start {
+			ranges = append(ranges, Range{Start: start, End: end})
+			start = end
+		}
+	}
+	return ranges, nil
+}
+
+// ScanRange calls fn for every line starting inside r, stopping early when fn
+// returns false. Ranges from SplitRanges can be scanned concurrently.
+func (f *FSLock) ScanRange(r Range, fn func(offset int64, line []byte) bool) (err error) {
+	defer f.wrap("read", &err)
+	if err := f.drainForRead(); err != nil {
+		return err
+	}
+	f.rlock()
+	defer f.runlock()
+
+	h := f.readHandle()
+	offset := r.Start
+	for offset < r.End {
+		line, err := h.readAtToEndOfLine(offset, f.readLength())
+		if err == EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !fn(offset, line) {
+			return nil
+		}
+		offset += int64(len(line)) + 1
+	}
+	return nil
+}
+
+// lineStart returns the offset of the first line starting at or after
+// offset, or the end of file when there is none.
+func (h readHandle) lineStart(offset int64) (int64, error) {
+	if offset == 0 {
+		return 0, nil
+	}
+	block := make([]byte, tailScanBlock)
+	pos := offset - 1
+	for {
+		n, err := h.readAt(block, pos)
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			return pos, nil
+		}
+		if i := bytes.IndexByte(block[:n], '\n'); i >= 0 {
+			return pos + int64(i) + 1, nil
+		}
+		pos += int64(n)
+	}
+}
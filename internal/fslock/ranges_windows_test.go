@@ -0,0 +1,64 @@
+package fslock
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitRanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	var data []byte
+	var lines []string
+	for i := 0; i < 50; i++ {
+		line := fmt.Sprintf("%d %s", i, strings.Repeat("x", i*7%23))
+		lines = append(lines, line)
+		data = append(data, line+"\n"...)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFSLock(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, n := range []int{1, 2, 3, 7, 50, 200} {
+		ranges, err := f.SplitRanges(n)
+		if err != nil {
+			t.Fatalf("SplitRanges(%d) = %v", n, err)
+		}
+		if len(ranges) == 0 || len(ranges) > n {
+			t.Fatalf("SplitRanges(%d) returned %d ranges", n, len(ranges))
+		}
+		next := int64(0)
+		var scanned []string
+		for _, r := range ranges {
+			if r.Start != next || r.Len() <= 0 {
+				t.Fatalf("SplitRanges(%d) = %v, not contiguous from %d", n, ranges, next)
+			}
+			if r.Start > 0 && data[r.Start-1] != '\n' {
+				t.Fatalf("SplitRanges(%d) = %v, %v starts inside a line", n, ranges, r)
+			}
+			next = r.End
+			if err := f.ScanRange(r, func(offset int64, line []byte) bool {
+				scanned = append(scanned, string(line))
+				return true
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if next != int64(len(data)) {
+			t.Fatalf("SplitRanges(%d) = %v, ends at %d of %d bytes", n, ranges, next, len(data))
+		}
+		if fmt.Sprint(scanned) != fmt.Sprint(lines) {
+			t.Fatalf("scanning the ranges of SplitRanges(%d) read %q", n, scanned)
+		}
+	}
+	if _, err := f.SplitRanges(0); err == nil {
+		t.Fatal("SplitRanges(0) succeeded")
+	}
+}
@@ -0,0 +1,56 @@
+package fslock
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadLargeFile(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	chunk := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	var want []byte
+	for i := 0; i < 64; i++ {
+		chunk[0] = byte(i)
+		if err := f.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, chunk...)
+	}
+	got, err := f.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) || !bytes.Equal(got, want) {
+		t.Fatalf("Read returned %d bytes of %d, or different ones", len(got), len(want))
+	}
+}
+
+func TestReadPastFourGiB(t *testing.T) {
+	// A sparse file takes almost no space however far its end lies.
+	path := filepath.Join(t.TempDir(), "log")
+	const offset = 5 << 30
+	growSparse(t, path, offset)
+	f, err := NewFSLockWithOptions(path, Options{Mode: defaultFileMode})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.AppendLine([]byte("far out")); err != nil {
+		t.Fatal(err)
+	}
+	// Reads at the offset, not at it wrapped around to 1 GiB.
+	line, err := f.ReadAtToEndOfLine(offset, 0)
+	if err != nil || string(line) != "far out" {
+		t.Fatalf("ReadAtToEndOfLine past 4 GiB = %q, %v", line, err)
+	}
+	line, next, err := f.ReadLineFrom(offset)
+	if err != nil || string(line) != "far out" || next != offset+8 {
+		t.Fatalf("ReadLineFrom past 4 GiB = %q, %d, %v", line, next, err)
+	}
+}
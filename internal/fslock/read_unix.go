@@ -0,0 +1,129 @@
+//go:build unix
+
+package fslock
+
+import (
+	"bytes"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+const tailScanBlock = 4096
+
+// readHandle performs positioned reads on a file descriptor. seek, when
+// set, serializes the hole queries that move the file offset.
+type readHandle struct {
+	fd   int
+	seek *sync.Mutex
+}
+
+func (h readHandle) size() (int64, error) {
+	return fileSize(h.fd)
+}
+
+func (h readHandle) readAt(data []byte, offset int64) (int, error) {
+	for {
+		n, err := unix.Pread(h.fd, data, offset)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return 0, mapError(err)
+		}
+		return n, nil
+	}
+}
+
+func (h readHandle) readAll() ([]byte, error) {
+	size, err := fileSize(h.fd)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return []byte{}, nil
+	}
+
+	// A single pread may return less than asked for, so keep reading until
+	// the buffer is full or the file ends.
+	data := make([]byte, size)
+	read := 0
+	for read < len(data) {
+		n, err := h.readAt(data[read:], int64(read))
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+		read += n
+	}
+	return data[:read], nil
+}
+
+func (h readHandle) readAtToEndOfLine(offset int64, length int) ([]byte, error) {
+	if offset < 0 {
+		return nil, ErrInvalidOffset
+	}
+	size, err := fileSize(h.fd)
+	if err != nil {
+		return nil, err
+	}
+	if offset >= size {
+		return nil, EOF
+	}
+	if length <= 0 {
+		length = DefaultReadLength
+	}
+
+	return h.readLine(offset, length)
+}
+
+// readLine reads blocks of length bytes from offset, appending each to the
+// line until a newline or the end of file is found.
+func (h readHandle) readLine(offset int64, length int) ([]byte, error) {
+	var line []byte
+	block := make([]byte, length)
+	for {
+		n, err := h.readAt(block, offset+int64(len(line)))
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			if len(line) == 0 {
+				return nil, EOF
+			}
+			return line, nil
+		}
+
+		if i := bytes.IndexByte(block[:n], '\n'); i >= 0 {
+			return append(line, block[:i]...), nil
+		}
+		line = append(line, block[:n]...)
+		if n < length {
+			return line, nil
+		}
+	}
+}
+
+// lastIndexByte returns the offset of the last c located before offset, or -1
+// if there is none.
+func (h readHandle) lastIndexByte(before int64, c byte) (int64, error) {
+	block := make([]byte, tailScanBlock)
+	end := before
+	for end > 0 {
+		start := end - tailScanBlock
+		if start < 0 {
+			start = 0
+		}
+		n, err := h.readAt(block[:end-start], start)
+		if err != nil {
+			return -1, err
+		}
+		if i := bytes.LastIndexByte(block[:n], c); i >= 0 {
+			return start + int64(i), nil
+		}
+		end = start
+	}
+	return -1, nil
+}
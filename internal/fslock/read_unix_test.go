@@ -0,0 +1,22 @@
+//go:build unix
+
+package fslock
+
+import (
+	"os"
+	"testing"
+)
+
+// growSparse creates the file at path holding size zero bytes, which unix
+// file systems store as a hole.
+func growSparse(t *testing.T, path string, size int64) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+}
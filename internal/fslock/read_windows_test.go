@@ -0,0 +1,306 @@
+package fslock
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// growSparse creates the file at path holding size zero bytes, marked
+// sparse first, so NTFS does not fill them in when it is written past.
+func growSparse(t *testing.T, path string, size int64) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var n uint32
+	if err := windows.DeviceIoControl(windows.Handle(f.Fd()), windows.FSCTL_SET_SPARSE, nil, 0, nil, 0, &n, nil); err != nil {
+		t.Skipf("no sparse files here: %v", err)
+	}
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOverlappedOffsetsPastFourGiB(t *testing.T) {
+	for _, remote := range []bool{false, true} {
+		ov, release, err := readHandle{remote: remote}.overlappedAt(5<<30 + 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ov.Offset != 1<<30+7 || ov.OffsetHigh != 1 {
+			t.Fatalf("offset 5 GiB + 7 split into %#x and %#x", ov.OffsetHigh, ov.Offset)
+		}
+		release()
+	}
+}
+
+func TestReadTimeoutCancelsBlockedRead(t *testing.T) {
+	// A read from an empty pipe blocks until something is written, like a
+	// read from a stalled share, and on a real handle rather than a stub.
+	var r, w windows.Handle
+	if err := windows.CreatePipe(&r, &w, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer windows.CloseHandle(r)
+	defer windows.CloseHandle(w)
+	h := readHandle{handler: r, timeout: 50 * time.Millisecond}
+
+	start := time.Now()
+	buf := make([]byte, 16)
+	if n, err := h.readAt(buf, 0); err != ErrTimeout {
+		t.Fatalf("read from an empty pipe = %d, %v, want ErrTimeout", n, err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > 5*time.Second {
+		t.Fatalf("gave up after %v, want about the 50ms timeout", elapsed)
+	}
+
+	// The handle is still usable after a cancelled read, and reads that
+	// finish in time are left alone.
+	var done uint32
+	if err := windows.WriteFile(w, []byte("one\n"), &done, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := h.readAt(buf, 0); err != nil || string(buf[:n]) != "one\n" {
+		t.Fatalf("read after a timeout = %q, %v", buf[:n], err)
+	}
+}
+
+func TestReadTimeoutLeavesFileReadsAlone(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE, ReadTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want := bytes.Repeat([]byte("line\n"), 1000)
+	if err := f.Write(want); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if data, err := f.Read(); err != nil || !bytes.Equal(data, want) {
+			t.Fatalf("Read %d = %d bytes, %v", i, len(data), err)
+		}
+	}
+}
+
+func TestReadAssemblesShortReads(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want := make([]byte, 8<<20)
+	for i := range want {
+		want[i] = byte('a' + i%26)
+	}
+	if err := f.Write(want); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cap every read at 1 MiB, as some handles do for large requests.
+	const limit = 1 << 20
+	reads := 0
+	saved := readFile
+	readFile = func(h windows.Handle, data []byte, n *uint32, ov *windows.Overlapped) error {
+		reads++
+		if len(data) > limit {
+			data = data[:limit]
+		}
+		return saved(h, data, n, ov)
+	}
+	t.Cleanup(func() { readFile = saved })
+
+	got, err := f.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) || !bytes.Equal(got, want) {
+		t.Fatalf("Read returned %d bytes of %d, or different ones", len(got), len(want))
+	}
+	if reads < len(want)/limit {
+		t.Fatalf("Read took %d reads of at most %d bytes for %d bytes", reads, limit, len(want))
+	}
+}
+
+func TestReadLinesAtPages(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	const lines = 10
+	for i := 0; i < lines; i++ {
+		if _, err := f.AppendLine([]byte(fmt.Sprintf("line %d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	var pages []int
+	offset := int64(0)
+	for {
+		page, next, err := f.ReadLinesAt(offset, 3)
+		if err != nil && !errors.Is(err, EOF) {
+			t.Fatal(err)
+		}
+		// Every page resumes exactly past its last line.
+		want := offset
+		for _, line := range page {
+			got = append(got, string(line))
+			want += int64(len(line)) + 1
+		}
+		if next != want {
+			t.Fatalf("page at %d resumes at %d, want %d", offset, next, want)
+		}
+		pages = append(pages, len(page))
+		offset = next
+		if errors.Is(err, EOF) {
+			break
+		}
+	}
+	var want []string
+	for i := 0; i < lines; i++ {
+		want = append(want, fmt.Sprintf("line %d", i))
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("paging read %q, want %q", got, want)
+	}
+	if fmt.Sprint(pages) != "[3 3 3 1]" {
+		t.Fatalf("page sizes %v, want [3 3 3 1]", pages)
+	}
+}
+
+// benchDirs returns the directories read benchmarks run in: a local
+// temporary one, and the share FSLOCK_BENCH_SHARE names, if any.
+func benchDirs(b *testing.B) map[string]string {
+	dirs := map[string]string{"local": b.TempDir()}
+	if share := os.Getenv("FSLOCK_BENCH_SHARE"); share != "" {
+		dir, err := os.MkdirTemp(share, "fslock-bench-")
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() { os.RemoveAll(dir) })
+		dirs["share"] = dir
+	}
+	return dirs
+}
+
+func BenchmarkReadAtToEndOfLine(b *testing.B) {
+	for name, dir := range benchDirs(b) {
+		b.Run(name, func(b *testing.B) {
+			f, err := NewFSLockWithOptions(filepath.Join(dir, "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer f.Close()
+			const lines = 1000
+			for i := 0; i < lines; i++ {
+				if _, err := f.AppendLine([]byte(fmt.Sprintf("line %04d", i))); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := f.ReadAtToEndOfLine(int64(i%lines)*10, 0); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestPooledEventsReadCorrectly(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	const lines = 200
+	for i := 0; i < lines; i++ {
+		if _, err := f.AppendLine([]byte(fmt.Sprintf("line %04d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// More readers at once than the pool holds events, so some reads get
+	// fresh events and some get reused ones.
+	readers := 2 * cap(eventPool)
+	errs := make(chan error, readers)
+	for r := 0; r < readers; r++ {
+		r := r
+		go func() {
+			for i := 0; i < lines; i++ {
+				j := (i + r) % lines
+				line, err := f.ReadAtToEndOfLine(int64(j)*10, 0)
+				if err == nil && string(line) != fmt.Sprintf("line %04d", j) {
+					err = fmt.Errorf("line %d read as %q", j, line)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for r := 0; r < readers; r++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(eventPool); n == 0 || n > cap(eventPool) {
+		t.Fatalf("%d events pooled after the reads, want between 1 and %d", n, cap(eventPool))
+	}
+}
+
+func TestSharesReadWithoutPooledEvents(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.remote {
+		t.Fatal("a file in the temporary directory counts as remote")
+	}
+	if share := os.Getenv("FSLOCK_BENCH_SHARE"); share != "" {
+		dir, err := os.MkdirTemp(share, "fslock-test-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		s, err := NewFSLockWithOptions(filepath.Join(dir, "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		if !s.remote {
+			t.Fatalf("a file on %s does not count as remote", share)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		if _, err := f.AppendLine([]byte(fmt.Sprintf("line %04d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Treated as a share, the file reads the same while the pool is left
+	// as it was.
+	f.remote = true
+	pooled := len(eventPool)
+	for i := 0; i < 10; i++ {
+		if line, err := f.ReadAtToEndOfLine(int64(i)*10, 0); err != nil || string(line) != fmt.Sprintf("line %04d", i) {
+			t.Fatalf("line %d read as %q, %v", i, line, err)
+		}
+	}
+	if n := len(eventPool); n != pooled {
+		t.Fatalf("%d events pooled after reads on a share, want %d", n, pooled)
+	}
+}
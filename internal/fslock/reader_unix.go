@@ -0,0 +1,77 @@
+//go:build unix
+
+package fslock
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// FSLockReader is a read-only view over a file locked by an FSLock in the
+// same process. Its descriptor is a duplicate of the owner's and shares the
+// owner's open file description, and so its flock, instead of conflicting
+// with it.
+type FSLockReader struct {
+	file *os.File
+	fd   int
+	path string
+}
+
+func (f *FSLock) NewReader() (r *FSLockReader, err error) {
+	defer f.wrap("duplicate", &err)
+	f.rlock()
+	defer f.runlock()
+
+	fd, err := unix.Dup(f.fd)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	unix.CloseOnExec(fd)
+	file := os.NewFile(uintptr(fd), f.file.Name())
+	return &FSLockReader{file: file, fd: fd, path: f.file.Name()}, nil
+}
+
+func (r *FSLockReader) Read() ([]byte, error) {
+	data, err := r.readHandle().readAll()
+	return data, pathError("read", r.path, err)
+}
+
+func (r *FSLockReader) ReadAtToEndOfLine(offset int64, length int) ([]byte, error) {
+	line, err := r.readHandle().readAtToEndOfLine(offset, length)
+	return line, pathError("read", r.path, err)
+}
+
+// ReadAt reads len(p) bytes at off, returning EOF if the file ends first. It
+// implements io.ReaderAt, so a reader can be wrapped in io.NewSectionReader to
+// stream a fixed range of the file.
+func (r *FSLockReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, pathError("read", r.path, ErrInvalidOffset)
+	}
+	h := r.readHandle()
+	read := 0
+	for read < len(p) {
+		n, err := h.readAt(p[read:], off+int64(read))
+		if err != nil {
+			return read, pathError("read", r.path, err)
+		}
+		if n == 0 {
+			return read, EOF
+		}
+		read += n
+	}
+	return read, nil
+}
+
+func (r *FSLockReader) readHandle() readHandle {
+	return readHandle{fd: r.fd}
+}
+
+func (r *FSLockReader) Close() error {
+	err := r.file.Close()
+	if pe, ok := err.(*os.PathError); ok {
+		err = mapError(pe.Err)
+	}
+	return pathError("close", r.path, err)
+}
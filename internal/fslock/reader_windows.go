@@ -0,0 +1,99 @@
+package fslock
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// FSLockReader is a read-only view over a file locked by an FSLock in the
+// same process. Its handle is a duplicate of the owner's, so it shares the
+// owner's lock instead of conflicting with it.
+type FSLockReader struct {
+	handler windows.Handle
+	timeout time.Duration
+	path    string
+	remote  bool
+}
+
+func (f *FSLock) NewReader() (r *FSLockReader, err error) {
+	defer f.wrap("duplicate", &err)
+	f.rlock()
+	defer f.runlock()
+
+	handler, err := f.duplicate(windows.GENERIC_READ, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &FSLockReader{handler: handler, timeout: f.opts.ReadTimeout, path: f.file.Name(), remote: f.remote}, nil
+}
+
+func (r *FSLockReader) Read() ([]byte, error) {
+	data, err := r.readHandle().readAll()
+	return data, pathError("read", r.path, err)
+}
+
+func (r *FSLockReader) ReadAtToEndOfLine(offset int64, length int) ([]byte, error) {
+	line, err := r.readHandle().readAtToEndOfLine(offset, length)
+	return line, pathError("read", r.path, err)
+}
+
+// ReadAt reads len(p) bytes at off, returning EOF if the file ends first. It
+// implements io.ReaderAt, so a reader can be wrapped in io.NewSectionReader to
+// stream a fixed range of the file.
+func (r *FSLockReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, pathError("read", r.path, ErrInvalidOffset)
+	}
+	h := r.readHandle()
+	read := 0
+	for read < len(p) {
+		n, err := h.readAt(p[read:], off+int64(read))
+		if err != nil {
+			return read, pathError("read", r.path, err)
+		}
+		if n == 0 {
+			return read, EOF
+		}
+		read += n
+	}
+	return read, nil
+}
+
+func (r *FSLockReader) readHandle() readHandle {
+	return readHandle{handler: r.handler, timeout: r.timeout, remote: r.remote}
+}
+
+func (r *FSLockReader) Close() error {
+	return pathError("close", r.path, mapError(windows.CloseHandle(r.handler)))
+}
+
+// Clone returns an FSLock over a duplicate of f's handle. The clone shares
+// f's OS lock but has its own mutex and read cursor, and closing it leaves f
+// open and locked.
+func (f *FSLock) Clone() (clone *FSLock, err error) {
+	defer f.wrap("duplicate", &err)
+	f.rlock()
+	defer f.runlock()
+
+	handler, err := f.duplicate(0, windows.DUPLICATE_SAME_ACCESS)
+	if err != nil {
+		return nil, err
+	}
+	file := os.NewFile(uintptr(handler), f.file.Name())
+	clone = &FSLock{file: *file, mu: sync.RWMutex{}, handler: handler, opts: f.opts, kind: f.kind, cloned: true, remote: f.remote}
+	clone.cursor.blockSize = f.cursor.blockSize
+	return clone, nil
+}
+
+func (f *FSLock) duplicate(access uint32, options uint32) (windows.Handle, error) {
+	process := windows.CurrentProcess()
+	var handler windows.Handle
+	err := windows.DuplicateHandle(process, f.handler, process, &handler, access, false, options)
+	if err != nil {
+		return 0, mapError(err)
+	}
+	return handler, nil
+}
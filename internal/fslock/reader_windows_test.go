@@ -0,0 +1,146 @@
+package fslock
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReaderReadsWhileOwnerWrites(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := f.NewReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const lines = 200
+	line := func(i int) []byte { return []byte(fmt.Sprintf("line %03d\n", i)) }
+	var want []byte
+	for i := 0; i < lines; i++ {
+		want = append(want, line(i)...)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < lines; i++ {
+			if err := f.Write(line(i)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	// Every read sees some prefix of what is being written, never anything
+	// else, and the whole of it once the writes are done.
+	for finished := false; ; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		data, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(want, data) {
+			t.Fatalf("reader saw %q", data)
+		}
+		if len(data) == len(want) {
+			break
+		}
+		if finished {
+			t.Fatalf("reader saw %d of %d bytes once the writes were done", len(data), len(want))
+		}
+	}
+	<-done
+
+	if got, err := r.ReadAtToEndOfLine(int64(len(line(0))), 0); err != nil || string(got) != "line 001" {
+		t.Fatalf("ReadAtToEndOfLine = %q, %v", got, err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// The owner keeps its handle and lock.
+	if err := f.Write(line(lines)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClonesReadConcurrently(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	f, err := NewFSLockWithOptions(path, Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	const lines = 400
+	for i := 0; i < lines; i++ {
+		if _, err := f.AppendLine([]byte(fmt.Sprintf("line %03d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	half := int64(len("line 000\n") * lines / 2)
+
+	var clones []*FSLock
+	for i := 0; i < 2; i++ {
+		c, err := f.Clone()
+		if err != nil {
+			t.Fatal(err)
+		}
+		clones = append(clones, c)
+	}
+	// The first clone reads the first half through its cursor and the
+	// second the second half from an offset, both at once.
+	got := make([][]string, 2)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < lines/2; i++ {
+			line, err := clones[0].NextLine()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			got[0] = append(got[0], string(line))
+		}
+	}()
+	if err := clones[1].LinesFrom(half, func(offset int64, line []byte) bool {
+		got[1] = append(got[1], string(line))
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	for i, read := range got {
+		var want []string
+		for j := i * lines / 2; j < (i+1)*lines/2; j++ {
+			want = append(want, fmt.Sprintf("line %03d", j))
+		}
+		if fmt.Sprint(read) != fmt.Sprint(want) {
+			t.Fatalf("clone %d read %q", i, read)
+		}
+	}
+
+	for _, c := range clones {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The cursor of f is its own, and its handle and lock outlive the
+	// clones.
+	if line, err := f.NextLine(); err != nil || string(line) != "line 000" {
+		t.Fatalf("NextLine of f = %q, %v", line, err)
+	}
+	if !lockedElsewhere(t, path, true) {
+		t.Fatal("closing the clones released the lock of f")
+	}
+	if _, err := f.AppendLine([]byte("after")); err != nil {
+		t.Fatal(err)
+	}
+}
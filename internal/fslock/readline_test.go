@@ -0,0 +1,150 @@
+package fslock
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadLineFromMatchesExplicitLength(t *testing.T) {
+	lengths := []int{0, 1, 7, DefaultReadLength - 1, DefaultReadLength, DefaultReadLength + 1, 3 * DefaultReadLength}
+	for _, readLength := range []int{0, 5} {
+		f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE, ReadLength: readLength})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var offsets []int64
+		end := int64(0)
+		for i, n := range lengths {
+			line := bytes.Repeat([]byte{byte('a' + i)}, n)
+			if i < len(lengths)-1 {
+				line = append(line, '\n')
+			}
+			if err := f.Write(line); err != nil {
+				t.Fatal(err)
+			}
+			offsets = append(offsets, end)
+			end += int64(len(line))
+		}
+
+		for i, offset := range offsets {
+			line, next, err := f.ReadLineFrom(offset)
+			if err != nil {
+				t.Fatalf("ReadLength %d: ReadLineFrom(%d) = %v", readLength, offset, err)
+			}
+			if len(line) != lengths[i] || (i < len(offsets)-1 && next != offsets[i+1]) {
+				t.Fatalf("ReadLength %d: ReadLineFrom(%d) = %d bytes, next %d", readLength, offset, len(line), next)
+			}
+			for _, length := range []int{1, 3, DefaultReadLength} {
+				explicit, err := f.ReadAtToEndOfLine(offset, length)
+				if err != nil || !bytes.Equal(explicit, line) {
+					t.Fatalf("ReadAtToEndOfLine(%d, %d) = %d bytes, %v, ReadLineFrom %d bytes", offset, length, len(explicit), err, len(line))
+				}
+			}
+		}
+		f.Close()
+	}
+}
+
+func TestReadAtToEndOfLineBounds(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Write([]byte("one\ntwo")); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		offset int64
+		want   error
+	}{
+		{-1, ErrInvalidOffset},
+		{7, EOF},
+		{100, EOF},
+	} {
+		if line, err := f.ReadAtToEndOfLine(tc.offset, 4); !errors.Is(err, tc.want) {
+			t.Fatalf("ReadAtToEndOfLine(%d) = %q, %v, want %v", tc.offset, line, err, tc.want)
+		}
+		if line, _, err := f.ReadLineFrom(tc.offset); !errors.Is(err, tc.want) {
+			t.Fatalf("ReadLineFrom(%d) = %q, %v, want %v", tc.offset, line, err, tc.want)
+		}
+	}
+	// The last byte still starts a line, unterminated as it is.
+	if line, err := f.ReadAtToEndOfLine(6, 4); err != nil || string(line) != "o" {
+		t.Fatalf("ReadAtToEndOfLine(6) = %q, %v", line, err)
+	}
+}
+
+func TestReadAtToEndOfLineMatchesReference(t *testing.T) {
+	var data []byte
+	for i := 0; i < 60; i++ {
+		n := (i * i * 37) % 9000
+		data = append(data, bytes.Repeat([]byte{byte('a' + i%26)}, n)...)
+		switch i % 3 {
+		case 0:
+			data = append(data, '\n')
+		case 1:
+			data = append(data, "\r\n"...)
+		default:
+			data = append(data, "\n\n"...)
+		}
+	}
+	data = append(data, "unterminated tail"...)
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	// reference splits the whole file in memory.
+	reference := func(offset int64) []byte {
+		rest := data[offset:]
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			return rest[:i]
+		}
+		return rest
+	}
+	for _, length := range []int{1, 2, 7, 512, 4096, 100000} {
+		for offset := int64(0); offset < int64(len(data)); {
+			line, err := f.ReadAtToEndOfLine(offset, length)
+			if err != nil {
+				t.Fatalf("ReadAtToEndOfLine(%d, %d) = %v", offset, length, err)
+			}
+			if want := reference(offset); !bytes.Equal(line, want) {
+				t.Fatalf("ReadAtToEndOfLine(%d, %d) = %d bytes, want %d", offset, length, len(line), len(want))
+			}
+			offset += int64(len(line)) + 1
+		}
+	}
+}
+
+func BenchmarkReadAtToEndOfLineLong(b *testing.B) {
+	for _, size := range []int{4 << 10, 64 << 10, 1 << 20} {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			f, err := NewFSLockWithOptions(filepath.Join(b.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer f.Close()
+			line := append(bytes.Repeat([]byte("x"), size), '\n')
+			if err := f.Write(line); err != nil {
+				b.Fatal(err)
+			}
+			// Linear reading keeps the time per byte flat as lines grow.
+			b.SetBytes(int64(size))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := f.ReadAtToEndOfLine(0, DefaultReadLength); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package fslock
+
+import "fmt"
+
+// RecordStore is a typed append log of T values, each stored as one framed
+// record.
+type RecordStore[T any] struct {
+	f     *FSLock
+	codec Codec
+}
+
+// NewRecordStore wraps f in a RecordStore using codec, or JSONCodec when
+// codec is nil.
+func NewRecordStore[T any](f *FSLock, codec Codec) *RecordStore[T] {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	return &RecordStore[T]{f: f, codec: codec}
+}
+
+// Append encodes v and writes it as a single record, returning the offset it
+// starts at. Nothing is written when encoding fails.
+func (s *RecordStore[T]) Append(v T) (int64, error) {
+	payload, err := s.codec.Marshal(v)
+	if err != nil {
+		return 0, pathError("encode", s.f.file.Name(), err)
+	}
+	return s.f.WriteRecord(payload)
+}
+
+// ReadAt decodes the record starting at offset.
+func (s *RecordStore[T]) ReadAt(offset int64) (T, error) {
+	var v T
+	payload, _, err := s.f.ReadRecordAt(offset)
+	if err != nil {
+		return v, err
+	}
+	if err := s.codec.Unmarshal(payload, &v); err != nil {
+		return v, pathError("decode", s.f.file.Name(), fmt.Errorf("record at offset %d: %w", offset, err))
+	}
+	return v, nil
+}
@@ -0,0 +1,70 @@
+package fslock
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type event struct {
+	Name  string
+	Count int
+	Value float64
+}
+
+func TestRecordStore(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s := NewRecordStore[event](f, nil)
+
+	events := []event{{"start", 1, 0.5}, {"tick", 2, 1.5}, {"stop", 3, 2.5}}
+	var offsets []int64
+	for i, e := range events {
+		offset, err := s.Append(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, offset)
+		// A value JSON can not encode is refused before anything is
+		// written, so the log stays intact around it.
+		if i == 1 {
+			_, size, _ := f.Size()
+			var pe *PathError
+			if _, err := s.Append(event{"bad", 0, math.NaN()}); !errors.As(err, &pe) || pe.Op != "encode" {
+				t.Fatalf("Append of an unencodable value = %v", err)
+			}
+			if _, after, _ := f.Size(); after != size {
+				t.Fatalf("failed Append grew the file from %d to %d bytes", size, after)
+			}
+		}
+	}
+	for i, offset := range offsets {
+		if got, err := s.ReadAt(offset); err != nil || got != events[i] {
+			t.Fatalf("ReadAt(%d) = %+v, %v, want %+v", offset, got, err, events[i])
+		}
+	}
+	if bad, err := f.ScanIntegrity(); err != nil || bad != -1 {
+		t.Fatalf("ScanIntegrity = %d, %v", bad, err)
+	}
+}
+
+func TestRecordStoreDecodeError(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	offset, err := f.WriteRecord([]byte("not json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pe *PathError
+	if _, err := NewRecordStore[event](f, nil).ReadAt(offset); !errors.As(err, &pe) || pe.Op != "decode" {
+		t.Fatalf("ReadAt of a record that is not JSON = %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package fslock
+
+import "sync"
+
+// registry records the files this process holds locks on, keyed by
+// lockKey, so a second lock on the same file fails fast instead of
+// contending with the process itself.
+var registry = struct {
+	sync.Mutex
+	held map[string]bool
+}{held: make(map[string]bool)}
+
+func register(key string) error {
+	registry.Lock()
+	defer registry.Unlock()
+	if registry.held[key] {
+		return ErrAlreadyLockedInProcess
+	}
+	registry.held[key] = true
+	return nil
+}
+
+func unregister(key string) {
+	registry.Lock()
+	defer registry.Unlock()
+	delete(registry.held, key)
+}
@@ -0,0 +1,38 @@
+package fslock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLockTwiceInProcess(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "lock")
+	f, err := NewFSLock(path, defaultFileMode|os.O_CREATE)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// However the path is spelled, it is the same file.
+	for _, name := range []string{path, filepath.Join(dir, ".", "lock"), filepath.Join(dir, "sub", "..", "lock")} {
+		if g, err := NewFSLock(name, defaultFileMode); !errors.Is(err, ErrAlreadyLockedInProcess) {
+			if err == nil {
+				g.Close()
+			}
+			t.Fatalf("second NewFSLock(%s) = %v, want ErrAlreadyLockedInProcess", name, err)
+		}
+		if _, err := TryLock(name, defaultFileMode); !errors.Is(err, ErrAlreadyLockedInProcess) {
+			t.Fatalf("TryLock(%s) = %v, want ErrAlreadyLockedInProcess", name, err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err = NewFSLock(path, defaultFileMode)
+	if err != nil {
+		t.Fatalf("NewFSLock after Close = %v", err)
+	}
+	f.Close()
+}
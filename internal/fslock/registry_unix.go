@@ -0,0 +1,10 @@
+//go:build unix
+
+package fslock
+
+import "path/filepath"
+
+// lockKey resolves name to the absolute path the registry tracks it under.
+func lockKey(name string) (string, error) {
+	return filepath.Abs(name)
+}
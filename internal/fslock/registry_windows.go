@@ -0,0 +1,16 @@
+package fslock
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// lockKey resolves name to the absolute path the registry tracks it under.
+// Windows paths compare case-insensitively, so the key is lowercased.
+func lockKey(name string) (string, error) {
+	path, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(path), nil
+}
@@ -0,0 +1,43 @@
+package fslock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTruncateToLastLine(t *testing.T) {
+	for _, tc := range []struct {
+		name, data, want string
+	}{
+		{"clean", "one\ntwo\n", "one\ntwo\n"},
+		{"partial tail", "one\ntwo\nthr", "one\ntwo\n"},
+		{"no newline", "no newline at all", ""},
+		{"empty", "", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "log")
+			if err := os.WriteFile(path, []byte(tc.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := NewFSLock(path, defaultFileMode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			removed, err := f.TruncateToLastLine()
+			if err != nil || removed != int64(len(tc.data)-len(tc.want)) {
+				t.Fatalf("TruncateToLastLine = %d, %v, want %d", removed, err, len(tc.data)-len(tc.want))
+			}
+			// Appends continue right after the last complete line.
+			if _, err := f.AppendLine([]byte("next")); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if data, err := os.ReadFile(path); err != nil || string(data) != tc.want+"next\n" {
+				t.Fatalf("file holds %q, %v, want %q", data, err, tc.want+"next\n")
+			}
+		})
+	}
+}
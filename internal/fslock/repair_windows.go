@@ -0,0 +1,65 @@
+package fslock
+
+import "errors"
+
+// TruncateToLastLine discards a trailing partial line, as left behind by a
+// crash in the middle of an append, by truncating the file just past its last
+// newline, or to zero when there is none. It returns the number of bytes
+// removed, and lets writes proceed again after an ErrShortWrite.
+func (f *FSLock) TruncateToLastLine() (removed int64, err error) {
+	defer f.wrap("truncate", &err)
+	f.lock()
+	defer f.unlock()
+
+	if err := f.drain(); err != nil && !errors.Is(err, ErrShortWrite) {
+		return 0, err
+	}
+	size, err := fileSize(f.handler)
+	if err != nil {
+		return 0, err
+	}
+	last, err := f.readHandle().lastIndexByte(size, '\n')
+	if err != nil {
+		return 0, err
+	}
+	end := last + 1
+	if end < size {
+		if err := f.truncate(end); err != nil {
+			return 0, err
+		}
+	}
+	f.repaired()
+	return size - end, nil
+}
+
+// repaired lifts the write stop a short write put in place, once the torn
+// data it left has been cut off.
+func (f *FSLock) repaired() {
+	if errors.Is(f.flushErr, ErrShortWrite) {
+		f.flushErr = nil
+	}
+}
+
+// Truncate cuts the file to size bytes, which must not exceed its current
+// size.
+func (f *FSLock) Truncate(size int64) (err error) {
+	defer f.wrap("truncate", &err)
+	f.lock()
+	defer f.unlock()
+
+	if err := f.drain(); err != nil {
+		return err
+	}
+	current, err := fileSize(f.handler)
+	if err != nil {
+		return err
+	}
+	if size < 0 || size > current {
+		return ErrInvalidOffset
+	}
+	if size == current {
+		return nil
+	}
+	f.cursor.reset()
+	return f.truncate(size)
+}
@@ -0,0 +1,69 @@
+package fslock
+
+import "bytes"
+
+// ring keeps copies of the last len(items) records pushed into it, along
+// with the start of a line appended without its newline yet.
+type ring struct {
+	items   [][]byte
+	next    int
+	full    bool
+	partial []byte
+}
+
+func newRing(size int) *ring {
+	return &ring{items: make([][]byte, size)}
+}
+
+func (r *ring) push(record []byte) {
+	r.items[r.next] = copyRecord(record)
+	r.next++
+	if r.next == len(r.items) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// feed pushes the lines data completes, however the appends that wrote them
+// split them up, and keeps what follows the last newline for the next call.
+func (r *ring) feed(data []byte) {
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			r.partial = append(r.partial, data...)
+			return
+		}
+		if len(r.partial) > 0 {
+			r.push(append(r.partial, data[:i]...))
+			r.partial = r.partial[:0]
+		} else {
+			r.push(data[:i])
+		}
+		data = data[i+1:]
+	}
+}
+
+// snapshot returns copies of the records from oldest to newest, which the
+// caller may change without affecting the ring.
+func (r *ring) snapshot() [][]byte {
+	n := r.next
+	if r.full {
+		n = len(r.items)
+	}
+	out := make([][]byte, 0, n)
+	if r.full {
+		for _, item := range r.items[r.next:] {
+			out = append(out, copyRecord(item))
+		}
+	}
+	for _, item := range r.items[:r.next] {
+		out = append(out, copyRecord(item))
+	}
+	return out
+}
+
+func copyRecord(record []byte) []byte {
+	item := make([]byte, len(record))
+	copy(item, record)
+	return item
+}
@@ -0,0 +1,47 @@
+package fslock
+
+import (
+	"fmt"
+	"testing"
+)
+
+func ringLines(r *ring) []string {
+	var out []string
+	for _, item := range r.snapshot() {
+		out = append(out, string(item))
+	}
+	return out
+}
+
+func TestRingKeepsLastLinesInOrder(t *testing.T) {
+	r := newRing(3)
+	for i := 0; i < 5; i++ {
+		r.feed([]byte(fmt.Sprintf("line%d\n", i)))
+	}
+	if got := fmt.Sprint(ringLines(r)); got != "[line2 line3 line4]" {
+		t.Fatalf("snapshot = %s", got)
+	}
+}
+
+func TestRingFeedJoinsSplitLines(t *testing.T) {
+	r := newRing(4)
+	r.feed([]byte("a\nb"))
+	r.feed([]byte("c"))
+	r.feed([]byte("d\n\ne\nf"))
+	if got := fmt.Sprint(ringLines(r)); got != "[a bcd  e]" {
+		t.Fatalf("snapshot = %q", ringLines(r))
+	}
+	r.feed([]byte("\n"))
+	if got := fmt.Sprint(ringLines(r)); got != "[bcd  e f]" {
+		t.Fatalf("snapshot = %q", ringLines(r))
+	}
+}
+
+func TestRingSnapshotReturnsCopies(t *testing.T) {
+	r := newRing(2)
+	r.feed([]byte("abc\n"))
+	r.snapshot()[0][0] = 'x'
+	if got := string(r.snapshot()[0]); got != "abc" {
+		t.Fatalf("snapshot after changing a copy = %q", got)
+	}
+}
@@ -0,0 +1,118 @@
+package fslock
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+
+	"golang.org/x/sys/windows"
+)
+
+type fileIdentity struct {
+	volume uint32
+	high   uint32
+	low    uint32
+}
+
+// FileID returns an identity of the open file that stays the same for the
+// life of the file, whatever path it is reached through, and differs from
+// that of a file later created under the same name. It folds the volume
+// serial number and the file index into 64 bits.
+func (f *FSLock) FileID() (id uint64, err error) {
+	defer f.wrap("stat", &err)
+	f.rlock()
+	defer f.runlock()
+	identity, err := handleIdentity(f.handler)
+	if err != nil {
+		return 0, err
+	}
+	return identity.id(), nil
+}
+
+func (i fileIdentity) id() uint64 {
+	var b [12]byte
+	binary.LittleEndian.PutUint32(b[0:], i.volume)
+	binary.LittleEndian.PutUint32(b[4:], i.high)
+	binary.LittleEndian.PutUint32(b[8:], i.low)
+	h := fnv.New64a()
+	h.Write(b[:])
+	return h.Sum64()
+}
+
+// ReopenIfRotated checks whether the path f was opened with now names a
+// different file, as happens when a log rotator renames the file and creates
+// a new one. If so, pending writes are synced to the old file, which is then
+// closed, and the new file is opened and locked with the same options, the
+// tail buffer holding the lines of the new file. It reports whether f
+// switched files.
+func (f *FSLock) ReopenIfRotated() (rotated bool, err error) {
+	defer f.wrap("reopen", &err)
+	f.lock()
+	defer f.unlock()
+
+	current, err := handleIdentity(f.handler)
+	if err != nil {
+		return false, err
+	}
+	onDisk, err := pathIdentity(f.file.Name())
+	if err == windows.ERROR_FILE_NOT_FOUND {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if current == onDisk {
+		return false, nil
+	}
+
+	// The registry already holds this path for f, so open the new file
+	// directly rather than through NewFSLockWithOptions.
+	next, err := newFSLock(context.Background(), f.file.Name(), f.opts, windows.LOCKFILE_EXCLUSIVE_LOCK)
+	if err != nil {
+		return false, err
+	}
+	if f.dirty {
+		if err := f.flush(); err != nil {
+			next.Close()
+			return false, err
+		}
+	}
+	f.view.close()
+	// The os.File owns the old handle, so it is closed through it, which
+	// also clears the finalizer that would otherwise close the handle again
+	// once the OS handed its value to another file.
+	f.file.Close()
+
+	f.file = next.file
+	f.handler = next.handler
+	f.kind = LockExclusive
+	f.dirty = false
+	f.writes = 0
+	f.summary.valid = false
+	f.cursor.reset()
+	// next loaded the tail of the new file when TailBuffer is set.
+	f.tail = next.tail
+	f.extent = next.extent
+	return true, nil
+}
+
+func handleIdentity(handler windows.Handle) (fileIdentity, error) {
+	info := windows.ByHandleFileInformation{}
+	if err := windows.GetFileInformationByHandle(handler, &info); err != nil {
+		return fileIdentity{}, err
+	}
+	return fileIdentity{volume: info.VolumeSerialNumber, high: info.FileIndexHigh, low: info.FileIndexLow}, nil
+}
+
+func pathIdentity(path string) (fileIdentity, error) {
+	name, err := utf16Path(path)
+	if err != nil {
+		return fileIdentity{}, err
+	}
+	h, err := windows.CreateFile(name, 0, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE, nil, windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return fileIdentity{}, err
+	}
+	defer windows.CloseHandle(h)
+	return handleIdentity(h)
+}
@@ -0,0 +1,52 @@
+package fslock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReopenIfRotated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	// DeleteOnClose shares the handle for deletes, which a rename needs on
+	// Windows.
+	f, err := NewFSLockWithOptions(path, Options{Mode: defaultFileMode | os.O_CREATE, TailBuffer: 2, DeleteOnClose: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.AppendLine([]byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	if rotated, err := f.ReopenIfRotated(); err != nil || rotated {
+		t.Fatalf("ReopenIfRotated before rotation = %v, %v", rotated, err)
+	}
+
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("new\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := f.ReopenIfRotated()
+	if err != nil || !rotated {
+		t.Fatalf("ReopenIfRotated = %v, %v", rotated, err)
+	}
+	if tail := f.Tail(); len(tail) != 1 || string(tail[0]) != "new" {
+		t.Fatalf("Tail after rotation = %q", tail)
+	}
+	if _, err := f.AppendLine([]byte("next")); err != nil {
+		t.Fatal(err)
+	}
+	// The handle deletes the file on close, so it is read back through f.
+	var lines []string
+	if err := f.Lines(func(offset int64, line []byte) bool {
+		lines = append(lines, string(line))
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || lines[0] != "new" || lines[1] != "next" {
+		t.Fatalf("rotated file holds %q", lines)
+	}
+}
@@ -0,0 +1,86 @@
+package fslock
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		records []string
+	}{
+		{"empty", nil},
+		{"single", []string{"only"}},
+		{"many", []string{"one", "two", "", "four", "a somewhat longer fifth record"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "log")
+			f, err := NewFSLock(path, defaultFileMode|os.O_CREATE)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var offsets []int64
+			end := int64(0)
+			for i, record := range tc.records {
+				offsets = append(offsets, end)
+				// Alternate the raw and the terminating append.
+				if i%2 == 0 {
+					err = f.Write([]byte(record + "\n"))
+				} else {
+					_, err = f.AppendLine([]byte(record))
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				end += int64(len(record)) + 1
+			}
+			if err := f.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err = NewFSLock(path, defaultFileMode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			var got []string
+			if err := f.Lines(func(offset int64, line []byte) bool {
+				got = append(got, fmt.Sprintf("%d:%s", offset, line))
+				return true
+			}); err != nil {
+				t.Fatal(err)
+			}
+			var want []string
+			for i, record := range tc.records {
+				want = append(want, fmt.Sprintf("%d:%s", offsets[i], record))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("Lines = %q, want %q", got, want)
+			}
+
+			// Resuming from every record offset sees the rest of the log,
+			// and from the end of file sees nothing.
+			for i := range tc.records {
+				n := 0
+				if err := f.LinesFrom(offsets[i], func(offset int64, line []byte) bool {
+					n++
+					return true
+				}); err != nil || n != len(tc.records)-i {
+					t.Fatalf("LinesFrom(%d) saw %d lines, %v, want %d", offsets[i], n, err, len(tc.records)-i)
+				}
+			}
+			if err := f.LinesFrom(end, func(int64, []byte) bool {
+				t.Fatal("LinesFrom the end of file returned a line")
+				return false
+			}); err != nil {
+				t.Fatalf("LinesFrom(%d) = %v", end, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package fslock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShortWriteStopsWrites(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	restore := shortWrites(t, 4)
+	if err := f.Write([]byte("second\n")); !errors.Is(err, ErrShortWrite) {
+		t.Fatalf("short Write = %v, want ErrShortWrite", err)
+	}
+	restore()
+	// The file now ends inside a record, so nothing more goes in after it.
+	if err := f.Write([]byte("third\n")); !errors.Is(err, ErrShortWrite) {
+		t.Fatalf("Write after a short write = %v, want ErrShortWrite", err)
+	}
+	if _, err := f.AppendLine([]byte("third")); !errors.Is(err, ErrShortWrite) {
+		t.Fatalf("AppendLine after a short write = %v, want ErrShortWrite", err)
+	}
+	if data, err := f.Read(); err != nil || string(data) != "first\nseco" {
+		t.Fatalf("file holds %q, %v", data, err)
+	}
+
+	if removed, err := f.TruncateToLastLine(); err != nil || removed != 4 {
+		t.Fatalf("TruncateToLastLine = %d, %v, want 4", removed, err)
+	}
+	if err := f.Write([]byte("third\n")); err != nil {
+		t.Fatalf("Write after TruncateToLastLine = %v", err)
+	}
+	if data, err := f.Read(); err != nil || string(data) != "first\nthird\n" {
+		t.Fatalf("file holds %q, %v", data, err)
+	}
+}
@@ -0,0 +1,128 @@
+package fslock
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Size returns the logical size of the file, where the data written to it
+// ends, and its physical size. The two differ when the tail of the file is
+// a hole, for example one left by SetEndOfFile, see extent.
+func (f *FSLock) Size() (logical int64, physical int64, err error) {
+	defer f.wrap("stat", &err)
+	if err := f.drainForRead(); err != nil {
+		return 0, 0, err
+	}
+	f.rlock()
+	defer f.runlock()
+	return f.logicalSize()
+}
+
+// Preallocate reserves disk space for at least size bytes without moving the
+// end of file, so appends keep landing right after the written data.
+func (f *FSLock) Preallocate(size int64) (err error) {
+	defer f.wrap("preallocate", &err)
+	f.lock()
+	defer f.unlock()
+	info := struct{ AllocationSize int64 }{AllocationSize: size}
+	return windows.SetFileInformationByHandle(f.handler, windows.FileAllocationInfo, (*byte)(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)))
+}
+
+// Lines calls fn for every line up to the logical end of the file, stopping
+// early when fn returns false. A hole at the tail of the file is not read
+// as lines.
+func (f *FSLock) Lines(fn func(offset int64, line []byte) bool) error {
+	return f.LinesFrom(0, fn)
+}
+
+// LinesFrom is like Lines but starts at offset, which must be the start of a
+// line, so a caller that already processed the file up to offset only reads
+// what was appended since.
+func (f *FSLock) LinesFrom(offset int64, fn func(offset int64, line []byte) bool) (err error) {
+	defer f.wrap("read", &err)
+	if offset < 0 {
+		return ErrInvalidOffset
+	}
+	if err := f.drainForRead(); err != nil {
+		return err
+	}
+	f.rlock()
+	defer f.runlock()
+
+	end, _, err := f.logicalSize()
+	if err != nil {
+		return err
+	}
+
+	for offset < end {
+		line, err := f.readHandle().readAtToEndOfLine(offset, f.readLength())
+		if err == EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if offset+int64(len(line)) > end {
+			line = line[:end-offset]
+		}
+		f.lineRead(offset, line)
+		if !fn(offset, line) {
+			return nil
+		}
+		offset += int64(len(line)) + 1
+	}
+	return nil
+}
+
+// FindFirst returns the first line, from the start of the file, for which
+// match returns true, along with its offset. ErrNotFound is returned when no
+// line matches.
+func (f *FSLock) FindFirst(match func(line []byte) bool) (line []byte, offset int64, err error) {
+	found := false
+	err = f.Lines(func(o int64, l []byte) bool {
+		if match(l) {
+			line, offset, found = l, o, true
+		}
+		return !found
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if !found {
+		return nil, 0, pathError("read", f.file.Name(), ErrNotFound)
+	}
+	return line, offset, nil
+}
+
+// dataEnd returns where the last range of the file the file system
+// allocated ends, as FSCTL_QUERY_ALLOCATED_RANGES reports them, or physical
+// where it reports none. Files that are not sparse are allocated in full.
+func (h readHandle) dataEnd(physical int64) (int64, error) {
+	type allocatedRange struct{ offset, length int64 }
+	in := allocatedRange{offset: 0, length: physical}
+	out := make([]allocatedRange, 64)
+	size := uint32(unsafe.Sizeof(out[0]))
+	end := int64(0)
+	for in.length > 0 {
+		var returned uint32
+		err := windows.DeviceIoControl(h.handler, windows.FSCTL_QUERY_ALLOCATED_RANGES, (*byte)(unsafe.Pointer(&in)), uint32(unsafe.Sizeof(in)), (*byte)(unsafe.Pointer(&out[0])), size*uint32(len(out)), &returned, nil)
+		if err != nil && err != windows.ERROR_MORE_DATA {
+			// A file system that does not track allocated ranges.
+			return physical, nil
+		}
+		n := int(returned / size)
+		if n == 0 {
+			break
+		}
+		end = out[n-1].offset + out[n-1].length
+		if err == nil {
+			break
+		}
+		in = allocatedRange{offset: end, length: physical - end}
+	}
+	if end > physical {
+		end = physical
+	}
+	return end, nil
+}
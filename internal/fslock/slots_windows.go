@@ -0,0 +1,87 @@
+package fslock
+
+// AppendSlot appends p zero-padded to the FixedRecordSize option and returns
+// the index of the slot it landed in. A p longer than a slot returns
+// ErrRecordTooLarge.
+func (f *FSLock) AppendSlot(p []byte) (index int64, err error) {
+	defer f.wrap("write", &err)
+	size, err := f.slotSize(p)
+	if err != nil {
+		return 0, err
+	}
+	block := make([]byte, size)
+	copy(block, p)
+
+	f.lock()
+	defer f.unlock()
+	end, err := f.end()
+	if err != nil {
+		return 0, err
+	}
+	if end%size != 0 {
+		return 0, ErrCorrupt
+	}
+	if _, err := f.write(block); err != nil {
+		return 0, err
+	}
+	return end / size, nil
+}
+
+// ReadIndex returns slot i, padding included. An index past the last slot
+// returns EOF.
+func (f *FSLock) ReadIndex(i int64) (block []byte, err error) {
+	defer f.wrap("read", &err)
+	size, err := f.slotSize(nil)
+	if err != nil {
+		return nil, err
+	}
+	if i < 0 {
+		return nil, ErrInvalidOffset
+	}
+	if err := f.drainForRead(); err != nil {
+		return nil, err
+	}
+	f.rlock()
+	defer f.runlock()
+	f.stats.reads.Add(1)
+
+	block = make([]byte, size)
+	n, err := f.readHandle().readAt(block, i*size)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, EOF
+	}
+	if int64(n) < size {
+		return nil, ErrCorrupt
+	}
+	return block, nil
+}
+
+// WriteIndex overwrites slot i in place with p zero-padded to the slot size.
+// Like WriteAt it needs the RandomAccess option.
+func (f *FSLock) WriteIndex(i int64, p []byte) error {
+	size, err := f.slotSize(p)
+	if err != nil {
+		return pathError("write", f.file.Name(), err)
+	}
+	if i < 0 {
+		return pathError("write", f.file.Name(), ErrInvalidOffset)
+	}
+	block := make([]byte, size)
+	copy(block, p)
+	_, err = f.WriteAt(block, i*size)
+	return err
+}
+
+func (f *FSLock) slotSize(p []byte) (int64, error) {
+	size := int64(f.opts.FixedRecordSize)
+	if size <= 0 {
+		return 0, ErrInvalidOptions
+	}
+	if int64(len(p)) > size {
+		return 0, ErrRecordTooLarge
+	}
+	return size, nil
+}
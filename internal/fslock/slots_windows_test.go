@@ -0,0 +1,49 @@
+package fslock
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSlots(t *testing.T) {
+	const size = 16
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "slots"), Options{Mode: defaultFileMode | os.O_CREATE, FixedRecordSize: size, RandomAccess: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	slot := func(s string) []byte {
+		block := make([]byte, size)
+		copy(block, s)
+		return block
+	}
+
+	for i := 0; i < 4; i++ {
+		index, err := f.AppendSlot([]byte(fmt.Sprint("record ", i)))
+		if err != nil || index != int64(i) {
+			t.Fatalf("AppendSlot %d = %d, %v", i, index, err)
+		}
+	}
+	if _, err := f.AppendSlot(bytes.Repeat([]byte("x"), size+1)); !errors.Is(err, ErrRecordTooLarge) {
+		t.Fatalf("AppendSlot of an oversized record = %v, want ErrRecordTooLarge", err)
+	}
+	if err := f.WriteIndex(2, []byte("patched")); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []string{"record 0", "record 1", "patched", "record 3"} {
+		if block, err := f.ReadIndex(int64(i)); err != nil || !bytes.Equal(block, slot(want)) {
+			t.Fatalf("ReadIndex(%d) = %q, %v, want %q", i, block, err, slot(want))
+		}
+	}
+	if _, err := f.ReadIndex(4); !errors.Is(err, EOF) {
+		t.Fatalf("ReadIndex past the last slot = %v, want EOF", err)
+	}
+	if _, physical, err := f.Size(); err != nil || physical != 4*size {
+		t.Fatalf("file is %d bytes, %v, want %d", physical, err, 4*size)
+	}
+}
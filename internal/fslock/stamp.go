@@ -0,0 +1,30 @@
+package fslock
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// stampLayout is the timestamp format WriteStamped prefixes lines with.
+const stampLayout = time.RFC3339Nano
+
+func stampLine(t time.Time, p []byte) []byte {
+	line := t.UTC().AppendFormat(nil, stampLayout)
+	line = append(line, ' ')
+	return append(line, p...)
+}
+
+// ParseStamped splits a line written by WriteStamped into its timestamp and
+// the original payload.
+func ParseStamped(line []byte) (time.Time, []byte, error) {
+	i := bytes.IndexByte(line, ' ')
+	if i < 0 {
+		return time.Time{}, nil, fmt.Errorf("%w: stamped line has no timestamp", ErrCorrupt)
+	}
+	t, err := time.Parse(stampLayout, string(line[:i]))
+	if err != nil {
+		return time.Time{}, nil, fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+	return t, line[i+1:], nil
+}
@@ -0,0 +1,18 @@
+package fslock
+
+import "time"
+
+// WriteStamped appends p as a line prefixed with the current time from the
+// Clock option, and returns that time.
+func (f *FSLock) WriteStamped(p []byte) (time.Time, error) {
+	now := f.now()
+	_, err := f.AppendLine(stampLine(now, p))
+	return now, err
+}
+
+func (f *FSLock) now() time.Time {
+	if f.opts.Clock != nil {
+		return f.opts.Clock()
+	}
+	return time.Now()
+}
@@ -0,0 +1,36 @@
+package fslock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteStampedUsesClock(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 6, time.FixedZone("UTC+2", 2*60*60))
+	opts := Options{
+		Mode:  defaultFileMode | os.O_CREATE,
+		Clock: func() time.Time { return at },
+	}
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if stamped, err := f.WriteStamped([]byte("payload")); err != nil || !stamped.Equal(at) {
+		t.Fatalf("WriteStamped = %v, %v, want %v", stamped, err, at)
+	}
+	data, err := f.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Stamps are stored in UTC.
+	if want := "2024-01-02T01:04:05.000000006Z payload\n"; string(data) != want {
+		t.Fatalf("file holds %q, want %q", data, want)
+	}
+	stamp, payload, err := ParseStamped(data[:len(data)-1])
+	if err != nil || !stamp.Equal(at) || string(payload) != "payload" {
+		t.Fatalf("ParseStamped = %v, %q, %v", stamp, payload, err)
+	}
+}
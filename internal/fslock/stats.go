@@ -0,0 +1,81 @@
+package fslock
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// FSLockStats is a snapshot of the activity of an FSLock within this
+// process.
+type FSLockStats struct {
+	// Waiters is the number of goroutines currently blocked on the
+	// in-process mutex.
+	Waiters      int
+	BytesWritten int64
+	Reads        int64
+	Flushes      int64
+}
+
+type counters struct {
+	waiters      atomic.Int64
+	bytesWritten atomic.Int64
+	reads        atomic.Int64
+	flushes      atomic.Int64
+}
+
+func (c *counters) snapshot() FSLockStats {
+	return FSLockStats{
+		Waiters:      int(c.waiters.Load()),
+		BytesWritten: c.bytesWritten.Load(),
+		Reads:        c.reads.Load(),
+		Flushes:      c.flushes.Load(),
+	}
+}
+
+// LockStats is a snapshot of the OS lock acquisitions made by every FSLock
+// in this process since it started. FailedTryLocks counts the TryLock
+// calls that found the file locked; the retries of a lock waited for count
+// toward TotalWait and MaxWait instead, whether the wait ended with the
+// lock or not.
+type LockStats struct {
+	Acquisitions   int64
+	FailedTryLocks int64
+	TotalWait      time.Duration
+	MaxWait        time.Duration
+}
+
+var lockCounters lockCounterSet
+
+type lockCounterSet struct {
+	acquisitions atomic.Int64
+	failedTries  atomic.Int64
+	totalWait    atomic.Int64
+	maxWait      atomic.Int64
+}
+
+func (c *lockCounterSet) acquired(wait time.Duration) {
+	c.acquisitions.Add(1)
+	c.waited(wait)
+}
+
+// waited adds wait, spent waiting for a lock whether or not it was taken,
+// to the wait times.
+func (c *lockCounterSet) waited(wait time.Duration) {
+	c.totalWait.Add(int64(wait))
+	for {
+		prev := c.maxWait.Load()
+		if int64(wait) <= prev || c.maxWait.CompareAndSwap(prev, int64(wait)) {
+			return
+		}
+	}
+}
+
+// ReadLockStats returns the lock counters of the process.
+func ReadLockStats() LockStats {
+	return LockStats{
+		Acquisitions:   lockCounters.acquisitions.Load(),
+		FailedTryLocks: lockCounters.failedTries.Load(),
+		TotalWait:      time.Duration(lockCounters.totalWait.Load()),
+		MaxWait:        time.Duration(lockCounters.maxWait.Load()),
+	}
+}
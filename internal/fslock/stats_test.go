@@ -0,0 +1,47 @@
+package fslock
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStatsCountWaiters(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Holding the mutex blocks writers and readers alike.
+	f.lock()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := f.Write([]byte("record\n")); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := f.Read(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	for deadline := time.Now().Add(5 * time.Second); f.Stats().Waiters != 6; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			f.unlock()
+			t.Fatalf("Waiters = %d, want 6", f.Stats().Waiters)
+		}
+	}
+	f.unlock()
+	wg.Wait()
+	if s := f.Stats(); s.Waiters != 0 || s.BytesWritten != 3*int64(len("record\n")) {
+		t.Fatalf("Stats once the lock is free = %+v", s)
+	}
+}
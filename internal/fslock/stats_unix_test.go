@@ -0,0 +1,93 @@
+//go:build unix
+
+package fslock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// holdLock locks path exclusively through a descriptor of its own, which
+// flock treats as another holder even within this process.
+func holdLock(t *testing.T, path string) (release func()) {
+	t.Helper()
+	fd, err := unix.Open(path, unix.O_RDWR|unix.O_CREAT, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.Flock(fd, unix.LOCK_EX); err != nil {
+		t.Fatal(err)
+	}
+	return func() { unix.Close(fd) }
+}
+
+// lockedElsewhere reports whether path is locked against a descriptor of its
+// own. shared tries a shared lock instead of an exclusive one.
+func lockedElsewhere(t *testing.T, path string, shared bool) bool {
+	t.Helper()
+	fd, err := unix.Open(path, unix.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(fd)
+	how := unix.LOCK_EX
+	if shared {
+		how = unix.LOCK_SH
+	}
+	switch err := unix.Flock(fd, how|unix.LOCK_NB); err {
+	case nil:
+		return false
+	case unix.EWOULDBLOCK:
+		return true
+	default:
+		t.Fatal(err)
+		return false
+	}
+}
+
+func TestLockStats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	before := ReadLockStats()
+
+	for i := 0; i < 3; i++ {
+		f, err := NewFSLock(path, defaultFileMode|os.O_CREATE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+
+	release := holdLock(t, path)
+	if _, err := TryLock(path, defaultFileMode); !errors.Is(err, ErrLocked) {
+		t.Fatalf("TryLock = %v, want ErrLocked", err)
+	}
+	if _, err := NewFSLockTimeout(path, defaultFileMode, 50*time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("NewFSLockTimeout = %v, want ErrTimeout", err)
+	}
+	time.AfterFunc(100*time.Millisecond, release)
+	f, err := NewFSLockTimeout(path, defaultFileMode, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	after := ReadLockStats()
+	if n := after.Acquisitions - before.Acquisitions; n != 4 {
+		t.Errorf("%d acquisitions, want 4", n)
+	}
+	// The polling of the two waits must not count as failed tries.
+	if n := after.FailedTryLocks - before.FailedTryLocks; n != 1 {
+		t.Errorf("%d failed tries, want 1", n)
+	}
+	if wait := after.TotalWait - before.TotalWait; wait < 150*time.Millisecond {
+		t.Errorf("waited %v in total, want at least 150ms", wait)
+	}
+	if after.MaxWait < 100*time.Millisecond {
+		t.Errorf("max wait %v, want at least 100ms", after.MaxWait)
+	}
+}
@@ -0,0 +1,50 @@
+package fslock
+
+import (
+	"bytes"
+)
+
+type summary struct {
+	valid bool
+	lines int64
+	bytes int64
+}
+
+// Summary counts the lines and bytes of the file in a single pass. A final
+// line without a newline still counts as a line. The result is cached until
+// the next write.
+func (f *FSLock) Summary() (lines int64, size int64, err error) {
+	defer f.wrap("read", &err)
+	f.lock()
+	defer f.unlock()
+
+	if !f.opts.ReadSkipsBuffer {
+		if err := f.drain(); err != nil {
+			return 0, 0, err
+		}
+	}
+	if f.summary.valid {
+		return f.summary.lines, f.summary.bytes, nil
+	}
+
+	block := make([]byte, DefaultReadBufferSize)
+	last := byte('\n')
+	for {
+		n, err := f.readHandle().readAt(block, size)
+		if err != nil {
+			return 0, 0, err
+		}
+		if n == 0 {
+			break
+		}
+		lines += int64(bytes.Count(block[:n], []byte{'\n'}))
+		last = block[n-1]
+		size += int64(n)
+	}
+	if last != '\n' {
+		lines++
+	}
+
+	f.summary = summary{valid: true, lines: lines, bytes: size}
+	return lines, size, nil
+}
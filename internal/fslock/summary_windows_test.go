@@ -0,0 +1,63 @@
+package fslock
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSummaryMatchesLinesAndSize(t *testing.T) {
+	files := map[string][]byte{
+		"empty":           {},
+		"lines":           []byte("one\ntwo\n"),
+		"partial":         []byte("one\ntwo"),
+		"blank lines":     []byte("\n\n\n"),
+		"several blocks":  bytes.Repeat([]byte("a line of the file\n"), 10000),
+		"partial at end":  append(bytes.Repeat([]byte("x\n"), 50000), 'y'),
+		"one long line":   bytes.Repeat([]byte("z"), 3*DefaultReadBufferSize),
+		"newline at edge": append(bytes.Repeat([]byte("w"), DefaultReadBufferSize-1), '\n'),
+	}
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewFSLock(path, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check := func(when string) {
+			t.Helper()
+			lines, size, err := f.Summary()
+			if err != nil {
+				t.Fatalf("%s %s: %v", name, when, err)
+			}
+			counted := int64(0)
+			if err := f.Lines(func(offset int64, line []byte) bool {
+				counted++
+				return true
+			}); err != nil {
+				t.Fatalf("%s %s: %v", name, when, err)
+			}
+			logical, _, err := f.Size()
+			if err != nil {
+				t.Fatalf("%s %s: %v", name, when, err)
+			}
+			if lines != counted || size != logical {
+				t.Fatalf("%s %s: Summary = %d lines, %d bytes, Lines and Size = %d, %d", name, when, lines, size, counted, logical)
+			}
+		}
+		check("")
+		// A write invalidates the cached result.
+		if err := f.Write([]byte(fmt.Sprintln("appended"))); err != nil {
+			t.Fatal(err)
+		}
+		check("after a write")
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package fslock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncEveryN(t *testing.T) {
+	var syncs []int
+	appends := 0
+	opts := Options{
+		Mode:       defaultFileMode | os.O_CREATE,
+		SyncEveryN: 5,
+		Observer:   Observer{OnSync: func() { syncs = append(syncs, appends) }},
+	}
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "log"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for appends = 1; appends <= 12; appends++ {
+		if _, err := f.AppendLine([]byte("record")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(syncs) != 2 || syncs[0] != 5 || syncs[1] != 10 {
+		t.Fatalf("synced after appends %v, want [5 10]", syncs)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(syncs) != 3 {
+		t.Fatalf("%d syncs after Close, want a final one", len(syncs))
+	}
+}
+
+func TestWriteSync(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	syncs := 0
+	opts := Options{
+		Mode:     defaultFileMode | os.O_CREATE,
+		Observer: Observer{OnSync: func() { syncs++ }},
+	}
+	f, err := NewFSLockWithOptions(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want string
+	for i, record := range []string{"first\n", "second\n"} {
+		offset, err := f.WriteSync([]byte(record))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset != int64(len(want)) || syncs != i+1 {
+			t.Fatalf("WriteSync(%q) at %d after %d syncs, want %d after %d", record, offset, syncs, len(want), i+1)
+		}
+		want += record
+	}
+	// Nothing is left for Close to sync, so what the reopened file holds was
+	// made durable by WriteSync itself.
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if syncs != 2 {
+		t.Fatalf("Close synced again after WriteSync")
+	}
+	f, err = NewFSLock(path, defaultFileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if data, err := f.Read(); err != nil || string(data) != want {
+		t.Fatalf("reopened file holds %q, %v, want %q", data, err, want)
+	}
+}
@@ -0,0 +1,59 @@
+package fslock
+
+import (
+	"errors"
+	"sync"
+)
+
+// SyncGroup coordinates a single durability point across several FSLocks.
+// Commit only syncs the members that were written since their last flush.
+type SyncGroup struct {
+	mu      sync.Mutex
+	members []*FSLock
+}
+
+func NewSyncGroup(locks ...*FSLock) *SyncGroup {
+	return &SyncGroup{members: locks}
+}
+
+func (g *SyncGroup) Add(f *FSLock) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.members = append(g.members, f)
+}
+
+func (g *SyncGroup) Remove(f *FSLock) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, m := range g.members {
+		if m == f {
+			g.members = append(g.members[:i], g.members[i+1:]...)
+			return
+		}
+	}
+}
+
+// Commit flushes every dirty member and returns the joined errors of the
+// members that failed.
+func (g *SyncGroup) Commit() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var errs []error
+	for _, m := range g.members {
+		if err := m.flushIfDirty(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f *FSLock) flushIfDirty() (err error) {
+	defer f.wrap("flush", &err)
+	f.lock()
+	defer f.unlock()
+	if !f.dirty && f.flushErr == nil {
+		return nil
+	}
+	return f.flush()
+}
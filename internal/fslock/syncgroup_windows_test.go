@@ -0,0 +1,70 @@
+package fslock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/windows"
+)
+
+func TestSyncGroupFlushesDirtyMembers(t *testing.T) {
+	dir := t.TempDir()
+	var files []*FSLock
+	for i := 0; i < 3; i++ {
+		f, err := NewFSLockWithOptions(filepath.Join(dir, fmt.Sprint("segment-", i)), Options{Mode: defaultFileMode | os.O_CREATE})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		files = append(files, f)
+	}
+	g := NewSyncGroup(files...)
+	flushes := func() string {
+		var counts []int64
+		for _, f := range files {
+			counts = append(counts, f.Stats().Flushes)
+		}
+		return fmt.Sprint(counts)
+	}
+
+	for _, f := range []*FSLock{files[0], files[2]} {
+		if err := f.Write([]byte("record\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := g.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := flushes(); got != "[1 0 1]" {
+		t.Fatalf("flushes after the first Commit = %s", got)
+	}
+	if err := g.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := flushes(); got != "[1 0 1]" {
+		t.Fatalf("flushes after a Commit with nothing written = %s", got)
+	}
+
+	// A failed member fails the Commit, and stays failed until cleared.
+	if err := files[1].Write([]byte("record\n")); err != nil {
+		t.Fatal(err)
+	}
+	restore := failFlushes(t, windows.ERROR_IO_DEVICE)
+	if err := g.Commit(); !errors.Is(err, windows.ERROR_IO_DEVICE) {
+		t.Fatalf("Commit with a failing member = %v", err)
+	}
+	restore()
+	if err := g.Commit(); !errors.Is(err, windows.ERROR_IO_DEVICE) {
+		t.Fatalf("Commit after a failed one = %v", err)
+	}
+	files[1].ClearError()
+	if err := g.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := flushes(); got != "[1 1 1]" {
+		t.Fatalf("flushes after the member recovered = %s", got)
+	}
+}
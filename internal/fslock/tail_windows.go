@@ -0,0 +1,226 @@
+package fslock
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const tailScanBlock = 4096
+
+// LastRecordOffset returns the bounds of the last valid framed record. The
+// trailing length of the final frame makes this a single read on a clean
+// file; a damaged or partial tail falls back to a forward scan so the partial
+// record is ignored. It returns EOF when the file holds no valid record.
+func (f *FSLock) LastRecordOffset() (start int64, end int64, err error) {
+	defer f.wrap("read", &err)
+	if err := f.drainForRead(); err != nil {
+		return 0, 0, err
+	}
+	f.rlock()
+	defer f.runlock()
+
+	h := f.readHandle()
+	size, err := fileSize(h.handler)
+	if err != nil {
+		return 0, 0, err
+	}
+	return h.lastRecord(size)
+}
+
+// ReverseRecords calls fn for every framed record from the last to the
+// first, stopping early when fn returns false. Walking starts at the last
+// valid record, so a corrupt or partial tail is skipped; damage found further
+// back returns ErrCorrupt.
+func (f *FSLock) ReverseRecords(fn func(offset int64, payload []byte) bool) (err error) {
+	defer f.wrap("read", &err)
+	if err := f.drainForRead(); err != nil {
+		return err
+	}
+	f.rlock()
+	defer f.runlock()
+
+	h := f.readHandle()
+	size, err := fileSize(h.handler)
+	if err != nil {
+		return err
+	}
+	_, end, err := h.lastRecord(size)
+	if err == EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for end > 0 {
+		start, payload, err := h.recordBefore(end, size)
+		if err != nil {
+			return err
+		}
+		if !fn(start, payload) {
+			return nil
+		}
+		end = start
+	}
+	return nil
+}
+
+// lastRecord finds the last valid record. The trailing length of the final
+// frame makes this a single lookup on a clean file.
+func (h readHandle) lastRecord(size int64) (int64, int64, error) {
+	start, _, err := h.recordBefore(size, size)
+	if err == nil {
+		return start, size, nil
+	}
+	if err != ErrCorrupt {
+		return 0, 0, err
+	}
+	return h.lastRecordByScan(size)
+}
+
+// recordBefore reads the record that ends right at end, using its trailing
+// length to find where it starts.
+func (h readHandle) recordBefore(end int64, size int64) (int64, []byte, error) {
+	if end < frameOverhead {
+		return 0, nil, ErrCorrupt
+	}
+	trailer := make([]byte, frameTrailerSize)
+	if _, err := h.readAt(trailer, end-frameTrailerSize); err != nil {
+		return 0, nil, err
+	}
+	start := end - frameOverhead - int64(binary.LittleEndian.Uint32(trailer))
+	if start < 0 {
+		return 0, nil, ErrCorrupt
+	}
+	payload, next, err := h.readRecordAt(start, size)
+	if err != nil {
+		return 0, nil, err
+	}
+	if next != end {
+		return 0, nil, ErrCorrupt
+	}
+	return start, payload, nil
+}
+
+func (h readHandle) lastRecordByScan(size int64) (int64, int64, error) {
+	start, end := int64(-1), int64(-1)
+	offset := int64(0)
+	for offset < size {
+		_, next, err := h.readRecordAt(offset, size)
+		if err == ErrCorrupt {
+			break
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		start, end = offset, next
+		offset = next
+	}
+	if start < 0 {
+		return 0, 0, EOF
+	}
+	return start, end, nil
+}
+
+// LastLineOffset returns the bounds of the last newline-terminated line, end
+// being just past its newline. A trailing partial line is ignored. It returns
+// EOF when the file holds no complete line.
+func (f *FSLock) LastLineOffset() (start int64, end int64, err error) {
+	defer f.wrap("read", &err)
+	if err := f.drainForRead(); err != nil {
+		return 0, 0, err
+	}
+	f.rlock()
+	defer f.runlock()
+
+	size, err := fileSize(f.handler)
+	if err != nil {
+		return 0, 0, err
+	}
+	last, err := f.readHandle().lastIndexByte(size, '\n')
+	if err != nil {
+		return 0, 0, err
+	}
+	if last < 0 {
+		return 0, 0, EOF
+	}
+	prev, err := f.readHandle().lastIndexByte(last, '\n')
+	if err != nil {
+		return 0, 0, err
+	}
+	return prev + 1, last + 1, nil
+}
+
+// Tail returns copies of the most recent lines, oldest first, as kept by the
+// TailBuffer option; changing them leaves the buffer as it is. A line
+// appended without its newline yet is left out until one follows. It
+// returns nil when the option is off.
+func (f *FSLock) Tail() [][]byte {
+	f.rlock()
+	defer f.runlock()
+	if f.tail == nil {
+		return nil
+	}
+	return f.tail.snapshot()
+}
+
+// loadTail seeds the tail buffer with the last complete lines of the file,
+// and with the line after them that the file ends in the middle of.
+func (f *FSLock) loadTail() error {
+	f.tail = newRing(f.opts.TailBuffer)
+	h := f.readHandle()
+	size, err := fileSize(h.handler)
+	if err != nil {
+		return err
+	}
+
+	lines := make([][]byte, 0, f.opts.TailBuffer)
+	end, err := h.lastIndexByte(size, '\n')
+	if err == nil && end+1 < size {
+		// A line the next append is to finish.
+		f.tail.partial = make([]byte, size-end-1)
+		_, err = h.readAt(f.tail.partial, end+1)
+	}
+	for err == nil && end >= 0 && len(lines) < f.opts.TailBuffer {
+		var start int64
+		start, err = h.lastIndexByte(end, '\n')
+		if err != nil {
+			break
+		}
+		line := make([]byte, end-start-1)
+		if _, err = h.readAt(line, start+1); err != nil {
+			break
+		}
+		lines = append(lines, line)
+		end = start
+	}
+	if err != nil {
+		return err
+	}
+	for i := len(lines) - 1; i >= 0; i-- {
+		f.tail.push(lines[i])
+	}
+	return nil
+}
+
+// lastIndexByte returns the offset of the last c located before offset, or -1
+// if there is none.
+func (h readHandle) lastIndexByte(before int64, c byte) (int64, error) {
+	block := make([]byte, tailScanBlock)
+	end := before
+	for end > 0 {
+		start := end - tailScanBlock
+		if start < 0 {
+			start = 0
+		}
+		n, err := h.readAt(block[:end-start], start)
+		if err != nil {
+			return -1, err
+		}
+		if i := bytes.LastIndexByte(block[:n], c); i >= 0 {
+			return start + int64(i), nil
+		}
+		end = start
+	}
+	return -1, nil
+}
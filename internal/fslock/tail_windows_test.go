@@ -0,0 +1,163 @@
+package fslock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func tailLines(f *FSLock) string {
+	var out []string
+	for _, line := range f.Tail() {
+		out = append(out, string(line))
+	}
+	return fmt.Sprint(out)
+}
+
+func TestTailTracksEveryAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	f, err := NewFSLockWithOptions(path, Options{Mode: defaultFileMode | os.O_CREATE, TailBuffer: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.AppendLine([]byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Write([]byte("two\nthr")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.WriteVectored([]byte("ee\n"), []byte("four\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := tailLines(f); got != "[two three four]" {
+		t.Fatalf("Tail = %s", got)
+	}
+	f.Tail()[0][0] = 'x'
+	if got := tailLines(f); got != "[two three four]" {
+		t.Fatalf("Tail after changing a returned line = %s", got)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = NewFSLockWithOptions(path, Options{TailBuffer: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if got := tailLines(f); got != "[three four]" {
+		t.Fatalf("Tail after reopen = %s", got)
+	}
+}
+
+func TestReverseRecords(t *testing.T) {
+	payloads := []string{"one", "two", "three", "four"}
+	path, offsets := framedFile(t, payloads...)
+	clean, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The last frame with a flipped payload byte, and cut short.
+	flipped := append([]byte{}, clean...)
+	flipped[offsets[3]+frameHeaderSize] ^= 0xff
+	torn := clean[:offsets[4]-2]
+
+	for _, c := range []struct {
+		name string
+		data []byte
+		want []string
+	}{
+		{"clean", clean, []string{"four", "three", "two", "one"}},
+		{"corrupt tail", flipped, []string{"three", "two", "one"}},
+		{"torn tail", torn, []string{"three", "two", "one"}},
+	} {
+		if err := os.WriteFile(path, c.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewFSLock(path, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		err = f.ReverseRecords(func(offset int64, payload []byte) bool {
+			if i := len(c.want) - 1 - len(got); i < 0 || offset != offsets[i] {
+				t.Errorf("%s: record %q at offset %d", c.name, payload, offset)
+			}
+			got = append(got, string(payload))
+			return true
+		})
+		f.Close()
+		if err != nil || fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Fatalf("%s: ReverseRecords read %q, %v, want %q", c.name, got, err, c.want)
+		}
+	}
+}
+
+func TestLastRecordOffset(t *testing.T) {
+	last := func(path string, torn []byte) (int64, int64, error) {
+		t.Helper()
+		f, err := NewFSLock(path, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if torn != nil {
+			if err := f.Write(torn); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return f.LastRecordOffset()
+	}
+
+	path, offsets := framedFile(t, "one", "two", "three")
+	if start, end, err := last(path, nil); err != nil || start != offsets[2] || end != offsets[3] {
+		t.Fatalf("LastRecordOffset = %d, %d, %v, want %d, %d", start, end, err, offsets[2], offsets[3])
+	}
+	// A record cut off by a crash is passed over.
+	torn := encodeFrame([]byte("a record that was cut off"))[:15]
+	if start, end, err := last(path, torn); err != nil || start != offsets[2] || end != offsets[3] {
+		t.Fatalf("LastRecordOffset with a torn tail = %d, %d, %v, want %d, %d", start, end, err, offsets[2], offsets[3])
+	}
+	path, _ = framedFile(t)
+	if _, _, err := last(path, nil); !errors.Is(err, EOF) {
+		t.Fatalf("LastRecordOffset of an empty file = %v, want EOF", err)
+	}
+}
+
+func TestLastLineOffset(t *testing.T) {
+	long := strings.Repeat("x", 3*tailScanBlock)
+	for _, tc := range []struct {
+		data       string
+		start, end int64
+	}{
+		{"one\ntwo\n", 4, 8},
+		{"one\ntwo\nthree, not yet termin", 4, 8},
+		{"only\n", 0, 5},
+		{"one\n" + long + "\npartial", 4, int64(5 + len(long))},
+		{"", -1, -1},
+		{"no newline at all", -1, -1},
+	} {
+		path := filepath.Join(t.TempDir(), "log")
+		if err := os.WriteFile(path, []byte(tc.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewFSLock(path, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start, end, err := f.LastLineOffset()
+		f.Close()
+		if tc.start < 0 {
+			if !errors.Is(err, EOF) {
+				t.Fatalf("LastLineOffset of %.20q = %d, %d, %v, want EOF", tc.data, start, end, err)
+			}
+			continue
+		}
+		if err != nil || start != tc.start || end != tc.end {
+			t.Fatalf("LastLineOffset of %.20q = %d, %d, %v, want %d, %d", tc.data, start, end, err, tc.start, tc.end)
+		}
+	}
+}
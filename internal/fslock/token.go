@@ -0,0 +1,8 @@
+package fslock
+
+// Token locates a record appended with AppendWithToken, whose first byte is
+// the status field UpdateToken patches.
+type Token struct {
+	Offset int64
+	Len    int
+}
@@ -0,0 +1,29 @@
+package fslock
+
+// AppendWithToken appends p and returns a Token for updating its status
+// later. The first byte of p is the status field.
+func (f *FSLock) AppendWithToken(p []byte) (t Token, err error) {
+	defer f.wrap("write", &err)
+	f.lock()
+	defer f.unlock()
+
+	offset, err := f.end()
+	if err != nil {
+		return Token{}, err
+	}
+	n, err := f.write(p)
+	if err != nil {
+		return Token{}, err
+	}
+	return Token{Offset: offset, Len: n}, nil
+}
+
+// UpdateToken overwrites the status byte of the record t refers to. As it
+// writes in place it needs the RandomAccess option.
+func (f *FSLock) UpdateToken(t Token, status byte) error {
+	if t.Len < 1 {
+		return pathError("write", f.file.Name(), ErrInvalidOffset)
+	}
+	_, err := f.WriteAt([]byte{status}, t.Offset)
+	return err
+}
@@ -0,0 +1,69 @@
+package fslock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdateToken(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "queue"), Options{Mode: defaultFileMode | os.O_CREATE, RandomAccess: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var tokens []Token
+	for i := 0; i < 5; i++ {
+		token, err := f.AppendWithToken([]byte(fmt.Sprintf("P job %d\n", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+	for _, i := range []int{1, 3} {
+		if err := f.UpdateToken(tokens[i], 'D'); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.UpdateToken(Token{}, 'D'); !errors.Is(err, ErrInvalidOffset) {
+		t.Fatalf("UpdateToken of an empty token = %v", err)
+	}
+
+	data, err := f.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses string
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if line != "" {
+			statuses += line[:1]
+		}
+	}
+	if statuses != "PDPDP" {
+		t.Fatalf("statuses read back = %s, file holds %q", statuses, data)
+	}
+	for i, token := range tokens {
+		record := string(data[token.Offset : token.Offset+int64(token.Len)])
+		if want := fmt.Sprintf(" job %d\n", i); record[1:] != want {
+			t.Fatalf("token %d refers to %q", i, record)
+		}
+	}
+}
+
+func TestUpdateTokenNeedsRandomAccess(t *testing.T) {
+	f, err := NewFSLockWithOptions(filepath.Join(t.TempDir(), "queue"), Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	token, err := f.AppendWithToken([]byte("P job\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.UpdateToken(token, 'D'); !errors.Is(err, ErrAppendOnly) {
+		t.Fatalf("UpdateToken without RandomAccess = %v, want ErrAppendOnly", err)
+	}
+}
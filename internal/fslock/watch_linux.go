@@ -0,0 +1,107 @@
+package fslock
+
+import (
+	"path/filepath"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyBufferSize is how many bytes of notifications Wait reads at a
+// time.
+const inotifyBufferSize = 4096
+
+// FileWatcher wakes up on changes to a file, appends and replacing it by a
+// rename included, which it learns of through inotify on its parent
+// directory. Changes that arrive between waits are queued by the system
+// and delivered together, so a burst of appends wakes the waiter once.
+type FileWatcher struct {
+	fd   int
+	name string
+	buf  []byte
+}
+
+// WatchFile starts watching the file at path, which need not exist yet.
+func WatchFile(path string) (*FileWatcher, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, pathError("watch", path, err)
+	}
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, pathError("watch", path, err)
+	}
+	mask := uint32(unix.IN_MODIFY | unix.IN_CREATE | unix.IN_MOVED_TO | unix.IN_DELETE | unix.IN_CLOSE_WRITE)
+	if _, err := unix.InotifyAddWatch(fd, filepath.Dir(abs), mask); err != nil {
+		unix.Close(fd)
+		return nil, pathError("watch", path, err)
+	}
+	return &FileWatcher{fd: fd, name: filepath.Base(abs), buf: make([]byte, inotifyBufferSize)}, nil
+}
+
+// Wait blocks for up to d or until the watched file changes, whichever
+// comes first. It must not be called concurrently with Close.
+func (w *FileWatcher) Wait(d time.Duration) error {
+	deadline := time.Now().Add(d)
+	for {
+		left := time.Until(deadline)
+		if left <= 0 {
+			return nil
+		}
+		ms := int(left.Milliseconds())
+		if ms == 0 {
+			ms = 1
+		}
+		fds := []unix.PollFd{{Fd: int32(w.fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, ms)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		if w.drain() {
+			return nil
+		}
+	}
+}
+
+// drain reads the queued notifications and reports whether they include
+// the watched file. An overflow means the system dropped notifications,
+// which could have included it.
+func (w *FileWatcher) drain() bool {
+	matched := false
+	for {
+		n, err := unix.Read(w.fd, w.buf)
+		if err != nil || n <= 0 {
+			return matched
+		}
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			ev := (*unix.InotifyEvent)(unsafe.Pointer(&w.buf[off]))
+			name := w.buf[off+unix.SizeofInotifyEvent : off+unix.SizeofInotifyEvent+int(ev.Len)]
+			if ev.Mask&unix.IN_Q_OVERFLOW != 0 || cString(name) == w.name {
+				matched = true
+			}
+			off += unix.SizeofInotifyEvent + int(ev.Len)
+		}
+	}
+}
+
+// cString returns the NUL-padded name b holds.
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+// Close stops watching.
+func (w *FileWatcher) Close() error {
+	return unix.Close(w.fd)
+}
@@ -0,0 +1,45 @@
+//go:build linux || windows
+
+package fslock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileWatcherWakesOnAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	w, err := WatchFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	f, err := NewFSLockWithOptions(path, Options{Mode: defaultFileMode | os.O_CREATE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// Let the creation of the file be seen before the appends.
+	if err := w.Wait(100 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	const period = 10 * time.Second
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		for i := 0; i < 10; i++ {
+			if err := f.Write([]byte("record\n")); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	start := time.Now()
+	if err := w.Wait(period); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > period/2 {
+		t.Fatalf("Wait took %v, the appends went unnoticed", elapsed)
+	}
+}
@@ -0,0 +1,30 @@
+package fslock
+
+import "time"
+
+// FileWatcher wakes up on changes to the size or last write time of a file,
+// see WaitForGrowth.
+type FileWatcher struct {
+	w *dirWatcher
+}
+
+// WatchFile starts watching the file at path, which need not exist yet.
+func WatchFile(path string) (*FileWatcher, error) {
+	w, err := watchFile(path)
+	if err != nil {
+		return nil, pathError("watch", path, err)
+	}
+	return &FileWatcher{w: w}, nil
+}
+
+// Wait blocks for up to d or until the watched file changes, whichever
+// comes first. It must not be called concurrently with Close.
+func (w *FileWatcher) Wait(d time.Duration) error {
+	return w.w.wait(d)
+}
+
+// Close stops watching.
+func (w *FileWatcher) Close() error {
+	w.w.close()
+	return nil
+}
@@ -0,0 +1,35 @@
+//go:build unix
+
+package fslock
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// diskFull is the native error a write fails with on a full disk.
+var diskFull = unix.ENOSPC
+
+// shortWrites makes every write stop after at most limit bytes until restore
+// is called or the test ends.
+func shortWrites(t *testing.T, limit int) (restore func()) {
+	saved := writeFile
+	writeFile = func(fd int, p []byte) (int, error) {
+		if len(p) > limit {
+			p = p[:limit]
+		}
+		return saved(fd, p)
+	}
+	restore = func() { writeFile = saved }
+	t.Cleanup(restore)
+	return restore
+}
+
+// failWrites makes every write fail with err, without writing anything,
+// until the test ends.
+func failWrites(t *testing.T, err error) {
+	saved := writeFile
+	writeFile = func(int, []byte) (int, error) { return 0, err }
+	t.Cleanup(func() { writeFile = saved })
+}
@@ -0,0 +1,33 @@
+package fslock
+
+import (
+	"testing"
+
+	"golang.org/x/sys/windows"
+)
+
+// diskFull is the native error a write fails with on a full disk.
+var diskFull = windows.ERROR_DISK_FULL
+
+// shortWrites makes every write stop after at most limit bytes until restore
+// is called or the test ends.
+func shortWrites(t *testing.T, limit int) (restore func()) {
+	saved := writeFile
+	writeFile = func(h windows.Handle, p []byte, done *uint32, ov *windows.Overlapped) error {
+		if len(p) > limit {
+			p = p[:limit]
+		}
+		return saved(h, p, done, ov)
+	}
+	restore = func() { writeFile = saved }
+	t.Cleanup(restore)
+	return restore
+}
+
+// failWrites makes every write fail with err, without writing anything,
+// until the test ends.
+func failWrites(t *testing.T, err error) {
+	saved := writeFile
+	writeFile = func(windows.Handle, []byte, *uint32, *windows.Overlapped) error { return err }
+	t.Cleanup(func() { writeFile = saved })
+}
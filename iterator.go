@@ -0,0 +1,63 @@
+package endor
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Iterator walks a sorted snapshot of keys taken when it was created. Values
+// are read only when asked for, and reflect the store at that moment: a key
+// deleted since the snapshot returns ErrKeyNotFound from Value.
+type Iterator struct {
+	db   *DB
+	keys []string
+	pos  int
+	// strip is the length of the bucket prefix cut off the keys of a
+	// Bucket's iterator, zero for a DB's.
+	strip int
+}
+
+// Scan returns an iterator over the keys starting with prefix.
+func (db *DB) Scan(prefix string) *Iterator {
+	return db.iterate(0, func(key string) bool { return strings.HasPrefix(key, prefix) && !isBucketKey(key) })
+}
+
+// Range returns an iterator over the keys k with start <= k < end. An empty
+// end leaves the range unbounded above.
+func (db *DB) Range(start string, end string) *Iterator {
+	return db.iterate(0, func(key string) bool { return key >= start && (end == "" || key < end) && !isBucketKey(key) })
+}
+
+func (db *DB) iterate(strip int, match func(key string) bool) *Iterator {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	now := time.Now().UnixNano()
+	var keys []string
+	for key, e := range db.index {
+		if !e.expired(now) && match(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return &Iterator{db: db, keys: keys, pos: -1, strip: strip}
+}
+
+// Next advances to the next key, reporting false once the keys are
+// exhausted.
+func (it *Iterator) Next() bool {
+	if it.pos < len(it.keys) {
+		it.pos++
+	}
+	return it.pos < len(it.keys)
+}
+
+// Key returns the current key.
+func (it *Iterator) Key() string {
+	return it.keys[it.pos][it.strip:]
+}
+
+// Value reads the current value of the current key.
+func (it *Iterator) Value() ([]byte, error) {
+	return it.db.Get(it.keys[it.pos])
+}
@@ -0,0 +1,92 @@
+package endor
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// collect returns the keys of it and their values in order.
+func collect(t *testing.T, it *Iterator) []string {
+	t.Helper()
+	var got []string
+	for it.Next() {
+		value, err := it.Value()
+		if err != nil {
+			t.Fatalf("Value of %s = %v", it.Key(), err)
+		}
+		got = append(got, it.Key()+"="+string(value))
+	}
+	return got
+}
+
+func TestScanAndRange(t *testing.T) {
+	db, _ := openTest(t, Options{SweepInterval: -1})
+	for _, key := range []string{"user:2", "order:1", "user:1", "user:10", "zebra"} {
+		if err := db.Set(key, []byte(key[len(key)-1:])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SetWithTTL("user:expired", []byte("x"), time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	// Keys of buckets stay out of the iterators of the DB.
+	if err := db.Bucket("user").Set("3", []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name string
+		it   *Iterator
+		want string
+	}{
+		{"Scan(user:)", db.Scan("user:"), "[user:1=1 user:10=0 user:2=2]"},
+		{"Scan()", db.Scan(""), "[order:1=1 user:1=1 user:10=0 user:2=2 zebra=a]"},
+		{"Scan(none)", db.Scan("none"), "[]"},
+		{"Range(user:1, user:2)", db.Range("user:1", "user:2"), "[user:1=1 user:10=0]"},
+		{"Range(user:, )", db.Range("user:", ""), "[user:1=1 user:10=0 user:2=2 zebra=a]"},
+		{"Range(b, a)", db.Range("b", "a"), "[]"},
+	} {
+		if got := fmt.Sprint(collect(t, c.it)); got != c.want {
+			t.Fatalf("%s = %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestIteratorValuesAreLazy(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	for _, key := range []string{"a", "b"} {
+		if err := db.Set(key, []byte("old")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	it := db.Scan("")
+	// The keys are fixed when the iterator is made, the values are read
+	// when asked for.
+	if err := db.Set("a", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set("c", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if !it.Next() || it.Key() != "a" {
+		t.Fatal("first key is not a")
+	}
+	if value, err := it.Value(); err != nil || string(value) != "new" {
+		t.Fatalf("Value(a) = %q, %v, want the value written since", value, err)
+	}
+	if !it.Next() || it.Key() != "b" {
+		t.Fatal("second key is not b")
+	}
+	if _, err := it.Value(); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Value(b) after its delete = %v, want ErrKeyNotFound", err)
+	}
+	if it.Next() || it.Next() {
+		t.Fatalf("iterator went on to %s", it.Key())
+	}
+}
@@ -0,0 +1,57 @@
+package endor
+
+import (
+	"sort"
+	"sync"
+)
+
+// keyLockShards is how many locks the keys of a store hash to.
+const keyLockShards = 256
+
+// keyLocks orders the writes to each key without ordering writes to
+// different keys, which only wait for each other at the append itself. A
+// write holds the locks of its keys from before its records get their
+// versions until they are applied, so the versions of a key grow in the
+// order its records land, and Increment can read, add and encode outside
+// the write lock without a concurrent write to the key slipping in between.
+type keyLocks struct {
+	shards [keyLockShards]sync.Mutex
+}
+
+func keyShard(key string) int {
+	// FNV-1a.
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h % keyLockShards)
+}
+
+// lock locks the shards of the keys of records, in order so writes sharing
+// several of them can not deadlock, and returns the function unlocking
+// them.
+func (l *keyLocks) lock(records []record) func() {
+	if len(records) == 1 {
+		mu := &l.shards[keyShard(records[0].Key)]
+		mu.Lock()
+		return mu.Unlock
+	}
+	shards := make([]int, 0, len(records))
+	seen := make(map[int]bool, len(records))
+	for _, r := range records {
+		if i := keyShard(r.Key); !seen[i] {
+			seen[i] = true
+			shards = append(shards, i)
+		}
+	}
+	sort.Ints(shards)
+	for _, i := range shards {
+		l.shards[i].Lock()
+	}
+	return func() {
+		for _, i := range shards {
+			l.shards[i].Unlock()
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package endor
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyLockHoldsOnlyItsKey(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	other := "b"
+	if keyShard(other) == keyShard("a") {
+		other = "c"
+	}
+	unlock := db.keys.lock([]record{{Key: "a"}})
+	done := make(chan error, 1)
+	go func() { done <- db.Set("a", []byte("1")) }()
+
+	// A write to a key of another shard goes on while a is locked.
+	if err := db.Set(other, []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Set of a locked key returned %v before it was unlocked", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.Get("a"); err != nil || string(got) != "1" {
+		t.Fatalf("Get a = %q, %v", got, err)
+	}
+}
+
+func TestKeyLocksSharedShards(t *testing.T) {
+	var l keyLocks
+	// Keys sharing a shard, twice over, lock it once.
+	same := ""
+	for i := 0; same == "" || keyShard(same) != keyShard("a"); i++ {
+		same = fmt.Sprint("key-", i)
+	}
+	done := make(chan struct{})
+	go func() {
+		l.lock([]record{{Key: "a"}, {Key: same}, {Key: "a"}, {Key: "c"}})()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("locking keys sharing a shard deadlocked")
+	}
+	// Overlapping batches locked from many goroutines can not deadlock
+	// either, whatever order their keys come in.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				keys := []record{{Key: fmt.Sprint(i + j)}, {Key: fmt.Sprint(j)}, {Key: fmt.Sprint(i)}}
+				l.lock(keys)()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestWritesToOneKeyKeepTheirOrder(t *testing.T) {
+	db, path := openTest(t, Options{})
+	events, cancel := db.Watch("k")
+	defer cancel()
+	const writers, writes = 8, 50
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		w := w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				if err := db.Set("k", []byte(fmt.Sprintf("%d-%d", w, i))); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	var last Event
+	for i := 0; i < writers*writes; i++ {
+		last = receive(t, events)
+	}
+
+	// The write applied last is the one with the highest version, so
+	// watchers, Get and a replay of the data file all agree on it.
+	value, version, err := db.GetVersion("k")
+	if err != nil || string(value) != string(last.Value) {
+		t.Fatalf("GetVersion = %q, %v, want the last event's %q", value, err, last.Value)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path + ".checkpoint"); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if replayed, v, err := db.GetVersion("k"); err != nil || string(replayed) != string(value) || v != version {
+		t.Fatalf("after replay GetVersion = %q at %d, %v, want %q at %d", replayed, v, err, value, version)
+	}
+}
@@ -0,0 +1,71 @@
+package endor
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSizeLimits(t *testing.T) {
+	db, path := openTest(t, Options{MaxKeySize: 8, MaxValueSize: 16, Merger: appendMerger{}})
+	long := strings.Repeat("k", 9)
+	large := bytes.Repeat([]byte("v"), 17)
+
+	if err := db.Set(long, []byte("v")); !errors.Is(err, ErrKeyTooLarge) {
+		t.Fatalf("Set of a 9 byte key = %v, want ErrKeyTooLarge", err)
+	}
+	if err := db.Set("key", large); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("Set of a 17 byte value = %v, want ErrValueTooLarge", err)
+	}
+	if err := db.Merge("key", large); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("Merge of a 17 byte operand = %v, want ErrValueTooLarge", err)
+	}
+	if _, err := db.Increment(long, 1); !errors.Is(err, ErrKeyTooLarge) {
+		t.Fatalf("Increment of a 9 byte key = %v, want ErrKeyTooLarge", err)
+	}
+	if err := db.SetReader("key", bytes.NewReader(large)); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("SetReader of a 17 byte value = %v, want ErrValueTooLarge", err)
+	}
+	// Keys and values right at the limits are written.
+	if err := db.Set(strings.Repeat("k", 8), bytes.Repeat([]byte("v"), 16)); err != nil {
+		t.Fatalf("Set at the limits = %v", err)
+	}
+
+	// A batch holding one record too large is rejected as a whole.
+	var b WriteBatch
+	b.Set("a", []byte("1"))
+	b.Set("b", large)
+	if err := db.Write(&b); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("Write of a batch with a 17 byte value = %v, want ErrValueTooLarge", err)
+	}
+	if _, err := db.Get("a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get of a key of the rejected batch = %v, want ErrKeyNotFound", err)
+	}
+
+	// The key of a bucket counts its name and the two marks around it.
+	bucket := db.Bucket("ab")
+	if err := bucket.Set("1234", []byte("v")); err != nil {
+		t.Fatalf("Bucket.Set of a key 8 bytes long with the bucket = %v", err)
+	}
+	if err := bucket.Set("12345", []byte("v")); !errors.Is(err, ErrKeyTooLarge) {
+		t.Fatalf("Bucket.Set of a key 9 bytes long with the bucket = %v, want ErrKeyTooLarge", err)
+	}
+
+	// Nothing rejected reached the data file.
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := OpenWithOptions(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if stats, err := db.Stats(); err != nil || stats.Records != 2 {
+		t.Fatalf("%d records after reopen, want 2 (%v)", stats.Records, err)
+	}
+	// Without limits, the same writes go through.
+	if err := db.Set(long, large); err != nil {
+		t.Fatalf("Set without limits = %v", err)
+	}
+}
@@ -0,0 +1,337 @@
+package endor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A large data file is replayed in parallel on open. It is split into
+// chunks at record boundaries, each chunk is decoded on a goroutine of its
+// own into the last record of every key it holds, and the chunks are merged
+// in order, the record furthest into the file winning, before the winners
+// are applied to the index. Only the records that win are applied, which
+// leaves the index as replaying every record does as long as a record of a
+// key replaces whatever came before it: stores keeping history, and data
+// files holding merges, records from before versions or a batch another
+// one cut short, are replayed one record at a time as before.
+
+// loadChunkMin is the fewest bytes of records a goroutine replays, below
+// which a data file is not worth splitting.
+const loadChunkMin = 8 << 20
+
+// loadChunk is a chunk of the data file replayed on its own.
+type loadChunk struct {
+	start, end int64
+	// winners holds the last record of each key in the chunk, without its
+	// value.
+	winners map[string]loadedRecord
+	// count is the number of records in the chunk, the last of which
+	// starts at last and ends at size.
+	count int
+	last  int64
+	size  int64
+
+	// first is the number of records before the first batch in the chunk
+	// starts, which still belong to a batch an earlier chunk started, and
+	// batch is the offset the last batch in it starts at, or -1. That
+	// batch is want records long, seen of which are in the chunk.
+	first int
+	batch int64
+	want  int
+	seen  int
+
+	// err is the first record that did not decode, and followed is set if
+	// another one follows it in the chunk.
+	err      error
+	followed bool
+	// sequential is set for a chunk that has to be replayed record by
+	// record, see above.
+	sequential bool
+}
+
+type loadedRecord struct {
+	r      record
+	offset int64
+	length int64
+}
+
+// loadParallel replays the records from offset on as load does, splitting
+// them among OpenWorkers goroutines, and reports false, having changed
+// nothing, if they have to be replayed on one instead.
+func (db *DB) loadParallel(from int64) (bool, error) {
+	workers := db.opts.OpenWorkers
+	if workers == 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers <= 1 || db.keepsHistory() || db.inMemory {
+		return false, nil
+	}
+	size, err := db.file.Size()
+	if err != nil {
+		return false, err
+	}
+	if n := (size - from) / loadChunkMin; n < int64(workers) {
+		workers = int(n)
+	}
+	if workers < 2 {
+		return false, nil
+	}
+	bounds, err := db.chunkBounds(from, size, workers)
+	if err != nil || len(bounds) < 3 {
+		return false, err
+	}
+
+	chunks := make([]*loadChunk, len(bounds)-1)
+	var wg sync.WaitGroup
+	for i := range chunks {
+		chunks[i] = &loadChunk{start: bounds[i], end: bounds[i+1]}
+		wg.Add(1)
+		go func(c *loadChunk) {
+			defer wg.Done()
+			if err := db.scanChunk(c); err != nil && c.err == nil {
+				c.err, c.followed = err, true
+			}
+		}(chunks[i])
+	}
+	wg.Wait()
+
+	for i, c := range chunks {
+		if c.sequential {
+			return false, nil
+		}
+		// A read-only store skips a last record a crash tore, as load
+		// does.
+		if c.err != nil && (i < len(chunks)-1 || c.followed || !db.readOnly) {
+			return true, c.err
+		}
+	}
+	torn, last, ok := tornBatch(chunks)
+	if !ok {
+		return false, nil
+	}
+	if torn >= 0 {
+		// Every record from where the batch starts on belongs to it, so
+		// only its chunk is replayed again, up to there.
+		c := chunks[last]
+		*c = loadChunk{start: c.start, end: torn}
+		if err := db.scanChunk(c); err != nil {
+			return true, err
+		}
+		chunks = chunks[:last+1]
+	}
+
+	winners := chunks[len(chunks)-1].winners
+	records := db.records
+	for i := len(chunks) - 2; i >= 0; i-- {
+		for key, w := range chunks[i].winners {
+			if _, ok := winners[key]; !ok {
+				winners[key] = w
+			}
+		}
+	}
+	loaded := make([]loadedRecord, 0, len(winners))
+	for _, w := range winners {
+		loaded = append(loaded, w)
+	}
+	if db.recency != nil {
+		// Keys are used in the order they were written.
+		sort.Slice(loaded, func(i, j int) bool { return loaded[i].offset < loaded[j].offset })
+	}
+	now := time.Now().UnixNano()
+	for _, w := range loaded {
+		db.apply(w.r, w.offset, w.length, now)
+	}
+	db.records = records
+	for _, c := range chunks {
+		db.records += int64(c.count)
+		if c.count > 0 {
+			db.last, db.size = c.last, c.size
+		}
+	}
+	if torn >= 0 && !db.readOnly {
+		return true, db.file.Truncate(torn)
+	}
+	return true, nil
+}
+
+// tornBatch returns the offset the batch a crash cut short at the end of
+// the data file starts at and the chunk it starts in, or -1. It reports
+// false if a batch ends before all of its records were written anywhere
+// else.
+func tornBatch(chunks []*loadChunk) (int64, int, bool) {
+	torn, last, missing := int64(-1), -1, 0
+	for i, c := range chunks {
+		if c.batch < 0 {
+			if missing -= c.count; missing < 0 {
+				missing = 0
+			}
+			continue
+		}
+		if missing > c.first {
+			return 0, 0, false
+		}
+		torn, last, missing = c.batch, i, c.want-c.seen
+		if missing < 0 {
+			missing = 0
+		}
+	}
+	if missing == 0 {
+		return -1, -1, true
+	}
+	return torn, last, true
+}
+
+// scanChunk decodes the records of c.
+func (db *DB) scanChunk(c *loadChunk) error {
+	c.winners = make(map[string]loadedRecord)
+	c.batch = -1
+	return db.format.scan(boundedStorage{db.file, c.end}, c.start, func(offset int64, body []byte) bool {
+		if c.err != nil {
+			c.followed = true
+			return false
+		}
+		r, err := db.format.unmarshal(body)
+		if err == nil {
+			err = db.openKey(&r)
+		}
+		if err != nil {
+			c.err = fmt.Errorf("%s: record at offset %d: %w", db.path, offset, err)
+			return true
+		}
+		if r.Op == opMerge || r.Version == 0 {
+			c.sequential = true
+			return false
+		}
+		if r.Batch > 0 {
+			if c.batch < 0 {
+				c.first = c.count
+			} else if c.seen < c.want {
+				c.sequential = true
+				return false
+			}
+			c.batch, c.want, c.seen = offset, r.Batch, 0
+		}
+		c.seen++
+		length := int64(len(body)) + db.format.overhead()
+		c.winners[r.Key] = loadedRecord{r: record{Op: r.Op, Key: r.Key, Expires: r.Expires, Version: r.Version}, offset: offset, length: length}
+		c.count++
+		c.last, c.size = offset, offset+length
+		return true
+	})
+}
+
+// chunkBounds splits the records between from and size into up to n chunks
+// of about the same size, returning the offsets they start at followed by
+// size. Lines are split after the first newline past where a chunk would
+// end; frames carry no mark to find them by, so they are walked by their
+// lengths alone, and a frame whose lengths do not add up ends the walk.
+func (db *DB) chunkBounds(from, size int64, n int) ([]int64, error) {
+	bounds := []int64{from}
+	next := func() int64 { return from + (size-from)*int64(len(bounds))/int64(n) }
+	if db.format.version() != formatBinary {
+		buf := make([]byte, readChunk)
+		for len(bounds) < n {
+			offset := next()
+			if last := bounds[len(bounds)-1]; offset < last {
+				offset = last
+			}
+			for offset < size {
+				read, err := db.file.ReadAt(buf, offset)
+				if err != nil && err != io.EOF {
+					return nil, err
+				}
+				if i := bytes.IndexByte(buf[:read], '\n'); i >= 0 {
+					offset += int64(i) + 1
+					break
+				}
+				if read == 0 {
+					offset = size
+				}
+				offset += int64(read)
+			}
+			if offset >= size {
+				break
+			}
+			bounds = append(bounds, offset)
+		}
+		return append(bounds, size), nil
+	}
+
+	r := frameWalker{s: db.file}
+	for offset := from; size-offset >= frameOverhead && len(bounds) < n; {
+		length, err := r.uint32At(offset)
+		if err != nil {
+			return nil, err
+		}
+		end := offset + length + frameOverhead
+		if end > size {
+			break
+		}
+		trailer, err := r.uint32At(end - 4)
+		if err != nil {
+			return nil, err
+		}
+		if trailer != length {
+			break
+		}
+		if offset = end; offset >= next() && offset < size {
+			bounds = append(bounds, offset)
+		}
+	}
+	return append(bounds, size), nil
+}
+
+// frameWalker reads the lengths of frames from a Storage through a window
+// of it, so walking small frames does not take a read for each.
+type frameWalker struct {
+	s      Storage
+	buf    []byte
+	offset int64
+}
+
+func (w *frameWalker) uint32At(offset int64) (int64, error) {
+	if offset < w.offset || offset+4 > w.offset+int64(len(w.buf)) {
+		if w.buf == nil {
+			w.buf = make([]byte, 16<<10)
+		}
+		n, err := w.s.ReadAt(w.buf[:cap(w.buf)], offset)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if n < 4 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		w.buf, w.offset = w.buf[:n], offset
+	}
+	return int64(binary.BigEndian.Uint32(w.buf[offset-w.offset:])), nil
+}
+
+// boundedStorage is a Storage read up to size only.
+type boundedStorage struct {
+	Storage
+	size int64
+}
+
+func (s boundedStorage) ReadAt(p []byte, off int64) (int, error) {
+	if off >= s.size {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > s.size-off {
+		n, err := s.Storage.ReadAt(p[:s.size-off], off)
+		if err == nil {
+			err = io.EOF
+		}
+		return n, err
+	}
+	return s.Storage.ReadAt(p, off)
+}
+
+func (s boundedStorage) Size() (int64, error) {
+	return s.size, nil
+}
@@ -0,0 +1,135 @@
+package endor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// loadedState is what replaying a data file leaves behind.
+type loadedState struct {
+	index                     map[string]entry
+	records, size, live, last int64
+}
+
+// replay opens the store at path with workers replaying it, from the
+// start, and returns what it loaded.
+func replay(t *testing.T, path string, workers int) (loadedState, error) {
+	t.Helper()
+	os.Remove(path + ".checkpoint")
+	db, err := OpenWithOptions(path, Options{OpenWorkers: workers, SweepInterval: -1, CheckpointInterval: -1})
+	if err != nil {
+		return loadedState{}, err
+	}
+	defer func() {
+		db.Close()
+		os.Remove(path + ".checkpoint")
+	}()
+	return loadedState{db.index, db.records, db.size, db.live, db.last}, nil
+}
+
+// fillLarge writes enough records to the store at path for it to be
+// replayed in parallel: overwrites, deletes, expiring keys and batches.
+func fillLarge(t *testing.T, path string, binary bool) {
+	t.Helper()
+	db, err := OpenWithOptions(path, Options{BinaryRecords: binary, SyncPolicy: SyncNever, CheckpointInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	value := make([]byte, 1<<10)
+	for i := range value {
+		value[i] = byte('a' + i%26)
+	}
+	for size := int64(0); size < 3*loadChunkMin; {
+		var b WriteBatch
+		for i := 0; i < 100; i++ {
+			key := fmt.Sprintf("key-%04d", (int(size)/1024+i*7)%5000)
+			switch i % 10 {
+			case 3:
+				b.Delete(key)
+			case 5:
+				b.SetWithTTL(key, value, time.Hour)
+			default:
+				b.Set(key, value)
+			}
+		}
+		if err := db.Write(&b); err != nil {
+			t.Fatal(err)
+		}
+		stats, err := db.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		size = stats.FileBytes
+	}
+}
+
+func TestParallelLoad(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes a large data file")
+	}
+	for _, binary := range []bool{false, true} {
+		t.Run(fmt.Sprintf("binary=%v", binary), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.db")
+			fillLarge(t, path, binary)
+			want, err := replay(t, path, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, workers := range []int{2, 4, 0} {
+				got, err := replay(t, path, workers)
+				if err != nil {
+					t.Fatalf("%d workers: %v", workers, err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Fatalf("%d workers loaded %d keys, %d records up to %d, want %d keys, %d records up to %d", workers, len(got.index), got.records, got.size, len(want.index), want.records, want.size)
+				}
+			}
+
+			// A batch a crash cut short at the end of the file is dropped
+			// as a whole, and cut off the file, either way.
+			db, err := OpenWithOptions(path, Options{SweepInterval: -1, CheckpointInterval: -1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b WriteBatch
+			for i := 0; i < 3; i++ {
+				b.Set(fmt.Sprintf("torn-%d", i), []byte("v"))
+			}
+			if err := db.Write(&b); err != nil {
+				t.Fatal(err)
+			}
+			end := db.index["torn-2"]
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, workers := range []int{1, 4} {
+				if err := os.WriteFile(path, data[:end.offset+end.length-3], 0o644); err != nil {
+					t.Fatal(err)
+				}
+				got, err := replay(t, path, workers)
+				if err != nil || !reflect.DeepEqual(got, want) {
+					t.Fatalf("%d workers, torn batch: loaded %d keys, %d records up to %d (%v), want %d keys, %d records up to %d", workers, len(got.index), got.records, got.size, err, len(want.index), want.records, want.size)
+				}
+				if info, err := os.Stat(path); err != nil || info.Size() != want.size {
+					t.Fatalf("%d workers, torn batch: file holds %d bytes after open, want %d", workers, info.Size(), want.size)
+				}
+			}
+
+			// A damaged record in the middle of the file fails the open.
+			corruptAt(t, path, loadChunkMin+100)
+			if _, err := replay(t, path, 4); !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("parallel replay of a damaged file = %v, want ErrCorrupt", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package endor
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// memoryPath names the storage of an in-memory store in error messages.
+const memoryPath = ":memory:"
+
+// OpenInMemory opens an empty store that lives only in memory. It has the
+// full API, iterators and watchers included, but no data file, lock or
+// syncs, so it suits tests and caches that need not survive the process.
+// Everything is gone once it is closed.
+func OpenInMemory() (*DB, error) {
+	return OpenInMemoryWithOptions(Options{})
+}
+
+// OpenInMemoryWithOptions is OpenInMemory with options. Options concerning
+// files, such as Storage, LockTimeout and MmapReads, are ignored.
+func OpenInMemoryWithOptions(opts Options) (*DB, error) {
+	opts.Storage = &memoryBackend{storages: make(map[string]*memoryStorage)}
+	opts.LockTimeout, opts.MmapReads = 0, false
+	return openDB(context.Background(), memoryPath, opts, false)
+}
+
+// memoryBackend keeps the storages of one in-memory store by name, so the
+// storage compaction writes under a sibling name can replace the old one.
+type memoryBackend struct {
+	mu       sync.Mutex
+	storages map[string]*memoryStorage
+}
+
+func (b *memoryBackend) Open(name string) (Storage, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.storages[name]
+	if s == nil {
+		s = &memoryStorage{}
+		b.storages[name] = s
+	}
+	return s, nil
+}
+
+func (b *memoryBackend) Replace(from string, to string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.storages[to] = b.storages[from]
+	delete(b.storages, from)
+	return nil
+}
+
+func (b *memoryBackend) Remove(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.storages, name)
+	return nil
+}
+
+// memoryStorage is a Storage kept in a byte slice.
+type memoryStorage struct {
+	mu   sync.RWMutex
+	data []byte
+}
+
+func (s *memoryStorage) Append(bufs ...[]byte) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offset := int64(len(s.data))
+	for _, b := range bufs {
+		s.data = append(s.data, b...)
+	}
+	return offset, nil
+}
+
+func (s *memoryStorage) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if off >= int64(len(s.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, s.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (s *memoryStorage) Size() (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return int64(len(s.data)), nil
+}
+
+func (s *memoryStorage) Sync() error {
+	return nil
+}
+
+func (s *memoryStorage) Truncate(size int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = s.data[:size]
+	return nil
+}
+
+func (s *memoryStorage) Close() error {
+	return nil
+}
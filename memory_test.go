@@ -0,0 +1,102 @@
+package endor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenInMemory(t *testing.T) {
+	// Run in an empty directory to see that nothing is written to disk.
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	db, err := OpenInMemoryWithOptions(Options{BinaryRecords: true, CacheSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := OpenInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	events, cancel := db.Watch("")
+	defer cancel()
+	const keys = 50
+	want := make(map[string]string)
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("key-%03d", i)
+		if err := db.Set(key, []byte(fmt.Sprintf(`{"n":%d}`, i%5))); err != nil {
+			t.Fatal(err)
+		}
+		want[key] = fmt.Sprintf(`{"n":%d}`, i%5)
+	}
+	for i := 0; i < keys; i += 2 {
+		if err := db.Delete(fmt.Sprintf("key-%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+		delete(want, fmt.Sprintf("key-%03d", i))
+	}
+	if ev := receive(t, events); ev.Key != "key-000" {
+		t.Fatalf("first event is for %q", ev.Key)
+	}
+	if err := db.CreateIndex("n", JSONField("n")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.GetByIndex("n", "1"); err != nil || fmt.Sprint(got) != "[key-001 key-011 key-021 key-031 key-041]" {
+		t.Fatalf("GetByIndex = %v, %v", got, err)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	checkKeys(t, db, keys, want, "after Compact")
+	if report, err := db.Verify(true); err != nil || report.Records != len(want) || len(report.Corrupt) != 0 {
+		t.Fatalf("Verify = %+v, %v", report, err)
+	}
+	// Stores opened in memory are separate.
+	checkKeys(t, other, keys, nil, "another store in memory")
+
+	// A snapshot of a store in memory restores into a data file.
+	var snapshot bytes.Buffer
+	if _, err := db.Snapshot(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get("key-001"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Get after Close = %v, want ErrClosed", err)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Fatalf("the store in memory left %v, %v on disk", entries, err)
+	}
+	backup := filepath.Join(t.TempDir(), "backup")
+	if err := os.WriteFile(backup, snapshot.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := OpenFromBackup(backup, filepath.Join(t.TempDir(), "test.db"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	checkKeys(t, restored, keys, want, "restored from a snapshot of a store in memory")
+
+	// What is closed is gone.
+	fresh, err := OpenInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fresh.Close()
+	checkKeys(t, fresh, keys, nil, "a new store in memory")
+}
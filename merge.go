@@ -0,0 +1,112 @@
+package endor
+
+import (
+	"math"
+	"time"
+)
+
+// Merger combines the operands DB.Merge appended for a key with the value
+// they were appended to, RocksDB style. It must be deterministic, since the
+// operands are merged again on every read until a compaction writes the
+// merged value back.
+type Merger interface {
+	// Merge returns the value of key after applying operands, oldest
+	// first, to value, which is nil for a key that was not set.
+	Merge(key string, value []byte, operands [][]byte) ([]byte, error)
+}
+
+// Merge appends operand to key without reading its current value, leaving
+// Options.Merger to combine them on read. Compaction stores the merged
+// value, so a long run of operands is only paid for until then, unless
+// HistoryVersions is set and every operand is kept. A key that
+// is not set is merged from a nil value; one that is keeps its expiry time.
+// Merge fails with ErrNoMerger unless Options.Merger is set.
+func (db *DB) Merge(key string, operand []byte) error {
+	if db.opts.Merger == nil {
+		return ErrNoMerger
+	}
+	return db.write([]record{{Op: opMerge, Key: key, Value: operand}})
+}
+
+// applyMerge is apply for a merge record. The entry of the key keeps
+// pointing at the value merged into, or at no record at all for a key that
+// was not set, and the operand is queued in db.merges.
+func (db *DB) applyMerge(r record, offset int64, length int64, now int64) {
+	e, ok := db.index[r.Key]
+	if !ok || e.expired(now) {
+		if ok {
+			db.retire(r.Key)
+		}
+		e = entry{offset: -1}
+	}
+	e.version = db.versionOf(r)
+	db.index[r.Key] = e
+	if !ok {
+		db.addKey(r.Key)
+	}
+	if db.merges == nil {
+		db.merges = make(map[string][]entry)
+	}
+	db.merges[r.Key] = append(db.merges[r.Key], entry{offset: offset, length: length})
+	db.live += length
+}
+
+// readLive returns the current record of key, whose index entry is e, with
+// the operands queued for it merged into its value.
+func (db *DB) readLive(key string, e entry) (record, error) {
+	return db.readMerged(key, e, db.merges[key], math.MaxUint64)
+}
+
+// readMerged returns the record base points at, or an empty one for a key
+// that was only merged into, with the operands of merges up to version at
+// merged into its value. The Version of the record returned is the one the
+// value started out at: that of base, or of the first operand without one.
+func (db *DB) readMerged(key string, base entry, merges []entry, at uint64) (record, error) {
+	r := record{Op: opSet, Key: key}
+	if base.offset >= 0 {
+		var err error
+		if r, err = db.readRecord(base.offset); err != nil {
+			return record{}, err
+		}
+	}
+	if len(merges) == 0 {
+		return r, nil
+	}
+	if db.opts.Merger == nil {
+		return record{}, ErrNoMerger
+	}
+	operands := make([][]byte, 0, len(merges))
+	for _, m := range merges {
+		op, err := db.readRecord(m.offset)
+		if err != nil {
+			return record{}, err
+		}
+		if base.offset < 0 && len(operands) == 0 {
+			r.Version = op.Version
+		}
+		if op.Version > at {
+			break
+		}
+		operands = append(operands, op.Value)
+	}
+	if len(operands) == 0 {
+		return r, nil
+	}
+	value, err := db.opts.Merger.Merge(key, r.Value, operands)
+	if err != nil {
+		return record{}, err
+	}
+	r.Op, r.Value = opSet, value
+	return r, nil
+}
+
+// liveValue is the merged value of key for the secondary indexes, which
+// drop a key that fails to merge.
+func (db *DB) liveValue(key string) ([]byte, bool) {
+	e, ok := db.index[key]
+	if !ok || e.expired(time.Now().UnixNano()) {
+		return nil, false
+	}
+	r, err := db.readLive(key, e)
+	return r.Value, err == nil
+}
@@ -0,0 +1,158 @@
+package endor
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// appendMerger appends the operands to the value, comma separated, and
+// fails on an operand of "fail".
+type appendMerger struct{}
+
+var errMergeFailed = errors.New("merge failed")
+
+func (appendMerger) Merge(key string, value []byte, operands [][]byte) ([]byte, error) {
+	parts := operands
+	if value != nil {
+		parts = append([][]byte{value}, operands...)
+	}
+	for _, op := range operands {
+		if string(op) == "fail" {
+			return nil, errMergeFailed
+		}
+	}
+	return bytes.Join(parts, []byte(",")), nil
+}
+
+func TestMerge(t *testing.T) {
+	opts := Options{Merger: appendMerger{}}
+	db, path := openTest(t, opts)
+	events, cancel := db.Watch("")
+	defer cancel()
+	get := func(key, want, when string) {
+		t.Helper()
+		if got, err := db.Get(key); err != nil || string(got) != want {
+			t.Fatalf("%s: Get %s = %q, %v, want %q", when, key, got, err, want)
+		}
+	}
+
+	for _, op := range []string{"a", "b"} {
+		if err := db.Merge("new", []byte(op)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	get("new", "a,b", "merged into a key that was not set")
+	if ev := receive(t, events); ev.Type != EventMerge || string(ev.Value) != "a" {
+		t.Fatalf("event of a merge = %v %+v", ev.Type, ev)
+	}
+	if err := db.SetWithTTL("set", []byte("x"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	expires := db.index["set"].expires
+	if err := db.Merge("set", []byte("y")); err != nil {
+		t.Fatal(err)
+	}
+	get("set", "x,y", "merged into a set key")
+	if db.index["set"].expires != expires {
+		t.Fatal("Merge dropped the expiry time")
+	}
+	// Set and Delete drop the operands queued so far.
+	if err := db.Merge("over", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set("over", []byte("fresh")); err != nil {
+		t.Fatal(err)
+	}
+	get("over", "fresh", "set after a merge")
+	if err := db.Delete("new"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get("new"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get after deleting a merged key = %v, want ErrKeyNotFound", err)
+	}
+
+	// Operands are replayed on open, and merged once more on read.
+	if err := db.Merge("set", []byte("z")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	for _, when := range []string{"from the checkpoint", "replaying the data file"} {
+		if db, err = OpenWithOptions(path, opts); err != nil {
+			t.Fatal(err)
+		}
+		get("set", "x,y,z", when)
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(path + ".checkpoint"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without the Merger the value can not be read.
+	if db, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get("set"); !errors.Is(err, ErrNoMerger) {
+		t.Fatalf("Get of a merged key without a Merger = %v, want ErrNoMerger", err)
+	}
+	if err := db.Merge("set", []byte("w")); !errors.Is(err, ErrNoMerger) {
+		t.Fatalf("Merge without a Merger = %v, want ErrNoMerger", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Compact writes the merged values back, so they read without one.
+	if db, err = OpenWithOptions(path, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.merges) != 0 {
+		t.Fatalf("operands of %d keys left after Compact", len(db.merges))
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if db, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	get("set", "x,y,z", "compacted, without a Merger")
+}
+
+func TestMergeErrors(t *testing.T) {
+	db, _ := openTest(t, Options{Merger: appendMerger{}})
+	if err := db.Set("k", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Merge("k", []byte("fail")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get("k"); !errors.Is(err, errMergeFailed) {
+		t.Fatalf("Get of a key that fails to merge = %v, want the Merger's error", err)
+	}
+	// A compaction can not write such a key back and leaves the file be.
+	if err := db.Compact(); !errors.Is(err, errMergeFailed) {
+		t.Fatalf("Compact with a key that fails to merge = %v, want the Merger's error", err)
+	}
+	if err := db.Merge("", []byte("x")); !errors.Is(err, ErrEmptyKey) {
+		t.Fatalf("Merge of an empty key = %v, want ErrEmptyKey", err)
+	}
+	small, _ := openTest(t, Options{Merger: appendMerger{}, MaxValueSize: 2})
+	if err := small.Merge("k", []byte("too long")); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("Merge of a long operand = %v, want ErrValueTooLarge", err)
+	}
+	plain, _ := openTest(t, Options{})
+	if err := plain.Merge("k", []byte("x")); !errors.Is(err, ErrNoMerger) {
+		t.Fatalf("Merge without a Merger = %v, want ErrNoMerger", err)
+	}
+}
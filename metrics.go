@@ -0,0 +1,78 @@
+package endor
+
+import "time"
+
+// Metrics receives measurements of a DB, set with Options.Metrics. Its
+// methods are called synchronously, some with the store locked, so they
+// must be fast and must not call back into the DB. The metrics package has
+// an implementation that serves them to Prometheus.
+type Metrics interface {
+	// Operation is called after every operation of the kinds listed as
+	// Op constants with how long it took and the error it returned, if
+	// any. A key that is not found is not an error.
+	Operation(op string, d time.Duration, err error)
+
+	// Gauges is called with the size of the store whenever a write or a
+	// compaction changed it.
+	Gauges(g Gauges)
+}
+
+// The operations reported to Metrics.Operation.
+const (
+	OpGet     = "get"
+	OpSet     = "set"
+	OpDelete  = "delete"
+	OpMerge   = "merge"
+	OpWrite   = "write"
+	OpFlush   = "flush"
+	OpCompact = "compact"
+)
+
+// Gauges describes the size of a store.
+type Gauges struct {
+	// FileBytes is the size of the data file and DeadBytes the part of it
+	// taken by overwritten, deleted and expired records, which Compact
+	// reclaims.
+	FileBytes int64
+	DeadBytes int64
+	// Keys is the number of entries in the index, including expired keys
+	// not swept yet.
+	Keys int
+}
+
+// observe reports the operation op started at start, which ended with *errp,
+// to the metrics, if any. It is meant to be deferred. ErrKeyNotFound is not
+// reported as a failure.
+func (db *DB) observe(op string, start time.Time, errp *error) {
+	if db.opts.Metrics == nil {
+		return
+	}
+	err := *errp
+	if err == ErrKeyNotFound {
+		err = nil
+	}
+	db.opts.Metrics.Operation(op, time.Since(start), err)
+}
+
+// gauges reports the size of the store to the metrics, if any. Callers hold
+// db.mu.
+func (db *DB) gauges() {
+	if db.opts.Metrics == nil {
+		return
+	}
+	db.opts.Metrics.Gauges(Gauges{FileBytes: db.size, DeadBytes: db.size - db.live, Keys: len(db.index)})
+}
+
+// writeOp names the operation a write of records is reported as.
+func writeOp(records []record) string {
+	if len(records) > 1 {
+		return OpWrite
+	}
+	switch records[0].Op {
+	case opDelete:
+		return OpDelete
+	case opMerge:
+		return OpMerge
+	}
+	return OpSet
+}
@@ -0,0 +1,158 @@
+// Package metrics implements endor.Metrics for Prometheus without depending
+// on its client library: Prometheus collects the measurements of a store
+// and serves them in the Prometheus text exposition format.
+//
+//	p := metrics.NewPrometheus("")
+//	db, err := endor.OpenWithOptions(path, endor.Options{Metrics: p})
+//	...
+//	http.Handle("/metrics", p)
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aaydin-tr/endor"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the latency histogram
+// buckets, from 50µs covering a cached Get to 2.5s covering a compaction.
+var DefaultBuckets = []float64{0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// Prometheus is an endor.Metrics that serves what it collects over HTTP.
+// It is meant for one store; give each store its own with a distinct
+// namespace.
+type Prometheus struct {
+	namespace string
+	buckets   []float64
+
+	mu     sync.Mutex
+	ops    map[string]*operation
+	gauges endor.Gauges
+}
+
+// operation holds the counts and latency histogram of one operation.
+type operation struct {
+	ok     uint64
+	failed uint64
+	// counts[i] counts the durations up to buckets[i], and sum adds all
+	// of them up, in seconds.
+	counts []uint64
+	sum    float64
+}
+
+// NewPrometheus returns a collector exposing metrics named after namespace,
+// such as endor_operations_total. An empty namespace selects "endor".
+func NewPrometheus(namespace string) *Prometheus {
+	if namespace == "" {
+		namespace = "endor"
+	}
+	return &Prometheus{namespace: namespace, buckets: DefaultBuckets, ops: make(map[string]*operation)}
+}
+
+func (p *Prometheus) Operation(op string, d time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	o := p.ops[op]
+	if o == nil {
+		o = &operation{counts: make([]uint64, len(p.buckets))}
+		p.ops[op] = o
+	}
+	if err != nil {
+		o.failed++
+	} else {
+		o.ok++
+	}
+	seconds := d.Seconds()
+	o.sum += seconds
+	for i, bound := range p.buckets {
+		if seconds <= bound {
+			o.counts[i]++
+		}
+	}
+}
+
+func (p *Prometheus) Gauges(g endor.Gauges) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.gauges = g
+}
+
+// ServeHTTP writes the metrics in the text exposition format.
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the text exposition format to w.
+func (p *Prometheus) WriteTo(w io.Writer) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cw := &countingWriter{w: w}
+	ns := p.namespace
+
+	names := make([]string, 0, len(p.ops))
+	for op := range p.ops {
+		names = append(names, op)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(cw, "# HELP %s_operations_total Operations by kind and result.\n", ns)
+	fmt.Fprintf(cw, "# TYPE %s_operations_total counter\n", ns)
+	for _, op := range names {
+		o := p.ops[op]
+		fmt.Fprintf(cw, "%s_operations_total{op=%q,result=\"ok\"} %d\n", ns, op, o.ok)
+		fmt.Fprintf(cw, "%s_operations_total{op=%q,result=\"error\"} %d\n", ns, op, o.failed)
+	}
+
+	fmt.Fprintf(cw, "# HELP %s_operation_duration_seconds Latency of operations by kind.\n", ns)
+	fmt.Fprintf(cw, "# TYPE %s_operation_duration_seconds histogram\n", ns)
+	for _, op := range names {
+		o := p.ops[op]
+		for i, bound := range p.buckets {
+			fmt.Fprintf(cw, "%s_operation_duration_seconds_bucket{op=%q,le=%q} %d\n", ns, op, strconv.FormatFloat(bound, 'g', -1, 64), o.counts[i])
+		}
+		total := o.ok + o.failed
+		fmt.Fprintf(cw, "%s_operation_duration_seconds_bucket{op=%q,le=\"+Inf\"} %d\n", ns, op, total)
+		fmt.Fprintf(cw, "%s_operation_duration_seconds_sum{op=%q} %s\n", ns, op, strconv.FormatFloat(o.sum, 'g', -1, 64))
+		fmt.Fprintf(cw, "%s_operation_duration_seconds_count{op=%q} %d\n", ns, op, total)
+	}
+
+	for _, g := range []struct {
+		name  string
+		help  string
+		value int64
+	}{
+		{"file_bytes", "Size of the data file.", p.gauges.FileBytes},
+		{"dead_bytes", "Bytes of the data file taken by overwritten, deleted and expired records.", p.gauges.DeadBytes},
+		{"index_entries", "Entries in the index.", int64(p.gauges.Keys)},
+	} {
+		fmt.Fprintf(cw, "# HELP %s_%s %s\n", ns, g.name, g.help)
+		fmt.Fprintf(cw, "# TYPE %s_%s gauge\n", ns, g.name)
+		fmt.Fprintf(cw, "%s_%s %d\n", ns, g.name, g.value)
+	}
+	return cw.n, cw.err
+}
+
+// countingWriter counts what is written to w and keeps the first error, so
+// WriteTo can write without checking every call.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aaydin-tr/endor"
+)
+
+func TestPrometheus(t *testing.T) {
+	p := NewPrometheus("")
+	p.Operation(endor.OpGet, 30*time.Microsecond, nil)
+	p.Operation(endor.OpGet, 2*time.Millisecond, nil)
+	p.Operation(endor.OpGet, time.Minute, errors.New("failed"))
+	p.Gauges(endor.Gauges{FileBytes: 100, DeadBytes: 40, Keys: 3})
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	out := rec.Body.String()
+	for _, want := range []string{
+		`endor_operations_total{op="get",result="ok"} 2`,
+		`endor_operations_total{op="get",result="error"} 1`,
+		`endor_operation_duration_seconds_bucket{op="get",le="5e-05"} 1`,
+		`endor_operation_duration_seconds_bucket{op="get",le="0.0025"} 2`,
+		`endor_operation_duration_seconds_bucket{op="get",le="2.5"} 2`,
+		`endor_operation_duration_seconds_bucket{op="get",le="+Inf"} 3`,
+		`endor_operation_duration_seconds_count{op="get"} 3`,
+		"endor_file_bytes 100\n",
+		"endor_dead_bytes 40\n",
+		"endor_index_entries 3\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("metrics lack %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestPrometheusCollectsFromStore(t *testing.T) {
+	p := NewPrometheus("store")
+	db, err := endor.OpenWithOptions(filepath.Join(t.TempDir(), "test.db"), endor.Options{Metrics: p})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if n, err := p.WriteTo(&out); err != nil || n != int64(out.Len()) {
+		t.Fatalf("WriteTo = %d, %v, wrote %d bytes", n, err, out.Len())
+	}
+	for _, want := range []string{`store_operations_total{op="set",result="ok"} 1`, "store_index_entries 1\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("metrics lack %q:\n%s", want, out.String())
+		}
+	}
+}
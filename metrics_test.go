@@ -0,0 +1,108 @@
+package endor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingMetrics keeps what a DB reports to its Metrics.
+type recordingMetrics struct {
+	mu     sync.Mutex
+	ops    []string
+	gauges []Gauges
+}
+
+func (m *recordingMetrics) Operation(op string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if d < 0 {
+		op += " with a negative duration"
+	}
+	if err != nil {
+		op += " failed"
+	}
+	m.ops = append(m.ops, op)
+}
+
+func (m *recordingMetrics) Gauges(g Gauges) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gauges = append(m.gauges, g)
+}
+
+// take returns the operations reported since the last call.
+func (m *recordingMetrics) take() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ops := fmt.Sprint(m.ops)
+	m.ops = nil
+	return ops
+}
+
+func (m *recordingMetrics) lastGauges() Gauges {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.gauges) == 0 {
+		return Gauges{}
+	}
+	return m.gauges[len(m.gauges)-1]
+}
+
+func TestMetrics(t *testing.T) {
+	m := &recordingMetrics{}
+	db, _ := openTest(t, Options{Metrics: m, SweepInterval: -1, CheckpointInterval: -1})
+	m.take()
+
+	if err := db.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.take(); got != "[flush set]" {
+		t.Fatalf("Set reported %s", got)
+	}
+	if g, _ := db.Stats(); m.lastGauges() != (Gauges{FileBytes: g.FileBytes, DeadBytes: g.DeadBytes, Keys: 1}) {
+		t.Fatalf("gauges after Set = %+v, want those of %+v", m.lastGauges(), g)
+	}
+	db.Get("a")
+	// A key that is not found is no failure.
+	if _, err := db.Get("missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatal(err)
+	}
+	if got := m.take(); got != "[get get]" {
+		t.Fatalf("Get reported %s", got)
+	}
+	if err := db.Set("", []byte("1")); !errors.Is(err, ErrEmptyKey) {
+		t.Fatal(err)
+	}
+	if got := m.take(); got != "[set failed]" {
+		t.Fatalf("a failed Set reported %s", got)
+	}
+
+	var b WriteBatch
+	b.Set("b", []byte("2"))
+	b.Delete("a")
+	if err := db.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.take(); got != "[flush write flush delete]" {
+		t.Fatalf("Write and Delete reported %s", got)
+	}
+	if g := m.lastGauges(); g.Keys != 0 || g.DeadBytes == 0 {
+		t.Fatalf("gauges after deleting everything = %+v", g)
+	}
+
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.take(); got != "[compact]" {
+		t.Fatalf("Compact reported %s", got)
+	}
+	if g := m.lastGauges(); g.DeadBytes != 0 {
+		t.Fatalf("gauges after Compact = %+v, want no dead bytes", g)
+	}
+}
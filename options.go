@@ -0,0 +1,162 @@
+package endor
+
+import "time"
+
+// Options configures a DB opened with OpenWithOptions.
+type Options struct {
+	// SweepInterval is how often expired keys are dropped from the index
+	// in the background. Expired keys are never returned either way; the
+	// sweep only frees their memory. Zero selects DefaultSweepInterval and
+	// a negative interval disables the sweeper.
+	SweepInterval time.Duration
+
+	// CompactRatio compacts the data file automatically, after a write,
+	// once this fraction of it is dead space taken by overwritten, deleted
+	// or expired records. Zero disables automatic compaction.
+	CompactRatio float64
+
+	// CompactMinBytes keeps automatic compaction off until the data file is
+	// at least this large, so small stores are not rewritten over and over.
+	// Zero selects DefaultCompactMinBytes.
+	CompactMinBytes int64
+
+	// CheckpointInterval is how often the index is checkpointed to a file
+	// next to the data file, in the background and on Close, so Open only
+	// replays the records appended since the last checkpoint instead of
+	// the whole data file. Zero selects DefaultCheckpointInterval and a
+	// negative interval leaves only the checkpoint taken on Close.
+	CheckpointInterval time.Duration
+
+	// SyncPolicy is when writes are synced to disk. The zero value syncs
+	// every write before it returns.
+	SyncPolicy SyncPolicy
+
+	// WriteBufferSize holds up to this many bytes of appended records in
+	// memory before writing them to the data file, so a run of small
+	// writes takes one write system call instead of one each. A sync
+	// writes the buffer out first, so it only saves calls under a
+	// SyncPolicy other than SyncAlways, and records still in it are lost
+	// if the process crashes and unseen by FollowWrites readers. Zero
+	// writes every commit through.
+	WriteBufferSize int
+
+	// ReadLength is how many bytes a read of a record from a data file of
+	// lines takes first, reading as much again until the end of the line
+	// turns up, so records that mostly fit in it take a single read.
+	// Zero selects fslock.DefaultReadLength.
+	ReadLength int
+
+	// Compression compresses the values of new records. Records keep the
+	// compression they were written with, so it can be changed between
+	// opens: older records still read back, and Compact rewrites them with
+	// the current setting.
+	Compression Compression
+
+	// BinaryRecords writes new data files with length-prefixed binary
+	// records instead of lines, which store values as they are rather
+	// than base64 encoded and read back with exact-size reads. A data
+	// file keeps the format it was created with, named in its header,
+	// until Compact rewrites it in the current one, so existing files of
+	// lines migrate with their next compaction.
+	BinaryRecords bool
+
+	// EncryptionKey encrypts the values of new records with AES-GCM. It must
+	// be 16, 24 or 32 bytes long, selecting AES-128, AES-192 or AES-256.
+	// Records written without a key stay readable; Rekey rewrites them all
+	// under a new one.
+	EncryptionKey []byte
+
+	// EncryptKeys seals the keys of new records too, not just their values.
+	// It needs EncryptionKey.
+	EncryptKeys bool
+
+	// MmapReads serves Get from a memory mapping of the data file instead
+	// of a read system call per lookup.
+	MmapReads bool
+
+	// MaxKeySize and MaxValueSize reject writes of longer keys, with
+	// ErrKeyTooLarge, and of longer values or merge operands, with
+	// ErrValueTooLarge, before anything is written. The key of a bucket
+	// includes the bucket name and two bytes more. Zero sets no limit.
+	MaxKeySize   int
+	MaxValueSize int
+
+	// Merger combines the operands of Merge with the values they were
+	// appended to. Nil disables Merge.
+	Merger Merger
+
+	// Codec encodes the values SetValue stores and GetValue decodes, for
+	// keys outside buckets and for buckets without a codec of their own,
+	// see Bucket.UseCodec. Nil selects JSONCodec. Codecs lists further
+	// NamedCodecs that values read with GetValue may have been encoded
+	// with, a codec used earlier for example.
+	Codec  Codec
+	Codecs []Codec
+
+	// OpenWorkers is how many goroutines replay the data file on open,
+	// each a chunk of it, when it holds enough records since the last
+	// checkpoint to be worth splitting. Zero selects runtime.GOMAXPROCS
+	// and one replays it on a single goroutine. Stores keeping history
+	// and data files holding merges are always replayed on one.
+	OpenWorkers int
+
+	// HistoryVersions keeps this many past states of every key, which
+	// GetAt and History read, instead of treating the records they were
+	// written with as dead space. Compaction copies them along. Zero keeps
+	// none.
+	HistoryVersions int
+
+	// CacheSize keeps the values of this many recently read keys in
+	// memory, so reading them again skips the data file. Writes to a key
+	// drop it from the cache. Zero disables the cache.
+	CacheSize int
+
+	// MaxBytes turns the store into a bounded cache: once its live
+	// records take more than this many bytes, the least recently read or
+	// written keys are deleted until they fit again, and the data file is
+	// compacted whenever it reaches twice the cap to reclaim their space.
+	// Evicted keys are reported to watchers as deletes. It can not be
+	// combined with HistoryVersions. Zero sets no cap.
+	MaxBytes int64
+
+	// LockTimeout makes Open fail with fslock.ErrLocked once another
+	// process has held the data file for this long, instead of waiting
+	// for it indefinitely. Zero waits indefinitely.
+	LockTimeout time.Duration
+
+	// FollowWrites keeps a store opened with OpenReadOnly up to date with
+	// the writes of the process holding it open for writing. The data file
+	// is then always opened without the shared lock, and the records the
+	// writer appends are replayed into the index as they arrive and passed
+	// to Watch. A data file the writer compacted or cut short is read again,
+	// and watchers are told of the keys that changed. It needs the data file at the
+	// path, not a Storage or segments; the other opens ignore it.
+	FollowWrites bool
+
+	// Storage keeps the records somewhere other than the data file at the
+	// path the DB is opened with, which then only names the storage. Nil
+	// selects the data file. Checkpoints, index sidecars and the other
+	// files around the data file are still kept next to that path.
+	Storage Backend
+
+	// SegmentSize splits the data file into segments of about this many
+	// bytes, the data file itself followed by path.000001, path.000002
+	// and so on, so no single file grows without bound. Only the last
+	// segment is written to. Zero keeps everything in the data file; a
+	// store that already has segments is opened with them either way, but
+	// only starts new ones with SegmentSize set. Which segments there
+	// are is kept in path.segments, and CompactSegments compacts them
+	// one at a time. Storage replaces segments.
+	SegmentSize int64
+
+	// Metrics receives counts, latencies and sizes of the store. Nil
+	// disables them.
+	Metrics Metrics
+}
+
+const (
+	DefaultSweepInterval   = time.Minute
+	DefaultCompactMinBytes = 1 << 20
+
+	DefaultCheckpointInterval = 5 * time.Minute
+)
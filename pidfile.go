@@ -0,0 +1,182 @@
+package endor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aaydin-tr/endor/internal/fslock"
+)
+
+// A store opened for writing from a path records the process holding it in
+// a PID file next to the data file, and removes it again when closed. The
+// OS lock on the data file is what keeps other writers out; the PID file
+// only tells who holds it, so Open can name the holder when it finds the
+// store locked and tooling can tell a store in use from one a killed
+// process left behind.
+
+// LockOwner is the process holding a store open for writing, as its PID
+// file records it.
+type LockOwner struct {
+	PID   int       `json:"pid"`
+	Host  string    `json:"host"`
+	Since time.Time `json:"since"`
+}
+
+// Alive reports whether the owner is still running. A process on another
+// host can not be checked and is taken to be.
+func (o LockOwner) Alive() bool {
+	if host, _ := os.Hostname(); host != o.Host {
+		return true
+	}
+	return fslock.ProcessAlive(o.PID)
+}
+
+func pidPath(path string) string {
+	return path + ".pid"
+}
+
+// Owner returns the process holding the store at path open for writing and
+// reports false when no PID file names one. An owner that is not Alive
+// left the store without closing it.
+func Owner(path string) (LockOwner, bool, error) {
+	data, err := os.ReadFile(pidPath(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return LockOwner{}, false, nil
+	}
+	if err != nil {
+		return LockOwner{}, false, err
+	}
+	var o LockOwner
+	if err := json.Unmarshal(data, &o); err != nil {
+		return LockOwner{}, false, fmt.Errorf("endor: %s: %w", pidPath(path), err)
+	}
+	return o, true, nil
+}
+
+// ForceUnlock clears what holds the store at path when the process that
+// opened it did not close it: if this process has it open, it is closed,
+// and the PID file is removed. It fails with ErrLockHeld, leaving the file
+// alone, while another process that is Alive holds the store. The lock of
+// a process that died is released by the OS, on Windows once it is done
+// cleaning up after the process.
+func ForceUnlock(path string) error {
+	if db := openStores.find(path); db != nil {
+		if err := db.Close(); err != nil && err != ErrClosed {
+			return err
+		}
+	}
+	o, ok, err := Owner(path)
+	if err != nil || !ok {
+		return err
+	}
+	if o.PID != os.Getpid() && o.Alive() {
+		return fmt.Errorf("%w: process %d on %s", ErrLockHeld, o.PID, o.Host)
+	}
+	return removePIDFile(path)
+}
+
+// writePIDFile records this process as the owner of the store at path.
+func writePIDFile(path string) error {
+	host, _ := os.Hostname()
+	data, err := json.Marshal(LockOwner{PID: os.Getpid(), Host: host, Since: time.Now()})
+	if err != nil {
+		return err
+	}
+	tmp := pidPath(path) + ".tmp"
+	if err := copyFile(tmp, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}); err != nil {
+		return err
+	}
+	return fslock.Replace(tmp, pidPath(path))
+}
+
+func removePIDFile(path string) error {
+	if err := os.Remove(pidPath(path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// lockedBy adds the owner the PID file of the store at path names to err,
+// which Open failed with since the store is locked.
+func lockedBy(path string, err error) error {
+	o, ok, _ := Owner(path)
+	if !ok {
+		return err
+	}
+	if !o.Alive() {
+		return fmt.Errorf("%w, by process %d on %s, which is no longer running", err, o.PID, o.Host)
+	}
+	return fmt.Errorf("%w, by process %d on %s", err, o.PID, o.Host)
+}
+
+// storeRegistry holds the stores this process opened from a path and has
+// not closed yet.
+type storeRegistry struct {
+	mu  sync.Mutex
+	dbs map[*DB]bool
+}
+
+var openStores = storeRegistry{dbs: make(map[*DB]bool)}
+
+func (r *storeRegistry) add(db *DB) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dbs[db] = true
+}
+
+func (r *storeRegistry) remove(db *DB) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.dbs, db)
+}
+
+func (r *storeRegistry) all() []*DB {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	dbs := make([]*DB, 0, len(r.dbs))
+	for db := range r.dbs {
+		dbs = append(dbs, db)
+	}
+	return dbs
+}
+
+// find returns the store open for writing on path, or nil.
+func (r *storeRegistry) find(path string) *DB {
+	for _, db := range r.all() {
+		if !db.readOnly && sameFile(db.path, path) {
+			return db
+		}
+	}
+	return nil
+}
+
+// CloseAll closes every store this process opened from a path and has not
+// closed yet, and returns their errors joined. Deferring it in main has
+// them release their locks and remove their PID files when the program
+// exits normally, even on a path that forgot to close one.
+func CloseAll() error {
+	var errs []error
+	for _, db := range openStores.all() {
+		if err := db.Close(); err != nil && err != ErrClosed {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sameFile reports whether a and b name the same path.
+func sameFile(a, b string) bool {
+	a, errA := filepath.Abs(a)
+	b, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && a == b
+}
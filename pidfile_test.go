@@ -0,0 +1,155 @@
+package endor
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeOwner writes the PID file of the store at path as if o held it.
+func writeOwner(t *testing.T, path string, o LockOwner) {
+	t.Helper()
+	data, err := json.Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pidPath(path), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// exitedPID returns the PID of a process that has exited.
+func exitedPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestOwner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	if _, ok, err := Owner(path); ok || err != nil {
+		t.Fatalf("Owner of a store never opened = %v, %v", ok, err)
+	}
+	before := time.Now()
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, _ := os.Hostname()
+	o, ok, err := Owner(path)
+	if err != nil || !ok || o.PID != os.Getpid() || o.Host != host || o.Since.Before(before.Add(-time.Second)) || !o.Alive() {
+		t.Fatalf("Owner of an open store = %+v, %v, %v, want this process", o, ok, err)
+	}
+
+	// Readers do not claim the store.
+	reader, err := OpenReadOnly(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _ := Owner(path); got != o {
+		t.Fatalf("Owner after OpenReadOnly = %+v, want %+v", got, o)
+	}
+	reader.Close()
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := Owner(path); ok || err != nil {
+		t.Fatalf("Owner after Close = %v, %v, want none", ok, err)
+	}
+
+	if err := os.WriteFile(pidPath(path), []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Owner(path); err == nil || !strings.Contains(err.Error(), pidPath(path)) {
+		t.Fatalf("Owner with a damaged PID file = %v, want an error naming it", err)
+	}
+}
+
+func TestOwnerAlive(t *testing.T) {
+	host, _ := os.Hostname()
+	if (LockOwner{PID: exitedPID(t), Host: host}).Alive() {
+		t.Fatal("a process that exited is alive")
+	}
+	// A process on another host can not be checked.
+	if !(LockOwner{PID: exitedPID(t), Host: host + ".elsewhere"}).Alive() {
+		t.Fatal("a process on another host is not taken to be alive")
+	}
+}
+
+func TestForceUnlock(t *testing.T) {
+	db, path := openTest(t, Options{})
+	// A store this process has open is closed.
+	if err := ForceUnlock(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set("a", []byte("1")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Set after ForceUnlock = %v, want ErrClosed", err)
+	}
+	if _, ok, _ := Owner(path); ok {
+		t.Fatal("PID file left after ForceUnlock")
+	}
+
+	// The PID file of a process that died without closing the store is
+	// removed, and opening the store takes it over either way.
+	host, _ := os.Hostname()
+	dead := LockOwner{PID: exitedPID(t), Host: host, Since: time.Now()}
+	writeOwner(t, path, dead)
+	if err := ForceUnlock(path); err != nil {
+		t.Fatalf("ForceUnlock of a dead owner = %v", err)
+	}
+	if _, ok, _ := Owner(path); ok {
+		t.Fatal("PID file of a dead owner left after ForceUnlock")
+	}
+	writeOwner(t, path, dead)
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open with a stale PID file = %v", err)
+	}
+	defer db.Close()
+	if o, _, _ := Owner(path); o.PID != os.Getpid() {
+		t.Fatalf("Owner after Open over a stale PID file = %+v", o)
+	}
+}
+
+func TestForceUnlockHeld(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	pid := holdStore(t, path)
+	if o, ok, err := Owner(path); err != nil || !ok || o.PID != pid || !o.Alive() {
+		t.Fatalf("Owner of a store another process holds = %+v, %v, %v, want process %d", o, ok, err, pid)
+	}
+	if err := ForceUnlock(path); !errors.Is(err, ErrLockHeld) {
+		t.Fatalf("ForceUnlock of a store another process holds = %v, want ErrLockHeld", err)
+	}
+	if o, ok, _ := Owner(path); !ok || o.PID != pid {
+		t.Fatalf("ForceUnlock removed the PID file of a live owner")
+	}
+}
+
+func TestCloseAll(t *testing.T) {
+	// Stores a failed test left open are closed first, so their errors do
+	// not count here.
+	CloseAll()
+	a, pathA := openTest(t, Options{})
+	b, pathB := openTest(t, Options{})
+	if err := CloseAll(); err != nil {
+		t.Fatal(err)
+	}
+	for _, db := range []*DB{a, b} {
+		if err := db.Set("a", []byte("1")); !errors.Is(err, ErrClosed) {
+			t.Fatalf("Set after CloseAll = %v, want ErrClosed", err)
+		}
+	}
+	for _, path := range []string{pathA, pathB} {
+		if _, ok, _ := Owner(path); ok {
+			t.Fatalf("PID file of %s left after CloseAll", path)
+		}
+	}
+}
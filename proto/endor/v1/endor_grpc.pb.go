@@ -0,0 +1,336 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: endor.proto
+
+// Package endor.v1 is the wire protocol of an endor store served over gRPC.
+// It mirrors the HTTP API of the server package: keys are strings and values
+// opaque bytes. The Go stubs next to this file are generated from it, see
+// generate.go, and package server/grpcserver serves them.
+
+package endorv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	Endor_Get_FullMethodName    = "/endor.v1.Endor/Get"
+	Endor_Set_FullMethodName    = "/endor.v1.Endor/Set"
+	Endor_Delete_FullMethodName = "/endor.v1.Endor/Delete"
+	Endor_Scan_FullMethodName   = "/endor.v1.Endor/Scan"
+	Endor_Watch_FullMethodName  = "/endor.v1.Endor/Watch"
+)
+
+// EndorClient is the client API for Endor service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type EndorClient interface {
+	// Get returns the value of a key, failing with NOT_FOUND if it is not set
+	// or has expired.
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	// Set stores a value under a key, for ttl_ms milliseconds if non-zero.
+	Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error)
+	// Delete removes a key. Deleting a key that is not set is not an error.
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	// Scan streams the keys starting with prefix, in order, with their values.
+	Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (Endor_ScanClient, error)
+	// Watch streams every change to the keys starting with prefix until the
+	// call is cancelled.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Endor_WatchClient, error)
+}
+
+type endorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEndorClient(cc grpc.ClientConnInterface) EndorClient {
+	return &endorClient{cc}
+}
+
+func (c *endorClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetResponse)
+	err := c.cc.Invoke(ctx, Endor_Get_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *endorClient) Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetResponse)
+	err := c.cc.Invoke(ctx, Endor_Set_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *endorClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, Endor_Delete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *endorClient) Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (Endor_ScanClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Endor_ServiceDesc.Streams[0], Endor_Scan_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &endorScanClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Endor_ScanClient interface {
+	Recv() (*Item, error)
+	grpc.ClientStream
+}
+
+type endorScanClient struct {
+	grpc.ClientStream
+}
+
+func (x *endorScanClient) Recv() (*Item, error) {
+	m := new(Item)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *endorClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Endor_WatchClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Endor_ServiceDesc.Streams[1], Endor_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &endorWatchClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Endor_WatchClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type endorWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *endorWatchClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// EndorServer is the server API for Endor service.
+// All implementations must embed UnimplementedEndorServer
+// for forward compatibility
+type EndorServer interface {
+	// Get returns the value of a key, failing with NOT_FOUND if it is not set
+	// or has expired.
+	Get(context.Context, *GetRequest) (*GetResponse, error)
+	// Set stores a value under a key, for ttl_ms milliseconds if non-zero.
+	Set(context.Context, *SetRequest) (*SetResponse, error)
+	// Delete removes a key. Deleting a key that is not set is not an error.
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	// Scan streams the keys starting with prefix, in order, with their values.
+	Scan(*ScanRequest, Endor_ScanServer) error
+	// Watch streams every change to the keys starting with prefix until the
+	// call is cancelled.
+	Watch(*WatchRequest, Endor_WatchServer) error
+	mustEmbedUnimplementedEndorServer()
+}
+
+// UnimplementedEndorServer must be embedded to have forward compatible implementations.
+type UnimplementedEndorServer struct {
+}
+
+func (UnimplementedEndorServer) Get(context.Context, *GetRequest) (*GetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedEndorServer) Set(context.Context, *SetRequest) (*SetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Set not implemented")
+}
+func (UnimplementedEndorServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedEndorServer) Scan(*ScanRequest, Endor_ScanServer) error {
+	return status.Errorf(codes.Unimplemented, "method Scan not implemented")
+}
+func (UnimplementedEndorServer) Watch(*WatchRequest, Endor_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedEndorServer) mustEmbedUnimplementedEndorServer() {}
+
+// UnsafeEndorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EndorServer will
+// result in compilation errors.
+type UnsafeEndorServer interface {
+	mustEmbedUnimplementedEndorServer()
+}
+
+func RegisterEndorServer(s grpc.ServiceRegistrar, srv EndorServer) {
+	s.RegisterService(&Endor_ServiceDesc, srv)
+}
+
+func _Endor_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EndorServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Endor_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EndorServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Endor_Set_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EndorServer).Set(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Endor_Set_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EndorServer).Set(ctx, req.(*SetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Endor_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EndorServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Endor_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EndorServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Endor_Scan_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ScanRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EndorServer).Scan(m, &endorScanServer{ServerStream: stream})
+}
+
+type Endor_ScanServer interface {
+	Send(*Item) error
+	grpc.ServerStream
+}
+
+type endorScanServer struct {
+	grpc.ServerStream
+}
+
+func (x *endorScanServer) Send(m *Item) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Endor_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EndorServer).Watch(m, &endorWatchServer{ServerStream: stream})
+}
+
+type Endor_WatchServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type endorWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *endorWatchServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Endor_ServiceDesc is the grpc.ServiceDesc for Endor service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Endor_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "endor.v1.Endor",
+	HandlerType: (*EndorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _Endor_Get_Handler,
+		},
+		{
+			MethodName: "Set",
+			Handler:    _Endor_Set_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _Endor_Delete_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Scan",
+			Handler:       _Endor_Scan_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Watch",
+			Handler:       _Endor_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "endor.proto",
+}
@@ -0,0 +1,5 @@
+// Package endorv1 holds the Go stubs generated from endor.proto, the gRPC
+// wire protocol of an endor store.
+package endorv1
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative endor.proto
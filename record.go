@@ -0,0 +1,96 @@
+package endor
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+)
+
+type opcode uint8
+
+const (
+	opSet opcode = iota
+	opDelete
+	// opMerge appends an operand for Options.Merger to the value of Key.
+	opMerge
+)
+
+// record is one record of the data file. As a line, see format.go for the
+// other format, it is written as
+//
+//	crc32c(json) as 8 hex digits | ' ' | json
+//
+// Values are base64 encoded by the JSON encoding, so they may hold any bytes,
+// newlines included. Lines of files written before checksums were added
+// start straight with the JSON object and are read without verification.
+type record struct {
+	Op    opcode `json:"op,omitempty"`
+	Key   string `json:"k"`
+	Value []byte `json:"v,omitempty"`
+	// Expires is the expiry time in Unix nanoseconds, or zero for a key
+	// that never expires.
+	Expires int64 `json:"exp,omitempty"`
+	// Batch is set on the first record of a batch to the number of records
+	// in it. Replay applies a batch only when all of them are present.
+	Batch int `json:"b,omitempty"`
+	// Compression is how Value is compressed. Records written without
+	// compression leave it out, so they read back as CompressionNone.
+	Compression Compression `json:"z,omitempty"`
+	// Encrypted marks a Value sealed with the store's encryption key.
+	Encrypted bool `json:"e,omitempty"`
+	// SealedKey holds the key, sealed with the encryption key, in place of
+	// Key when EncryptKeys is set.
+	SealedKey []byte `json:"sk,omitempty"`
+	// Version tells this write of Key apart from every other, see
+	// GetVersion. Records written before versions were added leave it
+	// out and get one when they are loaded.
+	Version uint64 `json:"ver,omitempty"`
+	// Codec is the name of the NamedCodec SetValue encoded Value with,
+	// and empty for values set as bytes.
+	Codec string `json:"c,omitempty"`
+}
+
+const checksumSize = 8
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+func encodeRecord(r record) ([]byte, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	line := make([]byte, checksumSize+1+len(data))
+	sum := crc32.Checksum(data, crcTable)
+	hex.Encode(line, []byte{byte(sum >> 24), byte(sum >> 16), byte(sum >> 8), byte(sum)})
+	line[checksumSize] = ' '
+	copy(line[checksumSize+1:], data)
+	return line, nil
+}
+
+func decodeRecord(line []byte) (record, error) {
+	data := line
+	if len(line) > 0 && line[0] != '{' {
+		if len(line) < checksumSize+1 || line[checksumSize] != ' ' {
+			return record{}, fmt.Errorf("%w: missing checksum", ErrCorrupt)
+		}
+		var sum [4]byte
+		if _, err := hex.Decode(sum[:], line[:checksumSize]); err != nil {
+			return record{}, fmt.Errorf("%w: %w", ErrCorrupt, err)
+		}
+		data = line[checksumSize+1:]
+		want := uint32(sum[0])<<24 | uint32(sum[1])<<16 | uint32(sum[2])<<8 | uint32(sum[3])
+		if crc32.Checksum(data, crcTable) != want {
+			return record{}, fmt.Errorf("%w: %w", ErrCorrupt, ErrChecksumMismatch)
+		}
+	}
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return record{}, fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+	return r, nil
+}
+
+func (r record) expired(now int64) bool {
+	return r.Expires != 0 && r.Expires <= now
+}
@@ -0,0 +1,18 @@
+package endor
+
+// recover undoes what a crash can leave behind before the index is loaded.
+// The data file doubles as the write-ahead log: every write is appended and
+// synced before it is applied to the index, so replaying the file on open
+// applies every committed write. What a crash can leave is
+//
+//   - a torn last record, cut short in the middle of its append, which is
+//     truncated away since its write never returned;
+//   - a batch missing some of its records, which load cuts off;
+//   - the sibling file of a compaction that never reached its rename, which
+//     is removed since the data file it would have replaced is still intact.
+func (db *DB) recover() error {
+	if err := db.backend.Remove(db.path + ".compact"); err != nil {
+		return err
+	}
+	return db.format.truncateTorn(db.file, db.start)
+}
@@ -0,0 +1,108 @@
+package endor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestRecoverTornTailAndAbandonedCompaction(t *testing.T) {
+	for _, binary := range []bool{false, true} {
+		opts := Options{BinaryRecords: binary}
+		db, path := openTest(t, opts)
+		want := map[string]string{}
+		for i := 0; i < 10; i++ {
+			key, value := fmt.Sprintf("k%d", i), fmt.Sprintf("value %d", i)
+			if err := db.Set(key, []byte(value)); err != nil {
+				t.Fatal(err)
+			}
+			want[key] = value
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		whole, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A crash mid-append leaves the start of a record, and one during
+		// a compaction its copy, behind. The checkpoint goes too, so the
+		// whole data file is replayed.
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		torn := append(data, data[len(data)-10:len(data)-3]...)
+		if err := os.WriteFile(path, torn, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path+".compact", []byte("partial copy"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(path + ".checkpoint"); err != nil {
+			t.Fatal(err)
+		}
+
+		db, err = OpenWithOptions(path, opts)
+		if err != nil {
+			t.Fatalf("binary %v: Open after a crash = %v", binary, err)
+		}
+		checkKeys(t, db, len(want), want, fmt.Sprintf("binary %v: after recovery", binary))
+		if info, err := os.Stat(path); err != nil || info.Size() != whole.Size() {
+			t.Fatalf("binary %v: torn record not cut off, file is %v bytes (%v), want %d", binary, info.Size(), err, whole.Size())
+		}
+		if _, err := os.Stat(path + ".compact"); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("binary %v: abandoned compaction left behind: %v", binary, err)
+		}
+		// Writes carry on from the last whole record.
+		if err := db.Set("after", []byte("crash")); err != nil {
+			t.Fatal(err)
+		}
+		want["after"] = "crash"
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		db, err = OpenWithOptions(path, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkKeys(t, db, len(want), want, fmt.Sprintf("binary %v: after writing past the repair", binary))
+		db.Close()
+	}
+}
+
+func TestCorruptRecordBeforeTheTailFailsOpen(t *testing.T) {
+	db, path := openTest(t, Options{})
+	for i := 0; i < 3; i++ {
+		if err := db.Set(fmt.Sprintf("k%d", i), []byte("some value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path + ".checkpoint"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Damage the first record. Only a torn tail is the mark of a crash, so
+	// this is not cut off but reported.
+	data[headerSize+5] ^= 0x55
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if db, err := Open(path); !errors.Is(err, ErrCorrupt) {
+		if err == nil {
+			db.Close()
+		}
+		t.Fatalf("Open of a store with a corrupt record = %v, want ErrCorrupt", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != int64(len(data)) {
+		t.Fatalf("a failed Open changed the data file: %v", err)
+	}
+}
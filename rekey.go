@@ -0,0 +1,37 @@
+package endor
+
+import "context"
+
+// Rekey switches the store to newKey and rewrites the data file through a
+// compaction, so no record stays readable with the old key. An empty newKey
+// removes the encryption. On error the store keeps the old key.
+func (db *DB) Rekey(newKey []byte) error {
+	aead, err := newCipher(newKey)
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	if db.readOnly || db.follower {
+		return ErrReadOnly
+	}
+	if db.snapshots > 0 || db.iterators > 0 {
+		return ErrSnapshot
+	}
+	old, encryptKeys := db.sealer, db.opts.EncryptKeys
+	db.sealer = aead
+	if aead == nil {
+		db.opts.EncryptKeys = false
+	}
+	if err := db.compact(context.Background()); err != nil {
+		db.sealer, db.opts.EncryptKeys = old, encryptKeys
+		return err
+	}
+	db.opener = aead
+	db.opts.EncryptionKey = newKey
+	return nil
+}
@@ -0,0 +1,201 @@
+package endor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// RepairReport lists the outcome of Repair.
+type RepairReport struct {
+	// Records is the number of records kept.
+	Records int
+	// Dropped holds the offsets of the records left out: those that failed
+	// to decode or whose checksum did not match, the torn last one and the
+	// intact records of batches that lost one of theirs.
+	Dropped []int64
+	// DroppedBytes is how many bytes of the data file were left out.
+	DroppedBytes int64
+}
+
+// Repair rewrites the data file of the closed store at path with every
+// record that still reads back, so a store that fails to open after a crash
+// or a bad disk opens again. Unlike Open it does not stop at the first bad
+// record: it drops each one, along with the rest of its batch so batches
+// stay all or nothing, and carries on with the next record. The file keeps
+// its record format. Binary records can not be told apart past a damaged
+// frame, so everything from one on is dropped. The dropped records
+// are appended to a ".quarantine" file next to the store, each prefixed
+// with its offset, and the checkpoint and saved secondary indexes are
+// removed, since the offsets they hold no longer apply. Records are checked
+// against their checksums only, so no encryption key is needed.
+func Repair(path string) (RepairReport, error) {
+	var (
+		file    Storage
+		backend Backend
+		err     error
+	)
+	if hasSegments(path) {
+		backend = segmentBackend{}
+		file, err = openSegments(context.Background(), path, Options{}, false)
+	} else {
+		backend = fileBackend{}
+		file, err = openFileStorage(context.Background(), path, Options{}, false)
+	}
+	if err != nil {
+		return RepairReport{}, err
+	}
+	tmp := path + ".repair"
+	format, start, header, err := readHeader(file)
+	if err != nil {
+		file.Close()
+		return RepairReport{}, fmt.Errorf("%s: %w", path, err)
+	}
+	report, bad, err := salvage(file, format, start, header, backend, tmp)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return report, errors.Join(err, backend.Remove(tmp))
+	}
+	if err := quarantineLines(path, report.Dropped, bad); err != nil {
+		return report, errors.Join(err, backend.Remove(tmp))
+	}
+	if err := backend.Replace(tmp, path); err != nil {
+		return report, errors.Join(err, backend.Remove(tmp))
+	}
+	remove := fileBackend{}.Remove
+	return report, errors.Join(remove(path+".checkpoint"), remove(path+".sidx"), remove(path+".bloom"))
+}
+
+// salvage copies the records of file, in format from start on, that decode
+// to the storage called tmp, under header, and returns the records it
+// dropped along with the report.
+func salvage(file Storage, format recordFormat, start int64, header fileHeader, backend Backend, tmp string) (RepairReport, [][]byte, error) {
+	out, err := backend.Open(tmp)
+	if err != nil {
+		return RepairReport{}, nil, err
+	}
+	if err := out.Truncate(0); err != nil {
+		out.Close()
+		return RepairReport{}, nil, err
+	}
+	header, err = header.orNew()
+	if err == nil {
+		_, err = writeHeader(out, format, header)
+	}
+	if err != nil {
+		out.Close()
+		return RepairReport{}, nil, err
+	}
+
+	var (
+		report   RepairReport
+		bad      [][]byte
+		writeErr error
+		// pending holds the records of the batch being read until all of
+		// them are there, and seen counts them, bad ones included. A
+		// broken batch lost one, so the rest of it is dropped as read.
+		pending [][]byte
+		offsets []int64
+		want    int
+		seen    int
+		broken  bool
+		// end is where the last record read ends and kept the number
+		// of bytes copied, header included.
+		end  = start
+		kept = start
+	)
+	drop := func(offset int64, line []byte) {
+		report.Dropped = append(report.Dropped, offset)
+		bad = append(bad, append([]byte(nil), line...))
+	}
+	dropPending := func() {
+		for i, line := range pending {
+			drop(offsets[i], line)
+		}
+		pending, offsets = nil, nil
+	}
+	keep := func(bodies ...[]byte) bool {
+		bufs := make([][]byte, 0, 3*len(bodies))
+		for _, body := range bodies {
+			bufs = append(bufs, format.frame(body)...)
+		}
+		if _, writeErr = out.Append(bufs...); writeErr != nil {
+			return false
+		}
+		report.Records += len(bodies)
+		for _, body := range bodies {
+			kept += int64(len(body)) + format.overhead()
+		}
+		return true
+	}
+	err = format.scan(file, start, func(offset int64, body []byte) bool {
+		end = offset + int64(len(body)) + format.overhead()
+		r, err := format.unmarshal(body)
+		if err == nil && r.Batch > 0 {
+			// A new batch starts, so the open one never completed.
+			dropPending()
+			want, seen, broken = r.Batch, 0, false
+		}
+		if want == 0 {
+			if err != nil {
+				drop(offset, body)
+				return true
+			}
+			return keep(body)
+		}
+		seen++
+		if err != nil && !broken {
+			dropPending()
+			broken = true
+		}
+		if broken {
+			drop(offset, body)
+		} else {
+			pending = append(pending, append([]byte(nil), body...))
+			offsets = append(offsets, offset)
+		}
+		if seen < want {
+			return true
+		}
+		ok := broken || keep(pending...)
+		pending, offsets, want = nil, nil, 0
+		return ok
+	})
+	dropPending()
+	if err == nil {
+		err = writeErr
+	}
+	if err == nil {
+		// A torn last line may not have been handed to the callback,
+		// unlike the damaged tail of binary records.
+		err = dropTail(file, end, drop)
+	}
+	if size, sizeErr := file.Size(); err == nil {
+		report.DroppedBytes, err = size-kept, sizeErr
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return report, bad, err
+}
+
+// dropTail drops the partial line a storage may end with after the last line
+// read, which ends at end.
+func dropTail(file Storage, end int64, drop func(offset int64, line []byte)) error {
+	size, err := file.Size()
+	if err != nil || size <= end {
+		return err
+	}
+	tail := make([]byte, size-end)
+	if _, err := file.ReadAt(tail, end); err != nil && err != io.EOF {
+		return err
+	}
+	drop(end, tail)
+	return nil
+}
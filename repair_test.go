@@ -0,0 +1,142 @@
+package endor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// corruptAt flips a byte of the data file at path.
+func corruptAt(t *testing.T, path string, at int64) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[at] ^= 0x01
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	for _, binary := range []bool{false, true} {
+		t.Run(fmt.Sprintf("binary=%v", binary), func(t *testing.T) {
+			db, path := openTest(t, Options{BinaryRecords: binary})
+			for _, key := range []string{"a", "b", "c"} {
+				if err := db.Set(key, []byte("value of "+key)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var batch WriteBatch
+			batch.Set("d", []byte("value of d"))
+			batch.Set("e", []byte("value of e"))
+			if err := db.Write(&batch); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Set("f", []byte("value of f")); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.CreateIndex("all", func([]byte) []string { return []string{"x"} }); err != nil {
+				t.Fatal(err)
+			}
+			// Repair reads records, so it needs the store closed.
+			if _, err := Repair(path); err == nil {
+				t.Fatal("Repair of an open store succeeded")
+			}
+			b, e := db.index["b"], db.index["e"]
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			corruptAt(t, path, b.offset+b.length-8)
+			corruptAt(t, path, e.offset+e.length-8)
+			if err := os.Remove(path + ".checkpoint"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Open(path); !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("Open of a damaged store = %v, want ErrCorrupt", err)
+			}
+
+			report, err := Repair(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]string{"a": "value of a", "c": "value of c", "f": "value of f"}
+			dropped := fmt.Sprint([]int64{b.offset, db.index["d"].offset, e.offset})
+			if report.Records != len(want) || fmt.Sprint(report.Dropped) != dropped || report.DroppedBytes == 0 {
+				t.Fatalf("Repair = %+v, want %d records and %s dropped", report, len(want), dropped)
+			}
+			quarantined, err := os.ReadFile(path + ".quarantine")
+			if err != nil || !strings.HasPrefix(string(quarantined), fmt.Sprintf("%d ", b.offset)) {
+				t.Fatalf("quarantine file holds %q, %v", quarantined, err)
+			}
+			for _, sidecar := range []string{".checkpoint", ".sidx", ".bloom", ".repair"} {
+				if _, err := os.Stat(path + sidecar); !errors.Is(err, os.ErrNotExist) {
+					t.Fatalf("%s left after Repair: %v", sidecar, err)
+				}
+			}
+
+			db, err = Open(path)
+			if err != nil {
+				t.Fatalf("Open after Repair = %v", err)
+			}
+			defer db.Close()
+			for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+				got, err := db.Get(key)
+				if value, ok := want[key]; ok && (err != nil || string(got) != value) || !ok && !errors.Is(err, ErrKeyNotFound) {
+					t.Fatalf("after Repair: Get %s = %q, %v", key, got, err)
+				}
+			}
+			if header := db.Header(); (header.Version == int(formatBinary)) != binary {
+				t.Fatalf("Repair changed the format to %d", header.Version)
+			}
+		})
+	}
+}
+
+func TestRepairDamagedFrame(t *testing.T) {
+	db, path := openTest(t, Options{BinaryRecords: true})
+	for _, key := range []string{"a", "b", "c"} {
+		if err := db.Set(key, []byte("value of "+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := db.index["b"]
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// With the length of b damaged, the frames past it can not be found,
+	// so c goes too.
+	corruptAt(t, path, b.offset)
+	report, err := Repair(path)
+	if err != nil || report.Records != 1 || len(report.Dropped) != 1 || report.Dropped[0] != b.offset {
+		t.Fatalf("Repair = %+v, %v, want a kept and everything from %d dropped", report, err, b.offset)
+	}
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Get("c"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get of a record past a damaged frame = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestRepairSoundStore(t *testing.T) {
+	db, path := openTest(t, Options{})
+	if err := db.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	report, err := Repair(path)
+	if err != nil || report.Records != 1 || len(report.Dropped) != 0 || report.DroppedBytes != 0 {
+		t.Fatalf("Repair of a sound store = %+v, %v", report, err)
+	}
+	if _, err := os.Stat(path + ".quarantine"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Repair of a sound store wrote a quarantine file: %v", err)
+	}
+}
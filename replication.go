@@ -0,0 +1,389 @@
+package endor
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// Replication ships the data file of a leader to its followers byte for
+// byte, so each follower's data file is a prefix of the leader's and the
+// offsets of both agree. A follower connects, sends a hello holding the
+// watermark of its own data file, and the leader answers whether the
+// follower has to start over before streaming every record from the point
+// the follower reached on, followed by new records as they are appended. A
+// follower taking the stream from the start takes the leader's header and
+// record format with it.
+
+// replicaHello is the first line a follower sends.
+type replicaHello struct {
+	Watermark watermark `json:"watermark"`
+}
+
+// replicaStart is the leader's answer to replicaHello. Reset tells the
+// follower its data file is not a prefix of the leader's, so it has to
+// empty it and take the stream from the start. Format is the format
+// version of the leader's data file.
+type replicaStart struct {
+	Reset  bool `json:"reset"`
+	Format byte `json:"format,omitempty"`
+}
+
+const (
+	// followRetry and maxFollowRetry bound the delay between the attempts
+	// of a follower to reconnect to its leader.
+	followRetry    = 100 * time.Millisecond
+	maxFollowRetry = 10 * time.Second
+
+	dialTimeout = 10 * time.Second
+)
+
+// ServeReplication streams the data file to the followers connecting on l,
+// which Follow opens, until l is closed, and returns the error that ended
+// accepting. Every follower gets its own goroutine; the stream of one ends
+// when the follower goes away, the store is closed or a compaction
+// rewrites the data file, after which the follower reconnects and starts
+// over. Replication is asynchronous: writes return without waiting for
+// followers.
+func (db *DB) ServeReplication(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go db.replicate(conn)
+	}
+}
+
+// replicate serves one follower.
+func (db *DB) replicate(conn net.Conn) error {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+	var hello replicaHello
+	if err := json.Unmarshal(line, &hello); err != nil {
+		return err
+	}
+
+	db.mu.RLock()
+	if db.closed {
+		db.mu.RUnlock()
+		return ErrClosed
+	}
+	from := hello.Watermark.Offset
+	reset := !db.covers(hello.Watermark)
+	if reset {
+		from = 0
+	}
+	generation := db.generation
+	format := db.format.version()
+	db.mu.RUnlock()
+	start, err := json.Marshal(replicaStart{Reset: reset, Format: format})
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(append(start, '\n')); err != nil {
+		return err
+	}
+
+	// The follower sends nothing after its hello, so a read returning
+	// tells that it went away.
+	gone := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, r)
+		close(gone)
+	}()
+	for {
+		// Taking the signal before looking at the size makes sure an
+		// append in between is not missed.
+		appended := db.appendedSignal()
+		n, err := db.streamTail(conn, from, generation)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			from += n
+			continue
+		}
+		select {
+		case <-appended:
+		case <-gone:
+			return nil
+		}
+	}
+}
+
+// streamTail copies the data file from offset from to its current end to
+// w, returning ErrClosed once the store is closed and errCompacted once the
+// data file was rewritten since the stream was at generation. Compaction
+// is held off during the copy, as it is for a Snapshot.
+func (db *DB) streamTail(w io.Writer, from int64, generation uint64) (int64, error) {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return 0, ErrClosed
+	}
+	if db.generation != generation {
+		db.mu.Unlock()
+		return 0, errCompacted
+	}
+	end := db.size
+	if end <= from {
+		db.mu.Unlock()
+		return 0, nil
+	}
+	file := db.file
+	db.snapshots++
+	db.mu.Unlock()
+
+	defer func() {
+		db.mu.Lock()
+		db.snapshots--
+		db.mu.Unlock()
+	}()
+	return io.Copy(w, io.NewSectionReader(file, from, end-from))
+}
+
+// errCompacted ends a replication stream whose data file was rewritten.
+var errCompacted = errors.New("data file was compacted")
+
+// appendedSignal returns a channel that is closed after the next append to
+// the data file, compaction or Close.
+func (db *DB) appendedSignal() <-chan struct{} {
+	db.tailMu.Lock()
+	defer db.tailMu.Unlock()
+	if db.appended == nil {
+		db.appended = make(chan struct{})
+	}
+	return db.appended
+}
+
+// signalAppended wakes the replication streams waiting for an append.
+func (db *DB) signalAppended() {
+	db.tailMu.Lock()
+	defer db.tailMu.Unlock()
+	if db.appended != nil {
+		close(db.appended)
+		db.appended = nil
+	}
+}
+
+// Follow opens the store at path as a follower of the leader serving
+// ServeReplication at addr. It returns once the local data file is loaded,
+// and keeps the store up to date in the background from then on,
+// reconnecting whenever the connection drops. Reads, Scan and Watch see the
+// replicated writes; Set, Delete, Write, Compact and Rekey fail with
+// ErrReadOnly. A data file that is not a prefix of the leader's, because
+// either side compacted for example, is emptied and copied again. The
+// follower needs the leader's EncryptionKey to read an encrypted store.
+func Follow(addr string, path string, opts Options) (*DB, error) {
+	db, err := OpenWithOptions(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	db.follower = true
+	db.unfollow = make(chan struct{})
+	db.unfollowed = make(chan struct{})
+	go db.follow(addr)
+	return db, nil
+}
+
+// follow replicates from addr until the store is closed.
+func (db *DB) follow(addr string) {
+	defer close(db.unfollowed)
+	delay := followRetry
+	for {
+		progressed, _ := db.followOnce(addr)
+		if progressed {
+			delay = followRetry
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-db.unfollow:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if delay *= 2; delay > maxFollowRetry {
+			delay = maxFollowRetry
+		}
+	}
+}
+
+// followOnce connects to addr and applies the stream until it ends,
+// reporting whether anything was applied.
+func (db *DB) followOnce(addr string) (progressed bool, err error) {
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return false, err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-db.unfollow:
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	db.mu.RLock()
+	w, err := db.watermark()
+	db.mu.RUnlock()
+	if err != nil {
+		return false, err
+	}
+	hello, err := json.Marshal(replicaHello{Watermark: w})
+	if err != nil {
+		return false, err
+	}
+	if _, err := conn.Write(append(hello, '\n')); err != nil {
+		return false, err
+	}
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return false, err
+	}
+	var start replicaStart
+	if err := json.Unmarshal(line, &start); err != nil {
+		return false, err
+	}
+	// An empty follower takes the stream from the start too, header
+	// included.
+	if start.Reset || w.Offset == 0 {
+		if err := db.resetReplica(start.Format, r); err != nil {
+			return false, err
+		}
+	}
+
+	// The records of a batch are held back until the batch is complete,
+	// so it is applied all or nothing, as load does.
+	var (
+		bodies  [][]byte
+		records []record
+		want    int
+	)
+	for {
+		body, err := db.format.read(r)
+		if err != nil {
+			return progressed, err
+		}
+		rec, err := db.decode(body)
+		if err != nil {
+			return progressed, err
+		}
+		if rec.Batch > 0 {
+			bodies, records, want = bodies[:0], records[:0], rec.Batch
+		}
+		bodies = append(bodies, body)
+		records = append(records, rec)
+		if want > 0 && len(records) < want {
+			continue
+		}
+		if err := db.applyReplicated(bodies, records); err != nil {
+			return progressed, err
+		}
+		progressed = true
+		bodies, records, want = bodies[:0], records[:0], 0
+	}
+}
+
+// applyReplicated appends the bodies of a replicated commit, which decode to
+// records, and applies them like write does.
+func (db *DB) applyReplicated(bodies [][]byte, records []record) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	offset, err := db.file.Append(db.frame(bodies)...)
+	if err != nil {
+		return err
+	}
+	if err := db.syncAppended(); err != nil {
+		return err
+	}
+	now := time.Now().UnixNano()
+	for i, r := range records {
+		length := int64(len(bodies[i])) + db.format.overhead()
+		db.apply(r, offset, length, now)
+		db.reindex(r, now)
+		offset += length
+	}
+	db.notify(records)
+	return nil
+}
+
+// resetReplica empties the data file and the indexes of a follower whose
+// data file diverged from the leader's, then copies the header of the
+// leader's data file from the stream r. A leader whose data file predates
+// headers streams none, and its format is the one version names. Watchers
+// see every key deleted, and set again as the stream restores it.
+func (db *DB) resetReplica(version byte, r *bufio.Reader) error {
+	format, err := formatOf(version)
+	if err != nil {
+		return err
+	}
+	var (
+		raw    []byte
+		header fileHeader
+	)
+	if magic, _ := r.Peek(len(headerMagic)); string(magic) == headerMagic {
+		if raw, err = copyHeader(r); err != nil {
+			return err
+		}
+		if format, _, header, err = parseHeader(raw); err != nil {
+			return err
+		}
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	if err := db.file.Truncate(0); err != nil {
+		return err
+	}
+	start := int64(len(raw))
+	if start > 0 {
+		if _, err := db.file.Append(raw); err != nil {
+			return err
+		}
+	}
+	deleted := make([]record, 0, len(db.index))
+	for key := range db.index {
+		deleted = append(deleted, record{Op: opDelete, Key: key})
+	}
+	db.index = make(map[string]entry)
+	db.filter.Store(newBloomFilter(0))
+	db.merges = nil
+	db.history = nil
+	db.expiring = nil
+	db.cache.clear()
+	db.recency.clear()
+	db.format, db.start, db.header = format, start, header
+	db.size, db.live, db.last, db.records = start, start, 0, 0
+	for name, s := range db.indexes {
+		db.indexes[name] = newSecondary(s.extract)
+	}
+	db.checkpointed = -1
+	db.notify(deleted)
+	return nil
+}
+
+// stopFollowing stops replicating into a follower and waits for it.
+func (db *DB) stopFollowing() {
+	if db.unfollow == nil {
+		return
+	}
+	close(db.unfollow)
+	<-db.unfollowed
+}
@@ -0,0 +1,172 @@
+package endor
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// eventually fails the test unless cond holds within five seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: still false after five seconds", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// replicated reports whether follower holds exactly the keys of want, named
+// like those of checkKeys.
+func replicated(follower *DB, keys int, want map[string]string) bool {
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("key-%03d", i)
+		got, err := follower.Get(key)
+		value, ok := want[key]
+		if ok && (err != nil || string(got) != value) || !ok && !errors.Is(err, ErrKeyNotFound) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReplication(t *testing.T) {
+	const keys = 200
+	leader, _ := openTest(t, Options{SegmentSize: 2 << 10})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go leader.ServeReplication(l)
+
+	want := make(map[string]string)
+	set := func(i int, value string) {
+		t.Helper()
+		key := fmt.Sprintf("key-%03d", i)
+		if err := leader.Set(key, []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+		want[key] = value
+	}
+	// compact runs a compaction of the leader, which returns ErrSnapshot
+	// while a stream is copying the data file and is tried again then.
+	compact := func(what string, compact func() error) {
+		t.Helper()
+		var err error
+		eventually(t, what, func() bool {
+			err = compact()
+			return !errors.Is(err, ErrSnapshot)
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+	}
+	for i := 0; i < keys/2; i++ {
+		set(i, "first")
+	}
+	path := filepath.Join(t.TempDir(), "follower.db")
+	follower, err := Follow(l.Addr().String(), path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { follower.Close() }()
+	eventually(t, "follower caught up", func() bool { return replicated(follower, keys, want) })
+
+	// Records streamed after the leader started new segments arrive as
+	// well, offsets running on across them.
+	segments := len(leader.file.(*segmentStorage).segments)
+	for i := keys / 2; i < keys; i++ {
+		set(i, "second")
+	}
+	if n := len(leader.file.(*segmentStorage).segments); n <= segments {
+		t.Fatalf("the leader still has %d segments, want it to have started new ones", n)
+	}
+	eventually(t, "follower saw the new segments", func() bool { return replicated(follower, keys, want) })
+
+	if err := follower.Set("key-000", []byte("local")); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("Set on a follower = %v, want ErrReadOnly", err)
+	}
+	if err := follower.Compact(); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("Compact on a follower = %v, want ErrReadOnly", err)
+	}
+
+	// A compaction ends the stream; the follower starts over and drops
+	// the keys deleted in the meantime.
+	for i := 0; i < keys; i += 2 {
+		if err := leader.Delete(fmt.Sprintf("key-%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+		delete(want, fmt.Sprintf("key-%03d", i))
+	}
+	compact("Compact", leader.Compact)
+	set(1, "after compaction")
+	eventually(t, "follower caught up after a compaction", func() bool { return replicated(follower, keys, want) })
+
+	// So does one of a single segment.
+	for i := 1; i < keys/2; i += 2 {
+		set(i, "third")
+	}
+	compact("CompactSegments", leader.CompactSegments)
+	set(3, "after compacting segments")
+	eventually(t, "follower caught up after compacting segments", func() bool { return replicated(follower, keys, want) })
+
+	// A follower reopened later resumes from its own data file.
+	if err := follower.Close(); err != nil {
+		t.Fatal(err)
+	}
+	set(5, "while away")
+	if follower, err = Follow(l.Addr().String(), path, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "reopened follower caught up", func() bool { return replicated(follower, keys, want) })
+}
+
+func TestFollowWithoutLeader(t *testing.T) {
+	leader, _ := openTest(t, Options{})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go leader.ServeReplication(l)
+	if err := leader.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "follower.db")
+	follower, err := Follow(l.Addr().String(), path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "follower caught up", func() bool {
+		got, err := follower.Get("a")
+		return err == nil && string(got) == "1"
+	})
+	if err := follower.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// With the leader gone, a follower still opens and serves what it
+	// replicated, and Close stops it retrying.
+	l.Close()
+	if follower, err = Follow(l.Addr().String(), path, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := follower.Get("a"); err != nil || string(got) != "1" {
+		t.Fatalf("Get from a follower without its leader = %q, %v", got, err)
+	}
+	done := make(chan error)
+	go func() { done <- follower.Close() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close of a follower retrying its leader did not return")
+	}
+}
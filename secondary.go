@@ -0,0 +1,292 @@
+package endor
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Extractor returns the values a secondary index files a record's value
+// under. A value can be filed under several values, or under none.
+type Extractor func(value []byte) []string
+
+// secondary is a secondary index, mapping the values an Extractor returns
+// to the keys whose current record produced them.
+type secondary struct {
+	extract Extractor
+	byKey   map[string][]string
+	byValue map[string]map[string]struct{}
+}
+
+func newSecondary(extract Extractor) *secondary {
+	return &secondary{extract: extract, byKey: make(map[string][]string), byValue: make(map[string]map[string]struct{})}
+}
+
+func (s *secondary) set(key string, values []string) {
+	s.remove(key)
+	if len(values) == 0 {
+		return
+	}
+	s.byKey[key] = values
+	for _, v := range values {
+		keys := s.byValue[v]
+		if keys == nil {
+			keys = make(map[string]struct{})
+			s.byValue[v] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+func (s *secondary) remove(key string) {
+	for _, v := range s.byKey[key] {
+		delete(s.byValue[v], key)
+		if len(s.byValue[v]) == 0 {
+			delete(s.byValue, v)
+		}
+	}
+	delete(s.byKey, key)
+}
+
+// sidecar is the file the secondary indexes are persisted to on Close, next
+// to the data file.
+type sidecar struct {
+	Watermark watermark                      `json:"watermark"`
+	Indexes   map[string]map[string][]string `json:"indexes"`
+}
+
+func (db *DB) sidecarPath() string {
+	return db.path + ".sidx"
+}
+
+// CreateIndex adds a secondary index called name, filing every live key
+// under the values extract returns for its value, and keeps it up to date on
+// every write. Extractors are code, so indexes must be created again after
+// each Open. When the store was closed with the index in place its saved
+// state is reused, and only the records written since are run through
+// extract rather than every live value. Saved indexes that are not created
+// again before Close are discarded. To change the extractor of an index,
+// drop it and create it again.
+func (db *DB) CreateIndex(name string, extract Extractor) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	if _, ok := db.indexes[name]; ok {
+		return ErrIndexExists
+	}
+	if err := db.loadSidecar(); err != nil {
+		return err
+	}
+
+	s := newSecondary(extract)
+	if saved, ok := db.saved.Indexes[name]; ok {
+		for key, values := range saved {
+			s.set(key, values)
+		}
+		if err := db.replayInto(s, db.saved.Watermark.Offset); err != nil {
+			return err
+		}
+	} else {
+		for key, e := range db.index {
+			r, err := db.readLive(key, e)
+			if err != nil {
+				return err
+			}
+			s.set(key, extract(r.Value))
+		}
+	}
+	if db.indexes == nil {
+		db.indexes = make(map[string]*secondary)
+	}
+	db.indexes[name] = s
+	return nil
+}
+
+// DropIndex removes the secondary index called name along with its saved
+// state.
+func (db *DB) DropIndex(name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	if _, ok := db.indexes[name]; !ok {
+		return ErrNoIndex
+	}
+	delete(db.indexes, name)
+	delete(db.saved.Indexes, name)
+	return nil
+}
+
+// GetByIndex returns the sorted keys the index called name files under
+// value.
+func (db *DB) GetByIndex(name string, value string) ([]string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	s, ok := db.indexes[name]
+	if !ok {
+		return nil, ErrNoIndex
+	}
+	now := time.Now().UnixNano()
+	var keys []string
+	for key := range s.byValue[value] {
+		if e, ok := db.index[key]; ok && !e.expired(now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// reindex updates the secondary indexes for the record r just applied.
+func (db *DB) reindex(r record, now int64) {
+	for _, s := range db.indexes {
+		db.indexRecord(s, r, now)
+	}
+}
+
+// indexRecord updates s for the record r. A merge indexes the current
+// merged value of the key, which a replay ends up at anyway.
+func (db *DB) indexRecord(s *secondary, r record, now int64) {
+	value := r.Value
+	if r.Op == opMerge {
+		var ok bool
+		if value, ok = db.liveValue(r.Key); !ok {
+			s.remove(r.Key)
+			return
+		}
+	}
+	if r.Op == opDelete || r.expired(now) {
+		s.remove(r.Key)
+	} else {
+		s.set(r.Key, s.extract(value))
+	}
+}
+
+func (db *DB) unindex(key string) {
+	for _, s := range db.indexes {
+		s.remove(key)
+	}
+}
+
+// replayInto runs the records from offset up to the end of the index's view
+// of the data file through s. The zero watermark of an empty file replays
+// from its first record.
+func (db *DB) replayInto(s *secondary, offset int64) error {
+	if offset < db.start {
+		offset = db.start
+	}
+	now := time.Now().UnixNano()
+	var replayErr error
+	err := db.format.scan(db.file, offset, func(offset int64, body []byte) bool {
+		if offset >= db.size {
+			return false
+		}
+		r, err := db.decode(body)
+		if err != nil {
+			replayErr = err
+			return false
+		}
+		db.indexRecord(s, r, now)
+		return true
+	})
+	return errors.Join(err, replayErr)
+}
+
+// loadSidecar reads the saved secondary indexes once. A sidecar that does
+// not match the data file, because it was compacted or restored after the
+// sidecar was written, is ignored and the indexes are rebuilt.
+func (db *DB) loadSidecar() error {
+	if db.saved != nil {
+		return nil
+	}
+	db.saved = &sidecar{}
+	var saved sidecar
+	ok, err := db.readState(db.sidecarPath(), &saved)
+	if err != nil || !ok || !db.covers(saved.Watermark) {
+		return err
+	}
+	db.saved = &saved
+	return nil
+}
+
+// saveIndexes persists the secondary indexes for the next session.
+// Callers hold db.mu.
+func (db *DB) saveIndexes() error {
+	if db.readOnly || db.inMemory || db.saved == nil {
+		return nil
+	}
+	if len(db.indexes) == 0 {
+		if err := os.Remove(db.sidecarPath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	w, err := db.watermark()
+	if err != nil {
+		return err
+	}
+	out := sidecar{Watermark: w, Indexes: make(map[string]map[string][]string, len(db.indexes))}
+	for name, s := range db.indexes {
+		out.Indexes[name] = s.byKey
+	}
+	return db.writeState(db.sidecarPath(), out)
+}
+
+// JSONField returns an Extractor for JSON values that files each value under
+// the field at path, a dot separated list of object keys such as
+// "user.email". A string field is used as is, other scalars as their JSON
+// text, and an array under each of its scalar elements. Values that are not
+// JSON objects or lack the field are not indexed.
+func JSONField(path string) Extractor {
+	fields := strings.Split(path, ".")
+	return func(value []byte) []string {
+		var v any
+		if err := json.Unmarshal(value, &v); err != nil {
+			return nil
+		}
+		for _, field := range fields {
+			obj, ok := v.(map[string]any)
+			if !ok {
+				return nil
+			}
+			if v, ok = obj[field]; !ok {
+				return nil
+			}
+		}
+		if list, ok := v.([]any); ok {
+			var values []string
+			for _, item := range list {
+				if s, ok := scalar(item); ok {
+					values = append(values, s)
+				}
+			}
+			return values
+		}
+		if s, ok := scalar(v); ok {
+			return []string{s}
+		}
+		return nil
+	}
+}
+
+func scalar(v any) (string, bool) {
+	switch v := v.(type) {
+	case nil, map[string]any, []any:
+		return "", false
+	case string:
+		return v, true
+	default:
+		text, err := json.Marshal(v)
+		return string(text), err == nil
+	}
+}
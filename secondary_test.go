@@ -0,0 +1,129 @@
+package endor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// countingField is JSONField("city") counting the values it extracts from.
+func countingField(calls *int) Extractor {
+	city := JSONField("city")
+	return func(value []byte) []string {
+		*calls++
+		return city(value)
+	}
+}
+
+func TestSecondaryIndex(t *testing.T) {
+	db, path := openTest(t, Options{})
+	users := map[string]string{
+		"ann": `{"city":"Oslo"}`,
+		"bob": `{"city":"Rome"}`,
+		"cat": `{"city":"Oslo"}`,
+		"dan": `not json`,
+	}
+	for key, value := range users {
+		if err := db.Set(key, []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	calls := 0
+	if err := db.CreateIndex("city", countingField(&calls)); err != nil {
+		t.Fatal(err)
+	}
+	check := func(city, want, when string) {
+		t.Helper()
+		keys, err := db.GetByIndex("city", city)
+		if err != nil || fmt.Sprint(keys) != want {
+			t.Fatalf("%s: GetByIndex(%s) = %v, %v, want %s", when, city, keys, err, want)
+		}
+	}
+	check("Oslo", "[ann cat]", "after CreateIndex")
+	// Writes keep the index up to date.
+	if err := db.Set("bob", []byte(`{"city":"Oslo"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("ann"); err != nil {
+		t.Fatal(err)
+	}
+	check("Oslo", "[bob cat]", "after the writes")
+	check("Rome", "[]", "after the writes")
+
+	if err := db.CreateIndex("city", countingField(&calls)); !errors.Is(err, ErrIndexExists) {
+		t.Fatalf("CreateIndex twice = %v, want ErrIndexExists", err)
+	}
+	if _, err := db.GetByIndex("country", "NO"); !errors.Is(err, ErrNoIndex) {
+		t.Fatalf("GetByIndex of a missing index = %v, want ErrNoIndex", err)
+	}
+	if err := db.DropIndex("country"); !errors.Is(err, ErrNoIndex) {
+		t.Fatalf("DropIndex of a missing index = %v, want ErrNoIndex", err)
+	}
+
+	// Close saves the index, so the next session only runs the records
+	// written since through the extractor.
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set("eve", []byte(`{"city":"Oslo"}`)); err != nil {
+		t.Fatal(err)
+	}
+	calls = 0
+	if err := db.CreateIndex("city", countingField(&calls)); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Fatalf("CreateIndex from the saved index ran the extractor %d times, want once", calls)
+	}
+	check("Oslo", "[bob cat eve]", "from the saved index")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A corrupt sidecar is ignored and the index rebuilt from the values.
+	if err := os.WriteFile(path+".sidx", []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open with a corrupt sidecar = %v", err)
+	}
+	defer db.Close()
+	calls = 0
+	if err := db.CreateIndex("city", countingField(&calls)); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 4 {
+		t.Fatalf("rebuilding the index ran the extractor %d times, want once per live key", calls)
+	}
+	check("Oslo", "[bob cat eve]", "rebuilt after a corrupt sidecar")
+
+	if err := db.DropIndex("city"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetByIndex("city", "Oslo"); !errors.Is(err, ErrNoIndex) {
+		t.Fatalf("GetByIndex after DropIndex = %v, want ErrNoIndex", err)
+	}
+}
+
+func TestJSONField(t *testing.T) {
+	extract := JSONField("user.tags")
+	for value, want := range map[string]string{
+		`{"user":{"tags":["a",1,true,null,{"x":1}]}}`: "[a 1 true]",
+		`{"user":{"tags":"solo"}}`:                    "[solo]",
+		`{"user":{"tags":2.5}}`:                       "[2.5]",
+		`{"user":{}}`:                                 "[]",
+		`{"user":"flat"}`:                             "[]",
+		`[1,2]`:                                       "[]",
+		`not json`:                                    "[]",
+	} {
+		if got := fmt.Sprint(extract([]byte(value))); got != want {
+			t.Fatalf("JSONField(user.tags)(%s) = %s, want %s", value, got, want)
+		}
+	}
+}
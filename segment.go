@@ -0,0 +1,582 @@
+package endor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aaydin-tr/endor/internal/fslock"
+)
+
+// Segments split the records of a store over numbered files of at most
+// SegmentSize bytes: the data file at path is segment zero and
+// path.000001, path.000002 and so on follow it. Offsets run on across
+// segments, segment i starting where segment i-1 ends, so the rest of the
+// store sees one contiguous storage. Only the last segment is appended to.
+// The others only change when CompactSegments rewrites one of them, or
+// removes it, which moves the segments after it down, or when a compaction
+// replaces the whole set.
+//
+// The manifest at path.segments lists the numbers of the segments in order.
+// A rewritten segment gets a new number, so replacing the manifest is what
+// swaps it in, and a crash leaves either the old segment or the new one in
+// place. Stores whose segments never changed that way may have no manifest,
+// their segments then being numbered from zero on without gaps.
+
+func segmentName(name string, id int) string {
+	if id == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s.%06d", name, id)
+}
+
+// segmentCount returns how many segments the storage called name has,
+// counting a missing data file as one empty segment, for a storage without
+// a manifest.
+func segmentCount(name string) (int, error) {
+	n := 1
+	for {
+		_, err := os.Stat(segmentName(name, n))
+		if errors.Is(err, fs.ErrNotExist) {
+			return n, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		n++
+	}
+}
+
+func manifestPath(name string) string {
+	return name + ".segments"
+}
+
+// segmentManifest is what the manifest holds.
+type segmentManifest struct {
+	Segments []int `json:"segments"`
+}
+
+// segmentIDs returns the numbers of the segments of the storage called name
+// in order, from its manifest or, without one, counting them.
+func segmentIDs(name string) ([]int, error) {
+	data, err := os.ReadFile(manifestPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		count, err := segmentCount(name)
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]int, count)
+		for i := range ids {
+			ids[i] = i
+		}
+		return ids, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m segmentManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("endor: %s: %w", manifestPath(name), err)
+	}
+	if len(m.Segments) == 0 || m.Segments[0] != 0 {
+		return nil, fmt.Errorf("endor: %s: does not start with the data file", manifestPath(name))
+	}
+	return m.Segments, nil
+}
+
+// writeManifest replaces the manifest of the storage called name with one
+// listing ids.
+func writeManifest(name string, ids []int) error {
+	data, err := json.Marshal(segmentManifest{Segments: ids})
+	if err != nil {
+		return err
+	}
+	tmp := manifestPath(name) + ".tmp"
+	if err := copyFile(tmp, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}); err != nil {
+		return err
+	}
+	return fslock.Replace(tmp, manifestPath(name))
+}
+
+// segmentFiles returns the numbers of the segment files next to the data
+// file called name, whether the manifest lists them or not.
+func segmentFiles(name string) ([]int, error) {
+	matches, err := filepath.Glob(name + ".[0-9]*")
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, match := range matches {
+		suffix := match[len(name)+1:]
+		if strings.Trim(suffix, "0123456789") != "" || len(suffix) < 6 {
+			continue
+		}
+		id, err := strconv.Atoi(suffix)
+		if err == nil && id > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// hasSegments reports whether the store at path was written with segments,
+// so it is opened as such even without SegmentSize.
+func hasSegments(path string) bool {
+	if _, err := os.Stat(manifestPath(path)); err == nil {
+		return true
+	}
+	_, err := os.Stat(segmentName(path, 1))
+	return err == nil
+}
+
+type segment struct {
+	*fileStorage
+	base int64
+	// id is the number the segment's file is named with.
+	id int
+}
+
+func (s segment) end() int64 {
+	return s.base + s.size
+}
+
+// segmentStorage is a Storage over the segments of one store.
+type segmentStorage struct {
+	name  string
+	opts  Options
+	limit int64
+
+	// mu guards segments against ReadAt while Append adds one or Truncate
+	// drops some. Everything else runs under db.mu, which already keeps
+	// those apart.
+	mu       sync.RWMutex
+	segments []segment
+}
+
+// openSegments opens every segment of the store at name, waiting for the
+// lock on the first one until ctx is done. A replacement a crash cut short
+// is finished first, unless the storage is read-only.
+func openSegments(ctx context.Context, name string, opts Options, readOnly bool) (*segmentStorage, error) {
+	pending, err := replacePending(name)
+	if err != nil {
+		return nil, err
+	}
+	if pending && readOnly {
+		return nil, fmt.Errorf("endor: %s: interrupted compaction, open the store for writing to finish it", name)
+	}
+	first, err := openFileStorage(ctx, name, opts, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	s := &segmentStorage{name: name, opts: opts, limit: opts.SegmentSize, segments: []segment{{fileStorage: first}}}
+	if pending {
+		// The lock on the first segment keeps other writers out from
+		// here on.
+		if err := finishReplace(name); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	ids, err := segmentIDs(name)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	for i, id := range ids[1:] {
+		f, err := openFileStorage(context.Background(), segmentName(name, id), opts, readOnly)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.segments = append(s.segments, segment{fileStorage: f, base: s.segments[i].end(), id: id})
+	}
+	if !readOnly {
+		if err := s.removeUnlisted(); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// removeUnlisted removes the segment files the manifest does not list: the
+// copy of a segment a crash kept from being swapped in, or the segment it
+// replaced, which was not removed yet.
+func (s *segmentStorage) removeUnlisted() error {
+	files, err := segmentFiles(s.name)
+	if err != nil {
+		return err
+	}
+	listed := make(map[int]bool, len(s.segments))
+	for _, seg := range s.segments {
+		listed[seg.id] = true
+	}
+	for _, id := range files {
+		if listed[id] {
+			continue
+		}
+		if err := os.Remove(segmentName(s.name, id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ids returns the numbers of the segments in order, with those of drop left
+// out and add appended.
+func (s *segmentStorage) ids(drop map[int]bool, add ...int) []int {
+	ids := make([]int, 0, len(s.segments)+len(add))
+	for _, seg := range s.segments {
+		if !drop[seg.id] {
+			ids = append(ids, seg.id)
+		}
+	}
+	return append(ids, add...)
+}
+
+// nextID returns the number for a new segment, past those of the segments
+// and of any file a crash left.
+func (s *segmentStorage) nextID() (int, error) {
+	files, err := segmentFiles(s.name)
+	if err != nil {
+		return 0, err
+	}
+	next := 1
+	for _, seg := range s.segments {
+		if seg.id >= next {
+			next = seg.id + 1
+		}
+	}
+	for _, id := range files {
+		if id >= next {
+			next = id + 1
+		}
+	}
+	return next, nil
+}
+
+// find returns the index of the segment holding offset, which is the last
+// one for an offset at or past the end.
+func (s *segmentStorage) find(offset int64) int {
+	i := sort.Search(len(s.segments), func(i int) bool { return s.segments[i].base > offset })
+	if i == 0 {
+		return 0
+	}
+	return i - 1
+}
+
+func (s *segmentStorage) last() segment {
+	return s.segments[len(s.segments)-1]
+}
+
+// Append starts a new segment first when bufs would take the last one past
+// the limit. A segment holds at least one write, so a write larger than
+// the limit gets a segment of its own.
+func (s *segmentStorage) Append(bufs ...[]byte) (int64, error) {
+	total := int64(0)
+	for _, b := range bufs {
+		total += int64(len(b))
+	}
+	last := s.last()
+	if s.limit > 0 && last.size > 0 && last.size+total > s.limit {
+		// The segment becomes immutable, so make it durable before any
+		// write lands in the next one.
+		if err := last.Sync(); err != nil {
+			return 0, err
+		}
+		id, err := s.nextID()
+		if err != nil {
+			return 0, err
+		}
+		f, err := openFileStorage(context.Background(), segmentName(s.name, id), s.opts, false)
+		if err != nil {
+			return 0, err
+		}
+		// The segment is listed before anything is written to it, so a
+		// crash can not lose a write to an unlisted file.
+		if err := writeManifest(s.name, s.ids(nil, id)); err != nil {
+			return 0, errors.Join(err, f.Close(), os.Remove(segmentName(s.name, id)))
+		}
+		last = segment{fileStorage: f, base: last.end(), id: id}
+		s.mu.Lock()
+		s.segments = append(s.segments, last)
+		s.mu.Unlock()
+	}
+	offset, err := last.Append(bufs...)
+	if err != nil {
+		return 0, err
+	}
+	return last.base + offset, nil
+}
+
+func (s *segmentStorage) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	read := 0
+	for read < len(p) {
+		at := off + int64(read)
+		seg := s.segments[s.find(at)]
+		n, err := seg.ReadAt(p[read:], at-seg.base)
+		read += n
+		if err == io.EOF && n > 0 && at+int64(n) < s.last().end() {
+			continue
+		}
+		if err != nil {
+			return read, err
+		}
+	}
+	return read, nil
+}
+
+func (s *segmentStorage) Size() (int64, error) {
+	return s.last().end(), nil
+}
+
+func (s *segmentStorage) Sync() error {
+	return s.last().Sync()
+}
+
+// Truncate removes the segments that start at or past size, except the
+// first, and cuts the one size falls in. The manifest drops the segments
+// before their files are removed.
+func (s *segmentStorage) Truncate(size int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keep := len(s.segments)
+	for keep > 1 && s.segments[keep-1].base >= size {
+		keep--
+	}
+	if keep < len(s.segments) {
+		drop := make(map[int]bool)
+		for _, seg := range s.segments[keep:] {
+			drop[seg.id] = true
+		}
+		if err := writeManifest(s.name, s.ids(drop)); err != nil {
+			return err
+		}
+	}
+	for len(s.segments) > keep {
+		last := s.last()
+		s.segments = s.segments[:len(s.segments)-1]
+		if err := last.Close(); err != nil {
+			return err
+		}
+		if err := os.Remove(segmentName(s.name, last.id)); err != nil {
+			return err
+		}
+	}
+	last := s.last()
+	return last.Truncate(size - last.base)
+}
+
+// swap puts with, a copy of the i-th segment written to the file numbered
+// id, in its place, or removes the segment when with is nil, and moves the
+// segments after it down by the bytes that saves. It returns the segment
+// swapped out, for the caller to close and remove. The new manifest is
+// written first, so a crash before it leaves the old segment in place, and
+// one after it leaves a file the next open removes.
+func (s *segmentStorage) swap(i int, with *fileStorage, id int) (segment, error) {
+	old := s.segments[i]
+	ids := s.ids(nil)
+	if with == nil {
+		ids = append(ids[:i], ids[i+1:]...)
+	} else {
+		ids[i] = id
+	}
+	if err := writeManifest(s.name, ids); err != nil {
+		return segment{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if with == nil {
+		s.segments = append(s.segments[:i], s.segments[i+1:]...)
+	} else {
+		s.segments[i] = segment{fileStorage: with, base: old.base, id: id}
+	}
+	for j := i; j < len(s.segments); j++ {
+		s.segments[j].base = s.segments[j-1].end()
+	}
+	return old, nil
+}
+
+func (s *segmentStorage) Close() error {
+	var errs []error
+	for _, seg := range s.segments {
+		errs = append(errs, seg.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (s *segmentStorage) ReadLineFrom(offset int64) ([]byte, int64, error) {
+	s.mu.RLock()
+	seg := s.segments[s.find(offset)]
+	s.mu.RUnlock()
+	line, next, err := seg.ReadLineFrom(offset - seg.base)
+	return line, seg.base + next, err
+}
+
+func (s *segmentStorage) LinesFrom(offset int64, fn func(offset int64, line []byte) bool) error {
+	s.mu.RLock()
+	first := s.find(offset)
+	segments := s.segments[first:]
+	s.mu.RUnlock()
+	for i, seg := range segments {
+		local := int64(0)
+		if i == 0 {
+			local = offset - seg.base
+		}
+		stopped := false
+		err := seg.LinesFrom(local, func(offset int64, line []byte) bool {
+			if !fn(seg.base+offset, line) {
+				stopped = true
+			}
+			return !stopped
+		})
+		if err != nil || stopped {
+			return err
+		}
+	}
+	return nil
+}
+
+// TruncateToLastLine only looks at the last segment, since the ones before
+// it were synced before it was started.
+func (s *segmentStorage) TruncateToLastLine() (int64, error) {
+	return s.last().TruncateToLastLine()
+}
+
+// segmentBackend is the Backend of segmentStorage.
+type segmentBackend struct {
+	opts Options
+}
+
+func (b segmentBackend) Open(name string) (Storage, error) {
+	return openSegments(context.Background(), name, b.opts, false)
+}
+
+// replaceJournal records a Replace in progress, so a crash half way through
+// renaming the segments is finished on the next open instead of leaving a
+// mix of old and new ones. IDs holds the numbers of the segments of From in
+// order, which journals written before manifests leave out for 0 up to
+// Segments.
+type replaceJournal struct {
+	From     string `json:"from"`
+	Segments int    `json:"segments"`
+	IDs      []int  `json:"ids,omitempty"`
+}
+
+func journalPath(name string) string {
+	return name + ".replace"
+}
+
+// Replace renames the segments of from over those of to and removes the
+// segments of to beyond them. The journal written first makes it all or
+// nothing across a crash.
+func (b segmentBackend) Replace(from string, to string) error {
+	ids, err := segmentIDs(from)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(replaceJournal{From: from, Segments: len(ids), IDs: ids})
+	if err != nil {
+		return err
+	}
+	tmp := journalPath(to) + ".tmp"
+	if err := copyFile(tmp, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}); err != nil {
+		return err
+	}
+	if err := fslock.Replace(tmp, journalPath(to)); err != nil {
+		return err
+	}
+	return finishReplace(to)
+}
+
+func replacePending(name string) (bool, error) {
+	_, err := os.Stat(journalPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// finishReplace carries out the replacement journaled for name, if any. The
+// renames done before a crash are skipped, so it can run any number of
+// times. The segments of name end up numbered from zero on, so neither
+// storage is left with a manifest.
+func finishReplace(name string) error {
+	data, err := os.ReadFile(journalPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var j replaceJournal
+	if err := json.Unmarshal(data, &j); err != nil {
+		return fmt.Errorf("endor: %s: %w", journalPath(name), err)
+	}
+	if j.IDs == nil {
+		for i := 0; i < j.Segments; i++ {
+			j.IDs = append(j.IDs, i)
+		}
+	}
+	for i, id := range j.IDs {
+		src := segmentName(j.From, id)
+		if _, err := os.Stat(src); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err := fslock.Replace(src, segmentName(name, i)); err != nil {
+			return err
+		}
+	}
+	if err := removeSegments(name, len(j.IDs)); err != nil {
+		return err
+	}
+	if err := os.Remove(manifestPath(j.From)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Remove(journalPath(name))
+}
+
+// removeSegments removes the segment files of name numbered from on, and
+// its manifest, leaving the segments below from numbered without gaps.
+func removeSegments(name string, from int) error {
+	if err := os.Remove(manifestPath(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	files, err := segmentFiles(name)
+	if err != nil {
+		return err
+	}
+	for _, id := range files {
+		if id < from {
+			continue
+		}
+		if err := os.Remove(segmentName(name, id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b segmentBackend) Remove(name string) error {
+	if err := removeSegments(name, 1); err != nil {
+		return err
+	}
+	return fileBackend{}.Remove(name)
+}
@@ -0,0 +1,224 @@
+package endor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// fillSegments sets keys key-000 on with values long enough that a store
+// with SegmentSize 1 KiB spreads them over several segments.
+func fillSegments(t *testing.T, db *DB, keys int, value string, want map[string]string) {
+	t.Helper()
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("key-%03d", i)
+		if err := db.Set(key, []byte(value+strings.Repeat(".", 40))); err != nil {
+			t.Fatal(err)
+		}
+		want[key] = value + strings.Repeat(".", 40)
+	}
+}
+
+func TestSegments(t *testing.T) {
+	const keys = 100
+	opts := Options{SegmentSize: 1 << 10}
+	db, path := openTest(t, opts)
+	want := make(map[string]string)
+	fillSegments(t, db, keys, "first", want)
+	s := db.file.(*segmentStorage)
+	if len(s.segments) < 3 {
+		t.Fatalf("%d segments, want the records spread over several", len(s.segments))
+	}
+	for i, seg := range s.segments {
+		if seg.size > opts.SegmentSize {
+			t.Fatalf("segment %d holds %d bytes, past the limit", i, seg.size)
+		}
+		if i > 0 && seg.base != s.segments[i-1].end() {
+			t.Fatalf("segment %d starts at %d, want %d", i, seg.base, s.segments[i-1].end())
+		}
+		if _, err := os.Stat(segmentName(path, seg.id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A write larger than the limit gets a segment of its own.
+	big := strings.Repeat("b", 2<<10)
+	if err := db.Set("key-000", []byte(big)); err != nil {
+		t.Fatal(err)
+	}
+	want["key-000"] = big
+	if last := s.last(); last.size <= opts.SegmentSize {
+		t.Fatalf("the segment of a large write holds %d bytes", last.size)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The store is opened with its segments without SegmentSize too, from
+	// the checkpoint and replaying them all.
+	for _, when := range []string{"from the checkpoint", "replaying the segments"} {
+		db, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkKeys(t, db, keys, want, when)
+		if _, ok := db.file.(*segmentStorage); !ok {
+			t.Fatalf("%s: opened without segments", when)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(path + ".checkpoint"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Compact replaces the whole set with segments numbered from one on.
+	db, err := OpenWithOptions(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 1; i < keys; i++ {
+		if err := db.Delete(fmt.Sprintf("key-%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+		delete(want, fmt.Sprintf("key-%03d", i))
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	checkKeys(t, db, keys, want, "after Compact")
+	ids, err := segmentIDs(path)
+	if err != nil || fmt.Sprint(ids) != "[0 1]" {
+		t.Fatalf("segments after Compact = %v, %v, want [0 1]", ids, err)
+	}
+	if files, _ := segmentFiles(path + ".compact"); len(files) != 0 {
+		t.Fatalf("Compact left its copy's segments %v", files)
+	}
+}
+
+func TestSegmentManifestInterruptedUpdate(t *testing.T) {
+	const keys = 60
+	opts := Options{SegmentSize: 1 << 10}
+	db, path := openTest(t, opts)
+	want := make(map[string]string)
+	fillSegments(t, db, keys, "first", want)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	listed, err := segmentIDs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An update of the manifest that crashed before its rename leaves a
+	// half-written temporary file, which is not read, and a new segment
+	// file it did not list yet, which is removed.
+	tmp := manifestPath(path) + ".tmp"
+	if err := os.WriteFile(tmp, []byte(`{"segments":[0,1,`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	next := listed[len(listed)-1] + 1
+	if err := os.WriteFile(segmentName(path, next), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db, err = OpenWithOptions(path, opts)
+	if err != nil {
+		t.Fatalf("Open after an interrupted manifest update = %v", err)
+	}
+	checkKeys(t, db, keys, want, "after an interrupted manifest update")
+	if _, err := os.Stat(segmentName(path, next)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("unlisted segment left in place: %v", err)
+	}
+	// The next update replaces the leftover.
+	fillSegments(t, db, keys, "second", want)
+	if _, err := os.Stat(tmp); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("temporary manifest left after an update: %v", err)
+	}
+	checkKeys(t, db, keys, want, "after the next update")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A manifest that does not parse, or does not start with the data
+	// file, fails Open rather than losing segments.
+	saved, err := os.ReadFile(manifestPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, manifest := range []string{`{"segments":[0,`, `{"segments":[3,4]}`, `{"segments":[]}`} {
+		if err := os.WriteFile(manifestPath(path), []byte(manifest), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if db, err := OpenWithOptions(path, opts); err == nil {
+			db.Close()
+			t.Fatalf("Open with the manifest %s succeeded", manifest)
+		} else if !strings.Contains(err.Error(), manifestPath(path)) {
+			t.Fatalf("Open with the manifest %s = %v, want it named", manifest, err)
+		}
+	}
+	if err := os.WriteFile(manifestPath(path), saved, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db, err = OpenWithOptions(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	checkKeys(t, db, keys, want, "with the manifest restored")
+}
+
+func TestSegmentReplaceInterrupted(t *testing.T) {
+	const keys = 60
+	opts := Options{SegmentSize: 1 << 10}
+	db, path := openTest(t, opts)
+	fillSegments(t, db, keys, "old", make(map[string]string))
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A compaction that crashed after journaling its replacement, with
+	// the first segment of the copy already renamed into place.
+	copyPath := path + ".compact"
+	c, err := OpenWithOptions(copyPath, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[string]string)
+	fillSegments(t, c, keys/2, "new", want)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := segmentIDs(copyPath)
+	if err != nil || len(ids) < 2 {
+		t.Fatalf("copy has segments %v, %v, want several", ids, err)
+	}
+	journal, err := json.Marshal(replaceJournal{From: copyPath, Segments: len(ids), IDs: ids})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(journalPath(path), journal, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(copyPath, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenReadOnly(path, opts); err == nil || !strings.Contains(err.Error(), "interrupted compaction") {
+		t.Fatalf("OpenReadOnly with a replacement pending = %v", err)
+	}
+	db, err = OpenWithOptions(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	checkKeys(t, db, keys, want, "after finishing the replacement")
+	for _, leftover := range []string{journalPath(path), manifestPath(copyPath), segmentName(copyPath, ids[1])} {
+		if _, err := os.Stat(leftover); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("%s left after finishing the replacement: %v", leftover, err)
+		}
+	}
+}
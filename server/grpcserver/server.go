@@ -0,0 +1,141 @@
+// Package grpcserver serves an endor store over gRPC, with the Endor service
+// of proto/endor/v1, so clients generated from endor.proto in any language
+// can share a store a Go process holds open:
+//
+//	s := grpc.NewServer()
+//	endorv1.RegisterEndorServer(s, grpcserver.New(db))
+//	s.Serve(lis)
+//
+// As with package server, the service serves the DB it was given, which
+// stays owned by the caller. Authentication and TLS are left to the options
+// and interceptors of the grpc.Server.
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/aaydin-tr/endor"
+	endorv1 "github.com/aaydin-tr/endor/proto/endor/v1"
+)
+
+// Server implements endorv1.EndorServer on a DB.
+type Server struct {
+	endorv1.UnimplementedEndorServer
+	db *endor.DB
+}
+
+// New returns a service serving db.
+func New(db *endor.DB) *Server {
+	return &Server{db: db}
+}
+
+func (s *Server) Get(ctx context.Context, req *endorv1.GetRequest) (*endorv1.GetResponse, error) {
+	value, err := s.db.GetContext(ctx, req.GetKey())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &endorv1.GetResponse{Value: value}, nil
+}
+
+func (s *Server) Set(ctx context.Context, req *endorv1.SetRequest) (*endorv1.SetResponse, error) {
+	var err error
+	switch ttl := req.GetTtlMs(); {
+	case ttl < 0:
+		return nil, status.Error(codes.InvalidArgument, "ttl_ms is negative")
+	case ttl > 0:
+		err = s.db.SetWithTTL(req.GetKey(), req.GetValue(), time.Duration(ttl)*time.Millisecond)
+	default:
+		err = s.db.SetContext(ctx, req.GetKey(), req.GetValue())
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &endorv1.SetResponse{}, nil
+}
+
+func (s *Server) Delete(ctx context.Context, req *endorv1.DeleteRequest) (*endorv1.DeleteResponse, error) {
+	if err := s.db.DeleteContext(ctx, req.GetKey()); err != nil {
+		return nil, toStatus(err)
+	}
+	return &endorv1.DeleteResponse{}, nil
+}
+
+// Scan streams the matching keys in order. Keys deleted while the scan runs
+// are left out.
+func (s *Server) Scan(req *endorv1.ScanRequest, stream endorv1.Endor_ScanServer) error {
+	ctx := stream.Context()
+	it := s.db.Scan(req.GetPrefix())
+	for it.Next() {
+		if err := ctx.Err(); err != nil {
+			return toStatus(err)
+		}
+		value, err := it.Value()
+		if errors.Is(err, endor.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return toStatus(err)
+		}
+		if err := stream.Send(&endorv1.Item{Key: it.Key(), Value: value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Watch streams the writes to the matching keys until the call is cancelled,
+// or ends it once the store is closed.
+func (s *Server) Watch(req *endorv1.WatchRequest, stream endorv1.Endor_WatchServer) error {
+	ctx := stream.Context()
+	events, cancel := s.db.Watch(req.GetPrefix())
+	defer cancel()
+	for {
+		select {
+		case <-ctx.Done():
+			return toStatus(ctx.Err())
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(&endorv1.Event{Type: eventType(e.Type), Key: e.Key, Value: e.Value}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func eventType(t endor.EventType) endorv1.Event_Type {
+	switch t {
+	case endor.EventSet:
+		return endorv1.Event_TYPE_SET
+	case endor.EventDelete:
+		return endorv1.Event_TYPE_DELETE
+	case endor.EventMerge:
+		return endorv1.Event_TYPE_MERGE
+	}
+	return endorv1.Event_TYPE_UNSPECIFIED
+}
+
+// toStatus maps the errors of the store to gRPC status codes.
+func toStatus(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	case errors.Is(err, endor.ErrKeyNotFound):
+		code = codes.NotFound
+	case errors.Is(err, endor.ErrEmptyKey), errors.Is(err, endor.ErrInvalidKey),
+		errors.Is(err, endor.ErrKeyTooLarge), errors.Is(err, endor.ErrValueTooLarge):
+		code = codes.InvalidArgument
+	case errors.Is(err, endor.ErrReadOnly):
+		code = codes.FailedPrecondition
+	case errors.Is(err, endor.ErrClosed):
+		code = codes.Unavailable
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,124 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/aaydin-tr/endor"
+	endorv1 "github.com/aaydin-tr/endor/proto/endor/v1"
+)
+
+func serve(t *testing.T) (endorv1.EndorClient, *endor.DB) {
+	t.Helper()
+	db, err := endor.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	endorv1.RegisterEndorServer(s, New(db))
+	go s.Serve(lis)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		s.Stop()
+		db.Close()
+	})
+	return endorv1.NewEndorClient(conn), db
+}
+
+func TestServer(t *testing.T) {
+	client, db := serve(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	watch, err := client.Watch(ctx, &endorv1.WatchRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The watch starts once the server handles the call, so write until
+	// it sees a write, and skip those writes from then on.
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+				db.Set("ping", nil)
+			}
+		}
+	}()
+	recv := func() (*endorv1.Event, error) {
+		for {
+			e, err := watch.Recv()
+			if err != nil || e.Key != "ping" {
+				return e, err
+			}
+		}
+	}
+	if _, err := watch.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	close(stop)
+
+	for _, key := range []string{"user/2", "user/1", "other"} {
+		if _, err := client.Set(ctx, &endorv1.SetRequest{Key: key, Value: []byte("v-" + key)}); err != nil {
+			t.Fatal(err)
+		}
+		e, err := recv()
+		if err != nil || e.Type != endorv1.Event_TYPE_SET || e.Key != key || string(e.Value) != "v-"+key {
+			t.Fatalf("Watch = %v, %v", e, err)
+		}
+	}
+
+	got, err := client.Get(ctx, &endorv1.GetRequest{Key: "user/1"})
+	if err != nil || string(got.Value) != "v-user/1" {
+		t.Fatalf("Get = %v, %v", got, err)
+	}
+	scan, err := client.Scan(ctx, &endorv1.ScanRequest{Prefix: "user/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for {
+		item, err := scan.Recv()
+		if err != nil {
+			break
+		}
+		keys = append(keys, item.Key)
+	}
+	if len(keys) != 2 || keys[0] != "user/1" || keys[1] != "user/2" {
+		t.Fatalf("Scan = %q", keys)
+	}
+
+	if _, err := client.Delete(ctx, &endorv1.DeleteRequest{Key: "user/1"}); err != nil {
+		t.Fatal(err)
+	}
+	if e, err := recv(); err != nil || e.Type != endorv1.Event_TYPE_DELETE || e.Key != "user/1" {
+		t.Fatalf("Watch = %v, %v", e, err)
+	}
+	if _, err := client.Get(ctx, &endorv1.GetRequest{Key: "user/1"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("Get after Delete = %v, want NotFound", err)
+	}
+	if _, err := client.Set(ctx, &endorv1.SetRequest{Key: ""}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Set of an empty key = %v, want InvalidArgument", err)
+	}
+	if _, err := client.Set(ctx, &endorv1.SetRequest{Key: "ttl", TtlMs: -1}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Set with a negative ttl = %v, want InvalidArgument", err)
+	}
+}
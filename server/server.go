@@ -0,0 +1,211 @@
+// Package server exposes an endor store over HTTP, so services written in
+// other languages can share a store a Go process holds open:
+//
+//	GET    /keys/{key}       returns the value as the response body
+//	PUT    /keys/{key}       stores the request body, for ?ttl=1m if given
+//	DELETE /keys/{key}       removes the key
+//	GET    /scan?prefix={p}  lists the keys starting with p and their values
+//
+// Keys may contain slashes, escaped as %2F or not. The handler serves the DB
+// it was given, so the process keeps a single lock on the data file.
+// Package server/grpcserver serves the same operations, and Watch, over
+// gRPC.
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aaydin-tr/endor"
+)
+
+// Options configures a Server created with New.
+type Options struct {
+	// Username and Password require HTTP basic authentication with these
+	// credentials on every request. An empty Username serves without
+	// authentication.
+	Username string
+	Password string
+
+	// MaxValueBytes rejects PUT bodies larger than this with 413 Request
+	// Entity Too Large. Zero selects DefaultMaxValueBytes.
+	MaxValueBytes int64
+}
+
+const DefaultMaxValueBytes = 32 << 20
+
+// Server is an http.Handler serving a DB.
+type Server struct {
+	db   *endor.DB
+	opts Options
+}
+
+// New returns a handler serving db, which stays owned by the caller: closing
+// the handler's http.Server leaves it open.
+func New(db *endor.DB, opts Options) *Server {
+	if opts.MaxValueBytes <= 0 {
+		opts.MaxValueBytes = DefaultMaxValueBytes
+	}
+	return &Server{db: db, opts: opts}
+}
+
+// Item is one key and value of a /scan response. The value is base64 encoded
+// in JSON.
+type Item struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="endor"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	path := r.URL.EscapedPath()
+	switch {
+	case strings.HasPrefix(path, "/keys/"):
+		key, err := url.PathUnescape(strings.TrimPrefix(path, "/keys/"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.serveKey(w, r, key)
+	case path == "/scan":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		s.serveScan(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) serveKey(w http.ResponseWriter, r *http.Request, key string) {
+	ctx := r.Context()
+	switch r.Method {
+	case http.MethodGet:
+		value, err := s.db.GetContext(ctx, key)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(value)
+	case http.MethodPut:
+		var ttl time.Duration
+		if v := r.URL.Query().Get("ttl"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				http.Error(w, "invalid ttl: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			ttl = d
+		}
+		value, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.opts.MaxValueBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ttl > 0 {
+			err = s.db.SetWithTTL(key, value, ttl)
+		} else {
+			err = s.db.SetContext(ctx, key, value)
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if err := s.db.DeleteContext(ctx, key); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// serveScan writes the matching keys as a JSON array, streaming it so a
+// large scan is not held in memory. Keys deleted while the scan runs are
+// left out.
+func (s *Server) serveScan(w http.ResponseWriter, r *http.Request) {
+	it := s.db.Scan(r.URL.Query().Get("prefix"))
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	io.WriteString(w, "[")
+	first := true
+	for it.Next() {
+		if r.Context().Err() != nil {
+			return
+		}
+		value, err := it.Value()
+		if errors.Is(err, endor.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			// The status line is already out, so all that is left is
+			// to cut the response short as invalid JSON.
+			return
+		}
+		if !first {
+			io.WriteString(w, ",")
+		}
+		first = false
+		enc.Encode(Item{Key: it.Key(), Value: value})
+	}
+	io.WriteString(w, "]\n")
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if s.opts.Username == "" {
+		return true
+	}
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	// Comparing digests keeps the comparison constant time even when the
+	// lengths differ.
+	wantUser, wantPass := sha256.Sum256([]byte(s.opts.Username)), sha256.Sum256([]byte(s.opts.Password))
+	gotUser, gotPass := sha256.Sum256([]byte(user)), sha256.Sum256([]byte(pass))
+	userOK := subtle.ConstantTimeCompare(gotUser[:], wantUser[:])
+	passOK := subtle.ConstantTimeCompare(gotPass[:], wantPass[:])
+	return userOK&passOK == 1
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+}
+
+// writeError maps the errors of the store to HTTP statuses.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, endor.ErrKeyNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, endor.ErrEmptyKey), errors.Is(err, endor.ErrInvalidKey):
+		status = http.StatusBadRequest
+	case errors.Is(err, endor.ErrReadOnly):
+		status = http.StatusForbidden
+	case errors.Is(err, endor.ErrClosed):
+		status = http.StatusServiceUnavailable
+	}
+	http.Error(w, err.Error(), status)
+}
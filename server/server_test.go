@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aaydin-tr/endor"
+)
+
+func serve(t *testing.T, opts Options) (*httptest.Server, *endor.DB) {
+	t.Helper()
+	db, err := endor.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(New(db, opts))
+	t.Cleanup(func() {
+		srv.Close()
+		db.Close()
+	})
+	return srv, db
+}
+
+// do sends a request and returns its status and body.
+func do(t *testing.T, method, url, body string, configure ...func(*http.Request)) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range configure {
+		c(req)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(data)
+}
+
+func TestKeys(t *testing.T) {
+	srv, db := serve(t, Options{})
+	if code, _ := do(t, http.MethodPut, srv.URL+"/keys/dir/a", "one"); code != http.StatusNoContent {
+		t.Fatalf("PUT = %d", code)
+	}
+	// Slashes in keys may be escaped or not.
+	if code, body := do(t, http.MethodGet, srv.URL+"/keys/dir%2Fa", ""); code != http.StatusOK || body != "one" {
+		t.Fatalf("GET = %d %q", code, body)
+	}
+	if value, err := db.Get("dir/a"); err != nil || string(value) != "one" {
+		t.Fatalf("the store holds %q, %v", value, err)
+	}
+	if code, _ := do(t, http.MethodPut, srv.URL+"/keys/tmp?ttl=1ms", "x"); code != http.StatusNoContent {
+		t.Fatalf("PUT with a ttl = %d", code)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if code, _ := do(t, http.MethodGet, srv.URL+"/keys/tmp", ""); code != http.StatusNotFound {
+		t.Fatalf("GET of an expired key = %d, want 404", code)
+	}
+	if code, _ := do(t, http.MethodDelete, srv.URL+"/keys/dir/a", ""); code != http.StatusNoContent {
+		t.Fatalf("DELETE = %d", code)
+	}
+	if code, _ := do(t, http.MethodGet, srv.URL+"/keys/dir/a", ""); code != http.StatusNotFound {
+		t.Fatalf("GET of a deleted key = %d, want 404", code)
+	}
+
+	for _, c := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPut, "/keys/", "v", http.StatusBadRequest},
+		{http.MethodPut, "/keys/a?ttl=soon", "v", http.StatusBadRequest},
+		{http.MethodPost, "/keys/a", "v", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/scan", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/elsewhere", "", http.StatusNotFound},
+	} {
+		if code, body := do(t, c.method, srv.URL+c.path, c.body); code != c.want {
+			t.Fatalf("%s %s = %d %q, want %d", c.method, c.path, code, body, c.want)
+		}
+	}
+
+	// A closed store is unavailable rather than broken.
+	db.Close()
+	if code, _ := do(t, http.MethodGet, srv.URL+"/keys/a", ""); code != http.StatusServiceUnavailable {
+		t.Fatalf("GET from a closed store = %d, want 503", code)
+	}
+}
+
+func TestMaxValueBytes(t *testing.T) {
+	srv, _ := serve(t, Options{MaxValueBytes: 4})
+	if code, _ := do(t, http.MethodPut, srv.URL+"/keys/a", "four"); code != http.StatusNoContent {
+		t.Fatalf("PUT at the limit = %d", code)
+	}
+	if code, _ := do(t, http.MethodPut, srv.URL+"/keys/a", "fives"); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("PUT over the limit = %d, want 413", code)
+	}
+}
+
+func TestScan(t *testing.T) {
+	srv, db := serve(t, Options{})
+	for _, key := range []string{"user:b", "user:a", "other"} {
+		if err := db.Set(key, []byte("v "+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	code, body := do(t, http.MethodGet, srv.URL+"/scan?prefix=user:", "")
+	var items []Item
+	if err := json.Unmarshal([]byte(body), &items); code != http.StatusOK || err != nil {
+		t.Fatalf("scan = %d %q, %v", code, body, err)
+	}
+	if len(items) != 2 || items[0].Key != "user:a" || string(items[0].Value) != "v user:a" || items[1].Key != "user:b" {
+		t.Fatalf("scan returned %+v", items)
+	}
+	if _, body := do(t, http.MethodGet, srv.URL+"/scan?prefix=none", ""); strings.TrimSpace(body) != "[]" {
+		t.Fatalf("empty scan = %q, want []", body)
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	srv, _ := serve(t, Options{Username: "admin", Password: "secret"})
+	for _, c := range []struct {
+		user, pass string
+		want       int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"admin", "wrong", http.StatusUnauthorized},
+		{"other", "secret", http.StatusUnauthorized},
+		{"admin", "secret", http.StatusNotFound},
+	} {
+		code, _ := do(t, http.MethodGet, srv.URL+"/keys/missing", "", func(r *http.Request) {
+			if c.user != "" {
+				r.SetBasicAuth(c.user, c.pass)
+			}
+		})
+		if code != c.want {
+			t.Fatalf("GET as %q/%q = %d, want %d", c.user, c.pass, code, c.want)
+		}
+	}
+}
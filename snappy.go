@@ -0,0 +1,163 @@
+package endor
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Values are compressed with CompressionSnappy in the Snappy block format,
+// which other implementations read and write too, so a record copied out of
+// a data file can be decoded elsewhere. The encoder is the plain greedy one:
+// it looks up every 4 bytes in a table of where they last started, and copies
+// the bytes a match there extends to. Copies only reach back 64 KiB, so they
+// fit the 1 and 2 byte offsets of the format.
+
+const (
+	snappyTableBits  = 14
+	snappyMaxOffset  = 1<<16 - 1
+	snappyMinEncoded = 17
+)
+
+var errSnappyCorrupt = errors.New("snappy: corrupt input")
+
+// snappyEncode returns src in the Snappy block format.
+func snappyEncode(src []byte) []byte {
+	dst := binary.AppendUvarint(make([]byte, 0, len(src)+len(src)/6+16), uint64(len(src)))
+	if len(src) < snappyMinEncoded {
+		return snappyLiteral(dst, src)
+	}
+	// table holds where each hash of 4 bytes last started, plus one, so
+	// zero is a hash not seen yet.
+	var table [1 << snappyTableBits]int32
+	lit := 0
+	for s := 0; s+4 <= len(src); {
+		v := binary.LittleEndian.Uint32(src[s:])
+		h := (v * 0x1e35a7bd) >> (32 - snappyTableBits)
+		candidate := int(table[h]) - 1
+		table[h] = int32(s + 1)
+		if candidate < 0 || s-candidate > snappyMaxOffset || binary.LittleEndian.Uint32(src[candidate:]) != v {
+			s++
+			continue
+		}
+		dst = snappyLiteral(dst, src[lit:s])
+		n := 4
+		for s+n < len(src) && src[candidate+n] == src[s+n] {
+			n++
+		}
+		dst = snappyCopy(dst, s-candidate, n)
+		s += n
+		lit = s
+	}
+	return snappyLiteral(dst, src[lit:])
+}
+
+// snappyLiteral appends the literal lit to dst.
+func snappyLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+	n := uint32(len(lit) - 1)
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2)
+	case n < 1<<8:
+		dst = append(dst, 60<<2, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+// snappyCopy appends a copy of the n bytes starting offset bytes back to
+// dst, n being at least 4 and offset at most snappyMaxOffset.
+func snappyCopy(dst []byte, offset, n int) []byte {
+	for n >= 68 {
+		dst = append(dst, 63<<2|2, byte(offset), byte(offset>>8))
+		n -= 64
+	}
+	if n > 64 {
+		dst = append(dst, 59<<2|2, byte(offset), byte(offset>>8))
+		n -= 60
+	}
+	if n >= 12 || offset >= 2048 {
+		return append(dst, byte(n-1)<<2|2, byte(offset), byte(offset>>8))
+	}
+	return append(dst, byte(offset>>8)<<5|byte(n-4)<<2|1, byte(offset))
+}
+
+// snappyDecode returns the bytes src holds in the Snappy block format.
+func snappyDecode(src []byte) ([]byte, error) {
+	size, read := binary.Uvarint(src)
+	// Every byte of input decodes to at most 64/3 bytes, so a length past
+	// that is damage rather than a value to allocate for.
+	if read <= 0 || size > uint64(len(src))*22 {
+		return nil, errSnappyCorrupt
+	}
+	src = src[read:]
+	dst := make([]byte, 0, size)
+	for len(src) > 0 {
+		tag := src[0]
+		var offset, n int
+		switch tag & 3 {
+		case 0:
+			n = int(tag >> 2)
+			src = src[1:]
+			if n >= 60 {
+				extra := n - 59
+				if len(src) < extra {
+					return nil, errSnappyCorrupt
+				}
+				n = 0
+				for i := extra - 1; i >= 0; i-- {
+					n = n<<8 | int(src[i])
+				}
+				src = src[extra:]
+			}
+			n++
+			if n > len(src) || uint64(len(dst)+n) > size {
+				return nil, errSnappyCorrupt
+			}
+			dst = append(dst, src[:n]...)
+			src = src[n:]
+			continue
+		case 1:
+			if len(src) < 2 {
+				return nil, errSnappyCorrupt
+			}
+			n = int(tag>>2&7) + 4
+			offset = int(tag>>5)<<8 | int(src[1])
+			src = src[2:]
+		case 2:
+			if len(src) < 3 {
+				return nil, errSnappyCorrupt
+			}
+			n = int(tag>>2) + 1
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case 3:
+			if len(src) < 5 {
+				return nil, errSnappyCorrupt
+			}
+			n = int(tag>>2) + 1
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+		if offset <= 0 || offset > len(dst) || uint64(len(dst)+n) > size {
+			return nil, errSnappyCorrupt
+		}
+		// The copy may overlap the bytes it appends, so it goes a byte at
+		// a time.
+		from := len(dst) - offset
+		for i := 0; i < n; i++ {
+			dst = append(dst, dst[from+i])
+		}
+	}
+	if uint64(len(dst)) != size {
+		return nil, errSnappyCorrupt
+	}
+	return dst, nil
+}
@@ -0,0 +1,91 @@
+package endor
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/aaydin-tr/endor/internal/fslock"
+)
+
+// Snapshot writes a consistent copy of the data file to w. It only holds the
+// lock long enough to note where the file ends, then streams everything up
+// to that offset while writes continue to append past it. Compaction is held
+// off until the copy finishes.
+func (db *DB) Snapshot(w io.Writer) (n int64, err error) {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return 0, ErrClosed
+	}
+	file, end := db.file, db.size
+	db.snapshots++
+	db.mu.Unlock()
+
+	defer func() {
+		db.mu.Lock()
+		db.snapshots--
+		db.mu.Unlock()
+	}()
+	return io.Copy(w, io.NewSectionReader(file, 0, end))
+}
+
+// BackupTo writes a snapshot to path, replacing any file there only once the
+// copy is complete and synced.
+func (db *DB) BackupTo(path string) error {
+	tmp := path + ".tmp"
+	if err := copyFile(tmp, func(w io.Writer) error {
+		_, err := db.Snapshot(w)
+		return err
+	}); err != nil {
+		return err
+	}
+	return fslock.Replace(tmp, path)
+}
+
+// OpenFromBackup restores the store at path from the backup written by
+// BackupTo or Snapshot, replacing whatever data file is at path, and opens
+// it. The backup itself is left untouched, and lands in a single data file
+// even if the store had segments.
+func OpenFromBackup(backup string, path string, opts Options) (*DB, error) {
+	src, err := os.Open(backup)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	tmp := path + ".restore"
+	if err := copyFile(tmp, func(w io.Writer) error {
+		_, err := io.Copy(w, src)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if err := fslock.Replace(tmp, path); err != nil {
+		return nil, errors.Join(err, os.Remove(tmp))
+	}
+	if err := removeSegments(path, 1); err != nil {
+		return nil, err
+	}
+	return OpenWithOptions(path, opts)
+}
+
+// copyFile creates path, fills it with fill and syncs it. The file is
+// removed if any step fails.
+func copyFile(path string, fill func(w io.Writer) error) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	err = fill(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Join(err, os.Remove(path))
+	}
+	return nil
+}
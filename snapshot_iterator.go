@@ -0,0 +1,221 @@
+package endor
+
+import (
+	"errors"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SnapshotIterator walks the keys and values of a store as they were when
+// it was created. Unlike Iterator it holds on to the records themselves:
+// writes, deletes and compactions since do not show, and reading values
+// takes no lock on the store. It reads the data file through handles of
+// its own, so a compaction replaces the file as usual while the old one
+// lives on, unlinked, until the iterators reading it are closed. Close must
+// be called.
+type SnapshotIterator struct {
+	db *DB
+	// view is a detached DB over the data file the iterator reads, which
+	// decodes its records as the store did when the iterator was created,
+	// even after a compaction or Rekey changed the format or key of the
+	// live one.
+	view *DB
+	// detached is set when the iterator reads through its own handles.
+	// Otherwise it reads the data file of the store and holds off
+	// compaction until it is closed.
+	detached bool
+
+	keys    []string
+	entries []entry
+	merges  [][]entry
+	pos     int
+	closed  bool
+}
+
+// NewSnapshotIterator returns a snapshot iterator over the keys starting
+// with prefix. Where the data file can not be replaced while open, on
+// Windows, and with a Storage other than the built-in ones, Compact fails
+// with ErrSnapshot until the iterator is closed, as it does during a
+// Snapshot.
+func (db *DB) NewSnapshotIterator(prefix string) (*SnapshotIterator, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	file, err := db.detach()
+	if err != nil {
+		return nil, err
+	}
+	it := &SnapshotIterator{db: db, pos: -1, detached: file != nil}
+	if file == nil {
+		file = db.file
+		db.iterators++
+	}
+	it.view = &DB{path: db.path, opts: db.opts, file: file, format: db.format, opener: db.opener}
+
+	now := time.Now().UnixNano()
+	for key, e := range db.index {
+		if !e.expired(now) && strings.HasPrefix(key, prefix) && !isBucketKey(key) {
+			it.keys = append(it.keys, key)
+		}
+	}
+	sort.Strings(it.keys)
+	it.entries = make([]entry, len(it.keys))
+	it.merges = make([][]entry, len(it.keys))
+	for i, key := range it.keys {
+		it.entries[i], it.merges[i] = db.index[key], db.merges[key]
+	}
+	return it, nil
+}
+
+// Next advances to the next key, reporting false once the keys are
+// exhausted.
+func (it *SnapshotIterator) Next() bool {
+	if it.closed {
+		return false
+	}
+	if it.pos < len(it.keys) {
+		it.pos++
+	}
+	return it.pos < len(it.keys)
+}
+
+// Key returns the current key.
+func (it *SnapshotIterator) Key() string {
+	return it.keys[it.pos]
+}
+
+// Value returns the value the current key had when the iterator was
+// created.
+func (it *SnapshotIterator) Value() ([]byte, error) {
+	if it.closed {
+		return nil, ErrClosed
+	}
+	r, err := it.view.readMerged(it.keys[it.pos], it.entries[it.pos], it.merges[it.pos], math.MaxUint64)
+	if err != nil {
+		return nil, err
+	}
+	return r.Value, nil
+}
+
+// Close releases the data file the iterator reads. Closing it again is a
+// no-op.
+func (it *SnapshotIterator) Close() error {
+	if it.closed {
+		return nil
+	}
+	it.closed = true
+	if it.detached {
+		return it.view.file.Close()
+	}
+	it.db.mu.Lock()
+	it.db.iterators--
+	it.db.mu.Unlock()
+	return nil
+}
+
+// detach returns a Storage reading the data file as it is now that a
+// compaction does not take away, or nil where there is none. A memory
+// storage is left alone by compaction anyway, so it is its own. Callers
+// hold db.mu.
+func (db *DB) detach() (Storage, error) {
+	if s, ok := db.file.(*memoryStorage); ok {
+		return s, nil
+	}
+	if runtime.GOOS == "windows" {
+		return nil, nil
+	}
+	var names []string
+	var bases []int64
+	switch s := db.file.(type) {
+	case *fileStorage:
+		if err := s.flush(); err != nil {
+			return nil, err
+		}
+		names, bases = []string{db.path}, []int64{0}
+	case *segmentStorage:
+		if err := s.last().flush(); err != nil {
+			return nil, err
+		}
+		s.mu.RLock()
+		for _, seg := range s.segments {
+			names = append(names, segmentName(s.name, seg.id))
+			bases = append(bases, seg.base)
+		}
+		s.mu.RUnlock()
+	default:
+		return nil, nil
+	}
+	v := &fileView{bases: bases, size: db.size}
+	for _, name := range names {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, errors.Join(err, v.Close())
+		}
+		v.files = append(v.files, f)
+	}
+	return v, nil
+}
+
+// fileView is a read-only Storage over the files of a data file, read
+// through handles of its own up to the size it had when opened.
+type fileView struct {
+	files []*os.File
+	// bases holds the offset each file starts at.
+	bases []int64
+	size  int64
+}
+
+func (v *fileView) ReadAt(p []byte, off int64) (int, error) {
+	if off >= v.size {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > v.size-off {
+		n, _ := v.ReadAt(p[:v.size-off], off)
+		return n, io.EOF
+	}
+	read := 0
+	for read < len(p) {
+		at := off + int64(read)
+		i := sort.Search(len(v.bases), func(i int) bool { return v.bases[i] > at }) - 1
+		n, err := v.files[i].ReadAt(p[read:], at-v.bases[i])
+		read += n
+		if err == io.EOF && n > 0 && i+1 < len(v.files) {
+			continue
+		}
+		if err != nil {
+			return read, err
+		}
+	}
+	return read, nil
+}
+
+func (v *fileView) Size() (int64, error) {
+	return v.size, nil
+}
+
+func (v *fileView) Append(bufs ...[]byte) (int64, error) {
+	return 0, ErrReadOnly
+}
+
+func (v *fileView) Sync() error {
+	return nil
+}
+
+func (v *fileView) Truncate(size int64) error {
+	return ErrReadOnly
+}
+
+func (v *fileView) Close() error {
+	var errs []error
+	for _, f := range v.files {
+		errs = append(errs, f.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,156 @@
+package endor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// snapshotOf returns what it holds as "key=value" strings and closes it.
+func snapshotOf(t *testing.T, it *SnapshotIterator) []string {
+	t.Helper()
+	var got []string
+	for it.Next() {
+		value, err := it.Value()
+		if err != nil {
+			t.Fatalf("Value of %s = %v", it.Key(), err)
+		}
+		got = append(got, it.Key()+"="+string(value))
+	}
+	if err := it.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestSnapshotIterator(t *testing.T) {
+	for _, segments := range []bool{false, true} {
+		t.Run(fmt.Sprintf("segments=%v", segments), func(t *testing.T) {
+			opts := Options{Merger: appendMerger{}}
+			if segments {
+				opts.SegmentSize = 1 << 10
+			}
+			db, _ := openTest(t, opts)
+			for _, key := range []string{"a:1", "a:2", "a:3", "b:1"} {
+				// Values large enough to fill several segments.
+				if err := db.Set(key, append([]byte("value of "+key), make([]byte, 400)...)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := db.Merge("a:3", []byte("+m")); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Bucket("a").Set("x", []byte("in a bucket")); err != nil {
+				t.Fatal(err)
+			}
+			it, err := db.NewSnapshotIterator("a:")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Writes, deletes and a compaction since do not show.
+			if err := db.Set("a:1", []byte("changed")); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Delete("a:2"); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Set("a:4", []byte("new")); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Compact(); err != nil {
+				t.Fatalf("Compact during a snapshot iterator = %v", err)
+			}
+			want := []string{"a:1=value of a:1", "a:2=value of a:2", "a:3=value of a:3,+m"}
+			got := snapshotOf(t, it)
+			for i := range got {
+				got[i] = strings.ReplaceAll(got[i], "\x00", "")
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("snapshot iterator read %q, want %q", got, want)
+			}
+			if got, err := db.Get("a:1"); err != nil || string(got) != "changed" {
+				t.Fatalf("Get after the iterator = %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestSnapshotIteratorAcrossRekey(t *testing.T) {
+	oldKey, newKey := bytes.Repeat([]byte("o"), 32), bytes.Repeat([]byte("n"), 32)
+	db, _ := openTest(t, Options{EncryptionKey: oldKey})
+	if err := db.Set("a", []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	it, err := db.NewSnapshotIterator("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The iterator still decrypts with the key the records were written
+	// under.
+	if err := db.Rekey(newKey); err != nil {
+		t.Fatalf("Rekey during a snapshot iterator = %v", err)
+	}
+	if got := snapshotOf(t, it); fmt.Sprint(got) != "[a=secret]" {
+		t.Fatalf("snapshot iterator after Rekey read %q", got)
+	}
+}
+
+func TestSnapshotIteratorClose(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	if err := db.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	it, err := db.NewSnapshotIterator("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !it.Next() {
+		t.Fatal("snapshot iterator is empty")
+	}
+	if err := it.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := it.Value(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Value after Close = %v, want ErrClosed", err)
+	}
+	if it.Next() {
+		t.Fatal("Next after Close reported a key")
+	}
+	if err := it.Close(); err != nil {
+		t.Fatalf("second Close = %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.NewSnapshotIterator(""); !errors.Is(err, ErrClosed) {
+		t.Fatalf("NewSnapshotIterator on a closed store = %v, want ErrClosed", err)
+	}
+}
+
+func TestSnapshotIteratorHoldsOffCompaction(t *testing.T) {
+	// A Storage the iterator can not read through handles of its own
+	// keeps the store from compacting until it is closed.
+	db, _ := openTest(t, Options{Storage: newTestBackend()})
+	if err := db.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	it, err := db.NewSnapshotIterator("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Compact(); !errors.Is(err, ErrSnapshot) {
+		t.Fatalf("Compact during a snapshot iterator = %v, want ErrSnapshot", err)
+	}
+	if err := db.Set("a", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if got := snapshotOf(t, it); fmt.Sprint(got) != "[a=1]" {
+		t.Fatalf("snapshot iterator read %q", got)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Compact after Close = %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package endor
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// duringWrite calls fn before its first write reaches buf.
+type duringWrite struct {
+	buf bytes.Buffer
+	fn  func()
+}
+
+func (w *duringWrite) Write(p []byte) (int, error) {
+	if w.fn != nil {
+		w.fn()
+		w.fn = nil
+	}
+	return w.buf.Write(p)
+}
+
+func TestSnapshotIsPointInTime(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	if err := db.Set("before", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	// Writes carry on while the copy streams, and compaction waits.
+	var compactErr error
+	w := &duringWrite{fn: func() {
+		if err := db.Set("during", []byte("2")); err != nil {
+			t.Error(err)
+		}
+		compactErr = db.Compact()
+	}}
+	if _, err := db.Snapshot(w); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(compactErr, ErrSnapshot) {
+		t.Fatalf("Compact during a snapshot = %v, want ErrSnapshot", compactErr)
+	}
+
+	backup := filepath.Join(t.TempDir(), "backup")
+	if err := os.WriteFile(backup, w.buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := OpenFromBackup(backup, filepath.Join(t.TempDir(), "restored.db"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	if got, err := restored.Get("before"); err != nil || string(got) != "1" {
+		t.Fatalf("Get(before) from the snapshot = %q, %v", got, err)
+	}
+	if _, err := restored.Get("during"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get(during) from the snapshot = %v, want ErrKeyNotFound", err)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Compact after the snapshot = %v", err)
+	}
+}
+
+func TestBackupToAndOpenFromBackup(t *testing.T) {
+	db, path := openTest(t, Options{})
+	want := map[string]string{"a": "1", "b": "2"}
+	for key, value := range want {
+		if err := db.Set(key, []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backup := filepath.Join(t.TempDir(), "backup")
+	if err := db.BackupTo(backup); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(backup + ".tmp"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("BackupTo left its temporary file: %v", err)
+	}
+	saved, err := os.ReadFile(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set("a", []byte("changed")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restoring replaces the data file at path and leaves the backup as
+	// it was.
+	db, err = OpenFromBackup(backup, path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	checkKeys(t, db, len(want), want, "after OpenFromBackup")
+	if data, err := os.ReadFile(backup); err != nil || !bytes.Equal(data, saved) {
+		t.Fatalf("OpenFromBackup changed the backup: %v", err)
+	}
+}
+
+func TestBackupErrors(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	if err := db.Set("k", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing", "backup")
+	if err := db.BackupTo(missing); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("BackupTo a missing directory = %v", err)
+	}
+	if _, err := OpenFromBackup(missing, filepath.Join(t.TempDir(), "restored.db"), Options{}); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("OpenFromBackup of a missing backup = %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Snapshot(&bytes.Buffer{}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Snapshot of a closed store = %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,60 @@
+package endor
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/aaydin-tr/endor/internal/fslock"
+)
+
+// writeState persists v as JSON to path, replacing the previous state only
+// once the new one is complete. An encrypted store seals the file, since it
+// holds keys and, for secondary indexes, parts of values.
+func (db *DB) writeState(path string, v any) error {
+	if db.inMemory {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if db.sealer != nil {
+		if data, err = seal(db.sealer, data, nil); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	if err := copyFile(tmp, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}); err != nil {
+		return err
+	}
+	return fslock.Replace(tmp, path)
+}
+
+// readState loads the state writeState saved at path into v and reports
+// whether there was one. State that can not be read back, because it is
+// damaged or sealed under another key, is reported as missing so it is
+// rebuilt from the data file.
+func (db *DB) readState(path string, v any) (bool, error) {
+	if db.inMemory {
+		return false, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if db.opener != nil {
+		if data, err = open(db.opener, data, nil); err != nil {
+			return false, nil
+		}
+	}
+	return json.Unmarshal(data, v) == nil, nil
+}
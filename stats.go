@@ -0,0 +1,78 @@
+package endor
+
+import "time"
+
+// Stats describes the internals of a store, as returned by DB.Stats.
+type Stats struct {
+	// FileBytes is the size of the data file and LiveBytes the part of it
+	// taken by the records the index points at. The rest, DeadBytes, is
+	// what Compact reclaims.
+	FileBytes int64
+	LiveBytes int64
+	DeadBytes int64
+
+	// Keys is the number of keys in the index, including expired ones the
+	// sweep has yet to drop.
+	Keys int
+
+	// Records is the number of records in the data file and DeadRecords
+	// those of them no longer needed. A store opened from a checkpoint of
+	// an older version only counts the records since it until it is
+	// compacted.
+	Records     int64
+	DeadRecords int64
+
+	// IndexBytes estimates the memory taken by the index: the keys and a
+	// fixed overhead per entry.
+	IndexBytes int64
+
+	// Compactions counts the compactions since Open, the last of which
+	// finished at LastCompaction.
+	Compactions    uint64
+	LastCompaction time.Time
+
+	// Flushes counts the syncs of the data file since Open.
+	Flushes int64
+}
+
+// indexEntryOverhead approximates what an index entry costs on top of its
+// key: the entry itself, the string header and the map's own bookkeeping.
+const indexEntryOverhead = 80
+
+// Stats returns the current Stats of the store.
+func (db *DB) Stats() (Stats, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return Stats{}, ErrClosed
+	}
+	s := Stats{
+		FileBytes:      db.size,
+		LiveBytes:      db.live,
+		DeadBytes:      db.size - db.live,
+		Keys:           len(db.index),
+		Records:        db.records,
+		Compactions:    db.generation,
+		LastCompaction: db.compacted,
+		Flushes:        db.flushes,
+	}
+	live := int64(0)
+	for key, e := range db.index {
+		s.IndexBytes += int64(len(key)) + indexEntryOverhead
+		if e.offset >= 0 {
+			live++
+		}
+	}
+	for _, merges := range db.merges {
+		live += int64(len(merges))
+	}
+	for _, revs := range db.history {
+		for _, rev := range revs {
+			live += 1 + int64(len(rev.merges))
+		}
+	}
+	if s.DeadRecords = s.Records - live; s.DeadRecords < 0 {
+		s.DeadRecords = 0
+	}
+	return s, nil
+}
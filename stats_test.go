@@ -0,0 +1,78 @@
+package endor
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	db, path := openTest(t, Options{})
+	empty, err := db.Stats()
+	if err != nil || empty.Keys != 0 || empty.Records != 0 || empty.DeadBytes != 0 || empty.FileBytes != empty.LiveBytes {
+		t.Fatalf("Stats of an empty store = %+v, %v", empty, err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if err := db.Set(key, []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Set("a", []byte("again")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	s, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := db.file.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Five records, three of them dead: the first a, b and its delete.
+	if s.Keys != 2 || s.Records != 5 || s.DeadRecords != 3 || s.FileBytes != size || s.LiveBytes+s.DeadBytes != s.FileBytes || s.DeadBytes == 0 {
+		t.Fatalf("Stats = %+v, file of %d bytes", s, size)
+	}
+	if s.IndexBytes != 2*(1+indexEntryOverhead) {
+		t.Fatalf("IndexBytes = %d, want %d", s.IndexBytes, 2*(1+indexEntryOverhead))
+	}
+	if s.Compactions != 0 || !s.LastCompaction.IsZero() || s.Flushes != 5 {
+		t.Fatalf("Stats before compacting = %+v", s)
+	}
+
+	start := time.Now()
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	s, err = db.Stats()
+	if err != nil || s.Records != 2 || s.DeadRecords != 0 || s.DeadBytes != 0 || s.Compactions != 1 || s.LastCompaction.Before(start) {
+		t.Fatalf("Stats after Compact = %+v, %v", s, err)
+	}
+
+	// The counts survive a reopen, from the checkpoint and replaying.
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Stats(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Stats after Close = %v, want ErrClosed", err)
+	}
+	for _, when := range []string{"from the checkpoint", "replaying the data file"} {
+		db, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reopened, err := db.Stats()
+		if err != nil || reopened.Keys != 2 || reopened.Records != 2 || reopened.FileBytes != s.FileBytes || reopened.LiveBytes != s.LiveBytes {
+			t.Fatalf("%s: Stats = %+v, %v, want those of %+v", when, reopened, err, s)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(path + ".checkpoint"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
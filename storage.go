@@ -0,0 +1,166 @@
+package endor
+
+import (
+	"bytes"
+	"io"
+)
+
+// Storage holds the records of a DB as an append-only sequence of bytes, in
+// one of the formats of format.go. The data file is the default; Options.Storage plugs
+// in others.
+type Storage interface {
+	// Append writes bufs back to back at the end as a single write and
+	// returns the offset the first of them starts at.
+	Append(bufs ...[]byte) (int64, error)
+
+	// ReadAt reads len(p) bytes at off, returning io.EOF when the storage
+	// ends first, as io.ReaderAt does. It must be safe to call while an
+	// Append is in progress, since snapshots and replication read from
+	// the storage without holding up writes.
+	ReadAt(p []byte, off int64) (int, error)
+
+	// Size returns the number of bytes in the storage.
+	Size() (int64, error)
+
+	// Sync makes everything appended so far durable. A write is only
+	// acknowledged once Sync returned.
+	Sync() error
+
+	// Truncate cuts the storage to size bytes, which is never more than
+	// it holds.
+	Truncate(size int64) error
+
+	Close() error
+}
+
+// Backend opens the Storage of DBs by name. The name of the storage of a DB
+// is the path it was opened with, and Compact writes the live records to
+// the storage named path+".compact" before replacing the old one with it.
+type Backend interface {
+	// Open opens the storage called name, creating an empty one if there
+	// is none.
+	Open(name string) (Storage, error)
+
+	// Replace atomically replaces the storage called to with the closed
+	// storage called from, which no longer exists afterwards.
+	Replace(from string, to string) error
+
+	// Remove removes the closed storage called name. Removing a storage
+	// that does not exist is not an error.
+	Remove(name string) error
+}
+
+// lineStorage is implemented by storages that read lines faster than the
+// generic helpers below manage through ReadAt.
+type lineStorage interface {
+	ReadLineFrom(offset int64) ([]byte, int64, error)
+	LinesFrom(offset int64, fn func(offset int64, line []byte) bool) error
+	TruncateToLastLine() (int64, error)
+}
+
+// readChunk is how many bytes the generic line helpers read at a time.
+const readChunk = 4 << 10
+
+// readLineFrom returns the line starting at offset, without its newline,
+// and the offset of the next line. An offset at the end of s returns
+// io.EOF.
+func readLineFrom(s Storage, offset int64) ([]byte, int64, error) {
+	if ls, ok := s.(lineStorage); ok {
+		return ls.ReadLineFrom(offset)
+	}
+	var line []byte
+	buf := make([]byte, readChunk)
+	for at := offset; ; {
+		n, err := s.ReadAt(buf, at)
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			line = append(line, buf[:i]...)
+			return line, offset + int64(len(line)) + 1, nil
+		}
+		line = append(line, buf[:n]...)
+		at += int64(n)
+		if err == io.EOF && len(line) > 0 {
+			return line, offset + int64(len(line)) + 1, nil
+		}
+		if err != nil {
+			return nil, offset, err
+		}
+	}
+}
+
+// linesFrom calls fn for every line of s from offset, which must be the
+// start of a line, on, stopping early when fn returns false.
+func linesFrom(s Storage, offset int64, fn func(offset int64, line []byte) bool) error {
+	if ls, ok := s.(lineStorage); ok {
+		return ls.LinesFrom(offset, fn)
+	}
+	size, err := s.Size()
+	if err != nil {
+		return err
+	}
+	r := io.NewSectionReader(s, offset, size-offset)
+	var pending []byte
+	buf := make([]byte, readChunk)
+	for {
+		n, err := r.Read(buf)
+		chunk := buf[:n]
+		for {
+			i := bytes.IndexByte(chunk, '\n')
+			if i < 0 {
+				break
+			}
+			// Every line gets its own slice, so fn may keep it.
+			line := append(pending, chunk[:i]...)
+			pending = nil
+			if !fn(offset, line) {
+				return nil
+			}
+			offset += int64(len(line)) + 1
+			chunk = chunk[i+1:]
+		}
+		pending = append(pending, chunk...)
+		if err == io.EOF {
+			if len(pending) > 0 {
+				fn(offset, pending)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// truncateToLastLine cuts a trailing partial line off the records of s,
+// which start at start, and returns the number of bytes removed. The header
+// before them can hold newlines of its own, so a first line torn is cut
+// back to start rather than to the last of those.
+func truncateToLastLine(s Storage, start int64) (int64, error) {
+	size, err := s.Size()
+	if err != nil {
+		return 0, err
+	}
+	end := size
+	buf := make([]byte, readChunk)
+	for end > start {
+		from := end - readChunk
+		if from < start {
+			from = start
+		}
+		n, err := s.ReadAt(buf[:end-from], from)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			end = from + int64(i) + 1
+			break
+		}
+		end = from
+	}
+	if end == size {
+		return 0, nil
+	}
+	if ls, ok := s.(lineStorage); ok && end > start {
+		return ls.TruncateToLastLine()
+	}
+	return size - end, s.Truncate(end)
+}
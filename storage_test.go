@@ -0,0 +1,135 @@
+package endor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// testBackend keeps storages in memory, like the backend of OpenInMemory,
+// but as a Backend of its own, so a DB treats it like any other and it
+// outlives the DBs opened on it. Open and Sync fail with errBackend while
+// failOpen or failSync is set.
+type testBackend struct {
+	*memoryBackend
+	failOpen atomic.Bool
+	failSync atomic.Bool
+	replaced []string
+
+	// appends and syncs count the calls to the storages of the backend.
+	appends atomic.Int64
+	syncs   atomic.Int64
+}
+
+var errBackend = errors.New("backend failed")
+
+func newTestBackend() *testBackend {
+	return &testBackend{memoryBackend: &memoryBackend{storages: make(map[string]*memoryStorage)}}
+}
+
+func (b *testBackend) Open(name string) (Storage, error) {
+	if b.failOpen.Load() {
+		return nil, errBackend
+	}
+	s, err := b.memoryBackend.Open(name)
+	return testStorage{s, b}, err
+}
+
+func (b *testBackend) Replace(from string, to string) error {
+	b.replaced = append(b.replaced, filepath.Base(from)+" "+filepath.Base(to))
+	return b.memoryBackend.Replace(from, to)
+}
+
+type testStorage struct {
+	Storage
+	b *testBackend
+}
+
+func (s testStorage) Append(bufs ...[]byte) (int64, error) {
+	s.b.appends.Add(1)
+	return s.Storage.Append(bufs...)
+}
+
+func (s testStorage) Sync() error {
+	s.b.syncs.Add(1)
+	if s.b.failSync.Load() {
+		return errBackend
+	}
+	return s.Storage.Sync()
+}
+
+func TestStorageBackend(t *testing.T) {
+	for _, binary := range []bool{false, true} {
+		t.Run(fmt.Sprintf("binary=%v", binary), func(t *testing.T) {
+			backend := newTestBackend()
+			opts := Options{Storage: backend, BinaryRecords: binary}
+			path := filepath.Join(t.TempDir(), "test.db")
+			db, err := OpenWithOptions(path, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			const keys = 20
+			want := make(map[string]string)
+			for i := 0; i < keys; i++ {
+				key := fmt.Sprintf("key-%03d", i)
+				if err := db.Set(key, []byte("value "+key)); err != nil {
+					t.Fatal(err)
+				}
+				want[key] = "value " + key
+			}
+			if err := db.Delete("key-000"); err != nil {
+				t.Fatal(err)
+			}
+			delete(want, "key-000")
+			if err := db.Compact(); err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(backend.replaced) != "[test.db.compact test.db]" {
+				t.Fatalf("Compact replaced %v", backend.replaced)
+			}
+			checkKeys(t, db, keys, want, "after Compact")
+
+			// A failed sync fails the write, which is not acknowledged.
+			backend.failSync.Store(true)
+			if err := db.Set("key-000", []byte("lost")); !errors.Is(err, errBackend) {
+				t.Fatalf("Set with a failing Sync = %v, want errBackend", err)
+			}
+			backend.failSync.Store(false)
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// The storage outlives the DB, and a torn tail is cut off
+			// without the line helpers the data file has.
+			s := backend.storages[path]
+			size := int64(len(s.data))
+			s.data = append(s.data, "key-999 half a rec"...)
+			if err := os.Remove(path + ".checkpoint"); err != nil {
+				t.Fatal(err)
+			}
+			if db, err = OpenWithOptions(path, opts); err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if int64(len(s.data)) != size {
+				t.Fatalf("storage holds %d bytes after the torn tail was repaired, want %d", len(s.data), size)
+			}
+			for key, value := range want {
+				if got, err := db.Get(key); err != nil || string(got) != value {
+					t.Fatalf("after reopening: Get %s = %q, %v", key, got, err)
+				}
+			}
+		})
+	}
+}
+
+func TestStorageBackendOpenError(t *testing.T) {
+	backend := newTestBackend()
+	backend.failOpen.Store(true)
+	if _, err := OpenWithOptions(filepath.Join(t.TempDir(), "test.db"), Options{Storage: backend}); !errors.Is(err, errBackend) {
+		t.Fatalf("Open with a failing backend = %v, want errBackend", err)
+	}
+}
@@ -0,0 +1,278 @@
+package endor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// streamChunk is how many bytes of a value SetReader and GetReader move at
+// a time.
+const streamChunk = 1 << 20
+
+// SetReader sets key to the value read from r, like Set, without holding
+// the value in memory. The value is spooled to a temporary file next to the
+// data file while r is read, then appended from there a chunk at a time;
+// writes wait for that copy, not for r. Only binary records store a value
+// as it is, so a store of lines, one that compresses or encrypts values,
+// keeps secondary indexes or runs hooks, or lives in memory reads the value
+// into memory and sets it as Set does. Watchers see a streamed value set
+// without the value.
+func (db *DB) SetReader(key string, r io.Reader) (err error) {
+	if !db.streams() || len(db.currentHooks()) > 0 {
+		value, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return db.Set(key, value)
+	}
+	defer db.observe(OpSet, time.Now(), &err)
+	rec := record{Op: opSet, Key: key}
+	if err := db.checkSize(rec); err != nil {
+		return err
+	}
+	spool, size, err := db.spool(r)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+	if db.opts.MaxValueSize > 0 && size > int64(db.opts.MaxValueSize) {
+		return ErrValueTooLarge
+	}
+
+	defer db.keys.lock([]record{rec})()
+	rec.Version = db.nextVersions(1)
+	head, err := binaryFormat{}.head(rec, 0)
+	if err != nil {
+		return err
+	}
+	if int64(len(head))+size > math.MaxUint32 {
+		return ErrValueTooLarge
+	}
+	sum := crc32.Checksum(head[4:], crcTable)
+	if err := copyChunks(io.NewSectionReader(spool, 0, size), func(chunk []byte) error {
+		sum = crc32.Update(sum, crcTable, chunk)
+		return nil
+	}); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(head, sum)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	switch {
+	case db.closed:
+		return ErrClosed
+	case db.readOnly || db.follower:
+		return ErrReadOnly
+	case !db.streamsLocked():
+		// A compaction or Rekey changed the format or key since.
+		value, err := io.ReadAll(io.NewSectionReader(spool, 0, size))
+		if err != nil {
+			return err
+		}
+		rec.Value = value
+		body, err := db.encode(db.format, rec)
+		if err != nil {
+			return err
+		}
+		return db.appendLocked([]record{rec}, [][]byte{body})
+	}
+	return db.appendStreamed(rec, head, io.NewSectionReader(spool, 0, size), size)
+}
+
+// streams reports whether values can be streamed to and from the data file
+// as they are.
+func (db *DB) streams() bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.streamsLocked()
+}
+
+func (db *DB) streamsLocked() bool {
+	return db.format.version() == formatBinary && db.opts.Compression == CompressionNone && db.sealer == nil && len(db.indexes) == 0 && !db.inMemory
+}
+
+// spool copies r to a temporary file and returns it along with its size.
+// It is created next to the data file, on the same disk, unless the store
+// has a Storage of its own.
+func (db *DB) spool(r io.Reader) (*os.File, int64, error) {
+	dir := ""
+	if db.opts.Storage == nil {
+		dir = filepath.Dir(db.path)
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(db.path)+".spool*")
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := io.CopyBuffer(f, r, make([]byte, streamChunk))
+	if err != nil {
+		f.Close()
+		return nil, 0, errors.Join(err, os.Remove(f.Name()))
+	}
+	return f, size, nil
+}
+
+// appendStreamed appends the record rec, whose body is head followed by
+// the size bytes of value, and applies it as appendLocked does. A copy
+// that fails halfway is cut off the data file again. db.mu must be held.
+func (db *DB) appendStreamed(rec record, head []byte, value io.Reader, size int64) error {
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(int64(len(head))+size))
+	offset, err := db.file.Append(length, head)
+	if err == nil {
+		err = copyChunks(value, func(chunk []byte) error {
+			_, err := db.file.Append(chunk)
+			return err
+		})
+	}
+	if err == nil {
+		_, err = db.file.Append(length)
+	}
+	if err != nil {
+		return errors.Join(err, db.file.Truncate(offset))
+	}
+	if err := db.syncAppended(); err != nil {
+		return err
+	}
+	db.apply(rec, offset, int64(len(head))+size+frameOverhead, time.Now().UnixNano())
+	db.notify([]record{rec})
+	db.signalAppended()
+	db.evict()
+	db.maybeCompact()
+	db.gauges()
+	return nil
+}
+
+// copyChunks hands what r holds to fn a chunk at a time. The chunk is only
+// valid until fn returns.
+func copyChunks(r io.Reader, fn func(chunk []byte) error) error {
+	buf := make([]byte, streamChunk)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if err := fn(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// GetReader returns a reader of the value of key, or ErrKeyNotFound if it
+// is not set or has expired, which reads the value from the data file a
+// chunk at a time instead of returning all of it at once. The value is the
+// one key had when GetReader returned, whatever is written after; the
+// checksum of the record is checked once the value was read to its end.
+// Values stored other than as they are, and reads that run hooks, are read
+// into memory as Get does. The reader must be closed, and holds off
+// compaction until it is where the data file can not be replaced while
+// open, as NewSnapshotIterator does.
+func (db *DB) GetReader(key string) (rc io.ReadCloser, err error) {
+	if len(db.currentHooks()) == 0 {
+		rc, ok, err := db.openValue(key)
+		if ok || err != nil {
+			return rc, err
+		}
+	}
+	value, err := db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(value)), nil
+}
+
+// openValue returns a reader streaming the value of key, reporting false if
+// it can not be streamed.
+func (db *DB) openValue(key string) (rc io.ReadCloser, ok bool, err error) {
+	start := time.Now()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil, false, ErrClosed
+	}
+	if !db.streamsLocked() || len(db.merges[key]) > 0 {
+		return nil, false, nil
+	}
+	defer db.observe(OpGet, start, &err)
+	e, found := db.index[key]
+	if !found || e.expired(time.Now().UnixNano()) {
+		return nil, true, ErrKeyNotFound
+	}
+	r, at, n, sum, want, err := binaryFormat{}.readHead(db.file, e.offset, e.length)
+	if err != nil {
+		return nil, true, fmt.Errorf("%s: record at offset %d: %w", db.path, e.offset, err)
+	}
+	if r.Encrypted || r.Compression != CompressionNone || r.SealedKey != nil {
+		return nil, false, nil
+	}
+	file, err := db.detach()
+	if err != nil {
+		return nil, true, err
+	}
+	v := &valueReader{db: db, file: file, sum: sum, want: want, detached: file != nil}
+	if file == nil {
+		v.file = db.file
+		db.iterators++
+	}
+	v.r = io.NewSectionReader(v.file, at, n)
+	db.recency.touch(key)
+	return v, true, nil
+}
+
+// valueReader reads a value streamed by GetReader, checking the checksum of
+// its record at the end.
+type valueReader struct {
+	db *DB
+	// file is the data file the value is read from, a detached view of it
+	// when detached is set, see SnapshotIterator.
+	file     Storage
+	detached bool
+	r        *io.SectionReader
+	sum      uint32
+	want     uint32
+	closed   bool
+}
+
+func (v *valueReader) Read(p []byte) (int, error) {
+	if v.closed {
+		return 0, ErrClosed
+	}
+	n, err := v.r.Read(p)
+	v.sum = crc32.Update(v.sum, crcTable, p[:n])
+	if err == io.EOF && v.sum != v.want {
+		return n, fmt.Errorf("%w: %w", ErrCorrupt, ErrChecksumMismatch)
+	}
+	return n, err
+}
+
+// Close releases the data file the value is read from. Closing it again is
+// a no-op.
+func (v *valueReader) Close() error {
+	if v.closed {
+		return nil
+	}
+	v.closed = true
+	if v.detached {
+		return v.file.Close()
+	}
+	v.db.mu.Lock()
+	v.db.iterators--
+	v.db.mu.Unlock()
+	return nil
+}
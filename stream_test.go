@@ -0,0 +1,174 @@
+package endor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// failingReader returns n bytes and then an error.
+type failingReader struct {
+	n int
+}
+
+var errReaderFailed = errors.New("reader failed")
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, errReaderFailed
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	r.n -= len(p)
+	return len(p), nil
+}
+
+// streamValue returns a value of n bytes that spans several chunks.
+func streamValue(n int) []byte {
+	value := make([]byte, n)
+	for i := range value {
+		value[i] = byte(i % 251)
+	}
+	return value
+}
+
+func TestStreaming(t *testing.T) {
+	for _, binary := range []bool{false, true} {
+		t.Run(fmt.Sprintf("binary=%v", binary), func(t *testing.T) {
+			db, path := openTest(t, Options{BinaryRecords: binary})
+			value := streamValue(2*streamChunk + 100)
+			if err := db.SetReader("big", bytes.NewReader(value)); err != nil {
+				t.Fatal(err)
+			}
+			if spools, _ := filepath.Glob(path + ".spool*"); len(spools) != 0 {
+				t.Fatalf("spool files left behind: %v", spools)
+			}
+			rc, err := db.GetReader("big")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, streamed := rc.(*valueReader); streamed != binary {
+				t.Fatalf("GetReader streams %v, want %v", streamed, binary)
+			}
+
+			// A value written or compacted away since reads as it was.
+			if err := db.Set("big", []byte("small")); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Compact(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(rc)
+			if err != nil || !bytes.Equal(got, value) {
+				t.Fatalf("GetReader read %d bytes, %v, want the %d written", len(got), err, len(value))
+			}
+			if err := rc.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := rc.Close(); err != nil {
+				t.Fatalf("second Close = %v", err)
+			}
+			if got, err := db.Get("big"); err != nil || string(got) != "small" {
+				t.Fatalf("Get after the stream = %q, %v", got, err)
+			}
+
+			// A streamed value replays like any other.
+			if err := db.SetReader("big", bytes.NewReader(value)); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			os.Remove(path + ".checkpoint")
+			db, err = OpenWithOptions(path, Options{BinaryRecords: binary})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if got, err := db.Get("big"); err != nil || !bytes.Equal(got, value) {
+				t.Fatalf("Get after replay = %d bytes, %v", len(got), err)
+			}
+			if _, err := db.GetReader("missing"); !errors.Is(err, ErrKeyNotFound) {
+				t.Fatalf("GetReader of a missing key = %v, want ErrKeyNotFound", err)
+			}
+		})
+	}
+}
+
+func TestSetReaderFails(t *testing.T) {
+	db, path := openTest(t, Options{BinaryRecords: true})
+	before, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A reader that fails halfway writes nothing and leaves no spool file.
+	if err := db.SetReader("big", &failingReader{n: streamChunk + 10}); !errors.Is(err, errReaderFailed) {
+		t.Fatalf("SetReader of a failing reader = %v, want its error", err)
+	}
+	if _, err := db.Get("big"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get after a failed SetReader = %v, want ErrKeyNotFound", err)
+	}
+	if after, err := db.Stats(); err != nil || after.FileBytes != before.FileBytes {
+		t.Fatalf("data file grew from %d to %d bytes on a failed SetReader (%v)", before.FileBytes, after.FileBytes, err)
+	}
+	if spools, _ := filepath.Glob(path + ".spool*"); len(spools) != 0 {
+		t.Fatalf("spool files left behind: %v", spools)
+	}
+	if err := db.SetReader("", bytes.NewReader([]byte("v"))); !errors.Is(err, ErrEmptyKey) {
+		t.Fatalf("SetReader of an empty key = %v, want ErrEmptyKey", err)
+	}
+
+	if err := db.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetReader("a", bytes.NewReader([]byte("2"))); !errors.Is(err, ErrClosed) {
+		t.Fatalf("SetReader on a closed store = %v, want ErrClosed", err)
+	}
+	reader, err := OpenReadOnly(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if err := reader.SetReader("a", bytes.NewReader([]byte("2"))); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("SetReader on a read-only store = %v, want ErrReadOnly", err)
+	}
+}
+
+func TestGetReaderChecksValue(t *testing.T) {
+	db, path := openTest(t, Options{BinaryRecords: true})
+	value := streamValue(streamChunk + 100)
+	if err := db.SetReader("big", bytes.NewReader(value)); err != nil {
+		t.Fatal(err)
+	}
+	// Open checks the last record, so another one follows.
+	if err := db.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	e := db.index["big"]
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	corruptAt(t, path, e.offset+e.length-10)
+	db, err := OpenWithOptions(path, Options{BinaryRecords: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rc, err := db.GetReader("big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	// The damage only shows once the value was read to its end.
+	if _, err := io.ReadAll(rc); !errors.Is(err, ErrCorrupt) || !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("reading a damaged value = %v, want ErrCorrupt", err)
+	}
+}
@@ -0,0 +1,96 @@
+package endor
+
+import (
+	"strconv"
+	"time"
+)
+
+// SyncPolicy says when the records a write appends are made durable. The
+// zero value is SyncAlways.
+type SyncPolicy struct {
+	interval time.Duration
+	every    int
+	never    bool
+}
+
+var (
+	// SyncAlways syncs the data file before every write returns, so an
+	// acknowledged write survives a crash of the process or the machine.
+	SyncAlways = SyncPolicy{}
+
+	// SyncNever leaves writing the data file back to the operating system.
+	// Writes survive the process crashing but may be lost with the
+	// machine.
+	SyncNever = SyncPolicy{never: true}
+)
+
+// SyncInterval syncs the data file in the background every d, so a crash
+// of the machine loses at most the writes of the last d. Close syncs
+// whatever is still pending. A d of zero or less is SyncAlways.
+func SyncInterval(d time.Duration) SyncPolicy {
+	if d <= 0 {
+		return SyncAlways
+	}
+	return SyncPolicy{interval: d}
+}
+
+// SyncEvery syncs the data file once every n writes, so a crash of the
+// machine loses at most the last n-1 writes, which share the cost of one
+// sync. Close syncs whatever is still pending. An n of one or less is
+// SyncAlways.
+func SyncEvery(n int) SyncPolicy {
+	if n <= 1 {
+		return SyncAlways
+	}
+	return SyncPolicy{every: n}
+}
+
+func (p SyncPolicy) String() string {
+	switch {
+	case p.never:
+		return "never"
+	case p.interval > 0:
+		return "every " + p.interval.String()
+	case p.every > 0:
+		return "every " + strconv.Itoa(p.every) + " writes"
+	default:
+		return "always"
+	}
+}
+
+// syncAppended makes a write that was just appended as durable as the sync
+// policy asks for. db.mu must be held.
+func (db *DB) syncAppended() (err error) {
+	switch policy := db.opts.SyncPolicy; {
+	case policy.never:
+		return nil
+	case policy.interval > 0:
+		db.unsynced = true
+		return nil
+	case policy.every > 0:
+		if db.unsyncedWrites++; db.unsyncedWrites < policy.every {
+			db.unsynced = true
+			return nil
+		}
+		db.unsyncedWrites = 0
+		db.unsynced = false
+	}
+	defer db.observe(OpFlush, time.Now(), &err)
+	db.flushes++
+	return db.file.Sync()
+}
+
+// syncPending syncs the writes SyncInterval left unsynced. db.mu must be
+// held.
+func (db *DB) syncPending() (err error) {
+	if !db.unsynced {
+		return nil
+	}
+	defer db.observe(OpFlush, time.Now(), &err)
+	db.flushes++
+	if err = db.file.Sync(); err != nil {
+		return err
+	}
+	db.unsynced, db.unsyncedWrites = false, 0
+	return nil
+}
@@ -0,0 +1,84 @@
+package endor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSyncPolicies(t *testing.T) {
+	for _, c := range []struct {
+		policy SyncPolicy
+		// synced is the number of syncs after seven writes, and closed
+		// after closing the store too.
+		synced, closed int64
+	}{
+		{SyncAlways, 7, 7},
+		{SyncNever, 0, 0},
+		{SyncEvery(3), 2, 3},
+		{SyncEvery(7), 1, 1},
+		{SyncInterval(time.Hour), 0, 1},
+	} {
+		t.Run(c.policy.String(), func(t *testing.T) {
+			db, path := openTest(t, Options{SyncPolicy: c.policy, SweepInterval: -1, CheckpointInterval: -1})
+			for i := 0; i < 7; i++ {
+				if err := db.Set(fmt.Sprintf("k%d", i), []byte("v")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if stats, err := db.Stats(); err != nil || stats.Flushes != c.synced {
+				t.Fatalf("%d syncs after seven writes, %v, want %d", stats.Flushes, err, c.synced)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if db.flushes != c.closed {
+				t.Fatalf("%d syncs after Close, want %d", db.flushes, c.closed)
+			}
+			// Every policy keeps the writes across a clean close.
+			db, err := Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if _, err := db.Get("k6"); err != nil {
+				t.Fatalf("Get of the last write after reopening = %v", err)
+			}
+		})
+	}
+}
+
+func TestSyncIntervalSyncsInTheBackground(t *testing.T) {
+	db, _ := openTest(t, Options{SyncPolicy: SyncInterval(5 * time.Millisecond)})
+	if err := db.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "write synced in the background", func() bool {
+		stats, err := db.Stats()
+		return err == nil && stats.Flushes == 1
+	})
+	// Nothing is synced while nothing is written.
+	time.Sleep(20 * time.Millisecond)
+	if stats, _ := db.Stats(); stats.Flushes != 1 {
+		t.Fatalf("%d syncs without writes in between, want 1", stats.Flushes)
+	}
+}
+
+func TestSyncPolicyString(t *testing.T) {
+	for _, c := range []struct {
+		policy SyncPolicy
+		want   string
+	}{
+		{SyncPolicy{}, "always"},
+		{SyncNever, "never"},
+		{SyncEvery(1), "always"},
+		{SyncEvery(10), "every 10 writes"},
+		{SyncInterval(0), "always"},
+		{SyncInterval(time.Second), "every 1s"},
+		{SyncInterval(-time.Second), "always"},
+	} {
+		if got := c.policy.String(); got != c.want {
+			t.Fatalf("%#v.String() = %q, want %q", c.policy, got, c.want)
+		}
+	}
+}
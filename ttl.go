@@ -0,0 +1,148 @@
+package endor
+
+import (
+	"context"
+	"time"
+)
+
+// SetWithTTL stores value under key until ttl has passed, after which the key
+// reads as missing. A ttl of zero or less stores the key without expiry.
+func (db *DB) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	r := record{Op: opSet, Key: key, Value: value}
+	if ttl > 0 {
+		r.Expires = time.Now().Add(ttl).UnixNano()
+	}
+	return db.write([]record{r})
+}
+
+// sweep drops expired keys from the index. Their records become dead space
+// in the data file until Compact removes them.
+func (db *DB) sweep() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.sweepLocked()
+}
+
+// sweepLocked is sweep with db.mu held.
+func (db *DB) sweepLocked() {
+	now := time.Now().UnixNano()
+	for key, e := range db.index {
+		if e.expired(now) {
+			db.retire(key)
+			delete(db.index, key)
+			db.unindex(key)
+			db.expire(key, e)
+		}
+	}
+}
+
+// OnExpire adds fn to the callbacks that are called with the key and the
+// value of every key that expires, from the goroutine sweeping expired keys
+// every SweepInterval, so it must not block for long. It is called at least
+// once for every key: keys that expired before the store was last closed,
+// or before the process died, without the callbacks being called for them
+// are reported after it is opened again. Keys of buckets are reported with
+// the prefix the bucket stores them under, and watchers see them deleted
+// once reported. A store opened read-only or following a leader, or with
+// the sweeper disabled, reports nothing.
+func (db *DB) OnExpire(fn func(key string, value []byte)) {
+	db.expireMu.Lock()
+	defer db.expireMu.Unlock()
+	db.onExpire = append(db.onExpire[:len(db.onExpire):len(db.onExpire)], fn)
+}
+
+func (db *DB) expireCallbacks() []func(key string, value []byte) {
+	db.expireMu.RLock()
+	defer db.expireMu.RUnlock()
+	return db.onExpire
+}
+
+// expire notes that key expired with its record at e. db.mu must be held.
+// Keys stay in db.expiring until the callbacks added with OnExpire were
+// called for them, after which a delete of the key is appended, so the
+// expiry is not reported again. A key whose callbacks ran without the
+// delete landing, because the process died in between, is reported again
+// once the store is opened again: its record is expired and no delete
+// follows it, which load and replay note as they go, and checkpoints and
+// compaction keep it that way. Any write to the key in the meantime, which
+// ends its expiry, takes it off the list.
+func (db *DB) expire(key string, e entry) {
+	if db.expiring == nil {
+		db.expiring = make(map[string]entry)
+	}
+	db.expiring[key] = e
+}
+
+// notifyExpired calls the OnExpire callbacks for the keys that expired
+// and appends a delete for each, unless the key was written since.
+func (db *DB) notifyExpired() error {
+	callbacks := db.expireCallbacks()
+	if len(callbacks) == 0 {
+		return nil
+	}
+	type expired struct {
+		key   string
+		e     entry
+		value []byte
+	}
+	var keys []expired
+	db.mu.RLock()
+	if db.closed || db.readOnly || db.follower {
+		db.mu.RUnlock()
+		return nil
+	}
+	for key, e := range db.expiring {
+		var value []byte
+		if e.offset >= 0 {
+			r, err := db.readRecord(e.offset)
+			if err != nil {
+				db.mu.RUnlock()
+				return err
+			}
+			value = r.Value
+		}
+		keys = append(keys, expired{key, e, value})
+	}
+	db.mu.RUnlock()
+	if len(keys) == 0 {
+		return nil
+	}
+	for _, k := range keys {
+		for _, fn := range callbacks {
+			fn(k.key, k.value)
+		}
+	}
+
+	records := make([]record, len(keys))
+	for i, k := range keys {
+		records[i] = record{Op: opDelete, Key: k.key}
+	}
+	defer db.keys.lock(records)()
+	if err := db.lockContext(context.Background()); err != nil {
+		return err
+	}
+	defer db.mu.Unlock()
+	if db.closed || db.readOnly || db.follower {
+		return nil
+	}
+	records = records[:0]
+	for _, k := range keys {
+		if e, ok := db.expiring[k.key]; ok && e.offset == k.e.offset {
+			records = append(records, record{Op: opDelete, Key: k.key})
+		}
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	first := db.nextVersions(len(records))
+	bodies := make([][]byte, len(records))
+	for i := range records {
+		records[i].Version = first + uint64(i)
+		body, err := db.encode(db.format, records[i])
+		if err != nil {
+			return err
+		}
+		bodies[i] = body
+	}
+	return db.appendLocked(records, bodies)
+}
@@ -0,0 +1,211 @@
+package endor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestSetWithTTL(t *testing.T) {
+	db, path := openTest(t, Options{SweepInterval: -1})
+	if err := db.SetWithTTL("short", []byte("v"), 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetWithTTL("long", []byte("v"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// A ttl of zero or less stores the key without expiry.
+	if err := db.SetWithTTL("forever", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetWithTTL("", []byte("v"), time.Hour); !errors.Is(err, ErrEmptyKey) {
+		t.Fatalf("SetWithTTL with an empty key = %v, want ErrEmptyKey", err)
+	}
+	if got, err := db.Get("short"); err != nil || string(got) != "v" {
+		t.Fatalf("Get(short) before it expired = %q, %v", got, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := db.Get("short"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get(short) after it expired = %v, want ErrKeyNotFound", err)
+	}
+	// The sweeper is off, so the expired key is still in the index, but
+	// it is not returned either way.
+	if stats, err := db.Stats(); err != nil || stats.Keys != 3 {
+		t.Fatalf("%d keys before a sweep, want 3 (%v)", stats.Keys, err)
+	}
+	db.sweep()
+	if stats, err := db.Stats(); err != nil || stats.Keys != 2 {
+		t.Fatalf("%d keys after a sweep, want 2 (%v)", stats.Keys, err)
+	}
+
+	// Expiry times are kept in the records, so they survive a reopen.
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := OpenWithOptions(path, Options{SweepInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Get("short"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get(short) after reopen = %v, want ErrKeyNotFound", err)
+	}
+	for _, key := range []string{"long", "forever"} {
+		if got, err := db.Get(key); err != nil || string(got) != "v" {
+			t.Fatalf("Get(%s) after reopen = %q, %v", key, got, err)
+		}
+	}
+}
+
+func TestSweeperDropsExpiredKeys(t *testing.T) {
+	db, _ := openTest(t, Options{SweepInterval: 10 * time.Millisecond})
+	if err := db.SetWithTTL("k", []byte("v"), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats, err := db.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Keys == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the sweeper never dropped the expired key")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// expirations returns a channel of the keys and values the OnExpire
+// callbacks of db are called with, as "key=value".
+func expirations(db *DB) chan string {
+	ch := make(chan string, 100)
+	db.OnExpire(func(key string, value []byte) { ch <- key + "=" + string(value) })
+	return ch
+}
+
+// expiredNothing fails if ch receives anything for a while.
+func expiredNothing(t *testing.T, ch chan string) {
+	t.Helper()
+	select {
+	case got := <-ch:
+		t.Fatalf("OnExpire called with %s", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestOnExpire(t *testing.T) {
+	db, path := openTest(t, Options{SweepInterval: 10 * time.Millisecond})
+	expired := expirations(db)
+	events, cancel := db.Watch("")
+	defer cancel()
+	if err := db.SetWithTTL("a", []byte("1"), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, events)
+	select {
+	case got := <-expired:
+		if got != "a=1" {
+			t.Fatalf("OnExpire called with %s, want a=1", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnExpire never called")
+	}
+	// Watchers see the key deleted once it was reported.
+	if ev := receive(t, events); ev.Type != EventDelete || ev.Key != "a" {
+		t.Fatalf("event %v %s after expiry, want the delete of a", ev.Type, ev.Key)
+	}
+
+	// A key written again before it expires is not reported, and a
+	// bucket key is with its prefix.
+	if err := db.SetWithTTL("b", []byte("2"), 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set("b", []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Bucket("x").SetWithTTL("c", []byte("4"), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-expired:
+		if want := bucketMark + "x" + bucketMark + "c=4"; got != want {
+			t.Fatalf("OnExpire called with %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnExpire never called for the bucket key")
+	}
+	expiredNothing(t, expired)
+
+	// Reported keys are not reported again after reopening.
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := OpenWithOptions(path, Options{SweepInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	expiredNothing(t, expirations(db))
+}
+
+func TestOnExpireAfterReopen(t *testing.T) {
+	for _, replay := range []bool{false, true} {
+		// Keys that expired while nothing was listening, or while the
+		// store was closed, are reported once it is opened again.
+		db, path := openTest(t, Options{SweepInterval: 10 * time.Millisecond})
+		if err := db.SetWithTTL("early", []byte("1"), time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, "the sweeper drops the key", func() bool {
+			stats, err := db.Stats()
+			return err == nil && stats.Keys == 0
+		})
+		if err := db.SetWithTTL("late", []byte("2"), 50*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if replay {
+			if err := os.Remove(path + ".checkpoint"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		time.Sleep(60 * time.Millisecond)
+
+		// Read-only stores report nothing.
+		reader, err := OpenReadOnly(path, Options{SweepInterval: 10 * time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expiredNothing(t, expirations(reader))
+		reader.Close()
+
+		db, err = OpenWithOptions(path, Options{SweepInterval: 10 * time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expired := expirations(db)
+		var got []string
+		for len(got) < 2 {
+			select {
+			case key := <-expired:
+				got = append(got, key)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("replay %v: OnExpire called for %q only", replay, got)
+			}
+		}
+		sort.Strings(got)
+		if fmt.Sprint(got) != "[early=1 late=2]" {
+			t.Fatalf("replay %v: OnExpire called for %q, want early and late", replay, got)
+		}
+		expiredNothing(t, expired)
+		db.Close()
+	}
+}
@@ -0,0 +1,98 @@
+package endor
+
+import "time"
+
+// Txn buffers Set and Delete operations until Commit writes them as one
+// atomic append. Its Get sees its own buffered writes first.
+//
+// Transactions run one at a time: Begin waits for the open transaction to
+// end, so every Txn must finish with Commit or Rollback. Plain Set, Delete
+// and Write calls are not held off and may land between a transaction's
+// reads and its commit.
+type Txn struct {
+	db     *DB
+	batch  WriteBatch
+	writes map[string]record
+	done   bool
+}
+
+// Begin starts a transaction, waiting for the open one to end first.
+func (db *DB) Begin() *Txn {
+	db.txn.Lock()
+	return &Txn{db: db, writes: make(map[string]record)}
+}
+
+// Get returns the value key has within the transaction: the last value it
+// buffered for key, or else the value in the store.
+func (t *Txn) Get(key string) ([]byte, error) {
+	if t.done {
+		return nil, ErrTxnDone
+	}
+	r, ok := t.writes[key]
+	if !ok {
+		return t.db.Get(key)
+	}
+	if r.Op == opDelete || r.expired(time.Now().UnixNano()) {
+		return nil, ErrKeyNotFound
+	}
+	return r.Value, nil
+}
+
+// Set buffers storing value under key.
+func (t *Txn) Set(key string, value []byte) error {
+	return t.SetWithTTL(key, value, 0)
+}
+
+// SetWithTTL buffers storing value under key until ttl has passed, counted
+// from the call rather than from the commit.
+func (t *Txn) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	if t.done {
+		return ErrTxnDone
+	}
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	t.batch.SetWithTTL(key, value, ttl)
+	t.writes[key] = t.batch.records[len(t.batch.records)-1]
+	return nil
+}
+
+// Delete buffers removing key.
+func (t *Txn) Delete(key string) error {
+	if t.done {
+		return ErrTxnDone
+	}
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	t.batch.Delete(key)
+	t.writes[key] = t.batch.records[len(t.batch.records)-1]
+	return nil
+}
+
+// Commit writes the buffered operations as one batch and ends the
+// transaction. Either all of them reach the store or, on error, none.
+func (t *Txn) Commit() error {
+	if t.done {
+		return ErrTxnDone
+	}
+	defer t.end()
+	return t.db.Write(&t.batch)
+}
+
+// Rollback drops the buffered operations and ends the transaction. Nothing
+// was written, so there is nothing to undo on disk.
+func (t *Txn) Rollback() error {
+	if t.done {
+		return ErrTxnDone
+	}
+	t.end()
+	return nil
+}
+
+func (t *Txn) end() {
+	t.done = true
+	t.batch.Reset()
+	t.writes = nil
+	t.db.txn.Unlock()
+}
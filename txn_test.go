@@ -0,0 +1,117 @@
+package endor
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTxnReadsItsOwnWrites(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	for key, value := range map[string]string{"a": "1", "b": "2"} {
+		if err := db.Set(key, []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	txn := db.Begin()
+	if err := txn.Set("a", []byte("changed")); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Set("c", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.SetWithTTL("d", []byte("gone"), time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	for key, want := range map[string]string{"a": "changed", "c": "new"} {
+		if got, err := txn.Get(key); err != nil || string(got) != want {
+			t.Fatalf("Txn.Get(%s) = %q, %v, want %q", key, got, err, want)
+		}
+	}
+	for _, key := range []string{"b", "d"} {
+		if _, err := txn.Get(key); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("Txn.Get(%s) = %v, want ErrKeyNotFound", key, err)
+		}
+	}
+	// Nothing reaches the store before the commit.
+	if got, err := db.Get("a"); err != nil || string(got) != "1" {
+		t.Fatalf("Get(a) before the commit = %q, %v", got, err)
+	}
+	if err := txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	checkKeys(t, db, 2, map[string]string{"a": "changed", "c": "new"}, "after the commit")
+}
+
+func TestTxnRollbackAndDone(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	txn := db.Begin()
+	if err := txn.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Set("", []byte("1")); !errors.Is(err, ErrEmptyKey) {
+		t.Fatalf("Txn.Set with an empty key = %v, want ErrEmptyKey", err)
+	}
+	if err := txn.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get("a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get(a) after a rollback = %v, want ErrKeyNotFound", err)
+	}
+	// A finished transaction refuses everything.
+	for name, err := range map[string]error{
+		"Get":      func() error { _, err := txn.Get("a"); return err }(),
+		"Set":      txn.Set("a", nil),
+		"Delete":   txn.Delete("a"),
+		"Commit":   txn.Commit(),
+		"Rollback": txn.Rollback(),
+	} {
+		if !errors.Is(err, ErrTxnDone) {
+			t.Fatalf("%s after Rollback = %v, want ErrTxnDone", name, err)
+		}
+	}
+}
+
+func TestTxnsRunOneAtATime(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	first := db.Begin()
+	began := make(chan *Txn)
+	go func() { began <- db.Begin() }()
+	select {
+	case <-began:
+		t.Fatal("Begin returned while another transaction was open")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := first.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case second := <-began:
+		second.Rollback()
+	case <-time.After(5 * time.Second):
+		t.Fatal("Begin still waiting after the open transaction committed")
+	}
+}
+
+func TestFailedCommitWritesNothing(t *testing.T) {
+	db, _ := openTest(t, Options{MaxValueSize: 4})
+	txn := db.Begin()
+	if err := txn.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Set("b", []byte("too large")); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Commit(); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("Commit = %v, want ErrValueTooLarge", err)
+	}
+	if _, err := db.Get("a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get(a) after a failed commit = %v, want ErrKeyNotFound", err)
+	}
+	// The failed commit still ended the transaction.
+	db.Begin().Rollback()
+}
@@ -0,0 +1,73 @@
+package endor
+
+import (
+	"fmt"
+	"time"
+)
+
+// TypedDB is a view of a DB that stores values of type T, encoded with a
+// Codec, instead of raw bytes. It shares the DB, so typed and raw access can
+// be mixed as long as the raw values are encoded the same way.
+type TypedDB[T any] struct {
+	db    *DB
+	codec Codec
+}
+
+// Typed returns a view of db storing values of type T encoded with codec.
+// A nil codec selects JSONCodec.
+func Typed[T any](db *DB, codec Codec) *TypedDB[T] {
+	if codec == nil {
+		codec = JSONCodec
+	}
+	return &TypedDB[T]{db: db, codec: codec}
+}
+
+// DB returns the store the view reads and writes.
+func (t *TypedDB[T]) DB() *DB {
+	return t.db
+}
+
+// Get returns the value of key decoded into a T, or ErrKeyNotFound if it is
+// not set or has expired.
+func (t *TypedDB[T]) Get(key string) (T, error) {
+	var v T
+	data, err := t.db.Get(key)
+	if err != nil {
+		return v, err
+	}
+	if err := t.codec.Unmarshal(data, &v); err != nil {
+		return v, fmt.Errorf("decode %q: %w", key, err)
+	}
+	return v, nil
+}
+
+// Set encodes v and stores it under key.
+func (t *TypedDB[T]) Set(key string, v T) error {
+	data, err := t.encode(key, v)
+	if err != nil {
+		return err
+	}
+	return t.db.Set(key, data)
+}
+
+// SetWithTTL encodes v and stores it under key until ttl has passed.
+func (t *TypedDB[T]) SetWithTTL(key string, v T, ttl time.Duration) error {
+	data, err := t.encode(key, v)
+	if err != nil {
+		return err
+	}
+	return t.db.SetWithTTL(key, data, ttl)
+}
+
+// Delete removes key.
+func (t *TypedDB[T]) Delete(key string) error {
+	return t.db.Delete(key)
+}
+
+func (t *TypedDB[T]) encode(key string, v T) ([]byte, error) {
+	data, err := t.codec.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("encode %q: %w", key, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,67 @@
+package endor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type typedUser struct {
+	Name string
+	Age  int
+}
+
+func TestTypedDB(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	for _, codec := range []Codec{nil, GobCodec} {
+		users := Typed[typedUser](db, codec)
+		if users.DB() != db {
+			t.Fatal("DB returns another store")
+		}
+		ann := typedUser{Name: "Ann", Age: 41}
+		if err := users.Set("ann", ann); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := users.Get("ann"); err != nil || got != ann {
+			t.Fatalf("Get = %+v, %v, want %+v", got, err, ann)
+		}
+		if err := users.SetWithTTL("tmp", ann, time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+		if _, err := users.Get("tmp"); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("Get of an expired key = %v, want ErrKeyNotFound", err)
+		}
+		if err := users.Delete("ann"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := users.Get("ann"); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("Get of a deleted key = %v, want ErrKeyNotFound", err)
+		}
+	}
+
+	// Typed and raw access share the store.
+	users := Typed[typedUser](db, nil)
+	if err := db.Set("bob", []byte(`{"Name":"Bob","Age":7}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := users.Get("bob"); err != nil || got != (typedUser{Name: "Bob", Age: 7}) {
+		t.Fatalf("Get of a raw JSON value = %+v, %v", got, err)
+	}
+
+	// A value that does not decode names its key.
+	if err := db.Set("bad", []byte("not json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.Get("bad"); err == nil || !strings.Contains(err.Error(), `decode "bad"`) {
+		t.Fatalf("Get of an undecodable value = %v", err)
+	}
+	funcs := Typed[func()](db, nil)
+	if err := funcs.Set("f", func() {}); err == nil || !strings.Contains(err.Error(), `encode "f"`) {
+		t.Fatalf("Set of an unencodable value = %v", err)
+	}
+	if _, err := db.Get("f"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("a value that failed to encode was stored: %v", err)
+	}
+}
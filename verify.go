@@ -0,0 +1,90 @@
+package endor
+
+import (
+	"fmt"
+	"os"
+)
+
+// VerifyReport lists the outcome of DB.Verify.
+type VerifyReport struct {
+	// Records is the number of records scanned.
+	Records int
+	// Corrupt holds the offsets of records that failed to decode or whose
+	// checksum did not match.
+	Corrupt []int64
+}
+
+// Verify checks the checksum of every record in the data file. With
+// quarantine set, corrupt records are copied to a ".quarantine" sibling file
+// for inspection, and keys whose current record is corrupt are dropped so
+// they read as missing instead of failing.
+func (db *DB) Verify(quarantine bool) (VerifyReport, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return VerifyReport{}, ErrClosed
+	}
+
+	var report VerifyReport
+	var bad [][]byte
+	err := db.format.scan(db.file, db.start, func(offset int64, body []byte) bool {
+		report.Records++
+		if _, err := db.format.unmarshal(body); err != nil {
+			report.Corrupt = append(report.Corrupt, offset)
+			bad = append(bad, body)
+		}
+		return true
+	})
+	if err != nil || !quarantine || len(bad) == 0 {
+		return report, err
+	}
+
+	if err := db.quarantine(report.Corrupt, bad); err != nil {
+		return report, err
+	}
+	corrupt := make(map[int64]bool, len(report.Corrupt))
+	for _, offset := range report.Corrupt {
+		corrupt[offset] = true
+	}
+	for key, e := range db.index {
+		if corrupt[e.offset] {
+			delete(db.index, key)
+			db.live -= e.length
+		}
+	}
+	// The index changed without the data file growing, so make sure the
+	// next checkpoint is taken.
+	db.checkpointed = -1
+	return report, nil
+}
+
+// quarantine appends the corrupt lines, each prefixed with its offset, to
+// the quarantine file. An in-memory store has no file to put them in.
+func (db *DB) quarantine(offsets []int64, lines [][]byte) error {
+	if db.inMemory {
+		return nil
+	}
+	return quarantineLines(db.path, offsets, lines)
+}
+
+// quarantineLines appends lines to the quarantine file of the store at path.
+func quarantineLines(path string, offsets []int64, lines [][]byte) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(path+".quarantine", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	for i, line := range lines {
+		if _, err := fmt.Fprintf(f, "%d %s\n", offsets[i], line); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,75 @@
+package endor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestVerifyFindsAndQuarantinesCorruptRecords(t *testing.T) {
+	db, path := openTest(t, Options{})
+	for _, key := range []string{"a", "b", "c"} {
+		if err := db.Set(key, []byte("value of "+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if report, err := db.Verify(false); err != nil || report.Records != 3 || len(report.Corrupt) != 0 {
+		t.Fatalf("Verify of a sound store = %+v, %v", report, err)
+	}
+
+	// Flip a byte of the value of b while the store is closed. Open loads
+	// the checkpoint Close took instead of reading the records again, so
+	// it does not notice.
+	offset, at := db.index["b"].offset, db.index["b"].offset+db.index["b"].length-8
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[at] ^= 0x01
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Get("b"); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Get of a corrupt record = %v, want ErrCorrupt", err)
+	}
+	report, err := db.Verify(false)
+	if err != nil || report.Records != 3 || fmt.Sprint(report.Corrupt) != fmt.Sprint([]int64{offset}) {
+		t.Fatalf("Verify = %+v, %v, want the record of b at %d", report, err, offset)
+	}
+	if _, err := os.Stat(path + ".quarantine"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Verify without quarantine wrote a quarantine file: %v", err)
+	}
+
+	if _, err := db.Verify(true); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(path + ".quarantine")
+	if err != nil || !strings.HasPrefix(string(data), fmt.Sprintf("%d ", offset)) {
+		t.Fatalf("quarantine file holds %q, %v", data, err)
+	}
+	if _, err := db.Get("b"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get of a quarantined key = %v, want ErrKeyNotFound", err)
+	}
+	for _, key := range []string{"a", "c"} {
+		if got, err := db.Get(key); err != nil || string(got) != "value of "+key {
+			t.Fatalf("Get(%s) = %q, %v", key, got, err)
+		}
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Verify(false); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Verify of a closed store = %v, want ErrClosed", err)
+	}
+}
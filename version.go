@@ -0,0 +1,86 @@
+package endor
+
+import (
+	"context"
+	"time"
+)
+
+// Versions tell the writes of a key apart, so a read-modify-write can make
+// sure nothing else wrote the key in between. Every write gets a version no
+// earlier write of the store had: the larger of the wall clock in Unix
+// nanoseconds and one past the largest version seen, so they stay unique
+// across reopens and compactions even though the records holding the
+// largest ones may be gone. The versions of a key also grow in the order
+// its records land in the data file, since writers draw them holding the
+// key locks, or the write lock, until the records are applied; only the
+// versions of different keys can land out of order.
+
+// nextVersions reserves n consecutive versions and returns the first.
+func (db *DB) nextVersions(n int) uint64 {
+	for {
+		last := db.version.Load()
+		first := last + 1
+		if now := uint64(time.Now().UnixNano()); now > first {
+			first = now
+		}
+		if db.version.CompareAndSwap(last, first+uint64(n)-1) {
+			return first
+		}
+	}
+}
+
+// versionOf returns the version of r, handing out a new one to records
+// written before versions were added, and makes sure no later write reuses
+// it.
+func (db *DB) versionOf(r record) uint64 {
+	if r.Version == 0 {
+		return db.nextVersions(1)
+	}
+	for {
+		last := db.version.Load()
+		if last >= r.Version || db.version.CompareAndSwap(last, r.Version) {
+			return r.Version
+		}
+	}
+}
+
+// GetVersion returns the value of key along with its version, which
+// SetIfVersion takes to make sure the key did not change in the meantime.
+// Like Get it returns ErrKeyNotFound for a key that is not set or has
+// expired.
+func (db *DB) GetVersion(key string) (value []byte, version uint64, err error) {
+	defer db.observe(OpGet, time.Now(), &err)
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, 0, ErrClosed
+	}
+	e, ok := db.index[key]
+	if !ok || e.expired(time.Now().UnixNano()) {
+		return nil, 0, ErrKeyNotFound
+	}
+	r, err := db.readLive(key, e)
+	if err != nil {
+		return nil, 0, err
+	}
+	return r.Value, e.version, nil
+}
+
+// SetIfVersion stores value under key only if the key still has version, as
+// returned by GetVersion, and fails with ErrVersionMismatch otherwise. A
+// version of zero stores value only if key is not set. The check and the
+// write happen under one lock, so of several writers racing from the same
+// version exactly one succeeds.
+func (db *DB) SetIfVersion(key string, value []byte, version uint64) error {
+	records := []record{{Op: opSet, Key: key, Value: value}}
+	return db.writeIf(context.Background(), records, func() error {
+		current := uint64(0)
+		if e, ok := db.index[key]; ok && !e.expired(time.Now().UnixNano()) {
+			current = e.version
+		}
+		if current != version {
+			return ErrVersionMismatch
+		}
+		return nil
+	})
+}
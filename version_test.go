@@ -0,0 +1,115 @@
+package endor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetIfVersion(t *testing.T) {
+	db, path := openTest(t, Options{})
+	// Version zero creates a key that is not set, and only then.
+	if err := db.SetIfVersion("a", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetIfVersion("a", []byte("again"), 0); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("SetIfVersion 0 of a set key = %v, want ErrVersionMismatch", err)
+	}
+	value, v1, err := db.GetVersion("a")
+	if err != nil || string(value) != "1" || v1 == 0 {
+		t.Fatalf("GetVersion = %q, %d, %v", value, v1, err)
+	}
+	if err := db.SetIfVersion("a", []byte("2"), v1); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetIfVersion("a", []byte("stale"), v1); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("SetIfVersion of a stale version = %v, want ErrVersionMismatch", err)
+	}
+	value, v2, err := db.GetVersion("a")
+	if err != nil || string(value) != "2" || v2 <= v1 {
+		t.Fatalf("GetVersion after the update = %q, %d, %v, want 2 and a version past %d", value, v2, err, v1)
+	}
+
+	// A deleted or expired key counts as not set.
+	if err := db.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.GetVersion("a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("GetVersion of a deleted key = %v, want ErrKeyNotFound", err)
+	}
+	if err := db.SetWithTTL("b", []byte("soon"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	for _, key := range []string{"a", "b"} {
+		if err := db.SetIfVersion(key, []byte("new"), 0); err != nil {
+			t.Fatalf("SetIfVersion 0 of %s = %v", key, err)
+		}
+	}
+
+	// Versions keep growing across a reopen and a compaction.
+	_, before, _ := db.GetVersion("a")
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if _, after, _ := db.GetVersion("a"); after != before {
+		t.Fatalf("Compact changed the version of a from %d to %d", before, after)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, v, _ := db.GetVersion("a"); v != before {
+		t.Fatalf("version of a after reopening = %d, want %d", v, before)
+	}
+	if err := db.Set("c", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, v, _ := db.GetVersion("c"); v <= before {
+		t.Fatalf("a write after reopening got version %d, not past %d", v, before)
+	}
+	if err := db.SetIfVersion("", []byte("1"), 0); !errors.Is(err, ErrEmptyKey) {
+		t.Fatalf("SetIfVersion of an empty key = %v, want ErrEmptyKey", err)
+	}
+}
+
+func TestSetIfVersionRace(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	if err := db.Set("counter", []byte("0")); err != nil {
+		t.Fatal(err)
+	}
+	_, version, err := db.GetVersion("counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Of the writers racing from the same version exactly one wins.
+	const writers = 8
+	var wg sync.WaitGroup
+	errs := make([]error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = db.SetIfVersion("counter", []byte(fmt.Sprint(i)), version)
+		}(i)
+	}
+	wg.Wait()
+	won := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			won++
+		case !errors.Is(err, ErrVersionMismatch):
+			t.Fatal(err)
+		}
+	}
+	if won != 1 {
+		t.Fatalf("%d writers won, want exactly one", won)
+	}
+}
@@ -0,0 +1,183 @@
+package endor
+
+import (
+	"strings"
+	"sync"
+)
+
+// EventType tells what a write did to a key.
+type EventType int
+
+const (
+	EventSet EventType = iota
+	EventDelete
+	// EventMerge is a Merge, whose Event.Value is the operand merged.
+	EventMerge
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventSet:
+		return "set"
+	case EventDelete:
+		return "delete"
+	case EventMerge:
+		return "merge"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes one write to a watched key. Value is nil for deletes.
+type Event struct {
+	Type  EventType
+	Key   string
+	Value []byte
+}
+
+// CancelFunc stops a watch and closes its channel.
+type CancelFunc func()
+
+// watcher queues the events of one Watch. The queue is unbounded, so a slow
+// consumer neither blocks writers nor misses events; it only falls behind.
+type watcher struct {
+	prefix string
+	ch     chan Event
+	done   chan struct{}
+
+	// strip is the length of the bucket prefix cut off the keys of a
+	// Bucket's watch, zero for a DB's.
+	strip int
+
+	stopOnce sync.Once
+
+	mu    sync.Mutex
+	cond  sync.Cond
+	queue []Event
+	// closed is set once no more events will be queued. The queued ones
+	// are still delivered unless done is closed as well.
+	closed bool
+}
+
+// Watch returns a channel receiving an Event for every Set and Delete of a
+// key starting with prefix, in commit order, from the call on. The channel
+// is closed by cancel, which drops the events not yet received, or after
+// the last event once the store is closed. Watching does not replay the
+// current contents of the store.
+func (db *DB) Watch(prefix string) (<-chan Event, CancelFunc) {
+	return db.watch(prefix, 0)
+}
+
+func (db *DB) watch(prefix string, strip int) (<-chan Event, CancelFunc) {
+	w := &watcher{prefix: prefix, strip: strip, ch: make(chan Event), done: make(chan struct{})}
+	w.cond.L = &w.mu
+
+	db.watchMu.Lock()
+	if db.watchers == nil {
+		db.watchers = make(map[*watcher]struct{})
+	}
+	db.watchers[w] = struct{}{}
+	db.watchMu.Unlock()
+
+	go w.run()
+	var once sync.Once
+	return w.ch, func() {
+		once.Do(func() {
+			db.watchMu.Lock()
+			delete(db.watchers, w)
+			db.watchMu.Unlock()
+			w.close()
+		})
+	}
+}
+
+func (w *watcher) run() {
+	defer close(w.ch)
+	for {
+		w.mu.Lock()
+		for len(w.queue) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if len(w.queue) == 0 {
+			w.mu.Unlock()
+			return
+		}
+		ev := w.queue[0]
+		w.queue[0] = Event{}
+		w.queue = w.queue[1:]
+		w.mu.Unlock()
+
+		select {
+		case w.ch <- ev:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *watcher) push(ev Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed {
+		w.queue = append(w.queue, ev)
+		w.cond.Signal()
+	}
+}
+
+// finish stops queueing events, letting the queued ones drain.
+func (w *watcher) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	w.cond.Signal()
+}
+
+// close stops the watcher and drops the queued events.
+func (w *watcher) close() {
+	w.mu.Lock()
+	w.closed = true
+	w.queue = nil
+	w.cond.Signal()
+	w.mu.Unlock()
+	w.stopOnce.Do(func() { close(w.done) })
+}
+
+// notify hands the committed records to the matching watchers. Callers hold
+// db.mu, so events reach every watcher in commit order.
+func (db *DB) notify(records []record) {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+	if len(db.watchers) == 0 {
+		return
+	}
+	for _, r := range records {
+		ev := Event{Type: EventSet, Key: r.Key}
+		switch r.Op {
+		case opDelete:
+			ev.Type = EventDelete
+		case opMerge:
+			ev.Type = EventMerge
+			ev.Value = append([]byte{}, r.Value...)
+		default:
+			ev.Value = append([]byte{}, r.Value...)
+		}
+		for w := range db.watchers {
+			if !strings.HasPrefix(r.Key, w.prefix) || w.strip == 0 && isBucketKey(r.Key) {
+				continue
+			}
+			ev := ev
+			ev.Key = r.Key[w.strip:]
+			w.push(ev)
+		}
+	}
+}
+
+// closeWatchers ends every watch when the store is closed.
+func (db *DB) closeWatchers() {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+	for w := range db.watchers {
+		w.finish()
+	}
+	db.watchers = nil
+}
@@ -0,0 +1,118 @@
+package endor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// receive returns the next event on ch, failing the test if there is none
+// within a second or ch is closed.
+func receive(t *testing.T, ch <-chan Event) Event {
+	t.Helper()
+	select {
+	case ev, ok := <-ch:
+		if !ok {
+			t.Fatal("watch channel closed early")
+		}
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no event within a second")
+	}
+	return Event{}
+}
+
+// drained fails the test unless ch is closed within a second, with no
+// events left.
+func drained(t *testing.T, ch <-chan Event) {
+	t.Helper()
+	select {
+	case ev, ok := <-ch:
+		if ok {
+			t.Fatalf("event %+v after the watch ended", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watch channel still open after a second")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	db, _ := openTest(t, Options{})
+	users, cancelUsers := db.Watch("user:")
+	all, cancelAll := db.Watch("")
+
+	// Writers do not wait for the watchers; the events queue up.
+	const writes = 100
+	for i := 0; i < writes; i++ {
+		if err := db.Set(fmt.Sprintf("user:%03d", i), []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Set("other", []byte("o")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("user:000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Bucket("b").Set("user:x", []byte("in a bucket")); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < writes; i++ {
+		ev := receive(t, users)
+		if ev.Type != EventSet || ev.Key != fmt.Sprintf("user:%03d", i) || string(ev.Value) != "v" {
+			t.Fatalf("event %d = %v %+v", i, ev.Type, ev)
+		}
+	}
+	if ev := receive(t, users); ev.Type != EventDelete || ev.Key != "user:000" || ev.Value != nil {
+		t.Fatalf("event of the delete = %v %+v", ev.Type, ev)
+	}
+	// Cancel drops what is left and closes the channel; writes go on.
+	cancelUsers()
+	cancelUsers()
+	drained(t, users)
+	if err := db.Set("user:late", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The watch of everything sees other keys too, but not bucket keys.
+	var keys []string
+	for i := 0; i < writes+3; i++ {
+		keys = append(keys, receive(t, all).Key)
+	}
+	if got := fmt.Sprint(keys[writes:]); got != "[other user:000 user:late]" {
+		t.Fatalf("last events of the watch of everything are for %s", got)
+	}
+
+	// The bucket's watch carries its keys without the bucket prefix.
+	inBucket, cancel := db.Bucket("b").Watch("")
+	defer cancel()
+	if err := db.Bucket("b").Delete("user:x"); err != nil {
+		t.Fatal(err)
+	}
+	if ev := receive(t, inBucket); ev.Type != EventDelete || ev.Key != "user:x" {
+		t.Fatalf("bucket event = %v %+v", ev.Type, ev)
+	}
+
+	// Close lets the queued events drain before closing the channel.
+	if err := db.Set("last", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if ev := receive(t, all); ev.Key != "last" {
+		t.Fatalf("event queued before Close is for %q", ev.Key)
+	}
+	drained(t, all)
+	drained(t, inBucket)
+	cancelAll()
+}
+
+func TestEventTypeString(t *testing.T) {
+	for typ, want := range map[EventType]string{EventSet: "set", EventDelete: "delete", EventMerge: "merge", 7: "unknown"} {
+		if got := typ.String(); got != want {
+			t.Fatalf("EventType(%d) = %q, want %q", typ, got, want)
+		}
+	}
+}
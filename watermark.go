@@ -0,0 +1,44 @@
+package endor
+
+import "hash/crc32"
+
+// watermark identifies how far into the data file a persisted structure,
+// such as the secondary index sidecar, is up to date.
+type watermark struct {
+	// Offset is the size of the data file when the watermark was taken,
+	// and so where replaying the records appended since starts.
+	Offset int64 `json:"offset"`
+	// Last is the offset of the record that ended at Offset and Sum the
+	// CRC-32C of its body. Together they tell whether the data file is
+	// still the one the watermark was taken of, rather than a compacted
+	// or restored one that happens to be as long.
+	Last int64  `json:"last"`
+	Sum  uint32 `json:"sum"`
+}
+
+// watermark returns the watermark of the data file as it is now. Callers
+// hold db.mu.
+func (db *DB) watermark() (watermark, error) {
+	if db.size == db.start {
+		return watermark{}, nil
+	}
+	body, _, err := db.format.readAt(db.file, db.last)
+	if err != nil {
+		return watermark{}, err
+	}
+	return watermark{Offset: db.size, Last: db.last, Sum: crc32.Checksum(body, crcTable)}, nil
+}
+
+// covers reports whether w was taken of the data file as it is now or of an
+// earlier state of it, so replaying from w.Offset brings a structure saved
+// at w up to date. Callers hold db.mu.
+func (db *DB) covers(w watermark) bool {
+	if w.Offset == 0 {
+		return true
+	}
+	if w.Offset > db.size || w.Last >= w.Offset || w.Last < db.start {
+		return false
+	}
+	body, next, err := db.format.readAt(db.file, w.Last)
+	return err == nil && next == w.Offset && crc32.Checksum(body, crcTable) == w.Sum
+}